@@ -15,6 +15,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -23,6 +24,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
 )
 
@@ -45,14 +47,20 @@ func main() {
     ipam         IP address management.
     node         Calico node management.
     version      Display the version of this binary.
-    export       Export the Calico datastore objects for migration
-    import       Import the Calico datastore objects for migration
+    migrate      Migrate the contents of an etcdv3 datastore to a Kubernetes datastore.
+    export       Export the Calico datastore objects for migration.  This is
+                 the same as 'migrate export'.
+    import       Import the Calico datastore objects for migration.  This is
+                 the same as 'migrate import'.
     datastore    Calico datastore management.
+    validate     Validate the Calico datastore objects.
 
 Options:
   -h --help               Show this screen.
   -l --log-level=<level>  Set the log level (one of panic, fatal, error,
                           warn, info, debug) [default: panic]
+  --log-format=<format>   Set the log format (one of text, json)
+                          [default: text]
   --context=<context>	  The name of the kubeconfig context to use.
 
 Description:
@@ -80,6 +88,19 @@ Description:
 		os.Exit(1)
 	}
 
+	if logFormat := arguments["--log-format"]; logFormat != nil {
+		switch logFormat.(string) {
+		case "text":
+			log.SetFormatter(&log.TextFormatter{})
+		case "json":
+			log.SetFormatter(&log.JSONFormatter{})
+		default:
+			fmt.Printf("Unknown log format: %s, expected one of: \n"+
+				"text, json.\n", logFormat)
+			os.Exit(1)
+		}
+	}
+
 	if logLevel := arguments["--log-level"]; logLevel != nil {
 		parsedLogLevel, err := log.ParseLevel(logLevel.(string))
 		if err != nil {
@@ -127,12 +148,21 @@ Description:
 			err = commands.IPAM(args)
 		case "datastore":
 			err = commands.Datastore(args)
+		case "validate":
+			err = commands.Validate(args)
+		case "migrate":
+			err = commands.Migrate(args)
+		case "export", "import":
+			err = commands.Migrate(append([]string{"migrate"}, args...))
 		default:
 			err = fmt.Errorf("Unknown command: %q\n%s", command, doc)
 		}
 
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err)
+			if errors.Is(err, common.ErrInterrupted) {
+				os.Exit(common.ExitCodeInterrupted)
+			}
 			os.Exit(1)
 		}
 	}
@@ -18,10 +18,12 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/docopt/docopt-go"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/argutils"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
@@ -29,7 +31,9 @@ import (
 
 func Apply(args []string) error {
 	doc := constants.DatastoreIntro + `Usage:
-  <BINARY_NAME> apply --filename=<FILENAME> [--recursive] [--skip-empty]
+  <BINARY_NAME> apply --filename=<FILENAME> [--recursive] [--skip-empty] [--server-side]
+                  [--wait [--timeout=<TIMEOUT>]] [--conflict=<MODE>] [--strict]
+                  [--save-config]
                   [--config=<CONFIG>] [--namespace=<NS>] [--context=<context>]
 
 Examples:
@@ -48,6 +52,20 @@ Options:
   -R --recursive            Process the filename specified in -f or --filename recursively.
      --skip-empty           Do not error if any files or directory specified using -f or --filename contain no
                             data.
+     --server-side          Request that resources are applied server-side. No
+                            datastore supports this yet, so resources are applied
+                            client-side, as without this option.
+     --wait                 Wait until the status of each applied resource shows
+                            that it has been programmed.
+     --timeout=<TIMEOUT>    Maximum time to wait, for example 30s or 2m.
+                            [default: 60s]
+     --conflict=<MODE>      How to resolve a conflict with a newer version of a
+                            resource.  One of: fail, overwrite, merge.
+                            [default: fail]
+     --strict               Treat validation warnings, such as an IPPool whose
+                            CIDR overlaps another IPPool, as errors.
+     --save-config          Record the applied configuration of each resource
+                            in its last-applied annotation.
   -c --config=<CONFIG>      Path to the file containing connection
                             configuration in YAML or JSON format.
                             [default: ` + constants.DefaultConfigPath + `]
@@ -58,7 +76,9 @@ Options:
 
 Description:
   The apply command is used to create or replace a set of resources by filename
-  or stdin.  JSON and YAML formats are accepted.
+  or stdin.  JSON and YAML formats are accepted.  The input may contain several
+  YAML documents separated by "---", or several JSON values, each of which is a
+  single resource, a resource list, or a JSON array of resources.
 
   Valid resource types are:
 
@@ -92,6 +112,30 @@ Description:
   When applying a resource to perform an update, the complete resource spec
   must be provided, it is not sufficient to supply only the fields that are
   being updated.
+
+  A conflict occurs when a resource includes a resource version that is older
+  than the latest version of the resource in the datastore, for example when
+  applying a resource from an earlier export.  The --conflict option
+  controls how a conflict is resolved:
+
+    fail       Fail to update the resource.  This is the default.
+    overwrite  Replace the latest version of the resource with the supplied
+               resource.
+    merge      Merge the spec of the supplied resource into the latest version
+               of the resource.  Maps are merged and lists are replaced.
+
+  The --wait option only waits for kinds with an observable status, which is
+  currently only kubeControllersConfiguration.  A kubeControllersConfiguration
+  has been programmed once the running config in its status matches its spec.
+  Note that environment variables on the kube-controllers override the running
+  config, in which case the wait will time out.  A warning is printed for each
+  resource of any other kind, and the command does not wait for it.
+
+  The --save-config option records the configuration of each resource, as
+  supplied to the command, in its projectcalico.org/last-applied-configuration
+  annotation.  A later apply can compare the annotation with the new
+  configuration to find the fields that were removed from it.  The annotation
+  is removed by "get --export".
 `
 	// Replace all instances of BINARY_NAME with the name of the binary.
 	name, _ := util.NameAndDescription()
@@ -108,6 +152,14 @@ Description:
 		os.Setenv("K8S_CURRENT_CONTEXT", context.(string))
 	}
 
+	var waitTimeout time.Duration
+	if argutils.ArgBoolOrFalse(parsedArgs, "--wait") {
+		waitTimeout, err = time.ParseDuration(parsedArgs["--timeout"].(string))
+		if err != nil || waitTimeout <= 0 {
+			return fmt.Errorf("Invalid timeout '%s', expected a positive duration such as 30s", parsedArgs["--timeout"])
+		}
+	}
+
 	results := common.ExecuteConfigCommand(parsedArgs, common.ActionApply)
 	log.Infof("results: %+v", results)
 
@@ -133,6 +185,9 @@ Description:
 		} else {
 			fmt.Printf("Successfully applied %d resource(s)\n", results.NumHandled)
 		}
+		if waitTimeout > 0 {
+			return common.WaitForResources(results.Client, results.Resources, waitTimeout)
+		}
 	} else {
 		if results.NumHandled-len(results.ResErrs) > 0 {
 			fmt.Printf("Partial success: ")
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+)
+
+// removeServerMetadata removes the metadata that is set by the datastore rather than by
+// the user, along with the last-applied annotation.
+func removeServerMetadata(rom v1.Object) {
+	rom.SetUID("")
+	rom.SetResourceVersion("")
+	rom.SetCreationTimestamp(v1.Time{})
+	rom.SetDeletionTimestamp(nil)
+	rom.SetDeletionGracePeriodSeconds(nil)
+	rom.SetClusterName("")
+	RemoveLastAppliedConfig(rom)
+}
+
+// CanonicalResources converts the resources into a canonical form, so that two exports of
+// unchanged resources are identical and can be stored in version control. The metadata
+// and status managed by the datastore and the Calico components are removed, and the
+// items of each list are sorted by namespace and name. The resources are always marshaled
+// with their fields in the order of their definition and with their map keys sorted, so
+// this is enough for the output to be stable.
+func CanonicalResources(resources []runtime.Object) error {
+	for _, r := range resources {
+		items := []runtime.Object{r}
+		list, isList := r.(resourcemgr.ResourceListObject)
+		if isList {
+			var err error
+			if items, err = meta.ExtractList(list); err != nil {
+				return err
+			}
+		}
+
+		for _, item := range items {
+			ro, ok := item.(resourcemgr.ResourceObject)
+			if !ok {
+				continue
+			}
+			rom := ro.GetObjectMeta()
+			removeServerMetadata(rom)
+			rom.SetGeneration(0)
+			rom.SetSelfLink("")
+			rom.SetManagedFields(nil)
+			if status := reflect.ValueOf(ro).Elem().FieldByName("Status"); status.IsValid() && status.CanSet() {
+				status.Set(reflect.Zero(status.Type()))
+			}
+		}
+		if !isList {
+			continue
+		}
+
+		sort.SliceStable(items, func(i, j int) bool { return pageKey(items[i]) < pageKey(items[j]) })
+		if err := meta.SetList(list, items); err != nil {
+			return err
+		}
+		lm := list.GetListMeta()
+		lm.SetResourceVersion("")
+		lm.SetContinue("")
+		lm.SetSelfLink("")
+	}
+	return nil
+}
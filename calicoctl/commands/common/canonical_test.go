@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing the canonical form of resources", func() {
+	It("Should remove the server metadata and status, and sort the list items", func() {
+		node := func(name, revision string) apiv3.Node {
+			n := apiv3.NewNode()
+			n.Name = name
+			n.ResourceVersion = revision
+			n.UID = "abcd"
+			n.CreationTimestamp = v1.NewTime(time.Now())
+			n.Annotations = map[string]string{LastAppliedConfigAnnotation: "{}", "owner": "team1"}
+			n.Status.WireguardPublicKey = "key"
+			return *n
+		}
+		list := apiv3.NewNodeList()
+		list.ResourceVersion = "200"
+		list.Continue = "token"
+		list.Items = []apiv3.Node{node("node2", "100"), node("node1", "101")}
+
+		policy := apiv3.NewNetworkPolicy()
+		policy.Namespace = "ns1"
+		policy.Name = "policy1"
+		policy.ResourceVersion = "102"
+
+		Expect(CanonicalResources([]runtime.Object{list, policy})).To(Succeed())
+		Expect(list.ResourceVersion).To(BeEmpty())
+		Expect(list.Continue).To(BeEmpty())
+		Expect(list.Items).To(HaveLen(2))
+		Expect(list.Items[0].Name).To(Equal("node1"))
+		Expect(list.Items[1].Name).To(Equal("node2"))
+		for _, n := range list.Items {
+			Expect(n.ResourceVersion).To(BeEmpty())
+			Expect(n.UID).To(BeEmpty())
+			Expect(n.CreationTimestamp.IsZero()).To(BeTrue())
+			Expect(n.Annotations).To(Equal(map[string]string{"owner": "team1"}))
+			Expect(n.Status).To(Equal(apiv3.NodeStatus{}))
+		}
+		Expect(policy.Namespace).To(Equal("ns1"))
+		Expect(policy.ResourceVersion).To(BeEmpty())
+	})
+})
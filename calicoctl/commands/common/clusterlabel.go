@@ -0,0 +1,37 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import "fmt"
+
+// ClusterLabel returns the label that identifies the cluster in the JSON output of
+// commands that may be run against many clusters. This is the label given by the user,
+// or the cluster GUID if no label was given.
+func ClusterLabel(label, clusterGUID string) string {
+	if label != "" {
+		return label
+	}
+	return clusterGUID
+}
+
+// WithClusterLabel prefixes the line with the cluster label, so that output aggregated
+// from many clusters can be attributed to the right cluster. The line is returned
+// unchanged if the label is empty.
+func WithClusterLabel(label, line string) string {
+	if label == "" {
+		return line
+	}
+	return fmt.Sprintf("[%s] %s", label, line)
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing cluster labels", func() {
+	It("Should use the label if set", func() {
+		Expect(ClusterLabel("prod-east", "abc123")).To(Equal("prod-east"))
+	})
+
+	It("Should fall back to the cluster GUID", func() {
+		Expect(ClusterLabel("", "abc123")).To(Equal("abc123"))
+	})
+
+	It("Should prefix the line with the label", func() {
+		Expect(WithClusterLabel("prod-east", "Check complete; found 0 problems.")).To(Equal("[prod-east] Check complete; found 0 problems."))
+	})
+
+	It("Should leave the line unchanged without a label", func() {
+		Expect(WithClusterLabel("", "Check complete; found 0 problems.")).To(Equal("Check complete; found 0 problems."))
+	})
+})
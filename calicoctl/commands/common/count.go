@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+)
+
+// CountResources returns the number of resources in each namespace, counting the items
+// of each list. Resources that are not namespaced are counted under the empty namespace.
+func CountResources(resources []runtime.Object) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, r := range resources {
+		items := []runtime.Object{r}
+		if list, ok := r.(resourcemgr.ResourceListObject); ok {
+			var err error
+			if items, err = meta.ExtractList(list); err != nil {
+				return nil, err
+			}
+		}
+		for _, item := range items {
+			ns := ""
+			if ro, ok := item.(resourcemgr.ResourceObject); ok {
+				ns = ro.GetObjectMeta().GetNamespace()
+			}
+			counts[ns]++
+		}
+	}
+	return counts, nil
+}
+
+// PrintCounts writes the counts returned by CountResources. When perNamespace is set, a
+// line is written for each namespace, in order, followed by the total; otherwise only the
+// total is written.
+func PrintCounts(w io.Writer, counts map[string]int, perNamespace, noHeaders bool) error {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if !perNamespace {
+		_, err := fmt.Fprintln(w, total)
+		return err
+	}
+
+	namespaces := make([]string, 0, len(counts))
+	for ns := range counts {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	tw := tabwriter.NewWriter(w, tableMinWidth, 1, tablePadding, ' ', 0)
+	if !noHeaders {
+		fmt.Fprintln(tw, "NAMESPACE\tCOUNT\t")
+	}
+	for _, ns := range namespaces {
+		fmt.Fprintf(tw, "%s\t%d\t\n", ns, counts[ns])
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t\n", total)
+	return tw.Flush()
+}
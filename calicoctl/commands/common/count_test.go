@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing counting resources", func() {
+	policy := func(namespace, name string) *apiv3.NetworkPolicy {
+		np := apiv3.NewNetworkPolicy()
+		np.Namespace = namespace
+		np.Name = name
+		return np
+	}
+
+	It("Should count the items of lists in each namespace", func() {
+		list := apiv3.NewNetworkPolicyList()
+		for _, np := range []*apiv3.NetworkPolicy{policy("ns2", "a"), policy("ns1", "a"), policy("ns2", "b")} {
+			list.Items = append(list.Items, *np)
+		}
+		counts, err := CountResources([]runtime.Object{list, policy("ns1", "c"), apiv3.NewIPPool()})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counts).To(Equal(map[string]int{"ns1": 2, "ns2": 2, "": 1}))
+
+		buf := &bytes.Buffer{}
+		Expect(PrintCounts(buf, counts, false, false)).To(Succeed())
+		Expect(buf.String()).To(Equal("5\n"))
+
+		buf.Reset()
+		delete(counts, "")
+		Expect(PrintCounts(buf, counts, true, false)).To(Succeed())
+		Expect(buf.String()).To(Equal("NAMESPACE   COUNT   \nns1         2       \nns2         2       \nTOTAL       4       \n"))
+	})
+
+	It("Should print zero for no resources", func() {
+		counts, err := CountResources([]runtime.Object{apiv3.NewNetworkPolicyList()})
+		Expect(err).NotTo(HaveOccurred())
+		buf := &bytes.Buffer{}
+		Expect(PrintCounts(buf, counts, false, false)).To(Succeed())
+		Expect(buf.String()).To(Equal("0\n"))
+	})
+})
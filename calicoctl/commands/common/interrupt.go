@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// ExitCodeInterrupted is the exit code used when a command stops early because it
+// received SIGINT or SIGTERM.
+const ExitCodeInterrupted = 130
+
+// ErrInterrupted is wrapped by the error returned from a command that stopped early
+// because it received SIGINT or SIGTERM.
+var ErrInterrupted = errors.New("interrupted")
+
+// NotifyInterrupt returns a context that is cancelled when the process receives SIGINT
+// or SIGTERM, and a function that stops watching for the signals. Until the function
+// is called, the first signal does not kill the process. A second signal exits the
+// process immediately with ExitCodeInterrupted, so that a command stuck in a datastore
+// operation can still be stopped.
+//
+// The context is not intended to be passed to datastore operations, since that would
+// abort an operation part way through. Instead, a long-running command checks it with
+// CheckInterrupt between operations, so that it stops cleanly once the current
+// operation has finished.
+func NotifyInterrupt() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	stopped := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			fmt.Fprintf(os.Stderr, "Received %s, stopping after the current operation. Send it again to stop immediately...\n", sig)
+			cancel()
+		case <-stopped:
+			return
+		}
+		select {
+		case sig := <-sigs:
+			fmt.Fprintf(os.Stderr, "Received %s again, stopping immediately\n", sig)
+			os.Exit(ExitCodeInterrupted)
+		case <-stopped:
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(sigs)
+			close(stopped)
+			cancel()
+		})
+	}
+}
+
+// CheckInterrupt returns an error wrapping ErrInterrupted if the context returned by
+// NotifyInterrupt has been cancelled by a signal, describing what was interrupted.
+func CheckInterrupt(ctx context.Context, what string) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return fmt.Errorf("%s was %w", what, ErrInterrupted)
+}
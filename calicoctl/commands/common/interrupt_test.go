@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing interrupt checks", func() {
+	It("Should not report an interrupt before the context is cancelled", func() {
+		Expect(CheckInterrupt(context.Background(), "Import")).NotTo(HaveOccurred())
+	})
+
+	It("Should report an interrupt once the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := CheckInterrupt(ctx, "Import")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("Import was interrupted"))
+		Expect(errors.Is(err, ErrInterrupted)).To(BeTrue())
+	})
+})
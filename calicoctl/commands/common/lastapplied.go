@@ -0,0 +1,68 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+)
+
+// LastAppliedConfigAnnotation is the annotation recording the configuration of a resource
+// as it was last applied or created with the --save-config option, so that a later apply
+// can compute which fields were removed from the configuration.
+const LastAppliedConfigAnnotation = "projectcalico.org/last-applied-configuration"
+
+// SetLastAppliedConfig records the configuration of the resource in its last-applied
+// annotation. The recorded configuration excludes the annotation itself and the metadata
+// set by the datastore, so that it only contains the fields supplied by the user.
+func SetLastAppliedConfig(resource resourcemgr.ResourceObject) error {
+	applied := resource.DeepCopyObject().(resourcemgr.ResourceObject)
+	rom := applied.GetObjectMeta()
+	RemoveLastAppliedConfig(rom)
+	rom.SetUID("")
+	rom.SetResourceVersion("")
+	rom.SetCreationTimestamp(v1.Time{})
+
+	b, err := json.Marshal(applied)
+	if err != nil {
+		return fmt.Errorf("Failed to record the applied configuration of %s %s: %v",
+			resource.GetObjectKind().GroupVersionKind().Kind, resource.GetObjectMeta().GetName(), err)
+	}
+
+	annotations := resource.GetObjectMeta().GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedConfigAnnotation] = string(b)
+	resource.GetObjectMeta().SetAnnotations(annotations)
+	return nil
+}
+
+// RemoveLastAppliedConfig removes the last-applied annotation, if any, from the metadata.
+func RemoveLastAppliedConfig(rom v1.Object) {
+	annotations := rom.GetAnnotations()
+	if _, ok := annotations[LastAppliedConfigAnnotation]; !ok {
+		return
+	}
+	delete(annotations, LastAppliedConfigAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	rom.SetAnnotations(annotations)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing the last-applied annotation", func() {
+	It("Should record the supplied configuration without the datastore metadata", func() {
+		pool := apiv3.NewIPPool()
+		pool.Name = "pool1"
+		pool.ResourceVersion = "100"
+		pool.UID = "abcd"
+		pool.Annotations = map[string]string{"owner": "team1"}
+		pool.Spec.CIDR = "10.0.0.0/16"
+
+		Expect(SetLastAppliedConfig(pool)).To(Succeed())
+		Expect(pool.Annotations).To(HaveKey("owner"))
+		Expect(pool.ResourceVersion).To(Equal("100"))
+
+		applied := apiv3.NewIPPool()
+		Expect(json.Unmarshal([]byte(pool.Annotations[LastAppliedConfigAnnotation]), applied)).To(Succeed())
+		Expect(applied.Name).To(Equal("pool1"))
+		Expect(applied.Spec.CIDR).To(Equal("10.0.0.0/16"))
+		Expect(applied.ResourceVersion).To(BeEmpty())
+		Expect(applied.UID).To(BeEmpty())
+		Expect(applied.Annotations).To(Equal(map[string]string{"owner": "team1"}))
+
+		// Applying again replaces the annotation rather than nesting it.
+		Expect(SetLastAppliedConfig(pool)).To(Succeed())
+		Expect(pool.Annotations[LastAppliedConfigAnnotation]).NotTo(ContainSubstring(LastAppliedConfigAnnotation))
+	})
+
+	It("Should remove the annotation", func() {
+		pool := apiv3.NewIPPool()
+		Expect(SetLastAppliedConfig(pool)).To(Succeed())
+		RemoveLastAppliedConfig(pool.GetObjectMeta())
+		Expect(pool.Annotations).To(BeNil())
+	})
+})
@@ -0,0 +1,74 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+)
+
+// SortPoliciesByOrder sorts the items of each policy list into the order in which the
+// policies are evaluated: by order, with the policies that have no order last, and then
+// by namespace and name. The Calico API does not have tiers, so every policy is in the
+// same tier. An error is returned if any of the resources are not policies.
+func SortPoliciesByOrder(resources []runtime.Object) error {
+	for _, r := range resources {
+		items := []runtime.Object{r}
+		list, isList := r.(resourcemgr.ResourceListObject)
+		if isList {
+			var err error
+			if items, err = meta.ExtractList(list); err != nil {
+				return err
+			}
+		}
+
+		orders := make([]*float64, len(items))
+		for i, item := range items {
+			order := resourcemgr.GetPolicyOrder(item)
+			ro, ok := item.(resourcemgr.ResourceObject)
+			if order == nil || !ok {
+				return fmt.Errorf("Sorting by order is only supported for policies, not %s", resourceKind(item))
+			}
+			orders[i] = order(ro)
+		}
+		if !isList {
+			continue
+		}
+
+		keys := make(map[runtime.Object]*float64, len(items))
+		for i, item := range items {
+			keys[item] = orders[i]
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			oi, oj := keys[items[i]], keys[items[j]]
+			switch {
+			case oi != nil && oj != nil && *oi != *oj:
+				return *oi < *oj
+			case (oi == nil) != (oj == nil):
+				return oi != nil
+			}
+			return pageKey(items[i]) < pageKey(items[j])
+		})
+		if err := meta.SetList(list, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
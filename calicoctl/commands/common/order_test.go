@@ -0,0 +1,58 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing sorting policies by order", func() {
+	order := func(o float64) *float64 { return &o }
+
+	It("Should sort policies by order, then namespace and name", func() {
+		list := apiv3.NewNetworkPolicyList()
+		for _, p := range []struct {
+			namespace, name string
+			order           *float64
+		}{
+			{"ns1", "none", nil}, {"ns2", "b", order(100)}, {"ns1", "late", order(1000)},
+			{"ns1", "b", order(100)}, {"ns1", "early", order(1.5)}, {"ns1", "a", nil},
+		} {
+			np := apiv3.NewNetworkPolicy()
+			np.Namespace = p.namespace
+			np.Name = p.name
+			np.Spec.Order = p.order
+			list.Items = append(list.Items, *np)
+		}
+
+		Expect(SortPoliciesByOrder([]runtime.Object{list})).To(Succeed())
+		var names []string
+		for _, p := range list.Items {
+			names = append(names, p.Namespace+"/"+p.Name)
+		}
+		Expect(names).To(Equal([]string{"ns1/early", "ns1/b", "ns2/b", "ns1/late", "ns1/a", "ns1/none"}))
+	})
+
+	It("Should reject resources that are not policies", func() {
+		list := apiv3.NewIPPoolList()
+		list.Items = append(list.Items, *apiv3.NewIPPool())
+		Expect(SortPoliciesByOrder([]runtime.Object{list})).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+)
+
+// PageResources limits each resource list to at most limit items, starting after the
+// item identified by the continue token, or from the start if the token is empty.
+//
+// The Calico API does not support paginated lists, so every resource is listed and the
+// page is selected here. The items are sorted by namespace and name, and the continue
+// token identifies the last item on the page, so the next page starts after that item
+// even if resources are added or removed in between. The continue token for the next
+// page is returned, and set on the list, or is empty if there are no more items.
+func PageResources(resources []runtime.Object, limit int, token string) ([]runtime.Object, string, error) {
+	after, err := decodeContinueToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	for _, r := range resources {
+		list, ok := r.(resourcemgr.ResourceListObject)
+		if !ok {
+			continue
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, "", err
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return pageKey(items[i]) < pageKey(items[j])
+		})
+
+		// Skip the items up to and including the last item of the previous page.
+		start := 0
+		if token != "" {
+			start = sort.Search(len(items), func(i int) bool {
+				return pageKey(items[i]) > after
+			})
+		}
+		items = items[start:]
+
+		if len(items) > limit {
+			items = items[:limit]
+			next = encodeContinueToken(pageKey(items[limit-1]))
+		}
+		if err := meta.SetList(list, items); err != nil {
+			return nil, "", err
+		}
+		if la, err := meta.ListAccessor(list); err == nil {
+			la.SetContinue(next)
+		}
+	}
+	return resources, next, nil
+}
+
+// pageKey returns the key used to order the items of a resource list. The namespace and
+// name are separated by a "/", which cannot appear in either.
+func pageKey(o runtime.Object) string {
+	m, err := meta.Accessor(o)
+	if err != nil {
+		return ""
+	}
+	return m.GetNamespace() + "/" + m.GetName()
+}
+
+func encodeContinueToken(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeContinueToken(token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.Contains(string(key), "/") {
+		return "", fmt.Errorf("Invalid continue token '%s'", token)
+	}
+	return string(key), nil
+}
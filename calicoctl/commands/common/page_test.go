@@ -0,0 +1,84 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing paging resource lists", func() {
+	newList := func() *apiv3.NetworkPolicyList {
+		list := apiv3.NewNetworkPolicyList()
+		for _, n := range []struct{ namespace, name string }{
+			{"ns2", "policy1"}, {"ns1", "policy2"}, {"ns1", "policy1"}, {"ns2", "policy2"}, {"ns3", "policy1"},
+		} {
+			p := apiv3.NewNetworkPolicy()
+			p.Namespace = n.namespace
+			p.Name = n.name
+			list.Items = append(list.Items, *p)
+		}
+		return list
+	}
+	names := func(list *apiv3.NetworkPolicyList) []string {
+		var names []string
+		for _, p := range list.Items {
+			names = append(names, p.Namespace+"/"+p.Name)
+		}
+		return names
+	}
+
+	It("Should page through the list in order of namespace and name", func() {
+		list := newList()
+		_, next, err := PageResources([]runtime.Object{list}, 2, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(list)).To(Equal([]string{"ns1/policy1", "ns1/policy2"}))
+		Expect(next).NotTo(BeEmpty())
+		Expect(list.Continue).To(Equal(next))
+
+		list = newList()
+		_, next, err = PageResources([]runtime.Object{list}, 2, next)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(list)).To(Equal([]string{"ns2/policy1", "ns2/policy2"}))
+
+		list = newList()
+		_, next, err = PageResources([]runtime.Object{list}, 2, next)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(list)).To(Equal([]string{"ns3/policy1"}))
+		Expect(next).To(BeEmpty())
+		Expect(list.Continue).To(BeEmpty())
+	})
+
+	It("Should continue after the last item even if it was deleted", func() {
+		list := newList()
+		_, next, err := PageResources([]runtime.Object{list}, 1, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		list = newList()
+		list.Items = append(list.Items[:2], list.Items[3:]...)
+		_, _, err = PageResources([]runtime.Object{list}, 1, next)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(list)).To(Equal([]string{"ns1/policy2"}))
+	})
+
+	It("Should reject an invalid continue token", func() {
+		_, _, err := PageResources([]runtime.Object{newList()}, 2, "not a token!")
+		Expect(err).To(HaveOccurred())
+	})
+})
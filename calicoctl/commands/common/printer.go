@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -25,18 +26,36 @@ import (
 	"strings"
 	"text/tabwriter"
 	"text/template"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
 
 	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
 	"github.com/projectcalico/go-json/json"
 	"github.com/projectcalico/go-yaml-wrapper"
+	api "github.com/projectcalico/libcalico-go/lib/apis/v3"
 	client "github.com/projectcalico/libcalico-go/lib/clientv3"
 	calicoErrors "github.com/projectcalico/libcalico-go/lib/errors"
 	"github.com/projectcalico/libcalico-go/lib/options"
 )
 
+// ANSI escape sequences used for color output.
+const (
+	colorBold   = "\x1b[1m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// Tabwriter settings used for table output.
+const (
+	tableMinWidth = 5
+	tablePadding  = 3
+)
+
 type ResourcePrinter interface {
 	Print(client client.Interface, resources []runtime.Object) error
 }
@@ -63,9 +82,17 @@ func (r ResourcePrinterJSON) Print(client client.Interface, resources []runtime.
 
 // ResourcePrinterYAML implements the ResourcePrinter interface and is used to display
 // a slice of resources in YAML format.
-type ResourcePrinterYAML struct{}
+type ResourcePrinterYAML struct {
+	// Chunk writes each resource as a separate YAML document as soon as it is rendered,
+	// rather than building a single document containing all of the resources.
+	Chunk bool
+}
 
 func (r ResourcePrinterYAML) Print(client client.Interface, resources []runtime.Object) error {
+	if r.Chunk {
+		return writeYAMLDocuments(os.Stdout, resources)
+	}
+
 	// If the results contain a single entry then extract the only value.
 	var rs interface{}
 	if len(resources) == 1 {
@@ -81,6 +108,31 @@ func (r ResourcePrinterYAML) Print(client client.Interface, resources []runtime.
 	return nil
 }
 
+// writeYAMLDocuments writes each of the resources to w as a separate YAML document,
+// expanding any resource lists. Each document is preceded by a "---" separator, so the
+// output can be read back with apply or create.
+func writeYAMLDocuments(w io.Writer, resources []runtime.Object) error {
+	for _, resource := range resources {
+		items := []runtime.Object{resource}
+		if list, ok := resource.(resourcemgr.ResourceListObject); ok {
+			var err error
+			if items, err = meta.ExtractList(list); err != nil {
+				return fmt.Errorf("Failed to expand resource list: %v", err)
+			}
+		}
+		for _, item := range items {
+			output, err := yaml.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "---\n%s", output); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // ResourcePrinterTable implements the ResourcePrinter interface and is used to display
 // a slice of resources in ps table format.
 type ResourcePrinterTable struct {
@@ -96,6 +148,20 @@ type ResourcePrinterTable struct {
 	// Namespace included. When a resource being printed is namespaced, this is used
 	// to determine if the namespace column should be printed or not.
 	PrintNamespace bool
+
+	// Do not print the headings row.
+	NoHeaders bool
+
+	// Color the output, emboldening the headings and highlighting resources which need
+	// attention. See ColorEnabled.
+	Color bool
+
+	// The maximum width of each table line. When non-zero, the widest columns are
+	// truncated with an ellipsis so that the table fits. See TerminalWidth.
+	MaxWidth int
+
+	// The keys of the labels to show as additional columns, after the headings.
+	LabelColumns []string
 }
 
 func (r ResourcePrinterTable) Print(client client.Interface, resources []runtime.Object) error {
@@ -112,7 +178,7 @@ func (r ResourcePrinterTable) Print(client client.Interface, resources []runtime
 		}
 
 		// Look up the template string for the specific resource type.
-		tpls, err := rm.GetTableTemplate(headings, r.PrintNamespace)
+		tpls, err := rm.GetTableTemplate(headings, r.PrintNamespace, r.LabelColumns)
 		if err != nil {
 			return err
 		}
@@ -120,25 +186,26 @@ func (r ResourcePrinterTable) Print(client client.Interface, resources []runtime
 
 		// Convert the template string into a template - we need to include the join
 		// function.
-		fns := template.FuncMap{
-			"join":            join,
-			"joinAndTruncate": joinAndTruncate,
-			"config":          config(client),
-		}
-		tmpl, err := template.New("get").Funcs(fns).Parse(tpls)
+		tmpl, err := template.New("get").Funcs(templateFuncs(client)).Parse(tpls)
 		if err != nil {
 			panic(err)
 		}
 
-		// Use a tabwriter to write out the template - this provides better formatting.
-		writer := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
-		err = tmpl.Execute(writer, resource)
+		// Execute the template, truncating the columns to fit the maximum width.
+		cells := new(bytes.Buffer)
+		err = tmpl.Execute(cells, resource)
 		// Templates for ps format are internally defined and therefore we should not
 		// hit errors writing the table formats.
 		if err != nil {
 			panic(err)
 		}
+
+		// Use a tabwriter to write out the table - this provides better formatting.
+		buf := new(bytes.Buffer)
+		writer := tabwriter.NewWriter(buf, tableMinWidth, 1, tablePadding, ' ', 0)
+		writer.Write([]byte(fitColumns(cells.String(), r.MaxWidth)))
 		writer.Flush()
+		r.writeTable(os.Stdout, buf.String(), resource)
 
 		// Leave a gap after each table.
 		fmt.Printf("\n")
@@ -146,6 +213,56 @@ func (r ResourcePrinterTable) Print(client client.Interface, resources []runtime
 	return nil
 }
 
+// writeTable writes the formatted table to w, removing the headings and adding color as
+// required. The table consists of a headings line followed by a line for each resource.
+func (r ResourcePrinterTable) writeTable(w io.Writer, table string, resource runtime.Object) {
+	lines := strings.Split(strings.TrimSuffix(table, "\n"), "\n")
+
+	// Work out which of the rows need highlighting. The rows are only colored if
+	// there is exactly one row per resource.
+	var highlight []bool
+	if r.Color {
+		items := []runtime.Object{resource}
+		if meta.IsListType(resource) {
+			if extracted, err := meta.ExtractList(resource); err == nil {
+				items = extracted
+			}
+		}
+		if len(items) == len(lines)-1 {
+			for _, item := range items {
+				highlight = append(highlight, highlightResource(item))
+			}
+		}
+	}
+
+	for i, line := range lines {
+		switch {
+		case i == 0 && r.NoHeaders:
+			continue
+		case i == 0 && r.Color:
+			line = colorBold + line + colorReset
+		case i > 0 && len(highlight) > 0 && highlight[i-1]:
+			line = colorYellow + line + colorReset
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// highlightResource returns true if the resource should be highlighted in colored
+// table output: disabled IP pools, and policies with no order (which are evaluated
+// after all policies that have an order).
+func highlightResource(resource runtime.Object) bool {
+	switch r := resource.(type) {
+	case *api.IPPool:
+		return r.Spec.Disabled
+	case *api.GlobalNetworkPolicy:
+		return r.Spec.Order == nil
+	case *api.NetworkPolicy:
+		return r.Spec.Order == nil
+	}
+	return false
+}
+
 // ResourcePrinterTemplateFile implements the ResourcePrinter interface and is used to display
 // a slice of resources using a user-defined go-lang template specified in a file.
 type ResourcePrinterTemplateFile struct {
@@ -168,14 +285,8 @@ type ResourcePrinterTemplate struct {
 }
 
 func (r ResourcePrinterTemplate) Print(client client.Interface, resources []runtime.Object) error {
-	// We include a join function in the template as it's useful for multi
-	// value columns.
-	fns := template.FuncMap{
-		"join":            join,
-		"joinAndTruncate": joinAndTruncate,
-		"config":          config(client),
-	}
-	tmpl, err := template.New("get").Funcs(fns).Parse(r.Template)
+	// User templates have the same functions as the table templates of the resources.
+	tmpl, err := template.New("get").Funcs(templateFuncs(client)).Parse(r.Template)
 	if err != nil {
 		return err
 	}
@@ -184,6 +295,76 @@ func (r ResourcePrinterTemplate) Print(client client.Interface, resources []runt
 	return err
 }
 
+// ResourcePrinterName implements the ResourcePrinter interface and is used to display
+// a slice of resources as one <kind>/<name> line per resource, for use in scripts.
+type ResourcePrinterName struct{}
+
+func (r ResourcePrinterName) Print(client client.Interface, resources []runtime.Object) error {
+	for _, name := range resourceNames(resources) {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// resourceNames returns the <kind>/<name> of each resource, expanding any resource lists.
+// The kind is lower case. The namespace is not included, so that the names can be passed
+// to the commands that accept <KIND>/<NAME>, with --namespace for namespaced resources.
+// Objects that are not resources are skipped.
+func resourceNames(resources []runtime.Object) []string {
+	var names []string
+	for _, resource := range resources {
+		items := []runtime.Object{resource}
+		if list, ok := resource.(resourcemgr.ResourceListObject); ok {
+			var err error
+			if items, err = meta.ExtractList(list); err != nil {
+				log.WithError(err).Info("Skipping resource list that cannot be expanded")
+				continue
+			}
+		}
+		for _, item := range items {
+			m, err := meta.Accessor(item)
+			if err != nil {
+				continue
+			}
+			names = append(names, strings.ToLower(resourceKind(item))+"/"+m.GetName())
+		}
+	}
+	return names
+}
+
+// resourceKind returns the kind of the resource. The items of a list do not always have
+// their type metadata set, in which case the kind is the name of the resource type.
+func resourceKind(resource runtime.Object) string {
+	if kind := resource.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+	return reflect.Indirect(reflect.ValueOf(resource)).Type().Name()
+}
+
+// templateFuncs returns the functions available to the table templates registered for
+// each resource, and to user-defined templates.
+func templateFuncs(client client.Interface) template.FuncMap {
+	return template.FuncMap{
+		"join":            join,
+		"joinAndTruncate": joinAndTruncate,
+		"config":          config(client),
+		"age":             age,
+	}
+}
+
+// age returns the time since the creation timestamp in a short human readable form, for
+// example "3d", "5h" or "12m". This is used by the AGE column of the table output.
+func age(creationTimestamp metav1.Time) string {
+	return ageSince(creationTimestamp, time.Now())
+}
+
+func ageSince(creationTimestamp metav1.Time, now time.Time) string {
+	if creationTimestamp.IsZero() {
+		return "<unknown>"
+	}
+	return duration.ShortHumanDuration(now.Sub(creationTimestamp.Time))
+}
+
 // join is similar to strings.Join() but takes an arbitrary slice of interfaces and converts
 // each to its string representation and joins them together with the provided separator
 // string.
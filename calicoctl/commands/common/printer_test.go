@@ -1,8 +1,18 @@
 package common
 
 import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	api "github.com/projectcalico/libcalico-go/lib/apis/v3"
 )
 
 var nilSlice []int
@@ -37,3 +47,101 @@ var _ = DescribeTable("Testing joinAndTruncate",
 	Entry("slice no truncate", []int{123456}, ",", 6, "123456"),
 	Entry("string", "HelloWorld", ",", 0, "HelloWorld"),
 )
+
+var _ = Describe("Testing table output", func() {
+	const table = "NAME   DISABLED\npool1  false\npool2  true\n"
+
+	pools := api.NewIPPoolList()
+	pools.Items = []api.IPPool{
+		{Spec: api.IPPoolSpec{Disabled: false}},
+		{Spec: api.IPPoolSpec{Disabled: true}},
+	}
+
+	It("Should write the table unchanged by default", func() {
+		buf := new(bytes.Buffer)
+		ResourcePrinterTable{}.writeTable(buf, table, pools)
+		Expect(buf.String()).To(Equal(table))
+	})
+
+	It("Should remove the headings", func() {
+		buf := new(bytes.Buffer)
+		ResourcePrinterTable{NoHeaders: true}.writeTable(buf, table, pools)
+		Expect(buf.String()).To(Equal("pool1  false\npool2  true\n"))
+	})
+
+	It("Should color the headings and highlighted resources", func() {
+		buf := new(bytes.Buffer)
+		ResourcePrinterTable{Color: true}.writeTable(buf, table, pools)
+		Expect(buf.String()).To(Equal(
+			colorBold + "NAME   DISABLED" + colorReset + "\n" +
+				"pool1  false\n" +
+				colorYellow + "pool2  true" + colorReset + "\n"))
+	})
+})
+
+var _ = Describe("Testing name output", func() {
+	It("Should print the kind and name of each resource in a list", func() {
+		pools := api.NewIPPoolList()
+		pools.Items = []api.IPPool{
+			{ObjectMeta: metav1.ObjectMeta{Name: "pool1"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "pool2"}},
+		}
+		Expect(resourceNames([]runtime.Object{pools})).To(Equal([]string{"ippool/pool1", "ippool/pool2"}))
+	})
+
+	It("Should not include the namespace of namespaced resources", func() {
+		policy := api.NewNetworkPolicy()
+		policy.Name = "allow-dns"
+		policy.Namespace = "kube-system"
+		Expect(resourceNames([]runtime.Object{policy})).To(Equal([]string{"networkpolicy/allow-dns"}))
+	})
+})
+
+var _ = DescribeTable("Testing age",
+	func(age time.Duration, expected string) {
+		now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		Expect(ageSince(metav1.NewTime(now.Add(-age)), now)).To(Equal(expected))
+	},
+	Entry("seconds", 45*time.Second, "45s"),
+	Entry("minutes", 12*time.Minute+30*time.Second, "12m"),
+	Entry("hours", 5*time.Hour+59*time.Minute, "5h"),
+	Entry("days", 3*24*time.Hour+2*time.Hour, "3d"),
+)
+
+var _ = Describe("Testing age with no creation timestamp", func() {
+	It("Should show an unknown age", func() {
+		Expect(age(metav1.Time{})).To(Equal("<unknown>"))
+	})
+})
+
+var _ = Describe("Testing template functions", func() {
+	It("Should provide the table template functions to user templates", func() {
+		fns := templateFuncs(nil)
+		for _, name := range []string{"join", "joinAndTruncate", "config", "age"} {
+			Expect(fns).To(HaveKey(name))
+		}
+	})
+})
+
+var _ = Describe("Testing chunked YAML output", func() {
+	It("Should write each resource as a separate document", func() {
+		pools := api.NewIPPoolList()
+		pools.Items = []api.IPPool{
+			{ObjectMeta: metav1.ObjectMeta{Name: "pool1"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "pool2"}},
+		}
+		profile := api.NewProfile()
+		profile.Name = "profile1"
+
+		var buf bytes.Buffer
+		Expect(writeYAMLDocuments(&buf, []runtime.Object{pools, profile})).To(Succeed())
+
+		docs := strings.Split(buf.String(), "---\n")
+		Expect(docs).To(HaveLen(4))
+		Expect(docs[0]).To(BeEmpty())
+		Expect(docs[1]).To(ContainSubstring("name: pool1"))
+		Expect(docs[2]).To(ContainSubstring("name: pool2"))
+		Expect(docs[3]).To(ContainSubstring("name: profile1"))
+		Expect(buf.String()).NotTo(ContainSubstring("items:"))
+	})
+})
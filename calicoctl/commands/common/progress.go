@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The width of the bar drawn by a Progress, excluding the label and counts. It is kept
+// short so that the lines written to stdout while the bar is shown overwrite all of it.
+const progressBarWidth = 20
+
+// ProgressEnabled returns true if progress bars may be shown. They are only shown when
+// both stdout and stderr are terminals, so that they never appear in piped or redirected
+// output, and may be turned off with the quiet option.
+func ProgressEnabled(quiet bool) bool {
+	return !quiet && stdoutIsTerminal() && stderrIsTerminal()
+}
+
+// Progress draws a progress bar on stderr for a phase with a known number of items. It
+// may be updated from several goroutines. The bar is redrawn each time the percentage
+// changes, and the cursor is left at the start of the line, so that any lines written to
+// stdout meanwhile replace the bar until it is next drawn. All methods of a nil Progress
+// do nothing, so callers can use NewProgress unconditionally.
+type Progress struct {
+	w       io.Writer
+	label   string
+	total   int64
+	done    int64
+	mu      sync.Mutex
+	percent int
+}
+
+// NewProgress returns a progress bar for the number of items, or nil if it is not enabled
+// or there are no items.
+func NewProgress(label string, total int, enabled bool) *Progress {
+	if !enabled || total <= 0 {
+		return nil
+	}
+	return newProgress(os.Stderr, label, total)
+}
+
+func newProgress(w io.Writer, label string, total int) *Progress {
+	p := &Progress{w: w, label: label, total: int64(total), percent: -1}
+	p.draw(0)
+	return p
+}
+
+// Add records that n more items are done.
+func (p *Progress) Add(n int) {
+	if p == nil {
+		return
+	}
+	p.draw(atomic.AddInt64(&p.done, int64(n)))
+}
+
+// Finish removes the bar, leaving the cursor at the start of the empty line.
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.w, "\r\033[K")
+}
+
+// draw redraws the bar if the percentage of the items done has changed.
+func (p *Progress) draw(done int64) {
+	if done > p.total {
+		done = p.total
+	}
+	percent := int(100 * done / p.total)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if percent <= p.percent {
+		return
+	}
+	p.percent = percent
+	filled := progressBarWidth * percent / 100
+	fmt.Fprintf(p.w, "\r\033[K%s [%s%s] %d/%d\r", p.label,
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled), done, p.total)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing progress bars", func() {
+	It("Should only redraw the bar when the percentage changes", func() {
+		buf := &bytes.Buffer{}
+		p := newProgress(buf, "Scanning", 200)
+		p.Add(1)
+		p.Add(1)
+		p.Add(98)
+		p.Finish()
+		Expect(buf.String()).To(Equal("\r\033[KScanning [....................] 0/200\r" +
+			"\r\033[KScanning [....................] 2/200\r" +
+			"\r\033[KScanning [##########..........] 100/200\r" +
+			"\r\033[K"))
+	})
+
+	It("Should count the items done by several goroutines", func() {
+		buf := &bytes.Buffer{}
+		p := newProgress(buf, "Scanning", 100)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					p.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		Expect(p.done).To(BeEquivalentTo(100))
+		Expect(buf.String()).To(HaveSuffix("Scanning [####################] 100/100\r"))
+	})
+
+	It("Should do nothing when disabled", func() {
+		p := NewProgress("Scanning", 10, false)
+		Expect(p).To(BeNil())
+		p.Add(1)
+		p.Finish()
+	})
+})
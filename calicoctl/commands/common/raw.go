@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+)
+
+// RawResources returns each of the resources as stored in the datastore. The resources
+// are fetched again from the backend client, so that none of the defaulting or conversion
+// done by the v3 client is applied. Lists are expanded into their items.
+func RawResources(ctx context.Context, c client.Interface, resources []runtime.Object) ([]runtime.Object, error) {
+	type accessor interface {
+		Backend() bapi.Client
+	}
+	ba, ok := c.(accessor)
+	if !ok {
+		return nil, fmt.Errorf("Client does not provide access to the datastore backend")
+	}
+	bc := ba.Backend()
+
+	var raw []runtime.Object
+	for _, resource := range resources {
+		items := []runtime.Object{resource}
+		if list, ok := resource.(resourcemgr.ResourceListObject); ok {
+			var err error
+			if items, err = meta.ExtractList(list); err != nil {
+				return nil, fmt.Errorf("Failed to expand resource list: %v", err)
+			}
+		}
+		for _, item := range items {
+			m, err := meta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			key := model.ResourceKey{Kind: resourceKind(item), Name: m.GetName(), Namespace: m.GetNamespace()}
+			kvp, err := bc.Get(ctx, key, "")
+			if err != nil {
+				return nil, fmt.Errorf("Failed to get %s from the datastore: %v", key, err)
+			}
+			obj, ok := kvp.Value.(runtime.Object)
+			if !ok {
+				return nil, fmt.Errorf("Datastore returned an unexpected value for %s", key)
+			}
+			raw = append(raw, obj)
+		}
+	}
+	return raw, nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	cerrors "github.com/projectcalico/libcalico-go/lib/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// rawBackend is a backend client that returns the stored objects by key.
+type rawBackend struct {
+	bapi.Client
+	stored map[model.ResourceKey]runtime.Object
+}
+
+func (b rawBackend) Get(ctx context.Context, key model.Key, revision string) (*model.KVPair, error) {
+	obj, ok := b.stored[key.(model.ResourceKey)]
+	if !ok {
+		return nil, cerrors.ErrorResourceDoesNotExist{Identifier: key}
+	}
+	return &model.KVPair{Key: key, Value: obj}, nil
+}
+
+type rawClient struct {
+	client.Interface
+	backend rawBackend
+}
+
+func (c rawClient) Backend() bapi.Client {
+	return c.backend
+}
+
+var _ = Describe("Testing getting raw resources", func() {
+	newPool := func(name, cidr string) *apiv3.IPPool {
+		p := apiv3.NewIPPool()
+		p.Name = name
+		p.Spec.CIDR = cidr
+		return p
+	}
+
+	It("should return the stored objects, expanding lists", func() {
+		stored1 := newPool("pool1", "10.0.0.0/24")
+		stored1.ResourceVersion = "10"
+		stored2 := newPool("pool2", "10.1.0.0/24")
+		stored2.Spec.BlockSize = 28
+		c := rawClient{backend: rawBackend{stored: map[model.ResourceKey]runtime.Object{
+			{Kind: apiv3.KindIPPool, Name: "pool1"}: stored1,
+			{Kind: apiv3.KindIPPool, Name: "pool2"}: stored2,
+		}}}
+
+		// The items of a list do not have their type metadata set.
+		list := apiv3.NewIPPoolList()
+		list.Items = []apiv3.IPPool{
+			{ObjectMeta: newPool("pool1", "").ObjectMeta},
+			{ObjectMeta: newPool("pool2", "").ObjectMeta},
+		}
+		raw, err := RawResources(context.Background(), c, []runtime.Object{list})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(raw).To(Equal([]runtime.Object{stored1, stored2}))
+	})
+
+	It("should fail if a resource is not in the datastore", func() {
+		c := rawClient{backend: rawBackend{stored: map[model.ResourceKey]runtime.Object{}}}
+		_, err := RawResources(context.Background(), c, []runtime.Object{newPool("pool1", "10.0.0.0/24")})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail if the client has no backend", func() {
+		_, err := RawResources(context.Background(), nil, []runtime.Object{newPool("pool1", "10.0.0.0/24")})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -15,9 +15,12 @@
 package common
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -28,6 +31,7 @@ import (
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/file"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	"github.com/projectcalico/go-json/json"
 	"github.com/projectcalico/go-yaml-wrapper"
 	client "github.com/projectcalico/libcalico-go/lib/clientv3"
 	calicoErrors "github.com/projectcalico/libcalico-go/lib/errors"
@@ -35,6 +39,18 @@ import (
 
 type action int
 
+// Modes for resolving an update conflict in apply and replace, set by the --conflict option.
+const (
+	// Fail the update. This is the default.
+	ConflictFail = "fail"
+
+	// Update the latest version of the resource with the supplied resource.
+	ConflictOverwrite = "overwrite"
+
+	// Merge the spec of the supplied resource into the latest version of the resource.
+	ConflictMerge = "merge"
+)
+
 const (
 	ActionApply action = iota
 	ActionCreate
@@ -91,6 +107,11 @@ type CommandResults struct {
 	// never be 0 without an associated error.
 	NumHandled int
 
+	// The number of resources that are being configured, and the number that were
+	// actually configured, keyed by kind.
+	NumResourcesByKind map[string]int
+	NumHandledByKind   map[string]int
+
 	// The associated error.
 	Err error
 
@@ -125,11 +146,19 @@ func ExecuteConfigCommand(args map[string]interface{}, action action) CommandRes
 	var resources []resourcemgr.ResourceObject
 
 	singleKind := false
+	namesFromStdin := false
 
 	log.Info("Executing config command")
 
 	errorOnEmpty := !argutils.ArgBoolOrFalse(args, "--skip-empty")
 
+	switch conflict := argutils.ArgStringOrBlank(args, "--conflict"); conflict {
+	case "", ConflictFail, ConflictOverwrite, ConflictMerge:
+	default:
+		return CommandResults{Err: fmt.Errorf("Invalid conflict mode '%s', expected one of: %s, %s, %s",
+			conflict, ConflictFail, ConflictOverwrite, ConflictMerge)}
+	}
+
 	if filename := args["--filename"]; filename != nil {
 		// Filename is specified.  Use the file iterator to handle the fact that this may be a directory rather than a
 		// single file. For each file load the resources from the file and convert to a single slice of resources for
@@ -180,6 +209,13 @@ func ExecuteConfigCommand(args map[string]interface{}, action action) CommandRes
 		// management commands.
 		var err error
 		singleKind = true
+		namesFromStdin, err = expandStdinNames(args, os.Stdin)
+		if err != nil {
+			return CommandResults{Err: err}
+		}
+		if err = SplitKindNames(args); err != nil {
+			return CommandResults{Err: err}
+		}
 		resources, err = resourcemgr.GetResourcesFromArgs(args)
 		if err != nil {
 			return CommandResults{Err: err}
@@ -205,6 +241,13 @@ func ExecuteConfigCommand(args map[string]interface{}, action action) CommandRes
 		log.Debugf("Data: %s", string(d))
 	}
 
+	// The Calico API does not support server-side apply for any datastore, so a server-side
+	// apply always falls back to a client-side apply. Calico resources do not carry a
+	// last-applied-configuration annotation, so a client-side apply does not grow them.
+	if action == ActionApply && argutils.ArgBoolOrFalse(args, "--server-side") {
+		fmt.Println("Server-side apply is not supported by the datastore, falling back to client-side apply")
+	}
+
 	// Load the client config and connect.
 	cf := args["--config"].(string)
 	cclient, err := clientmgr.NewClient(cf)
@@ -216,7 +259,7 @@ func ExecuteConfigCommand(args map[string]interface{}, action action) CommandRes
 
 	// Initialise the command results with the number of resources and the name of the
 	// kind of resource (if only dealing with a single resource).
-	results := CommandResults{Client: cclient}
+	results := CommandResults{Client: cclient, NumHandledByKind: map[string]int{}}
 	var kind string
 	count := make(map[string]int)
 	for _, r := range resources {
@@ -227,6 +270,7 @@ func ExecuteConfigCommand(args map[string]interface{}, action action) CommandRes
 	if len(count) == 1 || singleKind {
 		results.SingleKind = kind
 	}
+	results.NumResourcesByKind = count
 
 	// Now execute the command on each resource in order, exiting as soon as we hit an
 	// error.
@@ -253,6 +297,11 @@ func ExecuteConfigCommand(args map[string]interface{}, action action) CommandRes
 
 	for _, r := range resources {
 		res, err := ExecuteResourceAction(args, cclient, r, action)
+		if namesFromStdin {
+			// Names read from stdin may be numerous, so report the status of each one.
+			// This is written to stderr so that it does not corrupt the output of get.
+			printNameStatus(os.Stderr, r, err)
+		}
 		if err != nil {
 			switch action {
 			case ActionApply, ActionCreate, ActionDelete, ActionGetOrList:
@@ -270,22 +319,41 @@ func ExecuteConfigCommand(args map[string]interface{}, action action) CommandRes
 			for i := range res {
 				rom := res[i].(v1.ObjectMetaAccessor).GetObjectMeta()
 				rom.SetNamespace("")
-				rom.SetUID("")
-				rom.SetResourceVersion("")
-				rom.SetCreationTimestamp(v1.Time{})
-				rom.SetDeletionTimestamp(nil)
-				rom.SetDeletionGracePeriodSeconds(nil)
-				rom.SetClusterName("")
+				removeServerMetadata(rom)
 			}
 		}
 
 		results.Resources = append(results.Resources, res...)
 		results.NumHandled = results.NumHandled + len(res)
+		results.NumHandledByKind[r.GetObjectKind().GroupVersionKind().Kind] += len(res)
 	}
 
 	return results
 }
 
+// validateResource runs the validator registered for the kind of the resource, if any.
+// Warnings are written to stderr, or are treated as an error if the --strict option is set.
+func validateResource(ctx context.Context, args map[string]interface{}, client client.Interface, resource resourcemgr.ResourceObject) error {
+	validate := resourcemgr.GetValidator(resource)
+	if validate == nil {
+		return nil
+	}
+	warnings, err := validate(ctx, client, resource)
+	if err != nil {
+		return err
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+	if argutils.ArgBoolOrFalse(args, "--strict") {
+		return fmt.Errorf("Validation failed with --strict: %s", strings.Join(warnings, "; "))
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	return nil
+}
+
 // ExecuteResourceAction fans out the specific resource action to the appropriate method
 // on the ResourceManager for the specific resource.
 func ExecuteResourceAction(args map[string]interface{}, client client.Interface, resource resourcemgr.ResourceObject, action action) ([]runtime.Object, error) {
@@ -299,6 +367,17 @@ func ExecuteResourceAction(args map[string]interface{}, client client.Interface,
 	var resOut runtime.Object
 	ctx := context.Background()
 
+	if action == ActionApply || action == ActionCreate || action == ActionUpdate {
+		if err := validateResource(ctx, args, client, resource); err != nil {
+			return nil, err
+		}
+	}
+	if (action == ActionApply || action == ActionCreate) && argutils.ArgBoolOrFalse(args, "--save-config") {
+		if err := SetLastAppliedConfig(resource); err != nil {
+			return nil, err
+		}
+	}
+
 	switch action {
 	case ActionApply:
 		resOut, err = rm.Apply(ctx, client, resource)
@@ -315,6 +394,20 @@ func ExecuteResourceAction(args map[string]interface{}, client client.Interface,
 		resOut, err = rm.Patch(ctx, client, resource, patch)
 	}
 
+	// Resolve an update conflict depending on the --conflict option.
+	if _, ok := err.(calicoErrors.ErrorResourceUpdateConflict); ok && (action == ActionApply || action == ActionUpdate) {
+		switch argutils.ArgStringOrBlank(args, "--conflict") {
+		case ConflictOverwrite:
+			// Clear the resource version so that the latest resource version is used.
+			log.Infof("Overwriting the latest version of the resource after a conflict: %s", err)
+			resource.GetObjectMeta().SetResourceVersion("")
+			resOut, err = rm.Update(ctx, client, resource)
+		case ConflictMerge:
+			log.Infof("Merging with the latest version of the resource after a conflict: %s", err)
+			resOut, err = mergeSpec(ctx, client, rm, resource)
+		}
+	}
+
 	// Skip over some errors depending on command line options.
 	if err != nil {
 		skip := false
@@ -333,6 +426,27 @@ func ExecuteResourceAction(args map[string]interface{}, client client.Interface,
 	return []runtime.Object{resOut}, err
 }
 
+// mergeSpec performs a strategic merge of the spec of the resource into the latest version
+// of the resource in the datastore, and updates the resource. The metadata of the latest
+// version is kept.
+func mergeSpec(ctx context.Context, client client.Interface, rm resourcemgr.ResourceManager, resource resourcemgr.ResourceObject) (runtime.Object, error) {
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	patch, err := json.Marshal(map[string]interface{}{"spec": fields["spec"]})
+	if err != nil {
+		return nil, err
+	}
+
+	resource.GetObjectMeta().SetResourceVersion("")
+	return rm.Patch(ctx, client, resource, string(patch))
+}
+
 // handleNamespace fills in the namespace information in the resource (if required),
 // and validates the namespace depending on whether or not a namespace should be
 // provided based on the resource kind.
@@ -374,3 +488,116 @@ func handleNamespace(resource resourcemgr.ResourceObject, rm resourcemgr.Resourc
 
 	return nil
 }
+
+// expandStdinNames replaces a "-" in the <NAME> arguments with the names read from r,
+// one per line. Blank lines and lines starting with "#" are ignored. Returns true if
+// the names were read from r.
+func expandStdinNames(args map[string]interface{}, r io.Reader) (bool, error) {
+	argNames, ok := args["<NAME>"].([]string)
+	if !ok {
+		return false, nil
+	}
+
+	var names []string
+	fromReader := false
+	for _, name := range argNames {
+		if name != "-" {
+			names = append(names, name)
+			continue
+		}
+		if fromReader {
+			return false, fmt.Errorf("names may only be read from stdin once")
+		}
+		fromReader = true
+		read, err := readNames(r)
+		if err != nil {
+			return false, fmt.Errorf("failed to read resource names from stdin: %v", err)
+		}
+		names = append(names, read...)
+	}
+
+	if fromReader {
+		args["<NAME>"] = names
+	}
+	return fromReader, nil
+}
+
+// readNames reads the resource names from r, one per line.
+func readNames(r io.Reader) ([]string, error) {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, scanner.Err()
+}
+
+// SplitKindNames accepts resources named as <KIND>/<NAME>, as printed by get -o name, in
+// place of a separate <KIND> and <NAME>, for the commands that take a list of names. If
+// <KIND> is of the form <KIND>/<NAME>, the name is moved to the start of the <NAME>
+// arguments. Any <NAME> of the form <KIND>/<NAME> must be of the same kind, and is
+// replaced by the name alone.
+func SplitKindNames(args map[string]interface{}) error {
+	kind, ok := args["<KIND>"].(string)
+	if !ok {
+		return nil
+	}
+	names, ok := args["<NAME>"].([]string)
+	if !ok {
+		return nil
+	}
+	if i := strings.Index(kind, "/"); i >= 0 {
+		names = append([]string{kind[i+1:]}, names...)
+		kind = kind[:i]
+	}
+
+	split := make([]string, len(names))
+	for i, name := range names {
+		split[i] = name
+		j := strings.Index(name, "/")
+		if j < 0 {
+			continue
+		}
+		same, err := sameKind(kind, name[:j])
+		if err != nil {
+			return err
+		} else if !same {
+			return fmt.Errorf("resource %s is not of kind %s; only one kind of resource may be named", name, kind)
+		}
+		split[i] = name[j+1:]
+	}
+	args["<KIND>"] = kind
+	args["<NAME>"] = split
+	return nil
+}
+
+// sameKind returns true if the two names of resource kinds, such as "ippool" and
+// "ippools", refer to the same kind of resource.
+func sameKind(a, b string) (bool, error) {
+	ra, err := resourcemgr.GetResourceHelper(a)
+	if err != nil {
+		return false, err
+	}
+	rb, err := resourcemgr.GetResourceHelper(b)
+	if err != nil {
+		return false, err
+	}
+	return ra.NewResource("", "").GetObjectKind().GroupVersionKind() == rb.NewResource("", "").GetObjectKind().GroupVersionKind(), nil
+}
+
+// printNameStatus writes the outcome of the action on the named resource to w.
+func printNameStatus(w io.Writer, r resourcemgr.ResourceObject, err error) {
+	name := r.GetObjectMeta().GetName()
+	if ns := r.GetObjectMeta().GetNamespace(); ns != "" {
+		name = ns + "/" + name
+	}
+	if err != nil {
+		fmt.Fprintf(w, "%s: error: %v\n", name, err)
+	} else {
+		fmt.Fprintf(w, "%s: ok\n", name)
+	}
+}
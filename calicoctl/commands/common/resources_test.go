@@ -0,0 +1,112 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	api "github.com/projectcalico/libcalico-go/lib/apis/v3"
+)
+
+var _ = Describe("Reading resource names from stdin", func() {
+	const input = "pool1\n\n  pool2  \n# a comment\npool3\n"
+
+	It("Should read one name per line, ignoring blank and comment lines", func() {
+		names, err := readNames(strings.NewReader(input))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(Equal([]string{"pool1", "pool2", "pool3"}))
+	})
+
+	It("Should replace - with the names read", func() {
+		args := map[string]interface{}{"<NAME>": []string{"pool0", "-"}}
+		fromStdin, err := expandStdinNames(args, strings.NewReader(input))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fromStdin).To(BeTrue())
+		Expect(args["<NAME>"]).To(Equal([]string{"pool0", "pool1", "pool2", "pool3"}))
+	})
+
+	It("Should leave the names unchanged if - is not specified", func() {
+		args := map[string]interface{}{"<NAME>": []string{"pool0"}}
+		fromStdin, err := expandStdinNames(args, strings.NewReader(input))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fromStdin).To(BeFalse())
+		Expect(args["<NAME>"]).To(Equal([]string{"pool0"}))
+	})
+
+	It("Should reject - specified more than once", func() {
+		args := map[string]interface{}{"<NAME>": []string{"-", "-"}}
+		_, err := expandStdinNames(args, strings.NewReader(input))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Naming resources as <KIND>/<NAME>", func() {
+	It("Should accept the names printed by the name output", func() {
+		pools := api.NewIPPoolList()
+		pools.Items = []api.IPPool{
+			{ObjectMeta: metav1.ObjectMeta{Name: "pool1"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "pool2"}},
+		}
+		names := resourceNames([]runtime.Object{pools})
+		args := map[string]interface{}{"<KIND>": names[0], "<NAME>": names[1:]}
+		Expect(SplitKindNames(args)).To(Succeed())
+		Expect(args["<KIND>"]).To(Equal("ippool"))
+		Expect(args["<NAME>"]).To(Equal([]string{"pool1", "pool2"}))
+
+		resources, err := resourcemgr.GetResourcesFromArgs(args)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resources).To(HaveLen(2))
+		Expect(resources[0]).To(BeAssignableToTypeOf(&api.IPPool{}))
+		Expect(resources[0].GetObjectMeta().GetName()).To(Equal("pool1"))
+		Expect(resources[1].GetObjectMeta().GetName()).To(Equal("pool2"))
+	})
+
+	It("Should take the namespace of namespaced resources from --namespace", func() {
+		args := map[string]interface{}{"<KIND>": "networkpolicy/allow-dns", "<NAME>": []string{}, "--namespace": "kube-system"}
+		Expect(SplitKindNames(args)).To(Succeed())
+		resources, err := resourcemgr.GetResourcesFromArgs(args)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resources).To(HaveLen(1))
+		Expect(resources[0].GetObjectMeta().GetNamespace()).To(Equal("kube-system"))
+		Expect(resources[0].GetObjectMeta().GetName()).To(Equal("allow-dns"))
+	})
+
+	It("Should accept another name for the same kind", func() {
+		args := map[string]interface{}{"<KIND>": "ippools", "<NAME>": []string{"ippool/pool1", "pool2"}}
+		Expect(SplitKindNames(args)).To(Succeed())
+		Expect(args["<KIND>"]).To(Equal("ippools"))
+		Expect(args["<NAME>"]).To(Equal([]string{"pool1", "pool2"}))
+	})
+
+	It("Should reject names of more than one kind", func() {
+		args := map[string]interface{}{"<KIND>": "ippool/pool1", "<NAME>": []string{"bgppeer/peer1"}}
+		Expect(SplitKindNames(args)).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Resolving update conflicts", func() {
+	It("Should reject an invalid conflict mode", func() {
+		args := map[string]interface{}{"--conflict": "ignore"}
+		results := ExecuteConfigCommand(args, ActionApply)
+		Expect(results.Err).To(MatchError("Invalid conflict mode 'ignore', expected one of: fail, overwrite, merge"))
+	})
+})
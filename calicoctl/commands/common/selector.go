@@ -0,0 +1,48 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+)
+
+// SelectResources returns the items of the resource list whose labels match the label
+// selector. The selector uses the Kubernetes syntax, for example "app=legacy,tier!=web".
+func SelectResources(list resourcemgr.ResourceListObject, selector string) ([]resourcemgr.ResourceObject, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid label selector '%s': %v", selector, err)
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	var selected []resourcemgr.ResourceObject
+	for _, item := range items {
+		r, ok := item.(resourcemgr.ResourceObject)
+		if !ok {
+			continue
+		}
+		if sel.Matches(labels.Set(r.GetObjectMeta().GetLabels())) {
+			selected = append(selected, r)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing selecting resources by label", func() {
+	list := apiv3.NewNetworkPolicyList()
+	for _, p := range []struct {
+		name   string
+		labels map[string]string
+	}{
+		{"legacy1", map[string]string{"app": "legacy"}},
+		{"legacy2", map[string]string{"app": "legacy", "tier": "web"}},
+		{"current", map[string]string{"app": "current"}},
+		{"unlabelled", nil},
+	} {
+		np := apiv3.NewNetworkPolicy()
+		np.Namespace = "default"
+		np.Name = p.name
+		np.Labels = p.labels
+		list.Items = append(list.Items, *np)
+	}
+	names := func(selector string) []string {
+		selected, err := SelectResources(list, selector)
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, r := range selected {
+			names = append(names, r.GetObjectMeta().GetName())
+		}
+		return names
+	}
+
+	It("Should select the resources whose labels match", func() {
+		Expect(names("app=legacy")).To(Equal([]string{"legacy1", "legacy2"}))
+		Expect(names("app=legacy,tier!=web")).To(Equal([]string{"legacy1"}))
+		Expect(names("!app")).To(Equal([]string{"unlabelled"}))
+	})
+
+	It("Should reject an invalid selector", func() {
+		_, err := SelectResources(list, "=legacy")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,143 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The suffix added to truncated text.
+	truncationSuffix = "..."
+
+	// Columns are not truncated below this width when fitting a table to the terminal.
+	minTruncatedColumnWidth = 10
+)
+
+// ColorEnabled returns true if color output may be used. By default color is only used
+// when stdout is a terminal, and may be turned off by setting the NO_COLOR environment
+// variable. The forceColor and noColor options override the default.
+func ColorEnabled(forceColor, noColor bool) bool {
+	if noColor {
+		return false
+	}
+	if forceColor {
+		return true
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return stdoutIsTerminal()
+}
+
+// TerminalWidth returns the width of the terminal that stdout is writing to, or 0 if
+// stdout is not a terminal or the width cannot be determined. The COLUMNS environment
+// variable, if set, takes precedence over the width reported by the terminal.
+func TerminalWidth() int {
+	if !stdoutIsTerminal() {
+		return 0
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return terminalWidth(os.Stdout)
+}
+
+// stdoutIsTerminal returns true if stdout is a terminal.
+func stdoutIsTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// stderrIsTerminal returns true if stderr is a terminal.
+func stderrIsTerminal() bool {
+	fi, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Truncate shortens s to at most maxLen characters, replacing the end of the text with an
+// ellipsis if it is truncated. A maxLen of 0 disables truncation.
+func Truncate(s string, maxLen int) string {
+	runes := []rune(s)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return s
+	}
+	if maxLen <= len(truncationSuffix) {
+		return truncationSuffix[:maxLen]
+	}
+	return string(runes[:maxLen-len(truncationSuffix)]) + truncationSuffix
+}
+
+// fitColumns truncates the cells of a tab separated table so that, once formatted by a
+// tabwriter, each line is no wider than maxWidth. The widest columns are shortened first,
+// and no column is shortened below minTruncatedColumnWidth, so the table may still exceed
+// maxWidth if it has many columns. A maxWidth of 0 disables truncation.
+func fitColumns(table string, maxWidth int) string {
+	if maxWidth <= 0 {
+		return table
+	}
+
+	// Split the table into cells. Each cell is terminated by a tab, so the final
+	// element of each row is any trailing text which is not part of a column.
+	lines := strings.Split(table, "\n")
+	rows := make([][]string, len(lines))
+	var widths []int
+	for i, line := range lines {
+		rows[i] = strings.Split(line, "\t")
+		for col, cell := range rows[i][:len(rows[i])-1] {
+			if col == len(widths) {
+				widths = append(widths, tableMinWidth)
+			}
+			if l := len([]rune(cell)); l > widths[col] {
+				widths[col] = l
+			}
+		}
+	}
+
+	// Shrink the widest column until the table fits.
+	total := 0
+	for _, w := range widths {
+		total += w + tablePadding
+	}
+	for total > maxWidth {
+		widest := 0
+		for col, w := range widths {
+			if w > widths[widest] {
+				widest = col
+			}
+		}
+		if widths[widest] <= minTruncatedColumnWidth {
+			break
+		}
+		widths[widest]--
+		total--
+	}
+
+	for i, row := range rows {
+		for col := range row[:len(row)-1] {
+			row[col] = Truncate(row[col], widths[col])
+		}
+		lines[i] = strings.Join(row, "\t")
+	}
+	return strings.Join(lines, "\n")
+}
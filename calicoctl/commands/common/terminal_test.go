@@ -0,0 +1,59 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = DescribeTable("Testing Truncate",
+	func(s string, maxLen int, expected string) {
+		Expect(Truncate(s, maxLen)).To(Equal(expected))
+	},
+	Entry("no limit", "HelloWorld", 0, "HelloWorld"),
+	Entry("shorter than the limit", "Hello", 10, "Hello"),
+	Entry("equal to the limit", "HelloWorld", 10, "HelloWorld"),
+	Entry("longer than the limit", "HelloWorld", 8, "Hello..."),
+	Entry("limit shorter than the ellipsis", "HelloWorld", 2, ".."),
+	Entry("multi-byte characters", "héllowörld", 8, "héllo..."),
+)
+
+var _ = Describe("Testing fitting table columns", func() {
+	const table = "NAME\tSELECTOR\t\n" +
+		"policy1\thas(role) && role == 'frontend'\t\n" +
+		"policy2\tall()\t\n"
+
+	It("Should leave the table unchanged with no maximum width", func() {
+		Expect(fitColumns(table, 0)).To(Equal(table))
+	})
+
+	It("Should leave the table unchanged if it fits", func() {
+		Expect(fitColumns(table, 80)).To(Equal(table))
+	})
+
+	It("Should truncate the widest column to fit", func() {
+		Expect(fitColumns(table, 30)).To(Equal("NAME\tSELECTOR\t\n" +
+			"policy1\thas(role) && r...\t\n" +
+			"policy2\tall()\t\n"))
+	})
+
+	It("Should not truncate columns below the minimum width", func() {
+		Expect(fitColumns(table, 10)).To(Equal("NAME\tSELECTOR\t\n" +
+			"policy1\thas(rol...\t\n" +
+			"policy2\tall()\t\n"))
+	})
+})
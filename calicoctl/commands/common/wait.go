@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+)
+
+// The interval between polls of a resource's status while waiting for it to be programmed.
+const waitPollInterval = time.Second
+
+// WaitForResources waits until the status of each of the resources shows that it has been
+// programmed, or until the timeout expires. Resources whose kind does not have an observable
+// status are skipped with a warning.
+func WaitForResources(client client.Interface, resources []runtime.Object, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, r := range resources {
+		resource, ok := r.(resourcemgr.ResourceObject)
+		if !ok {
+			continue
+		}
+		id := resourceID(resource)
+
+		check := resourcemgr.GetStatusCheck(resource)
+		if check == nil {
+			fmt.Printf("Warning: %s does not have an observable status, not waiting for it\n", id)
+			continue
+		}
+
+		if err := waitForResource(ctx, client, resource, check); err != nil {
+			return fmt.Errorf("Timed out waiting for %s to be programmed: %v", id, err)
+		}
+		fmt.Printf("%s has been programmed\n", id)
+	}
+	return nil
+}
+
+// waitForResource polls the resource until the status check passes or the context expires.
+func waitForResource(ctx context.Context, client client.Interface, resource resourcemgr.ResourceObject, check resourcemgr.ResourceStatusCheck) error {
+	rm := resourcemgr.GetResourceManager(resource)
+
+	// Get the latest revision of the resource each time.
+	resource = resource.DeepCopyObject().(resourcemgr.ResourceObject)
+	resource.GetObjectMeta().SetResourceVersion("")
+
+	for {
+		current, err := rm.GetOrList(ctx, client, resource)
+		if err != nil {
+			log.WithError(err).Info("Failed to get resource status, retrying")
+		} else if check(current.(resourcemgr.ResourceObject)) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return err
+			}
+			return ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// resourceID returns a string identifying the resource by kind, namespace and name.
+func resourceID(resource resourcemgr.ResourceObject) string {
+	kind := resource.GetObjectKind().GroupVersionKind().Kind
+	if ns := resource.GetObjectMeta().GetNamespace(); ns != "" {
+		return fmt.Sprintf("%s(%s/%s)", kind, ns, resource.GetObjectMeta().GetName())
+	}
+	return fmt.Sprintf("%s(%s)", kind, resource.GetObjectMeta().GetName())
+}
@@ -30,7 +30,7 @@ import (
 func Create(args []string) error {
 	doc := constants.DatastoreIntro + `Usage:
   <BINARY_NAME> create --filename=<FILENAME> [--recursive] [--skip-empty]
-                   [--skip-exists] [--config=<CONFIG>] [--namespace=<NS>] [--context=<context>]
+                   [--skip-exists] [--strict] [--save-config] [--config=<CONFIG>] [--namespace=<NS>] [--context=<context>]
 
 Examples:
   # Create a policy using the data in policy.yaml.
@@ -50,6 +50,11 @@ Options:
                             data.
      --skip-exists          Skip over and treat as successful any attempts to
                             create an entry that already exists.
+     --strict               Treat validation warnings, such as an IPPool whose
+                            CIDR overlaps another IPPool, as errors.
+     --save-config          Record the configuration of each resource in its
+                            last-applied annotation, so that it can be
+                            updated by a later apply.
   -c --config=<CONFIG>      Path to the file containing connection
                             configuration in YAML or JSON format.
                             [default: ` + constants.DefaultConfigPath + `]
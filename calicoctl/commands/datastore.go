@@ -20,7 +20,7 @@ import (
 
 	"github.com/docopt/docopt-go"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
-	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
 )
 
@@ -30,7 +30,10 @@ func Datastore(args []string) error {
 	doc := constants.DatastoreIntro + `Usage:
   <BINARY_NAME> datastore <command> [<args>...]
 
-    migrate  Migrate the contents of an etcdv3 datastore to a Kubernetes datastore.
+    migrate      Migrate the contents of an etcdv3 datastore to a Kubernetes datastore.
+                 This is the same as '<BINARY_NAME> migrate'.
+    lock-status  Show whether the datastore is locked.
+    info         Show the datastore that <BINARY_NAME> is configured to use.
 
 Options:
   -h --help      Show this screen.
@@ -62,7 +65,11 @@ Description:
 
 	switch command {
 	case "migrate":
-		return datastore.Migrate(args)
+		return migrate.Migrate(args, VERSION)
+	case "lock-status":
+		return migrate.GetLockStatus(args)
+	case "info":
+		return migrate.GetDatastoreInfo(args)
 	default:
 		fmt.Println(doc)
 	}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/crds"
+	"github.com/projectcalico/libcalico-go/lib/apiconfig"
+)
+
+func Clean(args []string) error {
+	doc := `Usage:
+  <BINARY_NAME> <MIGRATE> clean [--config=<CONFIG>] [--confirm]
+
+Options:
+  -h --help                 Show this screen.
+  -c --config=<CONFIG>      Path to the file containing connection
+                            configuration in YAML or JSON format.
+                            [default: ` + constants.DefaultConfigPath + `]
+     --confirm              Confirm that all Calico resources should be
+                            deleted.
+
+Description:
+  Delete all Calico resources from the Kubernetes datastore by deleting the
+  Calico CRDs, for example to retry a failed import.  This deletes the
+  Calico resources and IPAM data, and the cluster information used to lock
+  the datastore.  Nodes are not deleted since they are backed by the
+  Kubernetes node resources.
+
+  This cannot be undone, so the --confirm option must be specified.  Do not
+  run this against a Kubernetes datastore that is in use by a Calico cluster.
+`
+	// Replace the BINARY_NAME and MIGRATE placeholders.
+	doc = usage(doc, args)
+
+	parsedArgs, err := docopt.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if len(parsedArgs) == 0 {
+		return nil
+	}
+
+	// Check that the datastore configured datastore is kubernetes
+	cf := parsedArgs["--config"].(string)
+	cfg, err := loadConfig(cf, apiconfig.Kubernetes, "clean")
+	if err != nil {
+		return err
+	}
+
+	if !parsedArgs["--confirm"].(bool) {
+		return fmt.Errorf("All Calico resources in the datastore will be deleted. Specify --confirm to continue.")
+	}
+
+	cs, err := newCRDClientset(cfg)
+	if err != nil {
+		return err
+	}
+
+	calicoCRDs, err := crds.CalicoCRDs()
+	if err != nil {
+		return err
+	}
+
+	// Delete each CRD, continuing past failures so that we can report every CRD that
+	// could not be deleted. CRDs which do not exist are skipped.
+	var failures []string
+	for _, crd := range calicoCRDs {
+		name := crd.GetObjectMeta().GetName()
+		err := cs.ApiextensionsV1().CustomResourceDefinitions().Delete(context.Background(), name, v1.DeleteOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			failures = append(failures, fmt.Sprintf("Error deleting CRD %s: %s", name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Failed to delete %d out of %d CRDs:\n%s", len(failures), len(calicoCRDs), strings.Join(failures, "\n"))
+	}
+
+	fmt.Print("Datastore cleaned.\n")
+	return nil
+}
@@ -21,7 +21,6 @@ import (
 	"strings"
 
 	"github.com/docopt/docopt-go"
-	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -29,7 +28,6 @@ import (
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
-	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
 	"github.com/projectcalico/libcalico-go/lib/apiconfig"
 	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
 	"github.com/projectcalico/libcalico-go/lib/backend/k8s/conversion"
@@ -59,7 +57,7 @@ var resourceDisplayMap map[string]string = map[string]string{
 	"ipamhandles":            "IPAMHandles",
 	"ipamconfigs":            "IPAMConfigurations",
 	"ippools":                "IPPools",
-	"bgpconfig":              "BGPConfigurations",
+	"bgpconfigs":             "BGPConfigurations",
 	"bgppeers":               "BGPPeers",
 	"clusterinfos":           "ClusterInformations",
 	"felixconfigs":           "FelixConfigurations",
@@ -72,14 +70,9 @@ var resourceDisplayMap map[string]string = map[string]string{
 	"nodes":                  "Nodes",
 }
 
-var namespacedResources map[string]struct{} = map[string]struct{}{
-	"networkpolicies": struct{}{},
-	"networksets":     struct{}{},
-}
-
 func Export(args []string) error {
 	doc := `Usage:
-  <BINARY_NAME> datastore migrate export [--config=<CONFIG>]
+  <BINARY_NAME> <MIGRATE> export [--config=<CONFIG>]
 
 Options:
   -h --help                 Show this screen.
@@ -114,9 +107,8 @@ Description:
     - WorkloadEndpoints
     - Profiles
 `
-	// Replace all instances of BINARY_NAME with the name of the binary.
-	name, _ := util.NameAndDescription()
-	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+	// Replace the BINARY_NAME and MIGRATE placeholders.
+	doc = usage(doc, args)
 
 	parsedArgs, err := docopt.ParseArgs(doc, args, "")
 	if err != nil {
@@ -143,16 +135,11 @@ Description:
 	}
 
 	// Check that the datastore configured datastore is etcd
-	cfg, err := clientmgr.LoadClientConfig(cf)
+	_, err = loadConfig(cf, apiconfig.EtcdV3, "export from")
 	if err != nil {
-		log.Info("Error loading config")
 		return err
 	}
 
-	if cfg.Spec.DatastoreType != apiconfig.EtcdV3 {
-		return fmt.Errorf("Invalid datastore type: %s to export from for datastore migration. Datastore type must be etcdv3", cfg.Spec.DatastoreType)
-	}
-
 	rp := common.ResourcePrinterYAML{}
 	etcdToKddNodeMap := make(map[string]string)
 	// Loop through all the resource types to retrieve every resource available by the v3 API.
@@ -0,0 +1,136 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	calicoErrors "github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+// The kinds of global configuration resource. The cluster-wide configuration of each kind
+// is the singleton named "default", and FelixConfigurations and BGPConfigurations may also
+// hold the configuration of a single node, named "node.<NODE>".
+var globalConfigKinds = []string{
+	apiv3.KindFelixConfiguration,
+	apiv3.KindBGPConfiguration,
+	apiv3.KindKubeControllersConfiguration,
+}
+
+// CheckGlobalConfig checks the names of the global configuration resources in the v3
+// YAML data, returning an error if any would not be used by the components that read
+// them. It returns the kinds of global configuration that have no "default" resource in
+// the data, so that the target would keep its own default configuration.
+func CheckGlobalConfig(data []byte) ([]string, error) {
+	objs, err := resourcemgr.CreateResourcesFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing v3 resources: %s", err)
+	}
+
+	found := map[string]bool{}
+	var invalid []string
+	for _, obj := range objs {
+		err := eachResource(obj, func(r resourcemgr.ResourceObject) error {
+			kind := r.GetObjectKind().GroupVersionKind().Kind
+			name := r.GetObjectMeta().GetName()
+			switch {
+			case !isGlobalConfigKind(kind):
+			case name == "default":
+				found[kind] = true
+			case kind == apiv3.KindKubeControllersConfiguration || !strings.HasPrefix(name, "node."):
+				invalid = append(invalid, fmt.Sprintf("%s %s", kind, name))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("Global configuration must be named \"default\", or \"node.<NODE>\" for FelixConfigurations and BGPConfigurations, so the following would be ignored: %s",
+			strings.Join(invalid, ", "))
+	}
+
+	var missing []string
+	for _, kind := range globalConfigKinds {
+		if !found[kind] {
+			missing = append(missing, kind)
+		}
+	}
+	return missing, nil
+}
+
+// verifyGlobalConfig checks that the spec of each "default" global configuration resource
+// in the v3 YAML data matches the resource in the datastore. Only the spec is compared,
+// since the status is owned by the components that read the configuration.
+func verifyGlobalConfig(ctx context.Context, c client.Interface, data []byte) ([]Discrepancy, error) {
+	objs, err := resourcemgr.CreateResourcesFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing v3 resources: %s", err)
+	}
+
+	var discrepancies []Discrepancy
+	for _, obj := range objs {
+		err := eachResource(obj, func(before resourcemgr.ResourceObject) error {
+			kind := before.GetObjectKind().GroupVersionKind().Kind
+			name := before.GetObjectMeta().GetName()
+			if !isGlobalConfigKind(kind) || name != "default" {
+				return nil
+			}
+
+			after, err := resourcemgr.GetResourceManager(before).GetOrList(ctx, c, before)
+			if _, ok := err.(calicoErrors.ErrorResourceDoesNotExist); ok {
+				discrepancies = append(discrepancies, Discrepancy{kind, name, "missing from the datastore"})
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("Error retrieving %s %s: %s", kind, name, err)
+			}
+
+			b, err := comparableFields(before)
+			if err != nil {
+				return err
+			}
+			a, err := comparableFields(after)
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(b["spec"], a["spec"]) {
+				discrepancies = append(discrepancies, Discrepancy{kind, name, "spec differs from the export"})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return discrepancies, nil
+}
+
+// isGlobalConfigKind returns true if the kind is one of the kinds of global configuration.
+func isGlobalConfigKind(kind string) bool {
+	for _, k := range globalConfigKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
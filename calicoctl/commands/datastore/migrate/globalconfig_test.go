@@ -0,0 +1,63 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	"strings"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const globalConfigYAML = `apiVersion: projectcalico.org/v3
+items:
+- apiVersion: projectcalico.org/v3
+  kind: FelixConfiguration
+  metadata:
+    name: default
+  spec:
+    logSeverityScreen: Info
+- apiVersion: projectcalico.org/v3
+  kind: FelixConfiguration
+  metadata:
+    name: node.node1
+  spec:
+    logSeverityScreen: Debug
+kind: FelixConfigurationList
+metadata: {}
+---
+apiVersion: projectcalico.org/v3
+kind: KubeControllersConfiguration
+metadata:
+  name: {{KCC_NAME}}
+spec:
+  controllers: {}
+`
+
+var _ = Describe("Global configuration import handling", func() {
+	It("should report the kinds with no default configuration", func() {
+		missing, err := migrate.CheckGlobalConfig([]byte(strings.Replace(globalConfigYAML, "{{KCC_NAME}}", "default", 1)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(Equal([]string{apiv3.KindBGPConfiguration}))
+	})
+
+	It("should reject global configuration that is not named default", func() {
+		_, err := migrate.CheckGlobalConfig([]byte(strings.Replace(globalConfigYAML, "{{KCC_NAME}}", "node.node1", 1)))
+		Expect(err).To(MatchError(ContainSubstring("KubeControllersConfiguration node.node1")))
+	})
+})
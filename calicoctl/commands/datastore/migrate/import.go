@@ -19,22 +19,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/docopt/docopt-go"
 	log "github.com/sirupsen/logrus"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/equality"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/argutils"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/crds"
-	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	yamlsep "github.com/projectcalico/calicoctl/v3/calicoctl/util/yaml"
 	yaml "github.com/projectcalico/go-yaml-wrapper"
 	"github.com/projectcalico/libcalico-go/lib/apiconfig"
 	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
@@ -43,12 +48,59 @@ import (
 	"github.com/projectcalico/libcalico-go/lib/backend/model"
 	client "github.com/projectcalico/libcalico-go/lib/clientv3"
 	calicoErrors "github.com/projectcalico/libcalico-go/lib/errors"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
 	"github.com/projectcalico/libcalico-go/lib/options"
 )
 
-func Import(args []string) error {
+// The number of attempts made to apply each CRD before giving up.
+const crdApplyAttempts = 3
+
+// The kind used by the --only-kind option of import to refer to the IPAM resources.
+const ipamKind = "ipam"
+
+// The annotations that mark the CRDs applied by import with the import run and the version
+// of calicoctl that applied them.
+const (
+	importRunIDAnnotation   = "projectcalico.org/import-run-id"
+	importVersionAnnotation = "projectcalico.org/import-version"
+)
+
+// crdImportMarker identifies the import run that applies the CRDs. A CRD that is already
+// marked with the same run and version was applied by an earlier attempt at the same
+// import, and does not need to be applied again.
+type crdImportMarker struct {
+	RunID   string
+	Version string
+}
+
+// mark annotates the CRD with the marker.
+func (m crdImportMarker) mark(crd *apiextensionsv1.CustomResourceDefinition) {
+	if crd.Annotations == nil {
+		crd.Annotations = map[string]string{}
+	}
+	crd.Annotations[importRunIDAnnotation] = m.RunID
+	crd.Annotations[importVersionAnnotation] = m.Version
+}
+
+// marked returns true if the CRD is annotated with the marker.
+func (m crdImportMarker) marked(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	runID, ok := crd.Annotations[importRunIDAnnotation]
+	return ok && runID == m.RunID && crd.Annotations[importVersionAnnotation] == m.Version
+}
+
+func Import(args []string, version string) error {
 	doc := `Usage:
-  <BINARY_NAME> datastore migrate import --filename=<FILENAME> [--config=<CONFIG>]
+  <BINARY_NAME> <MIGRATE> import --filename=<FILENAME> [--config=<CONFIG>] [--ipam-config=<CONFIG>]
+                                                  [--timings] [--server-side]
+                                                  [--map-namespaces=<MAPPING>]
+                                                  [--name-prefix=<PREFIX>] [--name-suffix=<SUFFIX>]
+                                                  [--preserve-cluster-info] [--ipam-only]
+                                                  [--dry-run=<DRY_RUN>] [--summary-file=<FILE>]
+                                                  [--cluster-label=<NAME>] [--only-kind=<KIND>...] [--strict]
+                                                  [--apply-order=<KINDS>] [--continue-on-error]
+                                                  [--check-permissions] [--field-manager=<NAME>] [--no-lock]
+                                                  [--run-id=<ID>] [--strip-status | --retain-status]
+                                                  [--force] [--save-config] [--quiet]
 
 Options:
   -h --help                 Show this screen.
@@ -57,14 +109,241 @@ Options:
   -c --config=<CONFIG>      Path to the file containing connection
                             configuration in YAML or JSON format.
                             [default: ` + constants.DefaultConfigPath + `]
+     --ipam-config=<CONFIG> Path to the file containing connection
+                            configuration of the datastore to import the IPAM
+                            data into, in YAML or JSON format.  Defaults to
+                            the datastore configured by --config.
+     --timings              Print the time taken by each phase of the import
+                            once the import completes, and record it in the
+                            summary file.
+     --server-side          Request that v3 resources are applied server-side.
+                            No datastore supports this yet, so the resources
+                            are applied client-side, as without this option.
+     --field-manager=<NAME> Name of the field manager that owns the fields of
+                            the CRDs set by the import.
+                            [default: calicoctl-import]
+     --map-namespaces=<MAPPING>
+                            Comma separated list of namespace mappings of the
+                            form <OLD>=<NEW>. Namespaced resources in each old
+                            namespace are imported into the new namespace.
+     --name-prefix=<PREFIX>
+                            Prefix to add to the name of each imported
+                            resource.
+     --name-suffix=<SUFFIX>
+                            Suffix to add to the name of each imported
+                            resource.
+     --strip-status         Clear the status of every v3 resource before it is
+                            applied.
+     --retain-status        Import the status of every v3 resource, including
+                            the status written by calico/node and
+                            kube-controllers.
+     --preserve-cluster-info
+                            Keep the cluster GUID and Calico version of the
+                            target datastore rather than replacing them with
+                            the values from the export.
+     --ipam-only            Only import IPAM data.  The file must contain just
+                            the IPAM JSON section of an export.
+     --dry-run=<DRY_RUN>    Validate the import without making any changes.
+                            Must be "server".
+     --no-lock              Do not lock the datastore.  The datastore must
+                            already be locked, otherwise the import fails.
+     --run-id=<ID>          Identifier of the import run, recorded on the
+                            applied CRDs.  Pass the identifier printed by an
+                            earlier attempt to resume it.  Defaults to a new
+                            identifier based on the current time.
+     --summary-file=<FILE>  Write a JSON summary of the imported v3 resources
+                            to the named file once the import completes.
+     --cluster-label=<NAME>
+                            Label identifying the cluster, used to prefix the
+                            summary lines and recorded in the summary file.
+     --only-kind=<KIND>     Only check that the datastore has no existing
+                            resources of the kind before importing.  May be
+                            repeated.  Use "ipam" for the IPAM resources.
+     --strict               Refuse to import v3 resources with validation
+                            warnings, such as an IPPool whose CIDR overlaps
+                            another IPPool.
+     --apply-order=<KINDS>  Comma separated list of the kinds of v3 resource
+                            to apply first, in order.  Overrides the default
+                            order.
+     --continue-on-error    Continue with the later phases of the import when
+                            a phase fails, and report all of the errors at the
+                            end.
+     --check-permissions    Check that the Kubernetes API server permits the
+                            changes made by the import before starting it.
+     --force                Import the IPAM data even if some IPAM blocks do
+                            not fall within any IP pool, printing a warning
+                            rather than failing.
+     --quiet                Do not show a progress bar when writing to a
+                            terminal.
+     --save-config          Record the imported configuration of each v3
+                            resource in its last-applied annotation, so that
+                            later applies can compute the fields that were
+                            removed.
 
 Description:
   Import the contents of the etcdv3 datastore from the file created by the
   export command.
+
+  The --name-prefix and --name-suffix options rename all imported resources
+  except Nodes, WorkloadEndpoints, ClusterInformations, FelixConfigurations,
+  BGPConfigurations and KubeControllersConfigurations.  Their names must match
+  the node or "default" configuration they refer to, or, for WorkloadEndpoints,
+  are derived from the node, orchestrator, workload and interface.  Calico
+  resources mostly refer to each other using label selectors, which are not
+  affected by renaming.  BGPPeers and HostEndpoints refer to Nodes, which are
+  not renamed.  WorkloadEndpoints and HostEndpoints refer to Profiles by name,
+  so those references are renamed along with the Profiles.
+
+  By default the status of Nodes and KubeControllersConfigurations is cleared
+  before they are applied, so that only their metadata and spec are imported.
+  Their status is owned by calico/node and kube-controllers, and importing it
+  can fail or leave stale status in place until they next update it.  They
+  repopulate the status once they are running against the new datastore.  Use
+  --strip-status to clear the status of every kind of v3 resource that has
+  one, or --retain-status to import the status of every resource unchanged.
+
+  By default the cluster GUID and Calico version are copied from the export, so
+  the imported cluster keeps the identity of the exported one.  When the
+  --preserve-cluster-info option is set, the target keeps the cluster GUID
+  generated when its datastore was initialized.  Reports created by
+  "ipam check" are keyed on the cluster GUID, so reports created before the
+  import cannot then be used with "ipam release --from-report"; run
+  "ipam check" again after the import.
+
+  When the --ipam-only option is set, only the IPAM allocations are imported.
+  The v3 resources and cluster information are not imported, and the datastore
+  only needs to be free of IPAM data rather than of all Calico resources.  This
+  allows the v3 resources to be managed separately, for example from Git.  The
+  datastore is still locked during the import.
+
+  Before importing, the datastore is checked for existing Calico resources of
+  every kind, and the import is refused if any are found.  For a phased
+  migration, where some resources have already been imported, use --only-kind
+  to limit the check to the kinds being imported.  The kinds are "ipam",
+  "clusterinfos", "ippools", "bgppeers", "globalnetworkpolicies",
+  "globalnetworksets", "heps", "kubecontrollersconfigs", "networkpolicies",
+  "networksets", "bgpconfigs" and "felixconfigs".
+
+  Before the IPAM data is imported, each IPAM block is checked against the IP
+  pools in the datastore, including those just imported.  If any block does
+  not fall within an IP pool, its CIDR is printed and the import fails before
+  any IPAM data is written, since addresses in the block could not be managed.
+  Use --force to import the IPAM data anyway.
+
+  When the --dry-run=server option is set, the file is read and checked, and
+  the Calico CRDs are submitted to the Kubernetes API server as a server-side
+  dry run.  This confirms that the API server would accept the CRDs without
+  installing them, and without checking, locking or modifying the datastore.
+  This can be used to validate an upcoming migration against a production API
+  server.
+
+  The default FelixConfiguration, BGPConfiguration and
+  KubeControllersConfiguration hold the cluster-wide configuration, and are
+  checked before the v3 resources are applied.  The import is refused if any
+  global configuration is named other than "default" (or "node.<NODE>" for
+  FelixConfigurations and BGPConfigurations), since it would be ignored, and a
+  warning is printed for each kind with no default in the export, since the
+  target then keeps its own default configuration.  Once the v3 resources are
+  applied, the spec of each default is checked against the datastore, and the
+  import fails if any were not applied.
+
+  Once the v3 resources are applied, a table of the number of resources of each
+  kind in the file and the number that were applied is printed.  The same
+  summary is written as JSON to the file named by the --summary-file option.
+  When importing into many clusters and aggregating the output, set
+  --cluster-label so that the summary can be attributed to the right cluster.
+  The summary file records the label, or the cluster GUID if no label is set.
+  With --timings, the summary file also records the time taken by each phase.
+
+  Once the CRDs are applied, the number of CRDs that were created, updated, and
+  skipped because they were already up to date is printed.  These counts, and
+  the error for each CRD that could not be applied, are also recorded in the
+  summary file.
+
+  The CRDs are created and updated with the field manager named by the
+  --field-manager option, so that the fields set by the migration can be told
+  apart from those set later by an operator.  The field manager is not used
+  for the v3 resources, since the Calico API does not record the owners of
+  fields.
+
+  Each CRD applied by the import is annotated with the identifier of the import
+  run (projectcalico.org/import-run-id) and the version of calicoctl
+  (projectcalico.org/import-version).  The annotations do not affect the CRDs,
+  and show which import last applied them.  The run identifier is printed
+  before the CRDs are applied.  When an import that failed part way through is
+  run again with the same --run-id, the CRDs that are already annotated with
+  that run and version are skipped rather than applied again.
+
+  The v3 resources are applied in order of kind, so that resources are applied
+  after the resources they refer to.  The default order is IPPool, Node,
+  BGPConfiguration, FelixConfiguration, KubeControllersConfiguration, BGPPeer,
+  HostEndpoint, GlobalNetworkSet, NetworkSet, GlobalNetworkPolicy and then
+  NetworkPolicy.  Use --apply-order to change the order, for example
+  "--apply-order=ippools,nodes".  Resources of kinds that are not listed are
+  applied afterwards, in the order they appear in the file.
+
+  The import runs in phases: CRD apply, pre-existence check, datastore lock,
+  v3 resource apply, cluster info update and IPAM push.  If the command
+  receives SIGINT or SIGTERM, the phase in progress is allowed to complete, so
+  that no phase is left half done.  The import then stops, reports which phase
+  was interrupted and which phases completed, and exits with code 130.  The
+  datastore is left locked and partially imported; clean it with "calicoctl
+  migrate clean" before importing again.  A second SIGINT or SIGTERM stops the
+  import immediately, also with code 130, leaving the phase in progress half
+  done.
+
+  By default the import locks the datastore if it is not already locked.  When
+  the datastore is locked by a separate step, for example by orchestration
+  tooling that manages the lock, use --no-lock so that the import does not
+  attempt to lock it.  The import then checks that the datastore is locked
+  before applying the CRDs, and fails without making any changes if it is not.
+
+  By default the import stops at the first phase that fails.  When the
+  --continue-on-error option is set, the CRD apply, pre-existence check, v3
+  resource apply and cluster info update phases continue after an error, and
+  all of the errors are reported at the end, so that every problem can be
+  fixed before the next attempt.  Failing to lock the datastore still stops
+  the import.  The IPAM push is skipped if an earlier phase failed, since IPAM
+  data cannot be imported again without first cleaning the datastore.
+
+  When the --check-permissions option is set, the import first asks the
+  Kubernetes API server whether the user may make each of the changes that the
+  import will make: creating and updating the Calico CRDs and the cluster
+  information, creating the IPAM resources, creating each kind of v3 resource
+  in the file (in each namespace used), and updating the nodes.  If any of the
+  permissions are missing, they are all listed and the import is not started.
+
+  When stdout and stderr are both terminals, a progress bar is shown on stderr
+  while the IPAM resources are created, unless --quiet is set.  The progress
+  bar is never shown in piped or redirected output.
+
+  Before any other checks, and before the datastore is locked or anything is
+  applied, the structure of each section of the file is validated: the v3
+  resources section must be a series of YAML documents that each have a kind,
+  the cluster information section must be a ClusterInformation resource in
+  JSON, and the IPAM section must be the IPAM data in JSON.  If the file is
+  invalid, for example because it was truncated, the invalid section and the
+  line of the file where the problem was found are printed, and the import is
+  not started.
+
+  By default every phase of the import writes to the Kubernetes datastore
+  configured by --config.  For a hybrid migration, where the configuration and
+  the IPAM data move at different times or to different datastores, use
+  --ipam-config to import the IPAM data into a separate Kubernetes or etcdv3
+  datastore.  The CRDs, v3 resources and cluster information are still written
+  to the datastore configured by --config, and the IP pools that the IPAM
+  blocks are checked against are read from it.  The "ipam" kind of the
+  pre-existence check, and the IPAM permissions checked by --check-permissions
+  when the IPAM datastore is Kubernetes, apply to the IPAM datastore.  Both
+  configurations are loaded and the IPAM datastore is read before any changes
+  are made, and the datastore that each phase writes to is printed and recorded
+  in the summary file.  A Kubernetes IPAM datastore must already have the
+  Calico CRDs.  Only the datastore configured by --config is locked, so make
+  sure that nothing allocates addresses in the IPAM datastore during the
+  import.
 `
-	// Replace all instances of BINARY_NAME with the name of the binary.
-	name, _ := util.NameAndDescription()
-	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+	// Replace the BINARY_NAME and MIGRATE placeholders.
+	doc = usage(doc, args)
 
 	parsedArgs, err := docopt.ParseArgs(doc, args, "")
 	if err != nil {
@@ -74,10 +353,10 @@ Description:
 		return nil
 	}
 
+	// Check that the datastore configured datastore is kubernetes
 	cf := parsedArgs["--config"].(string)
-	cfg, err := clientmgr.LoadClientConfig(cf)
+	cfg, err := loadConfig(cf, apiconfig.Kubernetes, "import to")
 	if err != nil {
-		log.Info("Error loading config")
 		return err
 	}
 
@@ -86,73 +365,409 @@ Description:
 		cfg.Spec.K8sClientQPS = float32(50)
 	}
 
+	// The IPAM data is imported into the same datastore, unless a separate datastore is
+	// configured for it.
+	ipamCf := argutils.ArgStringOrBlank(parsedArgs, "--ipam-config")
+	if ipamCf == cf {
+		ipamCf = ""
+	}
+	var ipamCfg *apiconfig.CalicoAPIConfig
+	var ipamClient client.Interface
+	if ipamCf != "" {
+		if ipamCfg, err = loadIPAMConfig(ipamCf); err != nil {
+			return err
+		}
+		if ipamCfg.Spec.DatastoreType == apiconfig.Kubernetes && ipamCfg.Spec.K8sClientQPS == float32(0) {
+			ipamCfg.Spec.K8sClientQPS = float32(50)
+		}
+		if ipamClient, err = client.New(*ipamCfg); err != nil {
+			return err
+		}
+	}
+
 	// Get the backend client for updating cluster info and migrating IPAM.
 	client, err := client.New(*cfg)
 	if err != nil {
 		return err
 	}
+	if ipamCf == "" {
+		ipamCfg, ipamClient = cfg, client
+	}
 
-	// Check that the datastore configured datastore is kubernetes
-	if cfg.Spec.DatastoreType != apiconfig.Kubernetes {
-		return fmt.Errorf("Invalid datastore type: %s to import to for datastore migration. Datastore type must be kubernetes", cfg.Spec.DatastoreType)
+	// Build the transforms to apply to the v3 resources before they are imported.
+	var transforms []ResourceTransform
+	if m := parsedArgs["--map-namespaces"]; m != nil {
+		namespaces, err := ParseNamespaceMap(m.(string))
+		if err != nil {
+			return err
+		}
+		transforms = append(transforms, NamespaceMapper(namespaces))
+	}
+	applyOrder := DefaultApplyOrder
+	if o := parsedArgs["--apply-order"]; o != nil {
+		applyOrder, err = ParseApplyOrder(o.(string))
+		if err != nil {
+			return err
+		}
+	}
+	if !parsedArgs["--retain-status"].(bool) {
+		transforms = append(transforms, StatusStripper(parsedArgs["--strip-status"].(bool)))
+	}
+	prefix := argutils.ArgStringOrBlank(parsedArgs, "--name-prefix")
+	suffix := argutils.ArgStringOrBlank(parsedArgs, "--name-suffix")
+	if prefix != "" || suffix != "" {
+		transforms = append(transforms, NameRewriter(prefix, suffix))
+	}
+
+	ctx := context.Background()
+
+	// Record how long each phase of the import takes, printing the results on
+	// exit if requested.
+	timings := newPhaseTimings()
+	showTimings := parsedArgs["--timings"].(bool)
+	if showTimings {
+		defer timings.print(os.Stdout)
+	}
+	// summaryTimings returns the phase timings to write to the import summary, which
+	// only includes them if --timings is set.
+	summaryTimings := func() []PhaseTiming {
+		if !showTimings {
+			return nil
+		}
+		return timings.summary()
+	}
+
+	ipamOnly := parsedArgs["--ipam-only"].(bool)
+	filename := parsedArgs["--filename"].(string)
+	summaryFile := argutils.ArgStringOrBlank(parsedArgs, "--summary-file")
+	label := argutils.ArgStringOrBlank(parsedArgs, "--cluster-label")
+	fieldManager := parsedArgs["--field-manager"].(string)
+	force := parsedArgs["--force"].(bool)
+	showProgress := common.ProgressEnabled(parsedArgs["--quiet"].(bool))
+	marker := crdImportMarker{RunID: argutils.ArgStringOrBlank(parsedArgs, "--run-id"), Version: version}
+	if marker.RunID == "" {
+		marker.RunID = time.Now().UTC().Format("20060102-150405")
+	}
+
+	// On SIGINT or SIGTERM, let the phase in progress complete and then stop, reporting
+	// the phase that was interrupted.
+	interrupt, stop := common.NotifyInterrupt()
+	defer stop()
+	var completed []string
+	checkInterrupted := func(phase string) error {
+		completed = append(completed, phase)
+		err := common.CheckInterrupt(interrupt, fmt.Sprintf("Import phase %q", phase))
+		if err != nil {
+			fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Import interrupted during the %q phase, which was allowed to complete.", phase)))
+			fmt.Printf("Completed phases: %s. The datastore is partially imported.\n", strings.Join(completed, ", "))
+		}
+		return err
+	}
+
+	// With --continue-on-error, the errors from each phase are collected and reported at
+	// the end instead of stopping the import.
+	continueOnError := parsedArgs["--continue-on-error"].(bool)
+	var phaseErrs []error
+	phaseFailed := func(err error) error {
+		if !continueOnError {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		phaseErrs = append(phaseErrs, err)
+		return nil
+	}
+
+	// Work out which kinds of resource must not already exist in the datastore.
+	checkKinds, err := preCheckKinds(parsedArgs["--only-kind"].([]string), ipamOnly)
+	if err != nil {
+		return err
+	}
+
+	// Read the file once, since it may be stdin, and validate each of its sections before
+	// making any changes, so that a malformed or truncated file is reported up front.
+	var v3Yaml, clusterInfoJson, ipamJson []byte
+	if ipamOnly {
+		ipamJson, err = readImportFile(filename)
+	} else {
+		v3Yaml, clusterInfoJson, ipamJson, err = splitImportFile(filename)
+	}
+	if err != nil {
+		return fmt.Errorf("Error while reading migration file: %s\n", err)
+	}
+	if err := ValidateImportFile(v3Yaml, clusterInfoJson, ipamJson, ipamOnly); err != nil {
+		return fmt.Errorf("Import file %s is invalid: %s", importFileName(filename), err)
+	}
+
+	// Check that a separate IPAM datastore can be read before making any changes, and
+	// report the datastore that each phase writes to.
+	if ipamCf != "" {
+		if err := checkIPAMTarget(ctx, ipamClient, ipamCf); err != nil {
+			return err
+		}
 	}
+	targets := ImportTargets(cf, cfg, ipamCf, ipamCfg, ipamOnly)
+	printImportTargets(os.Stdout, targets)
 
-	err = importCRDs(cfg)
+	if parsedArgs["--check-permissions"].(bool) {
+		var permYaml []byte
+		if !ipamOnly {
+			// Check the namespaces that the resources will be imported into.
+			if permYaml, err = TransformV3Resources(v3Yaml, transforms...); err != nil {
+				return fmt.Errorf("Error while preparing v3 resources for import: %s\n", err)
+			}
+		}
+		perms, err := ImportPermissions(permYaml)
+		if err != nil {
+			return err
+		}
+		if ipamCf != "" {
+			// The IPAM permissions only apply to the IPAM datastore, and only need to be
+			// checked if it is a Kubernetes datastore.
+			var ipamPerms []Permission
+			perms, ipamPerms = SplitIPAMPermissions(perms)
+			if ipamCfg.Spec.DatastoreType == apiconfig.Kubernetes {
+				if err := checkImportPermissions(ctx, ipamCfg, ipamPerms); err != nil {
+					return err
+				}
+				fmt.Printf("Checked %d permissions needed by the import in the IPAM datastore\n", len(ipamPerms))
+			}
+		}
+		if err := checkImportPermissions(ctx, cfg, perms); err != nil {
+			return err
+		}
+		fmt.Printf("Checked %d permissions needed by the import\n", len(perms))
+	}
+
+	if dryRun := parsedArgs["--dry-run"]; dryRun != nil {
+		if dryRun.(string) != "server" {
+			return fmt.Errorf("Invalid dry run mode '%s'. Only server dry runs are supported", dryRun)
+		}
+		start := time.Now()
+		crdSummary, err := importCRDs(cfg, true, fieldManager, marker)
+		timings.record("CRD dry run", start)
+		fmt.Printf("Dry run: %s\n", crdSummary)
+		if err != nil {
+			return fmt.Errorf("The CRDs necessary for datastore import would not be accepted: %s", err)
+		}
+		fmt.Println(common.WithClusterLabel(label, "Dry run succeeded. The CRDs necessary for datastore import would be accepted, and no changes were made."))
+		return nil
+	}
+
+	// The caller is responsible for locking the datastore, so check that it is locked
+	// before making any changes, rather than locking it.
+	noLock := parsedArgs["--no-lock"].(bool)
+	if noLock {
+		locked, err := checkLocked(ctx, client)
+		if err != nil {
+			return fmt.Errorf("Error while checking if datastore was locked: %s", err)
+		} else if !locked {
+			return fmt.Errorf("Datastore is not locked. Lock it with \"calicoctl datastore migrate lock\", or import without --no-lock")
+		}
+	}
+
+	fmt.Printf("Import run ID: %s. Use --run-id=%s to resume this import.\n", marker.RunID, marker.RunID)
+	start := time.Now()
+	crdSummary, err := importCRDs(cfg, false, fieldManager, marker)
+	timings.record("CRD apply", start)
+	fmt.Println(crdSummary)
 	if err != nil {
-		return fmt.Errorf("Error applying the CRDs necessary to begin datastore import: %s", err)
+		if err := phaseFailed(fmt.Errorf("Error applying the CRDs necessary to begin datastore import: %s", err)); err != nil {
+			return err
+		}
+	}
+	if err := checkInterrupted("CRD apply"); err != nil {
+		return err
 	}
 
-	err = checkCalicoResourcesNotExist(parsedArgs, client)
+	start = time.Now()
+	err = checkCalicoResourcesNotExist(ctx, client, ipamClient, checkKinds)
+	timings.record("Pre-existence check", start)
 	if err != nil {
-		// TODO: Add something like 'calicoctl datastore migrate clean' to delete all the CRDs to wipe out the Calico resources.
-		return fmt.Errorf("Datastore already has Calico resources: %s. Clear out all Calico resources by deleting all Calico CRDs.", err)
+		if len(checkKinds) == 1 && checkKinds[0] == ipamKind {
+			// Deleting the CRDs would also delete the v3 resources, which an IPAM only
+			// import leaves in place.
+			err = fmt.Errorf("Datastore already has IPAM resources: %s. Clear out only the IPAM blocks, block affinities and IPAM handles, without deleting the Calico CRDs or other Calico resources.", err)
+		} else {
+			err = fmt.Errorf("Datastore already has Calico resources: %s. Clear out all Calico resources by deleting all Calico CRDs, for example using \"calicoctl migrate clean\".", err)
+		}
+		if err := phaseFailed(err); err != nil {
+			return err
+		}
+	}
+	if err := checkInterrupted("Pre-existence check"); err != nil {
+		return err
 	}
 
 	// Ensure that the cluster info resource is initialized.
-	ctx := context.Background()
 	if err := client.EnsureInitialized(ctx, "", ""); err != nil {
 		return fmt.Errorf("Unable to initialize cluster information for the datastore migration: %s", err)
 	}
 
 	// Make sure that the datastore is locked. Since the call to EnsureInitialized
 	// should initialize it to unlocked, lock it before we continue.
-	locked, err := checkLocked(ctx, client)
-	if err != nil {
-		return fmt.Errorf("Error while checking if datastore was locked: %s", err)
-	} else if !locked {
-		err := Lock([]string{"datastore", "migrate", "lock", "-c", cf})
+	if !noLock {
+		locked, err := checkLocked(ctx, client)
 		if err != nil {
-			return fmt.Errorf("Error while attempting to lock the datastore for import: %s", err)
+			return fmt.Errorf("Error while checking if datastore was locked: %s", err)
+		} else if !locked {
+			err := Lock([]string{"datastore", "migrate", "lock", "-c", cf})
+			if err != nil {
+				return fmt.Errorf("Error while attempting to lock the datastore for import: %s", err)
+			}
 		}
 	}
+	if err := checkInterrupted("Datastore lock"); err != nil {
+		return err
+	}
 
-	// Split file into v3 API, ClusterGUID, and IPAM components
-	filename := parsedArgs["--filename"].(string)
-	v3Yaml, clusterInfoJson, ipamJson, err := splitImportFile(filename)
+	if ipamOnly {
+		if len(phaseErrs) > 0 {
+			return importFailed(phaseErrs)
+		}
+		if err := importIPAM(ctx, client, ipamClient, ipamJson, force, showProgress, timings); err != nil {
+			return err
+		}
+		if summaryFile != "" {
+			if err := writeImportSummary(ctx, client, summaryFile, label, crdSummary, []KindSummary{}, targets, summaryTimings()); err != nil {
+				return fmt.Errorf("Error writing import summary: %s", err)
+			}
+		}
+		fmt.Println(common.WithClusterLabel(label, "IPAM information successfully imported. Please refer to the datastore migration documentation for next steps."))
+		return nil
+	}
+
+	v3Yaml, err = TransformV3Resources(v3Yaml, transforms...)
+	if err == nil {
+		v3Yaml, err = OrderV3Resources(v3Yaml, applyOrder)
+	}
 	if err != nil {
-		return fmt.Errorf("Error while reading migration file: %s\n", err)
+		return fmt.Errorf("Error while preparing v3 resources for import: %s\n", err)
 	}
 
-	// Apply v3 API resources
-	err = updateV3Resources(cfg, v3Yaml)
+	// Check the global configuration before applying it, since misnamed configuration is
+	// accepted by the datastore but ignored by the components.
+	missingConfig, err := CheckGlobalConfig(v3Yaml)
 	if err != nil {
-		return fmt.Errorf("Failed to import v3 resources: %s\n", err)
+		return err
+	}
+	for _, kind := range missingConfig {
+		fmt.Printf("[WARNING] The export has no default %s. The target keeps its own default configuration.\n", kind)
 	}
 
-	// Update the clusterinfo resource with the data from the old datastore.
-	err = updateClusterInfo(ctx, client, clusterInfoJson)
+	// Apply v3 API resources
+	start = time.Now()
+	kinds, err := updateV3Resources(cfg, v3Yaml, parsedArgs["--server-side"].(bool), parsedArgs["--strict"].(bool),
+		parsedArgs["--save-config"].(bool))
+	timings.record("v3 resource apply", start)
 	if err != nil {
-		return fmt.Errorf("Failed to update cluster information: %s", err)
+		if err := phaseFailed(fmt.Errorf("Failed to import v3 resources: %s", err)); err != nil {
+			return err
+		}
+	} else {
+		printKindSummary(os.Stdout, kinds)
+
+		discrepancies, err := verifyGlobalConfig(ctx, client, v3Yaml)
+		if err == nil && len(discrepancies) > 0 {
+			msgs := make([]string, len(discrepancies))
+			for i, d := range discrepancies {
+				msgs[i] = "  " + d.String()
+			}
+			err = fmt.Errorf("Global configuration was not imported correctly:\n%s", strings.Join(msgs, "\n"))
+		}
+		if err != nil {
+			if err := phaseFailed(err); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkInterrupted("v3 resource apply"); err != nil {
+		return err
+	}
+
+	// Update the clusterinfo resource with the data from the old datastore, unless
+	// the target's identity is to be preserved.
+	if parsedArgs["--preserve-cluster-info"].(bool) {
+		fmt.Print("Preserving existing cluster information\n")
+	} else {
+		start = time.Now()
+		err = updateClusterInfo(ctx, client, clusterInfoJson)
+		timings.record("Cluster info update", start)
+		if err != nil {
+			if err := phaseFailed(fmt.Errorf("Failed to update cluster information: %s", err)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkInterrupted("Cluster info update"); err != nil {
+		return err
+	}
+
+	// Import IPAM components, unless an earlier phase failed.
+	if len(phaseErrs) > 0 {
+		fmt.Println("Skipping the IPAM import, since an earlier phase failed")
+		return importFailed(phaseErrs)
+	}
+	if err := importIPAM(ctx, client, ipamClient, ipamJson, force, showProgress, timings); err != nil {
+		return err
+	}
+
+	if summaryFile != "" {
+		if err := writeImportSummary(ctx, client, summaryFile, label, crdSummary, kinds, targets, summaryTimings()); err != nil {
+			return fmt.Errorf("Error writing import summary: %s", err)
+		}
 	}
 
-	// Import IPAM components
+	fmt.Println(common.WithClusterLabel(label, "Datastore information successfully imported. Please refer to the datastore migration documentation for next steps."))
+
+	return nil
+}
+
+// importFailed returns an error combining the errors from the phases of the import that
+// failed when --continue-on-error is set.
+func importFailed(errs []error) error {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = "  " + strings.TrimSpace(err.Error())
+	}
+	return fmt.Errorf("Import failed; %d phase(s) had errors:\n%s", len(errs), strings.Join(msgs, "\n"))
+}
+
+// importIPAM imports the IPAM data from the exported IPAM JSON into the IPAM datastore.
+// The IPAM blocks must all fall within the IP pools in the datastore that the v3 resources
+// were imported into, unless force is set.
+func importIPAM(ctx context.Context, c, ipamClient client.Interface, ipamJson []byte, force, showProgress bool, timings *phaseTimings) error {
 	fmt.Print("Importing IPAM resources\n")
-	ipam := NewMigrateIPAM(client)
-	err = json.Unmarshal(ipamJson, ipam)
+	ipam := NewMigrateIPAM(ipamClient)
+	err := json.Unmarshal(ipamJson, ipam)
 	if err != nil {
 		return fmt.Errorf("Failed to read IPAM resources: %s\n", err)
 	}
-	results := ipam.PushToDatastore()
+
+	poolList, err := c.IPPools().List(ctx, options.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to list IP pools: %s", err)
+	}
+	var pools []cnet.IPNet
+	for _, p := range poolList.Items {
+		_, cidr, err := cnet.ParseCIDR(p.Spec.CIDR)
+		if err != nil {
+			return fmt.Errorf("Failed to parse the CIDR of IP pool %s: %s", p.Name, err)
+		}
+		pools = append(pools, *cidr)
+	}
+	if outside := ipam.BlocksOutsidePools(pools); len(outside) > 0 {
+		for _, cidr := range outside {
+			fmt.Printf("IPAM block %s is not within any IP pool\n", cidr)
+		}
+		if !force {
+			return fmt.Errorf("%d IPAM block(s) are not within any IP pool. Import the IP pools that contain them, or use --force to import the IPAM data anyway", len(outside))
+		}
+		fmt.Printf("Warning: importing %d IPAM block(s) that are not within any IP pool\n", len(outside))
+	}
+	start := time.Now()
+	progress := common.NewProgress("Importing IPAM resources", ipam.numResources(), showProgress)
+	results := ipam.PushToDatastore(progress)
+	timings.record("IPAM push", start)
 
 	// Handle the IPAM results
 	if results.numHandled == 0 {
@@ -171,26 +786,18 @@ Description:
 		return fmt.Errorf("Hit error(s): %v", results.resErrs)
 	}
 
-	fmt.Print("Datastore information successfully imported. Please refer to the datastore migration documentation for next steps.\n")
-
 	return nil
 }
 
 func splitImportFile(filename string) ([]byte, []byte, []byte, error) {
-	// Get the appropriate file to read from
-	fname := filename
-	if filename == "-" {
-		fname = os.Stdin.Name()
-	}
-
-	b, err := ioutil.ReadFile(fname)
+	b, err := readImportFile(filename)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
 	split := bytes.Split(b, []byte("===\n"))
 	if len(split) != 3 {
-		return nil, nil, nil, fmt.Errorf("Imported file: %s is improperly formatted. Try recreating with 'calicoctl export'", fname)
+		return nil, nil, nil, fmt.Errorf("Imported file: %s is improperly formatted. Try recreating with 'calicoctl export'", importFileName(filename))
 	}
 
 	// First chunk should be the v3 resource YAML.
@@ -199,67 +806,157 @@ func splitImportFile(filename string) ([]byte, []byte, []byte, error) {
 	return split[0], split[1], split[2], nil
 }
 
-func checkCalicoResourcesNotExist(args map[string]interface{}, c client.Interface) error {
-	// Loop through all the v3 resources to see if anything is returned
-	extendedV3Resources := append(allV3Resources, "clusterinfo")
-	for _, r := range extendedV3Resources {
-		// Skip nodes since they are backed by the Kubernetes node resource
-		if r == "nodes" {
-			continue
-		}
+// ValidateImportFile checks the structure of each section of the import file: the v3
+// resources must be YAML documents that each have a kind, the cluster information must
+// unmarshal into a ClusterInformation, and the IPAM data must unmarshal into the IPAM
+// resources. Only the IPAM section is checked for an IPAM only import. The error names
+// the invalid section and the line of the file where the problem was found.
+func ValidateImportFile(v3Yaml, clusterInfoJson, ipamJson []byte, ipamOnly bool) error {
+	if ipamOnly {
+		return validateIPAMSection(ipamJson, 1)
+	}
 
-		// Create mocked args in order to retrieve Get resources.
-		mockArgs := map[string]interface{}{
-			"<KIND>":   r,
-			"<NAME>":   []string{},
-			"--config": args["--config"].(string),
-			"--export": false,
-			"--output": "ps",
-			"get":      true,
-		}
+	// The sections are separated by a "===" line.
+	clusterInfoLine := 1 + bytes.Count(v3Yaml, []byte("\n")) + 1
+	ipamLine := clusterInfoLine + bytes.Count(clusterInfoJson, []byte("\n")) + 1
 
-		if _, ok := namespacedResources[r]; ok {
-			mockArgs["--all-namespaces"] = true
+	// Each document of the v3 resources is followed by a "---" line.
+	separator := yamlsep.NewYAMLDocumentSeparator(bytes.NewReader(v3Yaml))
+	line := 1
+	for doc := 1; ; doc++ {
+		b, err := separator.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("the v3 resources section could not be read at document %d (line %d): %s", doc, line, err)
 		}
+		var fields map[string]interface{}
+		if err := yaml.Unmarshal(b, &fields); err != nil {
+			return fmt.Errorf("the v3 resources section is not valid YAML at document %d (line %d): %s", doc, line, err)
+		}
+		if len(fields) > 0 && fields["kind"] == nil {
+			return fmt.Errorf("the v3 resources section has a document with no kind at document %d (line %d)", doc, line)
+		}
+		line += bytes.Count(b, []byte("\n")) + 2
+	}
 
-		// Get resources
-		results := common.ExecuteConfigCommand(mockArgs, common.ActionGetOrList)
+	clusterInfo := apiv3.ClusterInformation{}
+	if err := json.Unmarshal(clusterInfoJson, &clusterInfo); err != nil {
+		return fmt.Errorf("the cluster information section is not a valid ClusterInformation (line %d): %s",
+			jsonErrorLine(clusterInfoJson, err, clusterInfoLine), err)
+	}
+	return validateIPAMSection(ipamJson, ipamLine)
+}
 
-		// Loop through the result lists and see if anything exists
-		for _, resource := range results.Resources {
-			if meta.LenList(resource) > 0 {
-				if r == "networkpolicies" {
-					// For networkpolicies, having K8s network policies should not throw an error
-					objs, err := meta.ExtractList(resource)
-					if err != nil {
-						return fmt.Errorf("Error extracting network policies for inspection: %s", err)
-					}
+// validateIPAMSection checks that the IPAM section, starting at the given line of the
+// file, unmarshals into the IPAM resources.
+func validateIPAMSection(ipamJson []byte, startLine int) error {
+	if err := json.Unmarshal(ipamJson, &migrateIPAM{}); err != nil {
+		return fmt.Errorf("the IPAM section is not valid IPAM data (line %d): %s",
+			jsonErrorLine(ipamJson, err, startLine), err)
+	}
+	return nil
+}
 
-					for _, obj := range objs {
-						metaObj, ok := obj.(v1.ObjectMetaAccessor)
-						if !ok {
-							return fmt.Errorf("Unable to convert Calico network policy for inspection")
-						}
+// jsonErrorLine returns the line of the file where the JSON unmarshal error occurred,
+// given the line that the JSON starts at. The start line is returned if the error does
+// not record where it occurred.
+func jsonErrorLine(data []byte, err error, startLine int) int {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return startLine
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return startLine + bytes.Count(data[:offset], []byte("\n"))
+}
 
-						// Make sure that the network policy is a K8s network policy
-						if !strings.HasPrefix(metaObj.GetObjectMeta().GetName(), conversion.K8sNetworkPolicyNamePrefix) {
-							return fmt.Errorf("Found existing Calico %s resource", results.SingleKind)
-						}
-					}
-				} else {
-					return fmt.Errorf("Found existing Calico %s resource", results.SingleKind)
-				}
-			}
+// readImportFile reads the file to import, or stdin if the filename is "-".
+func readImportFile(filename string) ([]byte, error) {
+	return ioutil.ReadFile(importFileName(filename))
+}
 
-			if results.FileInvalid {
-				return fmt.Errorf("Failed to execute command: %v", results.Err)
-			} else if results.Err != nil {
-				return fmt.Errorf("Failed to retrieve %s resources during datastore check: %v", resourceDisplayMap[r], results.Err)
+// importFileName returns the name of the file to read from.
+func importFileName(filename string) string {
+	if filename == "-" {
+		return os.Stdin.Name()
+	}
+	return filename
+}
+
+// preCheckKinds returns the kinds of resource to check for before importing. These are
+// the given kinds if any, or otherwise just IPAM for an IPAM only import, or every kind.
+// Nodes are never checked since they are backed by the Kubernetes node resource.
+func preCheckKinds(onlyKinds []string, ipamOnly bool) ([]string, error) {
+	valid := []string{ipamKind, "clusterinfos"}
+	for _, r := range allV3Resources {
+		if r != "nodes" {
+			valid = append(valid, r)
+		}
+	}
+
+	if len(onlyKinds) == 0 {
+		if ipamOnly {
+			return []string{ipamKind}, nil
+		}
+		return valid, nil
+	}
+
+	var kinds []string
+	for _, k := range onlyKinds {
+		k = strings.ToLower(k)
+		found := false
+		for _, v := range valid {
+			if strings.ToLower(v) == k {
+				kinds = append(kinds, v)
+				found = true
+				break
 			}
 		}
+		if !found {
+			return nil, fmt.Errorf("Invalid kind '%s', expected one of: %s", k, strings.Join(valid, ", "))
+		}
+	}
+	return kinds, nil
+}
+
+// checkCalicoResourcesNotExist checks that there are no existing resources of the given
+// kinds. The IPAM resources are checked in the IPAM datastore if the kinds include "ipam".
+func checkCalicoResourcesNotExist(ctx context.Context, c, ipamClient client.Interface, kinds []string) error {
+	var v3Kinds []string
+	checkIPAM := false
+	for _, k := range kinds {
+		if k == ipamKind {
+			checkIPAM = true
+		} else {
+			v3Kinds = append(v3Kinds, k)
+		}
+	}
+
+	counts, err := countCalicoResources(ctx, c, v3Kinds)
+	if err != nil {
+		return err
+	}
+	for _, r := range v3Kinds {
+		if counts[r] > 0 {
+			return fmt.Errorf("Found %d existing Calico %s resource(s)", counts[r], resourceDisplayMap[r])
+		}
 	}
 
-	// Check if any IPAM resources exist
+	if checkIPAM {
+		return checkIPAMNotExist(ipamClient)
+	}
+	return nil
+}
+
+// checkIPAMNotExist checks that there are no existing IPAM resources.
+func checkIPAMNotExist(c client.Interface) error {
 	ipam := NewMigrateIPAM(c)
 	err := ipam.PullFromDatastore()
 	if err != nil {
@@ -273,6 +970,46 @@ func checkCalicoResourcesNotExist(args map[string]interface{}, c client.Interfac
 	return nil
 }
 
+// countCalicoResources returns the number of existing resources of each of the given
+// kinds across all namespaces, keyed by kind. Kubernetes network policies are not
+// counted since they are managed through the Kubernetes API rather than by Calico.
+func countCalicoResources(ctx context.Context, c client.Interface, kinds []string) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, r := range kinds {
+		rh, err := resourcemgr.GetResourceHelper(r)
+		if err != nil {
+			return nil, err
+		}
+
+		list, err := rh.List(ctx, c, "")
+		if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve %s resources during datastore check: %v", resourceDisplayMap[r], err)
+		}
+
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, fmt.Errorf("Error extracting %s resources for inspection: %s", resourceDisplayMap[r], err)
+		}
+
+		for _, obj := range objs {
+			if r == "networkpolicies" {
+				metaObj, ok := obj.(v1.ObjectMetaAccessor)
+				if !ok {
+					return nil, fmt.Errorf("Unable to convert Calico network policy for inspection")
+				}
+
+				// Having K8s network policies should not count as existing Calico resources.
+				if strings.HasPrefix(metaObj.GetObjectMeta().GetName(), conversion.K8sNetworkPolicyNamePrefix) {
+					continue
+				}
+			}
+			counts[r]++
+		}
+	}
+
+	return counts, nil
+}
+
 func updateClusterInfo(ctx context.Context, c client.Interface, clusterInfoJson []byte) error {
 	// Unmarshal the etcd cluster info resource.
 	migrated := apiv3.ClusterInformation{}
@@ -298,105 +1035,169 @@ func updateClusterInfo(ctx context.Context, c client.Interface, clusterInfoJson
 	return nil
 }
 
-func updateV3Resources(cfg *apiconfig.CalicoAPIConfig, data []byte) error {
+func updateV3Resources(cfg *apiconfig.CalicoAPIConfig, data []byte, serverSide, strict, saveConfig bool) ([]KindSummary, error) {
 	// Create tempfile so the v3 resources can be created using Apply
 	tempfile, err := ioutil.TempFile("", "v3migration")
 	if err != nil {
-		return fmt.Errorf("Error while creating temporary v3 migration file: %s\n", err)
+		return nil, fmt.Errorf("Error while creating temporary v3 migration file: %s\n", err)
 	}
 	defer os.Remove(tempfile.Name())
 
 	if _, err := tempfile.Write(data); err != nil {
-		return fmt.Errorf("Error while writing to temporary v3 migration file: %s\n", err)
+		return nil, fmt.Errorf("Error while writing to temporary v3 migration file: %s\n", err)
 	}
 
 	// Create a tempfile for the config so QPS will be overwritten
 	tempConfigFile, err := ioutil.TempFile("", "qpsconfig")
 	if err != nil {
-		return fmt.Errorf("Error while creating temporary v3 migration config file: %s\n", err)
+		return nil, fmt.Errorf("Error while creating temporary v3 migration config file: %s\n", err)
 	}
 	defer os.Remove(tempConfigFile.Name())
 
 	cfgData, err := yaml.Marshal(cfg)
 	if err != nil {
-		return fmt.Errorf("Error while serializing temporary v3 migration config file: %s\n", err)
+		return nil, fmt.Errorf("Error while serializing temporary v3 migration config file: %s\n", err)
 	}
 
 	if _, err := tempConfigFile.Write(cfgData); err != nil {
-		return fmt.Errorf("Error while writing to temporary v3 migration config file: %s\n", err)
+		return nil, fmt.Errorf("Error while writing to temporary v3 migration config file: %s\n", err)
 	}
 
 	mockArgs := map[string]interface{}{
-		"--config":   tempConfigFile.Name(),
-		"--filename": tempfile.Name(),
-		"apply":      true,
+		"--config":      tempConfigFile.Name(),
+		"--filename":    tempfile.Name(),
+		"--server-side": serverSide,
+		"--strict":      strict,
+		"--save-config": saveConfig,
+		"apply":         true,
 	}
-	err = applyV3(mockArgs)
+	kinds, err := applyV3(mockArgs)
 	if err != nil {
-		return fmt.Errorf("Failed to import v3 resources: %s\n", err)
+		return nil, fmt.Errorf("Failed to import v3 resources: %s\n", err)
 	}
 
-	return nil
+	return kinds, nil
+}
+
+// importCRDs applies the Calico CRDs, returning the number created, updated and skipped
+// because they were already up to date, and the error applying each CRD that failed. If
+// dryRun is set, the CRDs are submitted to the API server as a server-side dry run, so
+// that they are validated but not persisted. The CRDs are applied with the field manager,
+// and annotated with the marker.
+func importCRDs(cfg *apiconfig.CalicoAPIConfig, dryRun bool, fieldManager string, marker crdImportMarker) (CRDSummary, error) {
+	summary := CRDSummary{}
+	cs, err := newCRDClientset(cfg)
+	if err != nil {
+		return summary, err
+	}
+
+	// Apply the CRDs
+	calicoCRDs, err := crds.CalicoCRDs()
+	if err != nil {
+		return summary, err
+	}
+	summary.Total = len(calicoCRDs)
+
+	// Apply each CRD, retrying a few times to ride out transient errors. Continue past
+	// failures so that we can report every CRD that could not be applied.
+	for _, crd := range calicoCRDs {
+		var result crdResult
+		for i := 0; i < crdApplyAttempts; i++ {
+			if i > 0 {
+				log.Infof("Error applying CRD %s: %s. Retrying.", crd.GetObjectMeta().GetName(), err)
+				time.Sleep(1 * time.Second)
+			}
+			if result, err = applyCRD(cs, crd, dryRun, fieldManager, marker); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			summary.Errors = append(summary.Errors, err.Error())
+			continue
+		}
+		summary.record(result)
+		log.Debugf("Applied %s CRD: %s", crd.GetObjectMeta().GetName(), result)
+	}
+
+	if len(summary.Errors) > 0 {
+		return summary, fmt.Errorf("Failed to apply %d out of %d CRDs:\n%s", len(summary.Errors), len(calicoCRDs), strings.Join(summary.Errors, "\n"))
+	}
+
+	return summary, nil
 }
 
-func importCRDs(cfg *apiconfig.CalicoAPIConfig) error {
+// newCRDClientset returns an apiextensions clientset for managing the Calico CRDs in the
+// Kubernetes datastore.
+func newCRDClientset(cfg *apiconfig.CalicoAPIConfig) (clientset.Interface, error) {
 	// Start a kube client
 	// Create the correct config for the clientset
 	config, _, err := k8s.CreateKubernetesClientset(&cfg.Spec)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create the apiextensions clientset
 	cs, err := clientset.NewForConfig(config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Debugf("Created k8s CRD ClientSet: %+v", cs)
+	return cs, nil
+}
 
-	// Apply the CRDs
-	calicoCRDs, err := crds.CalicoCRDs()
-	if err != nil {
-		return err
+// applyCRD creates the CRD, or updates it if it already exists and differs. If dryRun is
+// set, the request is a server-side dry run and the CRD is not changed. The field manager
+// is recorded as the owner of the fields that are set. The CRD is annotated with the
+// marker, and is skipped if it already has the marker.
+func applyCRD(cs clientset.Interface, crd *apiextensionsv1.CustomResourceDefinition, dryRun bool, fieldManager string, marker crdImportMarker) (crdResult, error) {
+	var dryRunOpts []string
+	if dryRun {
+		dryRunOpts = []string{v1.DryRunAll}
+	}
+	marker.mark(crd)
+	_, err := cs.ApiextensionsV1().CustomResourceDefinitions().Create(context.Background(), crd, v1.CreateOptions{DryRun: dryRunOpts, FieldManager: fieldManager})
+	if err == nil {
+		return crdCreated, nil
+	}
+	if !kerrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("Error creating CRD %s: %s", crd.GetObjectMeta().GetName(), err)
 	}
 
-	for _, crd := range calicoCRDs {
-		_, err := cs.ApiextensionsV1().CustomResourceDefinitions().Create(context.Background(), crd, v1.CreateOptions{})
-		if err != nil {
-			if kerrors.IsAlreadyExists(err) {
-				// If the CRD already exists attempt to update it.
-				// Need to retrieve the current CRD first.
-				currentCRD, err := cs.ApiextensionsV1().CustomResourceDefinitions().Get(context.Background(), crd.GetObjectMeta().GetName(), v1.GetOptions{})
-				if err != nil {
-					return fmt.Errorf("Error retrieving existing CRD to update: %s: %s", crd.GetObjectMeta().GetName(), err)
-				}
+	// If the CRD already exists attempt to update it.
+	// Need to retrieve the current CRD first.
+	currentCRD, err := cs.ApiextensionsV1().CustomResourceDefinitions().Get(context.Background(), crd.GetObjectMeta().GetName(), v1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving existing CRD to update: %s: %s", crd.GetObjectMeta().GetName(), err)
+	}
+	if marker.marked(currentCRD) {
+		return crdResumed, nil
+	}
+	if equality.Semantic.DeepEqual(currentCRD.Spec, crd.Spec) {
+		return crdSkipped, nil
+	}
 
-				// Use the resource version so that the current CRD can be overwritten.
-				crd.GetObjectMeta().SetResourceVersion(currentCRD.GetObjectMeta().GetResourceVersion())
+	// Use the resource version so that the current CRD can be overwritten.
+	crd.GetObjectMeta().SetResourceVersion(currentCRD.GetObjectMeta().GetResourceVersion())
 
-				// Update the CRD.
-				_, err = cs.ApiextensionsV1().CustomResourceDefinitions().Update(context.Background(), crd, v1.UpdateOptions{})
-				if err != nil {
-					return fmt.Errorf("Error updating CRD %s: %s", crd.GetObjectMeta().GetName(), err)
-				}
-			} else {
-				return fmt.Errorf("Error creating CRD %s: %s", crd.GetObjectMeta().GetName(), err)
-			}
-		}
-		log.Debugf("Applied %s CRD", crd.GetObjectMeta().GetName())
+	// Update the CRD.
+	_, err = cs.ApiextensionsV1().CustomResourceDefinitions().Update(context.Background(), crd, v1.UpdateOptions{DryRun: dryRunOpts, FieldManager: fieldManager})
+	if err != nil {
+		return "", fmt.Errorf("Error updating CRD %s: %s", crd.GetObjectMeta().GetName(), err)
 	}
-
-	return nil
+	return crdUpdated, nil
 }
 
-func applyV3(args map[string]interface{}) error {
+// applyV3 applies the v3 resources, returning the number of resources of each kind in
+// the file and the number that were applied.
+func applyV3(args map[string]interface{}) ([]KindSummary, error) {
 	results := common.ExecuteConfigCommand(args, common.ActionApply)
 	log.Infof("results: %+v", results)
+	kinds := SummarizeKinds(results.NumResourcesByKind, results.NumHandledByKind)
 
 	if results.FileInvalid {
-		return fmt.Errorf("Failed to execute command: %v", results.Err)
+		return nil, fmt.Errorf("Failed to execute command: %v", results.Err)
 	} else if results.NumHandled == 0 {
-		return fmt.Errorf("Failed to apply any resources: %v", results.ResErrs)
+		return nil, fmt.Errorf("Failed to apply any resources: %v", results.ResErrs)
 	} else if len(results.ResErrs) == 0 {
 		if results.SingleKind != "" {
 			fmt.Printf("Successfully applied %d '%s' resource(s)\n", results.NumHandled, results.SingleKind)
@@ -423,9 +1224,9 @@ func applyV3(args map[string]interface{}) error {
 		}
 
 		if len(errors) > 0 {
-			return fmt.Errorf("Hit error(s): %v", errors)
+			return nil, fmt.Errorf("Hit error(s): %v", errors)
 		}
 	}
 
-	return nil
+	return kinds, nil
 }
@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Import file validation", func() {
+	// The v3 section has 7 lines, so the cluster information starts at line 9 and the
+	// IPAM data at line 13.
+	v3 := []byte("kind: IPPool\nmetadata:\n  name: pool1\n---\nkind: Profile\nmetadata:\n  name: profile1\n")
+	clusterInfo := []byte("{\n  \"kind\": \"ClusterInformation\"\n}\n")
+	ipam := []byte("{\n  \"blocks\": []\n}\n")
+
+	It("should accept a valid file", func() {
+		Expect(migrate.ValidateImportFile(v3, clusterInfo, ipam, false)).To(Succeed())
+		Expect(migrate.ValidateImportFile(nil, nil, ipam, true)).To(Succeed())
+	})
+
+	It("should report a v3 resource with no kind", func() {
+		err := migrate.ValidateImportFile([]byte("kind: IPPool\n---\nmetadata:\n  name: p1\n"), clusterInfo, ipam, false)
+		Expect(err).To(MatchError(ContainSubstring("v3 resources section has a document with no kind at document 2 (line 3)")))
+	})
+
+	It("should report an invalid cluster information section", func() {
+		bad := []byte("{\n  \"spec\": {\n    \"clusterGUID\": 5\n  }\n}\n")
+		err := migrate.ValidateImportFile(v3, bad, ipam, false)
+		Expect(err).To(MatchError(ContainSubstring("cluster information section is not a valid ClusterInformation (line 11)")))
+	})
+
+	It("should report an invalid IPAM section", func() {
+		bad := []byte("{\n  \"blocks\": \"none\"\n}\n")
+		err := migrate.ValidateImportFile(v3, clusterInfo, bad, false)
+		Expect(err).To(MatchError(ContainSubstring("IPAM section is not valid IPAM data (line 14)")))
+
+		err = migrate.ValidateImportFile(nil, nil, []byte("{\n  \"blocks\": ["), true)
+		Expect(err).To(MatchError(ContainSubstring("IPAM section is not valid IPAM data")))
+	})
+})
@@ -0,0 +1,159 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
+	"github.com/projectcalico/libcalico-go/lib/apiconfig"
+	"github.com/projectcalico/libcalico-go/lib/options"
+)
+
+// DatastoreInfo describes the datastore that calicoctl is configured to use, as output by
+// the datastore info command.
+type DatastoreInfo struct {
+	DatastoreType         string   `json:"datastoreType"`
+	Endpoints             []string `json:"endpoints,omitempty"`
+	Kubeconfig            string   `json:"kubeconfig,omitempty"`
+	InsecureSkipTLSVerify bool     `json:"insecureSkipTLSVerify"`
+
+	// Whether the cluster information could be read from the datastore, and the error
+	// if it could not.
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+
+	ClusterGUID   string `json:"clusterGUID,omitempty"`
+	CalicoVersion string `json:"calicoVersion,omitempty"`
+}
+
+func GetDatastoreInfo(args []string) error {
+	doc := `Usage:
+  <BINARY_NAME> datastore info [--config=<CONFIG>] [--output=<OUTPUT>]
+
+Options:
+  -h --help                 Show this screen.
+  -o --output=<OUTPUT>      Output format.  One of: text, json.
+                            [default: text]
+  -c --config=<CONFIG>      Path to the file containing connection
+                            configuration in YAML or JSON format.
+                            [default: ` + constants.DefaultConfigPath + `]
+
+Description:
+  Show the datastore that <BINARY_NAME> is configured to use: the datastore
+  type, the endpoints, the kubeconfig file, and whether TLS verification of the
+  Kubernetes API server is skipped.  The configuration is loaded from the
+  config file, or from the environment if the default config file does not
+  exist.
+
+  If the datastore is reachable, the cluster GUID and Calico version are read
+  from the cluster information.  If it is not, the error is shown instead, and
+  the command still succeeds.  This command does not modify the datastore.
+`
+	// Replace all instances of BINARY_NAME with the name of the binary.
+	name, _ := util.NameAndDescription()
+	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+
+	parsedArgs, err := docopt.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if len(parsedArgs) == 0 {
+		return nil
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "text" && output != "json" {
+		return fmt.Errorf("Unrecognized output format '%s', expected one of: text, json", output)
+	}
+
+	cf := parsedArgs["--config"].(string)
+	cfg, err := clientmgr.LoadClientConfig(cf)
+	if err != nil {
+		return err
+	}
+	info := NewDatastoreInfo(cfg)
+
+	client, err := clientmgr.NewClientFromConfig(cfg)
+	if err == nil {
+		clusterinfo, err := client.ClusterInformation().Get(context.Background(), "default", options.GetOptions{})
+		if err == nil {
+			info.Reachable = true
+			info.ClusterGUID = clusterinfo.Spec.ClusterGUID
+			info.CalicoVersion = clusterinfo.Spec.CalicoVersion
+		} else {
+			info.Error = fmt.Sprintf("Error retrieving ClusterInformation: %s", err)
+		}
+	} else {
+		info.Error = err.Error()
+	}
+
+	if output == "json" {
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Printf("Datastore type: %s\n", info.DatastoreType)
+	if len(info.Endpoints) > 0 {
+		fmt.Printf("Endpoints: %s\n", strings.Join(info.Endpoints, ", "))
+	}
+	if info.Kubeconfig != "" {
+		fmt.Printf("Kubeconfig: %s\n", info.Kubeconfig)
+	}
+	if info.DatastoreType == string(apiconfig.Kubernetes) {
+		fmt.Printf("Skip TLS verification: %t\n", info.InsecureSkipTLSVerify)
+	}
+	if !info.Reachable {
+		fmt.Printf("Datastore is not reachable: %s\n", info.Error)
+		return nil
+	}
+	fmt.Printf("Cluster GUID: %s\n", info.ClusterGUID)
+	fmt.Printf("Calico version: %s\n", info.CalicoVersion)
+	return nil
+}
+
+// NewDatastoreInfo returns the information about the datastore that is available from the
+// configuration, without connecting to the datastore.
+func NewDatastoreInfo(cfg *apiconfig.CalicoAPIConfig) DatastoreInfo {
+	info := DatastoreInfo{DatastoreType: string(cfg.Spec.DatastoreType)}
+	switch cfg.Spec.DatastoreType {
+	case apiconfig.EtcdV3:
+		if cfg.Spec.EtcdEndpoints != "" {
+			for _, e := range strings.Split(cfg.Spec.EtcdEndpoints, ",") {
+				info.Endpoints = append(info.Endpoints, strings.TrimSpace(e))
+			}
+		} else if cfg.Spec.EtcdDiscoverySrv != "" {
+			info.Endpoints = []string{"SRV " + cfg.Spec.EtcdDiscoverySrv}
+		}
+	case apiconfig.Kubernetes:
+		if cfg.Spec.K8sAPIEndpoint != "" {
+			info.Endpoints = []string{cfg.Spec.K8sAPIEndpoint}
+		}
+		info.Kubeconfig = cfg.Spec.Kubeconfig
+		info.InsecureSkipTLSVerify = cfg.Spec.K8sInsecureSkipTLSVerify
+	}
+	return info
+}
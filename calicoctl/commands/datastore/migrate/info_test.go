@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+	"github.com/projectcalico/libcalico-go/lib/apiconfig"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Datastore info", func() {
+	It("Should describe an etcd datastore", func() {
+		cfg := apiconfig.NewCalicoAPIConfig()
+		cfg.Spec.DatastoreType = apiconfig.EtcdV3
+		cfg.Spec.EtcdEndpoints = "https://10.0.0.1:2379, https://10.0.0.2:2379"
+
+		Expect(migrate.NewDatastoreInfo(cfg)).To(Equal(migrate.DatastoreInfo{
+			DatastoreType: "etcdv3",
+			Endpoints:     []string{"https://10.0.0.1:2379", "https://10.0.0.2:2379"},
+		}))
+	})
+
+	It("Should describe a Kubernetes datastore", func() {
+		cfg := apiconfig.NewCalicoAPIConfig()
+		cfg.Spec.DatastoreType = apiconfig.Kubernetes
+		cfg.Spec.Kubeconfig = "/home/user/.kube/config"
+		cfg.Spec.K8sAPIEndpoint = "https://10.0.0.1:6443"
+		cfg.Spec.K8sInsecureSkipTLSVerify = true
+
+		Expect(migrate.NewDatastoreInfo(cfg)).To(Equal(migrate.DatastoreInfo{
+			DatastoreType:         "kubernetes",
+			Endpoints:             []string{"https://10.0.0.1:6443"},
+			Kubeconfig:            "/home/user/.kube/config",
+			InsecureSkipTLSVerify: true,
+		}))
+	})
+})
@@ -23,14 +23,14 @@ import (
 
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
-	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
 	"github.com/projectcalico/libcalico-go/lib/clientv3"
 	"github.com/projectcalico/libcalico-go/lib/options"
 )
 
 func Lock(args []string) error {
 	doc := `Usage:
-  <BINARY_NAME> datastore migrate lock [--config=<CONFIG>]
+  <BINARY_NAME> <MIGRATE> lock [--config=<CONFIG>]
 
 Options:
   -h --help                 Show this screen.
@@ -43,9 +43,8 @@ Description:
   Calico resources from affecting the cluster but does not prevent updating
   or creating new Calico resources.
 `
-	// Replace all instances of BINARY_NAME with the name of the binary.
-	name, _ := util.NameAndDescription()
-	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+	// Replace the BINARY_NAME and MIGRATE placeholders.
+	doc = usage(doc, args)
 
 	parsedArgs, err := docopt.ParseArgs(doc, args, "")
 	if err != nil {
@@ -94,5 +93,11 @@ func checkLocked(ctx context.Context, c clientv3.Interface) (bool, error) {
 		return false, fmt.Errorf("Error retrieving ClusterInformation: %s", err)
 	}
 
-	return !*clusterinfo.Spec.DatastoreReady, nil
+	return isLocked(clusterinfo), nil
+}
+
+// isLocked returns true if the cluster information shows that the datastore is locked. A
+// datastore which has not been marked as ready or not is unlocked.
+func isLocked(clusterinfo *apiv3.ClusterInformation) bool {
+	return clusterinfo.Spec.DatastoreReady != nil && !*clusterinfo.Spec.DatastoreReady
 }
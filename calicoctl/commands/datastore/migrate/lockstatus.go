@@ -0,0 +1,106 @@
+// Copyright (c) 2020 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
+	"github.com/projectcalico/libcalico-go/lib/options"
+)
+
+// LockStatus is the lock state of the datastore, as output by the lock-status command.
+type LockStatus struct {
+	Locked              bool   `json:"locked"`
+	ClusterGUID         string `json:"clusterGUID"`
+	ClusterInfoRevision string `json:"clusterInformationRevision"`
+}
+
+func GetLockStatus(args []string) error {
+	doc := `Usage:
+  <BINARY_NAME> datastore lock-status [--config=<CONFIG>] [--output=<OUTPUT>]
+
+Options:
+  -h --help                 Show this screen.
+  -o --output=<OUTPUT>      Output format.  One of: text, json.
+                            [default: text]
+  -c --config=<CONFIG>      Path to the file containing connection
+                            configuration in YAML or JSON format.
+                            [default: ` + constants.DefaultConfigPath + `]
+
+Description:
+  Show whether the datastore is locked, along with the cluster GUID and the
+  revision of the cluster information.  The datastore is locked by
+  "<BINARY_NAME> datastore migrate lock" and during a datastore import.  This
+  command does not modify the datastore.
+`
+	// Replace all instances of BINARY_NAME with the name of the binary.
+	name, _ := util.NameAndDescription()
+	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+
+	parsedArgs, err := docopt.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if len(parsedArgs) == 0 {
+		return nil
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "text" && output != "json" {
+		return fmt.Errorf("Unrecognized output format '%s', expected one of: text, json", output)
+	}
+
+	cf := parsedArgs["--config"].(string)
+	client, err := clientmgr.NewClient(cf)
+	if err != nil {
+		return err
+	}
+
+	clusterinfo, err := client.ClusterInformation().Get(context.Background(), "default", options.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Error retrieving ClusterInformation: %s", err)
+	}
+	status := LockStatus{
+		Locked:              isLocked(clusterinfo),
+		ClusterGUID:         clusterinfo.Spec.ClusterGUID,
+		ClusterInfoRevision: clusterinfo.ResourceVersion,
+	}
+
+	if output == "json" {
+		b, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	if status.Locked {
+		fmt.Println("Datastore is locked.")
+	} else {
+		fmt.Println("Datastore is not locked.")
+	}
+	fmt.Printf("Cluster GUID: %s\n", status.ClusterGUID)
+	fmt.Printf("Cluster information revision: %s\n", status.ClusterInfoRevision)
+	return nil
+}
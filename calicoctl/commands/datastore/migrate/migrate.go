@@ -0,0 +1,128 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
+	"github.com/projectcalico/libcalico-go/lib/apiconfig"
+)
+
+// Migrate function is a switch to migrate related sub-commands. The sub-commands may be
+// run as "migrate <command>" or, for backwards compatibility, as
+// "datastore migrate <command>". The version of calicoctl is recorded on the CRDs applied
+// by import.
+func Migrate(args []string, version string) error {
+	var err error
+	doc := constants.DatastoreIntro + `Usage:
+  <BINARY_NAME> <MIGRATE> <command> [<args>...]
+
+    export  Export the contents of the etcdv3 datastore to yaml.
+    import  Store and convert yaml of resources into the Kubernetes datastore.
+    lock    Lock the datastore to prevent changes from occurring during datastore migration.
+    unlock  Unlock the datastore to allow changes once the migration is completed.
+    clean   Delete all Calico resources from the Kubernetes datastore.
+    status  Show the lock state and contents of the datastore.
+    verify  Compare an export with the datastore it was imported into.
+
+Options:
+  -h --help      Show this screen.
+
+Description:
+  Migration specific commands.
+
+  See '<BINARY_NAME> <MIGRATE> <command> --help' to read about a specific subcommand.
+`
+	doc = usage(doc, args)
+
+	var parser = &docopt.Parser{
+		HelpHandler:   docopt.PrintHelpAndExit,
+		OptionsFirst:  true,
+		SkipHelpFlags: false,
+	}
+	arguments, err := parser.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if arguments["<command>"] == nil {
+		return nil
+	}
+
+	command := arguments["<command>"].(string)
+	args = append(append([]string{}, args[:migrateArgs(args)]...), command)
+	args = append(args, arguments["<args>"].([]string)...)
+
+	switch command {
+	case "export":
+		return Export(args)
+	case "import":
+		return Import(args, version)
+	case "lock":
+		return Lock(args)
+	case "unlock":
+		return Unlock(args)
+	case "clean":
+		return Clean(args)
+	case "status":
+		return Status(args)
+	case "verify":
+		return Verify(args)
+	default:
+		fmt.Println(doc)
+	}
+
+	return nil
+}
+
+// migrateArgs returns the number of leading arguments that make up the command used to
+// run the migrate sub-commands: 2 for "datastore migrate", and 1 for "migrate".
+func migrateArgs(args []string) int {
+	if len(args) > 1 && args[0] == "datastore" && args[1] == "migrate" {
+		return 2
+	}
+	return 1
+}
+
+// usage replaces the <BINARY_NAME> and <MIGRATE> placeholders in the doc string of a
+// migrate sub-command with the name of the binary and the command used to run the
+// migrate sub-commands, so that the usage matches however the sub-command was run.
+func usage(doc string, args []string) string {
+	name, _ := util.NameAndDescription()
+	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+	return strings.ReplaceAll(doc, "<MIGRATE>", strings.Join(args[:migrateArgs(args)], " "))
+}
+
+// loadConfig loads the client configuration from the config file, and checks that the
+// datastore is of the type required for the migration step. The step is used in the
+// error message, for example "export from".
+func loadConfig(cf string, datastoreType apiconfig.DatastoreType, step string) (*apiconfig.CalicoAPIConfig, error) {
+	cfg, err := clientmgr.LoadClientConfig(cf)
+	if err != nil {
+		log.Info("Error loading config")
+		return nil, err
+	}
+
+	if cfg.Spec.DatastoreType != datastoreType {
+		return nil, fmt.Errorf("Invalid datastore type: %s to %s for datastore migration. Datastore type must be %s", cfg.Spec.DatastoreType, step, datastoreType)
+	}
+	return cfg, nil
+}
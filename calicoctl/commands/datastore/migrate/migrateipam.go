@@ -26,6 +26,9 @@ import (
 	"github.com/projectcalico/libcalico-go/lib/backend/model"
 	client "github.com/projectcalico/libcalico-go/lib/clientv3"
 	"github.com/projectcalico/libcalico-go/lib/errors"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
 )
 
 var ipamHandlePrefixes []string = []string{"ipip-tunnel-addr-", "vxlan-tunnel-addr-", "wireguard-tunnel-addr-"}
@@ -86,6 +89,24 @@ func NewMigrateIPAM(c client.Interface) *migrateIPAM {
 	}
 }
 
+// The kinds of IPAM resource, in the order they are listed by the status command.
+var ipamResourceKinds = []string{"ipamBlocks", "blockaffinities", "ipamhandles", "ipamconfigs"}
+
+// ResourceCounts returns the number of each kind of IPAM resource, keyed by the display
+// name of the kind.
+func (m *migrateIPAM) ResourceCounts() map[string]int {
+	configs := 0
+	if m.IPAMConfig != nil {
+		configs = 1
+	}
+	return map[string]int{
+		resourceDisplayMap["ipamBlocks"]:      len(m.IPAMBlocks),
+		resourceDisplayMap["blockaffinities"]: len(m.BlockAffinities),
+		resourceDisplayMap["ipamhandles"]:     len(m.IPAMHandles),
+		resourceDisplayMap["ipamconfigs"]:     configs,
+	}
+}
+
 func (m *migrateIPAM) SetNodeMap(nodeMap map[string]string) {
 	m.nodeMap = nodeMap
 }
@@ -254,10 +275,40 @@ func (m *migrateIPAM) PullFromDatastore() error {
 	return nil
 }
 
-func (m *migrateIPAM) PushToDatastore() ipamResults {
+// BlocksOutsidePools returns the CIDRs of the IPAM blocks that do not fall within any of
+// the given IP pools.
+func (m *migrateIPAM) BlocksOutsidePools(pools []cnet.IPNet) []string {
+	var cidrs []string
+	for _, b := range m.IPAMBlocks {
+		if b.Value == nil {
+			continue
+		}
+		if !blockInPools(b.Value.CIDR, pools) {
+			cidrs = append(cidrs, b.Value.CIDR.String())
+		}
+	}
+	return cidrs
+}
+
+// blockInPools returns true if the block CIDR is contained by one of the pools.
+func blockInPools(block cnet.IPNet, pools []cnet.IPNet) bool {
+	blockOnes, blockBits := block.Mask.Size()
+	for _, p := range pools {
+		poolOnes, poolBits := p.Mask.Size()
+		if poolBits == blockBits && poolOnes <= blockOnes && p.Contains(block.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// PushToDatastore creates the IPAM resources in the datastore, recording each resource
+// that is handled in the progress bar, which may be nil.
+func (m *migrateIPAM) PushToDatastore(progress *common.Progress) ipamResults {
 	ctx := context.Background()
 	errs := []error{}
 	handled := 0
+	defer progress.Finish()
 
 	for _, bakv := range m.BlockAffinities {
 		kv := &model.KVPair{
@@ -271,6 +322,7 @@ func (m *migrateIPAM) PushToDatastore() ipamResults {
 		}
 		log.Debugf("Created Block Affinity: %+v", created)
 		handled++
+		progress.Add(1)
 	}
 
 	for _, bkv := range m.IPAMBlocks {
@@ -286,6 +338,7 @@ func (m *migrateIPAM) PushToDatastore() ipamResults {
 		}
 		log.Debugf("Created IPAM Block: %+v", created)
 		handled++
+		progress.Add(1)
 	}
 
 	for _, hkv := range m.IPAMHandles {
@@ -308,6 +361,7 @@ func (m *migrateIPAM) PushToDatastore() ipamResults {
 		}
 		log.Debugf("Created IPAM Handle: %+v", created)
 		handled++
+		progress.Add(1)
 	}
 
 	ipamConfigCount := 0
@@ -325,6 +379,7 @@ func (m *migrateIPAM) PushToDatastore() ipamResults {
 		}
 		log.Debugf("Created IPAM Config: %+v", created)
 		handled++
+		progress.Add(1)
 	}
 
 	return ipamResults{
@@ -335,10 +390,15 @@ func (m *migrateIPAM) PushToDatastore() ipamResults {
 }
 
 func (m *migrateIPAM) IsEmpty() bool {
+	return m.numResources() == 0
+}
+
+// numResources returns the number of IPAM resources.
+func (m *migrateIPAM) numResources() int {
 	ipamConfigCount := 0
 	if m.IPAMConfig != nil {
 		ipamConfigCount = 1
 	}
 
-	return len(m.BlockAffinities)+len(m.IPAMBlocks)+len(m.IPAMHandles)+ipamConfigCount == 0
+	return len(m.BlockAffinities) + len(m.IPAMBlocks) + len(m.IPAMHandles) + ipamConfigCount
 }
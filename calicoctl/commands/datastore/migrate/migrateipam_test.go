@@ -169,6 +169,32 @@ var _ = Describe("IPAM migration handling", func() {
 		Expect(migrateIPAM.IPAMHandles).To(HaveLen(1))
 		Expect(migrateIPAM.IPAMHandles[0].Key).To(Equal(newHandleKeyPath))
 	})
+
+	It("Should count each kind of IPAM resource", func() {
+		migrateIPAM := migrate.NewMigrateIPAM(NewMockIPAMClient(NewMockIPAMBackendClient(model.KVPairList{}, model.KVPairList{}, model.KVPairList{})))
+		Expect(migrateIPAM.ResourceCounts()).To(Equal(map[string]int{
+			"IPAMBlocks": 0, "BlockAffinities": 0, "IPAMHandles": 0, "IPAMConfigurations": 0,
+		}))
+
+		migrateIPAM.IPAMBlocks = []*migrate.IPAMBlockKVPair{{}, {}}
+		migrateIPAM.IPAMConfig = &migrate.IPAMConfigKVPair{}
+		Expect(migrateIPAM.ResourceCounts()).To(Equal(map[string]int{
+			"IPAMBlocks": 2, "BlockAffinities": 0, "IPAMHandles": 0, "IPAMConfigurations": 1,
+		}))
+	})
+
+	It("Should report the IPAM blocks that are not within an IP pool", func() {
+		migrateIPAM := migrate.NewMigrateIPAM(NewMockIPAMClient(NewMockIPAMBackendClient(model.KVPairList{}, model.KVPairList{}, model.KVPairList{})))
+		for _, cidr := range []string{"192.168.201.0/26", "10.0.0.0/26", "192.0.0.0/8", "fd00::/122"} {
+			migrateIPAM.IPAMBlocks = append(migrateIPAM.IPAMBlocks, &migrate.IPAMBlockKVPair{
+				Value: &model.AllocationBlock{CIDR: net.MustParseCIDR(cidr)},
+			})
+		}
+
+		pools := []net.IPNet{net.MustParseCIDR("192.168.0.0/16"), net.MustParseCIDR("fd00::/64")}
+		Expect(migrateIPAM.BlocksOutsidePools(pools)).To(Equal([]string{"10.0.0.0/26", "192.0.0.0/8"}))
+		Expect(migrateIPAM.BlocksOutsidePools(nil)).To(HaveLen(4))
+	})
 })
 
 // MockIPAMClient subs out the clientv3.Interface but only in a way where'
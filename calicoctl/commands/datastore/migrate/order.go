@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	yaml "github.com/projectcalico/go-yaml-wrapper"
+)
+
+// DefaultApplyOrder is the order in which the kinds of v3 resources are imported, so that
+// resources are applied after the resources they refer to. IP pools come before the nodes
+// whose tunnel addresses are assigned from them, nodes before the per-node configuration,
+// peers and host endpoints, and network sets before the policies that select them.
+var DefaultApplyOrder = []string{
+	"IPPool",
+	"Node",
+	"BGPConfiguration",
+	"FelixConfiguration",
+	"KubeControllersConfiguration",
+	"BGPPeer",
+	"HostEndpoint",
+	"GlobalNetworkSet",
+	"NetworkSet",
+	"GlobalNetworkPolicy",
+	"NetworkPolicy",
+}
+
+// ParseApplyOrder parses a comma separated list of kinds, which may use any of the names
+// accepted on the command line, for example "ippools" or "networkpolicy".
+func ParseApplyOrder(s string) ([]string, error) {
+	var kinds []string
+	for _, name := range strings.Split(s, ",") {
+		rh, err := resourcemgr.GetResourceHelper(strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid apply order '%s': %s", s, err)
+		}
+		kinds = append(kinds, resourceKind(rh.NewResource("", "")))
+	}
+	return kinds, nil
+}
+
+// OrderV3Resources returns the exported YAML data with the resources of the kinds in
+// order first, in that order. Resources of other kinds follow, in their original order.
+// The export contains a list of resources for each kind, so the lists are reordered as a
+// whole.
+func OrderV3Resources(data []byte, order []string) ([]byte, error) {
+	objs, err := resourcemgr.CreateResourcesFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing v3 resources: %s", err)
+	}
+
+	rank := func(obj runtime.Object) int {
+		kind := strings.TrimSuffix(resourceKind(obj), "List")
+		for i, k := range order {
+			if k == kind {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		return rank(objs[i]) < rank(objs[j])
+	})
+
+	var out bytes.Buffer
+	for _, obj := range objs {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("Error serializing v3 resources: %s", err)
+		}
+		out.Write(b)
+		out.WriteString("---\n")
+	}
+	return out.Bytes(), nil
+}
+
+// resourceKind returns the kind of the resource or resource list, from its type.
+func resourceKind(obj runtime.Object) string {
+	return reflect.TypeOf(obj).Elem().Name()
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Etcd to KDD Migration Import apply order", func() {
+	It("Should apply global policies before namespaced policies by default", func() {
+		data, err := migrate.OrderV3Resources([]byte(v3ResourcesYAML), migrate.DefaultApplyOrder)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namesOf(data)).To(Equal([]string{"/allow-dns", "old-team/allow-dns", "other-team/allow-dns"}))
+	})
+
+	It("Should apply the listed kinds first", func() {
+		order, err := migrate.ParseApplyOrder("networkpolicies")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(order).To(Equal([]string{"NetworkPolicy"}))
+
+		data, err := migrate.OrderV3Resources([]byte(v3ResourcesYAML), order)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namesOf(data)).To(Equal([]string{"old-team/allow-dns", "other-team/allow-dns", "/allow-dns"}))
+	})
+
+	It("Should keep the file order of kinds that are not listed", func() {
+		data, err := migrate.OrderV3Resources([]byte(v3ResourcesYAML), []string{"IPPool"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namesOf(data)).To(Equal([]string{"old-team/allow-dns", "other-team/allow-dns", "/allow-dns"}))
+	})
+
+	It("Should reject unknown kinds", func() {
+		_, err := migrate.ParseApplyOrder("ippools,widgets")
+		Expect(err).To(HaveOccurred())
+	})
+})
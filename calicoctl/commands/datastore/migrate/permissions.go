@@ -0,0 +1,202 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	"github.com/projectcalico/libcalico-go/lib/apiconfig"
+	"github.com/projectcalico/libcalico-go/lib/backend/k8s"
+)
+
+// The API group of the Calico CRDs.
+const calicoCRDGroup = "crd.projectcalico.org"
+
+// Permission is a permission on the Kubernetes API server that the import needs.
+type Permission struct {
+	Verb      string
+	Group     string
+	Resource  string
+	Namespace string
+}
+
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource += "." + p.Group
+	}
+	if p.Namespace != "" {
+		return fmt.Sprintf("%s %s in namespace %s", p.Verb, resource, p.Namespace)
+	}
+	return fmt.Sprintf("%s %s", p.Verb, resource)
+}
+
+// kindResources maps the kinds of v3 resource to the CRD resources that they are stored as.
+// Nodes are not included, since they are stored in the Kubernetes nodes.
+var kindResources = map[string]string{
+	"BGPConfiguration":             "bgpconfigurations",
+	"BGPPeer":                      "bgppeers",
+	"FelixConfiguration":           "felixconfigurations",
+	"GlobalNetworkPolicy":          "globalnetworkpolicies",
+	"GlobalNetworkSet":             "globalnetworksets",
+	"HostEndpoint":                 "hostendpoints",
+	"IPPool":                       "ippools",
+	"KubeControllersConfiguration": "kubecontrollersconfigurations",
+	"NetworkPolicy":                "networkpolicies",
+	"NetworkSet":                   "networksets",
+}
+
+// ImportPermissions returns the permissions needed to import the exported v3 resources,
+// in addition to the CRDs, cluster information and IPAM resources that every import
+// writes. The v3 resources are nil for an IPAM only import.
+func ImportPermissions(v3Yaml []byte) ([]Permission, error) {
+	perms := []Permission{
+		{Verb: "create", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+		{Verb: "update", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+		{Verb: "create", Group: calicoCRDGroup, Resource: "clusterinformations"},
+		{Verb: "update", Group: calicoCRDGroup, Resource: "clusterinformations"},
+		{Verb: "create", Group: calicoCRDGroup, Resource: "ipamblocks"},
+		{Verb: "create", Group: calicoCRDGroup, Resource: "blockaffinities"},
+		{Verb: "create", Group: calicoCRDGroup, Resource: "ipamhandles"},
+	}
+	if len(v3Yaml) == 0 {
+		return perms, nil
+	}
+
+	objs, err := resourcemgr.CreateResourcesFromReader(bytes.NewReader(v3Yaml))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing v3 resources: %s", err)
+	}
+	seen := map[Permission]bool{}
+	var resourcePerms []Permission
+	for _, obj := range objs {
+		items := []runtime.Object{obj}
+		if list, ok := obj.(resourcemgr.ResourceListObject); ok {
+			if items, err = meta.ExtractList(list); err != nil {
+				return nil, fmt.Errorf("Error parsing v3 resources: %s", err)
+			}
+		}
+		for _, item := range items {
+			p, ok := resourcePermission(item)
+			if !ok || seen[p] {
+				continue
+			}
+			seen[p] = true
+			resourcePerms = append(resourcePerms, p)
+		}
+	}
+	sort.Slice(resourcePerms, func(i, j int) bool {
+		return resourcePerms[i].String() < resourcePerms[j].String()
+	})
+	return append(perms, resourcePerms...), nil
+}
+
+// resourcePermission returns the permission needed to apply the v3 resource. The nodes
+// already exist, so are updated rather than created.
+func resourcePermission(obj runtime.Object) (Permission, bool) {
+	kind := resourceKind(obj)
+	if kind == "Node" {
+		return Permission{Verb: "update", Resource: "nodes"}, true
+	}
+	resource, ok := kindResources[kind]
+	if !ok {
+		log.Infof("Not checking permissions for resources of kind %s", kind)
+		return Permission{}, false
+	}
+	p := Permission{Verb: "create", Group: calicoCRDGroup, Resource: resource}
+	if m, err := meta.Accessor(obj); err == nil {
+		p.Namespace = m.GetNamespace()
+	}
+	return p, true
+}
+
+// ipamResources are the CRD resources that hold the IPAM data.
+var ipamResources = map[string]bool{
+	"ipamblocks":      true,
+	"blockaffinities": true,
+	"ipamhandles":     true,
+}
+
+// SplitIPAMPermissions splits the permissions into those needed to write the IPAM data and
+// the rest, so that they can be checked against separate IPAM and config targets.
+func SplitIPAMPermissions(perms []Permission) (config, ipam []Permission) {
+	for _, p := range perms {
+		if p.Group == calicoCRDGroup && ipamResources[p.Resource] {
+			ipam = append(ipam, p)
+		} else {
+			config = append(config, p)
+		}
+	}
+	return config, ipam
+}
+
+// checkImportPermissions checks that the user has each of the permissions, reporting all
+// of the missing permissions together.
+func checkImportPermissions(ctx context.Context, cfg *apiconfig.CalicoAPIConfig, perms []Permission) error {
+	_, cs, err := k8s.CreateKubernetesClientset(&cfg.Spec)
+	if err != nil {
+		return err
+	}
+	missing, err := missingPermissions(ctx, cs, perms)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		var lines []string
+		for _, p := range missing {
+			lines = append(lines, "  "+p.String())
+		}
+		return fmt.Errorf("Missing %d permission(s) needed to import the datastore:\n%s", len(missing), strings.Join(lines, "\n"))
+	}
+	return nil
+}
+
+// missingPermissions returns the permissions that the user does not have, according to
+// a SelfSubjectAccessReview of each permission.
+func missingPermissions(ctx context.Context, cs kubernetes.Interface, perms []Permission) ([]Permission, error) {
+	var missing []Permission
+	for _, p := range perms {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: p.Namespace,
+					Verb:      p.Verb,
+					Group:     p.Group,
+					Resource:  p.Resource,
+				},
+			},
+		}
+		result, err := cs.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, v1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Error checking permission to %s: %s", p, err)
+		}
+		if !result.Status.Allowed {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
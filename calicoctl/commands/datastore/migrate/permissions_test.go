@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Etcd to KDD Migration Import permissions", func() {
+	permissionStrings := func(perms []migrate.Permission) []string {
+		var s []string
+		for _, p := range perms {
+			s = append(s, p.String())
+		}
+		return s
+	}
+	basePermissions := []string{
+		"create customresourcedefinitions.apiextensions.k8s.io",
+		"update customresourcedefinitions.apiextensions.k8s.io",
+		"create clusterinformations.crd.projectcalico.org",
+		"update clusterinformations.crd.projectcalico.org",
+		"create ipamblocks.crd.projectcalico.org",
+		"create blockaffinities.crd.projectcalico.org",
+		"create ipamhandles.crd.projectcalico.org",
+	}
+
+	It("Should only need the base permissions for an IPAM only import", func() {
+		perms, err := migrate.ImportPermissions(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(permissionStrings(perms)).To(Equal(basePermissions))
+	})
+
+	It("Should need to create each kind of resource in each namespace", func() {
+		perms, err := migrate.ImportPermissions([]byte(v3ResourcesYAML))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(permissionStrings(perms)).To(Equal(append(basePermissions,
+			"create globalnetworkpolicies.crd.projectcalico.org",
+			"create networkpolicies.crd.projectcalico.org in namespace old-team",
+			"create networkpolicies.crd.projectcalico.org in namespace other-team",
+		)))
+	})
+
+	It("Should split out the IPAM permissions for a separate IPAM datastore", func() {
+		perms, err := migrate.ImportPermissions([]byte(v3ResourcesYAML))
+		Expect(err).NotTo(HaveOccurred())
+		config, ipam := migrate.SplitIPAMPermissions(perms)
+		Expect(permissionStrings(ipam)).To(Equal(basePermissions[4:]))
+		Expect(permissionStrings(config)).To(Equal(append(basePermissions[:4:4],
+			"create globalnetworkpolicies.crd.projectcalico.org",
+			"create networkpolicies.crd.projectcalico.org in namespace old-team",
+			"create networkpolicies.crd.projectcalico.org in namespace other-team",
+		)))
+	})
+
+	It("Should need to update the nodes", func() {
+		perms, err := migrate.ImportPermissions([]byte(`apiVersion: projectcalico.org/v3
+kind: Node
+metadata:
+  name: node1
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(permissionStrings(perms)).To(ContainElement("update nodes"))
+	})
+})
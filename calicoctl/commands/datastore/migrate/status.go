@@ -0,0 +1,155 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/options"
+)
+
+// MigrationStatus is the state of the datastore for a migration, as output by the status
+// command. The resources are counted by kind, keyed by the display name of the kind.
+type MigrationStatus struct {
+	DatastoreType   string         `json:"datastoreType"`
+	Locked          bool           `json:"locked"`
+	ClusterGUID     string         `json:"clusterGUID"`
+	CalicoVersion   string         `json:"calicoVersion"`
+	CalicoResources map[string]int `json:"calicoResources"`
+	IPAMResources   map[string]int `json:"ipamResources"`
+
+	// Whether the datastore holds any IPAM resources.
+	IPAMExists bool `json:"ipamExists"`
+}
+
+func Status(args []string) error {
+	doc := `Usage:
+  <BINARY_NAME> <MIGRATE> status [--config=<CONFIG>] [--output=<OUTPUT>]
+
+Options:
+  -h --help                 Show this screen.
+  -o --output=<OUTPUT>      Output format.  One of: text, json.
+                            [default: text]
+  -c --config=<CONFIG>      Path to the file containing connection
+                            configuration in YAML or JSON format.
+                            [default: ` + constants.DefaultConfigPath + `]
+
+Description:
+  Show the state of the datastore for a migration: the datastore type,
+  whether the datastore is locked, the cluster GUID and Calico version, the
+  number of each kind of Calico resource and IPAM resource in the datastore,
+  and whether any IPAM resources exist.  Use this to check that the source
+  datastore is locked before an export, and that the target datastore is empty
+  before an import.
+
+  This command does not modify the datastore, so it can be run by a separate
+  process, for example with --output=json, to monitor an import that is in
+  progress or has completed.
+`
+	// Replace the BINARY_NAME and MIGRATE placeholders.
+	doc = usage(doc, args)
+
+	parsedArgs, err := docopt.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if len(parsedArgs) == 0 {
+		return nil
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "text" && output != "json" {
+		return fmt.Errorf("Unrecognized output format '%s', expected one of: text, json", output)
+	}
+
+	cf := parsedArgs["--config"].(string)
+	cfg, err := clientmgr.LoadClientConfig(cf)
+	if err != nil {
+		return err
+	}
+	client, err := clientmgr.NewClient(cf)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	clusterinfo, err := client.ClusterInformation().Get(ctx, "default", options.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Error retrieving ClusterInformation: %s", err)
+	}
+	status := MigrationStatus{
+		DatastoreType:   string(cfg.Spec.DatastoreType),
+		Locked:          isLocked(clusterinfo),
+		ClusterGUID:     clusterinfo.Spec.ClusterGUID,
+		CalicoVersion:   clusterinfo.Spec.CalicoVersion,
+		CalicoResources: map[string]int{},
+	}
+
+	counts, err := countCalicoResources(ctx, client, allV3Resources)
+	if err != nil {
+		return err
+	}
+	for _, r := range allV3Resources {
+		status.CalicoResources[resourceDisplayMap[r]] = counts[r]
+	}
+
+	ipam := NewMigrateIPAM(client)
+	if err := ipam.PullFromDatastore(); err != nil {
+		return fmt.Errorf("Failed to retrieve IPAM resources: %s", err)
+	}
+	status.IPAMResources = ipam.ResourceCounts()
+	for _, n := range status.IPAMResources {
+		if n > 0 {
+			status.IPAMExists = true
+		}
+	}
+
+	if output == "json" {
+		b, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Printf("Datastore type: %s\n", status.DatastoreType)
+	if status.Locked {
+		fmt.Println("Datastore is locked.")
+	} else {
+		fmt.Println("Datastore is not locked.")
+	}
+	fmt.Printf("Cluster GUID: %s\n", status.ClusterGUID)
+	fmt.Printf("Calico version: %s\n", status.CalicoVersion)
+	fmt.Println("Calico resources:")
+	for _, r := range allV3Resources {
+		fmt.Printf("  %s: %d\n", resourceDisplayMap[r], status.CalicoResources[resourceDisplayMap[r]])
+	}
+	fmt.Println("IPAM resources:")
+	for _, r := range ipamResourceKinds {
+		fmt.Printf("  %s: %d\n", resourceDisplayMap[r], status.IPAMResources[resourceDisplayMap[r]])
+	}
+	if !status.IPAMExists {
+		fmt.Println("The datastore has no IPAM resources.")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	"github.com/projectcalico/libcalico-go/lib/options"
+)
+
+// ImportSummary is the summary of an import, as written by the --summary-file option of
+// the import command.
+type ImportSummary struct {
+	// The label identifying the cluster, or the cluster GUID if no label was given.
+	ClusterLabel string        `json:"clusterLabel"`
+	CRDs         CRDSummary    `json:"crds"`
+	V3Resources  []KindSummary `json:"v3Resources"`
+
+	// The datastores that the phases of the import wrote to.
+	Targets []ImportTarget `json:"targets"`
+
+	// The time taken by each phase of the import, if --timings was set.
+	Timings []PhaseTiming `json:"timings,omitempty"`
+}
+
+// crdResult is the result of applying a CRD.
+type crdResult string
+
+const (
+	crdCreated crdResult = "created"
+	crdUpdated crdResult = "updated"
+	crdSkipped crdResult = "skipped"
+	crdResumed crdResult = "resumed"
+)
+
+// CRDSummary is the number of Calico CRDs that were created, updated, skipped because
+// they were already up to date, and skipped because they were already applied by the same
+// import run, and the errors applying the CRDs that failed.
+type CRDSummary struct {
+	Total   int      `json:"total"`
+	Created int      `json:"created"`
+	Updated int      `json:"updated"`
+	Skipped int      `json:"skipped"`
+	Resumed int      `json:"resumed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+func (s *CRDSummary) record(result crdResult) {
+	switch result {
+	case crdCreated:
+		s.Created++
+	case crdUpdated:
+		s.Updated++
+	case crdSkipped:
+		s.Skipped++
+	case crdResumed:
+		s.Resumed++
+	}
+}
+
+func (s CRDSummary) String() string {
+	counts := fmt.Sprintf("created %d, updated %d, skipped %d that were up to date", s.Created, s.Updated, s.Skipped)
+	if s.Resumed > 0 {
+		counts += fmt.Sprintf(", skipped %d already applied by this import run", s.Resumed)
+	}
+	return fmt.Sprintf("Applied %d of %d CRDs (%s)", s.Created+s.Updated+s.Skipped+s.Resumed, s.Total, counts)
+}
+
+// KindSummary is the number of v3 resources of a kind in the import file, and the number
+// that were applied to the datastore.
+type KindSummary struct {
+	Kind    string `json:"kind"`
+	Total   int    `json:"total"`
+	Applied int    `json:"applied"`
+}
+
+// SummarizeKinds combines the number of resources of each kind in the import file with
+// the number of each kind that were applied, sorted by kind. Kinds that appear in either
+// map are included.
+func SummarizeKinds(total, applied map[string]int) []KindSummary {
+	kinds := map[string]bool{}
+	for kind := range total {
+		kinds[kind] = true
+	}
+	for kind := range applied {
+		kinds[kind] = true
+	}
+
+	summary := []KindSummary{}
+	for kind := range kinds {
+		summary = append(summary, KindSummary{Kind: kind, Total: total[kind], Applied: applied[kind]})
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		return summary[i].Kind < summary[j].Kind
+	})
+	return summary
+}
+
+// printKindSummary writes a table of the number of resources of each kind that were
+// applied to w.
+func printKindSummary(w io.Writer, summary []KindSummary) {
+	var total, applied int
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"KIND", "IN FILE", "APPLIED"})
+	for _, k := range summary {
+		table.Append([]string{k.Kind, strconv.Itoa(k.Total), strconv.Itoa(k.Applied)})
+		total += k.Total
+		applied += k.Applied
+	}
+	table.SetFooter([]string{"TOTAL", strconv.Itoa(total), strconv.Itoa(applied)})
+	table.Render()
+}
+
+// writeImportSummary writes the summary of the applied CRDs and imported v3 resources, the
+// datastores written to and, if set, the phase timings, as JSON to the named file. The
+// summary is labelled with the cluster label or, if no label was given, the GUID of the
+// cluster that was imported into.
+func writeImportSummary(ctx context.Context, c client.Interface, filename, label string, crds CRDSummary, kinds []KindSummary, targets []ImportTarget, timings []PhaseTiming) error {
+	clusterInfo, err := c.ClusterInformation().Get(ctx, "default", options.GetOptions{})
+	if err != nil {
+		return err
+	}
+	summary := ImportSummary{
+		ClusterLabel: common.ClusterLabel(label, clusterInfo.Spec.ClusterGUID),
+		CRDs:         crds,
+		V3Resources:  kinds,
+		Targets:      targets,
+		Timings:      timings,
+	}
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(b, '\n'), 0644)
+}
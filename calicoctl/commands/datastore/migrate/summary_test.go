@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test import summary", func() {
+	It("should combine the counts of each kind, sorted by kind", func() {
+		total := map[string]int{"NetworkPolicy": 120, "IPPool": 4, "Node": 3}
+		applied := map[string]int{"NetworkPolicy": 120, "IPPool": 4, "Node": 2}
+		Expect(migrate.SummarizeKinds(total, applied)).To(Equal([]migrate.KindSummary{
+			{Kind: "IPPool", Total: 4, Applied: 4},
+			{Kind: "NetworkPolicy", Total: 120, Applied: 120},
+			{Kind: "Node", Total: 3, Applied: 2},
+		}))
+	})
+
+	It("should include kinds with no resources applied", func() {
+		total := map[string]int{"HostEndpoint": 1}
+		Expect(migrate.SummarizeKinds(total, nil)).To(Equal([]migrate.KindSummary{
+			{Kind: "HostEndpoint", Total: 1, Applied: 0},
+		}))
+	})
+
+	It("should return an empty summary when there are no resources", func() {
+		Expect(migrate.SummarizeKinds(nil, nil)).To(Equal([]migrate.KindSummary{}))
+	})
+
+	It("should describe the CRDs that were applied", func() {
+		s := migrate.CRDSummary{Total: 20, Created: 3, Updated: 1, Skipped: 15, Errors: []string{"Error creating CRD"}}
+		Expect(s.String()).To(Equal("Applied 19 of 20 CRDs (created 3, updated 1, skipped 15 that were up to date)"))
+	})
+
+	It("should describe the CRDs that were already applied by the import run", func() {
+		s := migrate.CRDSummary{Total: 20, Created: 2, Skipped: 3, Resumed: 15}
+		Expect(s.String()).To(Equal("Applied 20 of 20 CRDs (created 2, updated 0, skipped 3 that were up to date, skipped 15 already applied by this import run)"))
+	})
+
+	It("should summarize the timings of the phases in the order they were run", func() {
+		phases := []string{"CRD apply", "v3 resource apply", "IPAM push"}
+		durations := map[string]time.Duration{
+			"CRD apply":         1500 * time.Microsecond,
+			"v3 resource apply": 2*time.Second + 300*time.Microsecond,
+			"IPAM push":         250 * time.Millisecond,
+		}
+		Expect(migrate.SummarizeTimings(phases, durations)).To(Equal([]migrate.PhaseTiming{
+			{Phase: "CRD apply", Duration: "2ms"},
+			{Phase: "v3 resource apply", Duration: "2s"},
+			{Phase: "IPAM push", Duration: "250ms"},
+		}))
+	})
+
+	It("should only write the timings to the summary if they were recorded", func() {
+		b, err := json.Marshal(migrate.ImportSummary{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).NotTo(ContainSubstring(`"timings"`))
+
+		b, err = json.Marshal(migrate.ImportSummary{Timings: []migrate.PhaseTiming{{Phase: "IPAM push", Duration: "250ms"}}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(`"timings":[{"phase":"IPAM push","duration":"250ms"}]`))
+	})
+})
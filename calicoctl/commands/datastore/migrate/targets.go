@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/libcalico-go/lib/apiconfig"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	"github.com/projectcalico/libcalico-go/lib/options"
+)
+
+// ImportTarget is a datastore that the import writes to, and the phases of the import that
+// write to it.
+type ImportTarget struct {
+	Phases        []string `json:"phases"`
+	DatastoreType string   `json:"datastoreType"`
+	Config        string   `json:"config"`
+}
+
+// ImportTargets returns the datastores that the phases of the import write to. The CRDs,
+// v3 resources and cluster information are written to the datastore configured by
+// config, and the IPAM data to the datastore configured by ipamConfig, or to the same
+// datastore if ipamConfig is empty.
+func ImportTargets(config string, cfg *apiconfig.CalicoAPIConfig, ipamConfig string, ipamCfg *apiconfig.CalicoAPIConfig, ipamOnly bool) []ImportTarget {
+	phases := []string{"CRD apply"}
+	if !ipamOnly {
+		phases = append(phases, "v3 resource apply", "Cluster info update")
+	}
+	if ipamConfig == "" {
+		return []ImportTarget{{Phases: append(phases, "IPAM push"), DatastoreType: string(cfg.Spec.DatastoreType), Config: config}}
+	}
+	return []ImportTarget{
+		{Phases: phases, DatastoreType: string(cfg.Spec.DatastoreType), Config: config},
+		{Phases: []string{"IPAM push"}, DatastoreType: string(ipamCfg.Spec.DatastoreType), Config: ipamConfig},
+	}
+}
+
+// printImportTargets writes the datastore that each phase of the import writes to.
+func printImportTargets(w io.Writer, targets []ImportTarget) {
+	for _, t := range targets {
+		fmt.Fprintf(w, "Import target for %s: %s datastore configured by %s\n", strings.Join(t.Phases, ", "), t.DatastoreType, t.Config)
+	}
+}
+
+// loadIPAMConfig loads the configuration of the datastore that the IPAM data is imported
+// into, which may be either a Kubernetes or an etcdv3 datastore.
+func loadIPAMConfig(cf string) (*apiconfig.CalicoAPIConfig, error) {
+	cfg, err := clientmgr.LoadClientConfig(cf)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Spec.DatastoreType != apiconfig.Kubernetes && cfg.Spec.DatastoreType != apiconfig.EtcdV3 {
+		return nil, fmt.Errorf("Invalid datastore type: %s to import IPAM to. Datastore type must be %s or %s", cfg.Spec.DatastoreType, apiconfig.Kubernetes, apiconfig.EtcdV3)
+	}
+	return cfg, nil
+}
+
+// checkIPAMTarget checks that the datastore that the IPAM data is imported into can be
+// read, before any changes are made. A Kubernetes datastore must already have the Calico
+// CRDs, since they are only applied to the datastore configured by --config.
+func checkIPAMTarget(ctx context.Context, c client.Interface, cf string) error {
+	if _, err := c.IPPools().List(ctx, options.ListOptions{}); err != nil {
+		return fmt.Errorf("Unable to read the IPAM target datastore configured by %s: %s", cf, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+	"github.com/projectcalico/libcalico-go/lib/apiconfig"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Import targets", func() {
+	kdd := apiconfig.NewCalicoAPIConfig()
+	kdd.Spec.DatastoreType = apiconfig.Kubernetes
+	etcd := apiconfig.NewCalicoAPIConfig()
+	etcd.Spec.DatastoreType = apiconfig.EtcdV3
+
+	It("should write every phase to a single datastore by default", func() {
+		targets := migrate.ImportTargets("kdd.yaml", kdd, "", nil, false)
+		Expect(targets).To(Equal([]migrate.ImportTarget{{
+			Phases:        []string{"CRD apply", "v3 resource apply", "Cluster info update", "IPAM push"},
+			DatastoreType: "kubernetes",
+			Config:        "kdd.yaml",
+		}}))
+	})
+
+	It("should write the IPAM data to a separate datastore", func() {
+		targets := migrate.ImportTargets("kdd.yaml", kdd, "etcd.yaml", etcd, false)
+		Expect(targets).To(Equal([]migrate.ImportTarget{
+			{Phases: []string{"CRD apply", "v3 resource apply", "Cluster info update"}, DatastoreType: "kubernetes", Config: "kdd.yaml"},
+			{Phases: []string{"IPAM push"}, DatastoreType: "etcdv3", Config: "etcd.yaml"},
+		}))
+	})
+
+	It("should only apply the CRDs to the config datastore for an IPAM only import", func() {
+		targets := migrate.ImportTargets("kdd.yaml", kdd, "etcd.yaml", etcd, true)
+		Expect(targets[0].Phases).To(Equal([]string{"CRD apply"}))
+		Expect(targets[1].Phases).To(Equal([]string{"IPAM push"}))
+	})
+})
@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"io"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// phaseTimings records the wall-clock duration of each phase of a migration
+// command, in the order that the phases were run.
+type phaseTimings struct {
+	phases    []string
+	durations map[string]time.Duration
+}
+
+func newPhaseTimings() *phaseTimings {
+	return &phaseTimings{durations: map[string]time.Duration{}}
+}
+
+// record stores the time elapsed since start against the named phase. Recording
+// the same phase more than once accumulates the durations.
+func (t *phaseTimings) record(phase string, start time.Time) {
+	if _, ok := t.durations[phase]; !ok {
+		t.phases = append(t.phases, phase)
+	}
+	t.durations[phase] += time.Since(start)
+}
+
+// summary returns the recorded phases and their durations, in the order that the
+// phases were run, for the import summary.
+func (t *phaseTimings) summary() []PhaseTiming {
+	return SummarizeTimings(t.phases, t.durations)
+}
+
+// PhaseTiming is the duration of a phase of an import, as written to the import summary.
+type PhaseTiming struct {
+	Phase    string `json:"phase"`
+	Duration string `json:"duration"`
+}
+
+// SummarizeTimings returns the duration of each of the phases, in the given order. The
+// durations are rounded to the millisecond, as they are when printed.
+func SummarizeTimings(phases []string, durations map[string]time.Duration) []PhaseTiming {
+	summary := []PhaseTiming{}
+	for _, phase := range phases {
+		summary = append(summary, PhaseTiming{Phase: phase, Duration: durations[phase].Round(time.Millisecond).String()})
+	}
+	return summary
+}
+
+// print writes a table of the recorded phases and their durations to w.
+func (t *phaseTimings) print(w io.Writer) {
+	var total time.Duration
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"PHASE", "DURATION"})
+	for _, phase := range t.phases {
+		table.Append([]string{phase, t.durations[phase].Round(time.Millisecond).String()})
+		total += t.durations[phase]
+	}
+	table.SetFooter([]string{"TOTAL", total.Round(time.Millisecond).String()})
+	table.Render()
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2020 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	yaml "github.com/projectcalico/go-yaml-wrapper"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+)
+
+// ResourceTransform modifies a v3 resource in place before it is imported.
+type ResourceTransform func(resourcemgr.ResourceObject) error
+
+// TransformV3Resources applies the transforms, in order, to every v3 resource in the
+// exported YAML data and returns the updated YAML. An error is returned if, after the
+// transforms, two distinct resources would be imported as the same resource.
+func TransformV3Resources(data []byte, transforms ...ResourceTransform) ([]byte, error) {
+	if len(transforms) == 0 {
+		return data, nil
+	}
+
+	objs, err := resourcemgr.CreateResourcesFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing v3 resources: %s", err)
+	}
+
+	// Track the original identity of each transformed resource so that we can detect
+	// distinct resources which would overwrite each other.
+	imported := map[string]string{}
+	var out bytes.Buffer
+	for _, obj := range objs {
+		err := eachResource(obj, func(r resourcemgr.ResourceObject) error {
+			original := resourceID(r)
+			for _, transform := range transforms {
+				if err := transform(r); err != nil {
+					return err
+				}
+			}
+
+			id := resourceID(r)
+			if other, ok := imported[id]; ok {
+				return fmt.Errorf("Resources %s and %s would both be imported as %s", other, original, id)
+			}
+			imported[id] = original
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("Error serializing v3 resources: %s", err)
+		}
+		out.Write(b)
+		out.WriteString("---\n")
+	}
+
+	return out.Bytes(), nil
+}
+
+// NamespaceMapper returns a ResourceTransform that moves namespaced resources from
+// each of the namespaces in the map to the corresponding mapped namespace. Resources
+// in namespaces that are not in the map are unchanged.
+func NamespaceMapper(namespaces map[string]string) ResourceTransform {
+	return func(r resourcemgr.ResourceObject) error {
+		if ns, ok := namespaces[r.GetObjectMeta().GetNamespace()]; ok {
+			r.GetObjectMeta().SetNamespace(ns)
+		}
+		return nil
+	}
+}
+
+// NameRewriter returns a ResourceTransform that adds the prefix and suffix to the name of
+// each resource. Nodes, WorkloadEndpoints, ClusterInformation and the configuration
+// resources are not renamed since their names are significant: nodes must match the
+// Kubernetes node names, the names of workload endpoints are derived from their node,
+// orchestrator, workload and interface, and the configuration resources are named either
+// "default" or after the node they apply to.
+//
+// Calico resources mostly refer to each other using label selectors rather than by name.
+// BGPPeers and HostEndpoints refer to Nodes, which are not renamed. WorkloadEndpoints and
+// HostEndpoints refer to Profiles by name, so those references are renamed along with the
+// Profiles.
+func NameRewriter(prefix, suffix string) ResourceTransform {
+	rename := func(profiles []string) {
+		for i, p := range profiles {
+			profiles[i] = prefix + p + suffix
+		}
+	}
+	return func(r resourcemgr.ResourceObject) error {
+		switch res := r.(type) {
+		case *apiv3.Node, *apiv3.ClusterInformation, *apiv3.FelixConfiguration,
+			*apiv3.BGPConfiguration, *apiv3.KubeControllersConfiguration:
+			return nil
+		case *apiv3.WorkloadEndpoint:
+			rename(res.Spec.Profiles)
+			return nil
+		case *apiv3.HostEndpoint:
+			rename(res.Spec.Profiles)
+		}
+		r.GetObjectMeta().SetName(prefix + r.GetObjectMeta().GetName() + suffix)
+		return nil
+	}
+}
+
+// StatusStripper returns a ResourceTransform that clears the status of resources, so that
+// only their metadata and spec are imported. If all is false, the status is only cleared
+// for Nodes and KubeControllersConfigurations, whose status is written by calico/node and
+// kube-controllers and is repopulated once they are running against the new datastore.
+// Otherwise the status of every kind of resource that has one is cleared.
+func StatusStripper(all bool) ResourceTransform {
+	return func(r resourcemgr.ResourceObject) error {
+		if !all {
+			switch r.(type) {
+			case *apiv3.Node, *apiv3.KubeControllersConfiguration:
+			default:
+				return nil
+			}
+		}
+		if status := reflect.ValueOf(r).Elem().FieldByName("Status"); status.IsValid() && status.CanSet() {
+			status.Set(reflect.Zero(status.Type()))
+		}
+		return nil
+	}
+}
+
+// ParseNamespaceMap parses a namespace mapping of the form "old=new,old2=new2".
+func ParseNamespaceMap(s string) (map[string]string, error) {
+	namespaces := map[string]string{}
+	for _, m := range strings.Split(s, ",") {
+		parts := strings.Split(m, "=")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid namespace mapping '%s', expected the form <OLD>=<NEW>", m)
+		}
+		if _, ok := namespaces[parts[0]]; ok {
+			return nil, fmt.Errorf("Namespace '%s' is mapped more than once", parts[0])
+		}
+		namespaces[parts[0]] = parts[1]
+	}
+	return namespaces, nil
+}
+
+// eachResource calls fn for the resource, or for each resource in the list if obj is a list.
+func eachResource(obj runtime.Object, fn func(resourcemgr.ResourceObject) error) error {
+	if meta.IsListType(obj) {
+		return meta.EachListItem(obj, func(o runtime.Object) error {
+			return fn(o.(resourcemgr.ResourceObject))
+		})
+	}
+	return fn(obj.(resourcemgr.ResourceObject))
+}
+
+// resourceID returns a string uniquely identifying the resource by kind, namespace and name.
+func resourceID(r resourcemgr.ResourceObject) string {
+	kind := reflect.TypeOf(r).Elem().Name()
+	if ns := r.GetObjectMeta().GetNamespace(); ns != "" {
+		return fmt.Sprintf("%s(%s/%s)", kind, ns, r.GetObjectMeta().GetName())
+	}
+	return fmt.Sprintf("%s(%s)", kind, r.GetObjectMeta().GetName())
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2020 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	"bytes"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const v3ResourcesYAML = `apiVersion: projectcalico.org/v3
+items:
+- apiVersion: projectcalico.org/v3
+  kind: NetworkPolicy
+  metadata:
+    name: allow-dns
+    namespace: old-team
+  spec:
+    selector: all()
+- apiVersion: projectcalico.org/v3
+  kind: NetworkPolicy
+  metadata:
+    name: allow-dns
+    namespace: other-team
+  spec:
+    selector: all()
+kind: NetworkPolicyList
+metadata: {}
+---
+apiVersion: projectcalico.org/v3
+items:
+- apiVersion: projectcalico.org/v3
+  kind: GlobalNetworkPolicy
+  metadata:
+    name: allow-dns
+  spec:
+    selector: all()
+kind: GlobalNetworkPolicyList
+metadata: {}
+---
+`
+
+// namesOf returns the namespace/name of each resource in the YAML data.
+func namesOf(data []byte) []string {
+	objs, err := resourcemgr.CreateResourcesFromReader(bytes.NewReader(data))
+	Expect(err).NotTo(HaveOccurred())
+
+	var names []string
+	for _, obj := range objs {
+		err := meta.EachListItem(obj, func(o runtime.Object) error {
+			m := o.(resourcemgr.ResourceObject).GetObjectMeta()
+			names = append(names, m.GetNamespace()+"/"+m.GetName())
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+	return names
+}
+
+var _ = Describe("Etcd to KDD Migration Import transforms", func() {
+	It("Should not modify the data when there are no transforms", func() {
+		data, err := migrate.TransformV3Resources([]byte(v3ResourcesYAML))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(v3ResourcesYAML))
+	})
+
+	Context("with a namespace mapping", func() {
+		It("Should move resources in mapped namespaces only", func() {
+			namespaces, err := migrate.ParseNamespaceMap("old-team=new-team")
+			Expect(err).NotTo(HaveOccurred())
+
+			data, err := migrate.TransformV3Resources([]byte(v3ResourcesYAML), migrate.NamespaceMapper(namespaces))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(namesOf(data)).To(Equal([]string{"new-team/allow-dns", "other-team/allow-dns", "/allow-dns"}))
+		})
+
+		It("Should reject mappings that would overwrite distinct resources", func() {
+			namespaces, err := migrate.ParseNamespaceMap("old-team=other-team")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = migrate.TransformV3Resources([]byte(v3ResourcesYAML), migrate.NamespaceMapper(namespaces))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("would both be imported as NetworkPolicy(other-team/allow-dns)"))
+		})
+
+		It("Should reject invalid mappings", func() {
+			_, err := migrate.ParseNamespaceMap("old-team")
+			Expect(err).To(HaveOccurred())
+			_, err = migrate.ParseNamespaceMap("a=b,a=c")
+			Expect(err).To(HaveOccurred())
+			_, err = migrate.ParseNamespaceMap("a=")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with a name prefix and suffix", func() {
+		It("Should rename resources", func() {
+			data, err := migrate.TransformV3Resources([]byte(v3ResourcesYAML), migrate.NameRewriter("a-", "-b"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(namesOf(data)).To(Equal([]string{"old-team/a-allow-dns-b", "other-team/a-allow-dns-b", "/a-allow-dns-b"}))
+		})
+
+		It("Should not rename configuration resources", func() {
+			felixConfig := apiv3.NewFelixConfiguration()
+			felixConfig.Name = "default"
+			Expect(migrate.NameRewriter("a-", "-b")(felixConfig)).NotTo(HaveOccurred())
+			Expect(felixConfig.Name).To(Equal("default"))
+		})
+
+		It("Should rename the profiles referred to by host endpoints", func() {
+			profile := apiv3.NewProfile()
+			profile.Name = "web"
+			hep := apiv3.NewHostEndpoint()
+			hep.Name = "node1-eth0"
+			hep.Spec.Node = "node1"
+			hep.Spec.Profiles = []string{"web"}
+
+			rewrite := migrate.NameRewriter("a-", "-b")
+			Expect(rewrite(profile)).NotTo(HaveOccurred())
+			Expect(rewrite(hep)).NotTo(HaveOccurred())
+			Expect(hep.Name).To(Equal("a-node1-eth0-b"))
+			Expect(hep.Spec.Node).To(Equal("node1"))
+			Expect(hep.Spec.Profiles).To(Equal([]string{profile.Name}))
+		})
+
+		It("Should not rename workload endpoints, but should rename their profiles", func() {
+			wep := apiv3.NewWorkloadEndpoint()
+			wep.Name = "node1-k8s-pod1-eth0"
+			wep.Namespace = "default"
+			wep.Spec.Profiles = []string{"web"}
+			Expect(migrate.NameRewriter("a-", "-b")(wep)).NotTo(HaveOccurred())
+			Expect(wep.Name).To(Equal("node1-k8s-pod1-eth0"))
+			Expect(wep.Spec.Profiles).To(Equal([]string{"a-web-b"}))
+		})
+	})
+
+	Context("with status stripping", func() {
+		newNode := func() *apiv3.Node {
+			node := apiv3.NewNode()
+			node.Name = "node1"
+			node.Status.WireguardPublicKey = "key"
+			return node
+		}
+
+		It("Should clear the status of kinds with a server-owned status by default", func() {
+			node := newNode()
+			Expect(migrate.StatusStripper(false)(node)).NotTo(HaveOccurred())
+			Expect(node.Status).To(Equal(apiv3.NodeStatus{}))
+			Expect(node.Name).To(Equal("node1"))
+		})
+
+		It("Should ignore kinds without a status", func() {
+			gnp := apiv3.NewGlobalNetworkPolicy()
+			gnp.Spec.Selector = "all()"
+			Expect(migrate.StatusStripper(true)(gnp)).NotTo(HaveOccurred())
+			Expect(gnp.Spec.Selector).To(Equal("all()"))
+		})
+	})
+})
@@ -23,13 +23,12 @@ import (
 
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
-	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
 	"github.com/projectcalico/libcalico-go/lib/options"
 )
 
 func Unlock(args []string) error {
 	doc := `Usage:
-  <BINARY_NAME> datastore migrate unlock [--config=<CONFIG>]
+  <BINARY_NAME> <MIGRATE> unlock [--config=<CONFIG>]
 
 Options:
   -h --help                 Show this screen.
@@ -41,9 +40,8 @@ Description:
   Unlock the datastore to complete migration. This once again allows
   Calico resources to take effect in the cluster.
 `
-	// Replace all instances of BINARY_NAME with the name of the binary.
-	name, _ := util.NameAndDescription()
-	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+	// Replace the BINARY_NAME and MIGRATE placeholders.
+	doc = usage(doc, args)
 
 	parsedArgs, err := docopt.ParseArgs(doc, args, "")
 	if err != nil {
@@ -0,0 +1,408 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/validate"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	calicoErrors "github.com/projectcalico/libcalico-go/lib/errors"
+	"github.com/projectcalico/libcalico-go/lib/options"
+)
+
+func Verify(args []string) error {
+	doc := `Usage:
+  <BINARY_NAME> <MIGRATE> verify --before=<FILENAME> [--after=<CONFIG>]
+
+Options:
+  -h --help                 Show this screen.
+     --before=<FILENAME>    File created by the export command.  If set to
+                            "-" loads from stdin.
+     --after=<CONFIG>       Path to the file containing connection
+                            configuration, in YAML or JSON format, for the
+                            datastore that the export was imported into.
+                            [default: ` + constants.DefaultConfigPath + `]
+
+Description:
+  Verify a completed migration by comparing the file created by the export
+  command with the contents of the datastore that it was imported into.  Every
+  difference is reported, including fields such as status that were not
+  preserved by the migration.  This command does not modify the datastore.
+
+  Each exported v3 resource must exist with the same labels, annotations, spec
+  and any other fields.  The last-applied annotation, which is added by import
+  --save-config, is not compared.  Resources created in the datastore since the
+  import are not reported.  The cluster GUID and Calico version must match the
+  export, so they are reported if the import used --preserve-cluster-info.  The IPAM
+  blocks, block affinities, handles and configuration must match the export
+  exactly, so any allocations made since the import are reported.
+
+  The references between the resources in the datastore are also checked, as
+  for "validate references".  References that do not resolve are reported as
+  warnings, since they may have been exported that way, and do not cause the
+  verification to fail.
+`
+	// Replace the BINARY_NAME and MIGRATE placeholders.
+	doc = usage(doc, args)
+
+	parsedArgs, err := docopt.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if len(parsedArgs) == 0 {
+		return nil
+	}
+
+	client, err := clientmgr.NewClient(parsedArgs["--after"].(string))
+	if err != nil {
+		return err
+	}
+
+	discrepancies, err := VerifyImport(context.Background(), client, parsedArgs["--before"].(string))
+	if err != nil {
+		return err
+	}
+	for _, d := range discrepancies {
+		fmt.Printf("  %s\n", d)
+	}
+
+	// References that do not resolve may have been exported that way, so they are
+	// reported without failing the verification.
+	dangling, err := validate.CheckReferences(context.Background(), client)
+	if err != nil {
+		return err
+	}
+	if len(dangling) > 0 {
+		fmt.Printf("Warning: found %d references that do not resolve:\n", len(dangling))
+		for _, d := range dangling {
+			fmt.Printf("  %s\n", d)
+		}
+	}
+
+	if len(discrepancies) > 0 {
+		return fmt.Errorf("Found %d discrepancies between the export and the datastore.", len(discrepancies))
+	}
+	fmt.Println("Migration verified. The datastore matches the export.")
+	return nil
+}
+
+// Discrepancy is a difference between an export and the datastore it was imported into.
+type Discrepancy struct {
+	// The kind of resource, for example "NetworkPolicy" or "IPAMBlock".
+	Kind string
+
+	// The name of the resource, including the namespace of namespaced resources.
+	Name string
+
+	// A description of the difference.
+	Detail string
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s %s: %s", d.Kind, d.Name, d.Detail)
+}
+
+// VerifyImport compares the file created by the export command with the contents of the
+// datastore it was imported into, returning every difference found.
+func VerifyImport(ctx context.Context, c client.Interface, filename string) ([]Discrepancy, error) {
+	v3Yaml, clusterInfoJson, ipamJson, err := splitImportFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading migration file: %s", err)
+	}
+
+	discrepancies, err := verifyV3Resources(ctx, c, v3Yaml)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := verifyClusterInfo(ctx, c, clusterInfoJson)
+	if err != nil {
+		return nil, err
+	}
+	discrepancies = append(discrepancies, d...)
+
+	d, err = verifyIPAM(c, ipamJson)
+	if err != nil {
+		return nil, err
+	}
+	return append(discrepancies, d...), nil
+}
+
+// verifyV3Resources checks that each exported v3 resource exists in the datastore and
+// matches the export.
+func verifyV3Resources(ctx context.Context, c client.Interface, data []byte) ([]Discrepancy, error) {
+	objs, err := resourcemgr.CreateResourcesFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing v3 resources: %s", err)
+	}
+
+	var discrepancies []Discrepancy
+	for _, obj := range objs {
+		err := eachResource(obj, func(before resourcemgr.ResourceObject) error {
+			kind := before.GetObjectKind().GroupVersionKind().Kind
+			name := before.GetObjectMeta().GetName()
+			if ns := before.GetObjectMeta().GetNamespace(); ns != "" {
+				name = ns + "/" + name
+			}
+
+			after, err := resourcemgr.GetResourceManager(before).GetOrList(ctx, c, before)
+			if _, ok := err.(calicoErrors.ErrorResourceDoesNotExist); ok {
+				discrepancies = append(discrepancies, Discrepancy{kind, name, "missing from the datastore"})
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("Error retrieving %s %s: %s", kind, name, err)
+			}
+
+			diffs, err := DiffResources(before, after)
+			if err != nil {
+				return err
+			}
+			for _, diff := range diffs {
+				discrepancies = append(discrepancies, Discrepancy{kind, name, diff})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return discrepancies, nil
+}
+
+// DiffResources compares an exported resource with the same resource read from the
+// datastore, returning a description of each field that differs. The labels and
+// annotations, spec, and every other top level field, such as status, are compared.
+// The remaining metadata is set by the datastore, and so is not compared. Nor is the
+// last-applied annotation, which records how the resource was applied rather than its
+// configuration, and is added by import --save-config.
+func DiffResources(before, after runtime.Object) ([]string, error) {
+	b, err := comparableFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := comparableFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]bool{}
+	for f := range b {
+		fields[f] = true
+	}
+	for f := range a {
+		fields[f] = true
+	}
+	var sorted []string
+	for f := range fields {
+		sorted = append(sorted, f)
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, f := range sorted {
+		bv, inBefore := b[f]
+		av, inAfter := a[f]
+		switch {
+		case reflect.DeepEqual(bv, av):
+		case !inAfter || av == nil:
+			diffs = append(diffs, fmt.Sprintf("%s is missing from the datastore", f))
+		case !inBefore || bv == nil:
+			diffs = append(diffs, fmt.Sprintf("%s is not in the export", f))
+		default:
+			diffs = append(diffs, fmt.Sprintf("%s differs from the export", f))
+		}
+	}
+	return diffs, nil
+}
+
+// comparableFields returns the fields of the resource to compare, keyed by field name.
+func comparableFields(obj runtime.Object) (map[string]interface{}, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "apiVersion")
+	delete(fields, "kind")
+
+	var m v1.ObjectMeta
+	if md, ok := fields["metadata"]; ok {
+		b, err := json.Marshal(md)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		delete(fields, "metadata")
+	}
+	common.RemoveLastAppliedConfig(&m)
+	if len(m.Labels) > 0 {
+		fields["metadata.labels"] = m.Labels
+	}
+	if len(m.Annotations) > 0 {
+		fields["metadata.annotations"] = m.Annotations
+	}
+	return fields, nil
+}
+
+// verifyClusterInfo checks that the cluster GUID and Calico version match the export.
+func verifyClusterInfo(ctx context.Context, c client.Interface, clusterInfoJson []byte) ([]Discrepancy, error) {
+	exported := apiv3.ClusterInformation{}
+	if err := json.Unmarshal(clusterInfoJson, &exported); err != nil {
+		return nil, fmt.Errorf("Error reading exported cluster info: %s", err)
+	}
+	clusterinfo, err := c.ClusterInformation().Get(ctx, "default", options.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving ClusterInformation: %s", err)
+	}
+
+	var discrepancies []Discrepancy
+	if clusterinfo.Spec.ClusterGUID != exported.Spec.ClusterGUID {
+		discrepancies = append(discrepancies, Discrepancy{apiv3.KindClusterInformation, "default",
+			fmt.Sprintf("cluster GUID is %s, expected %s", clusterinfo.Spec.ClusterGUID, exported.Spec.ClusterGUID)})
+	}
+	if clusterinfo.Spec.CalicoVersion != exported.Spec.CalicoVersion {
+		discrepancies = append(discrepancies, Discrepancy{apiv3.KindClusterInformation, "default",
+			fmt.Sprintf("Calico version is %s, expected %s", clusterinfo.Spec.CalicoVersion, exported.Spec.CalicoVersion)})
+	}
+	return discrepancies, nil
+}
+
+// verifyIPAM checks that the IPAM resources in the datastore match the export exactly.
+func verifyIPAM(c client.Interface, ipamJson []byte) ([]Discrepancy, error) {
+	exported := NewMigrateIPAM(c)
+	if err := json.Unmarshal(ipamJson, exported); err != nil {
+		return nil, fmt.Errorf("Failed to read IPAM resources: %s", err)
+	}
+	current := NewMigrateIPAM(c)
+	if err := current.PullFromDatastore(); err != nil {
+		return nil, fmt.Errorf("Failed to retrieve IPAM resources: %s", err)
+	}
+
+	var discrepancies []Discrepancy
+	diff := func(kind string, before, after map[string]interface{}) error {
+		d, err := diffIPAMValues(kind, before, after)
+		discrepancies = append(discrepancies, d...)
+		return err
+	}
+
+	before, after := map[string]interface{}{}, map[string]interface{}{}
+	for _, kv := range exported.IPAMBlocks {
+		before[kv.Key] = kv.Value
+	}
+	for _, kv := range current.IPAMBlocks {
+		after[kv.Key] = kv.Value
+	}
+	if err := diff("IPAMBlock", before, after); err != nil {
+		return nil, err
+	}
+
+	before, after = map[string]interface{}{}, map[string]interface{}{}
+	for _, kv := range exported.BlockAffinities {
+		before[kv.Key] = kv.Value
+	}
+	for _, kv := range current.BlockAffinities {
+		after[kv.Key] = kv.Value
+	}
+	if err := diff("BlockAffinity", before, after); err != nil {
+		return nil, err
+	}
+
+	before, after = map[string]interface{}{}, map[string]interface{}{}
+	for _, kv := range exported.IPAMHandles {
+		before[kv.Key] = kv.Value
+	}
+	for _, kv := range current.IPAMHandles {
+		after[kv.Key] = kv.Value
+	}
+	if err := diff("IPAMHandle", before, after); err != nil {
+		return nil, err
+	}
+
+	before, after = map[string]interface{}{}, map[string]interface{}{}
+	if exported.IPAMConfig != nil {
+		before[exported.IPAMConfig.Key] = exported.IPAMConfig.Value
+	}
+	if current.IPAMConfig != nil {
+		after[current.IPAMConfig.Key] = current.IPAMConfig.Value
+	}
+	if err := diff("IPAMConfig", before, after); err != nil {
+		return nil, err
+	}
+	return discrepancies, nil
+}
+
+// diffIPAMValues compares the exported IPAM values of a kind with the values in the
+// datastore, keyed by the default path of each resource. The values are compared in
+// their exported JSON form, so fields which are not exported are not compared.
+func diffIPAMValues(kind string, before, after map[string]interface{}) ([]Discrepancy, error) {
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var discrepancies []Discrepancy
+	for _, k := range sorted {
+		bv, inBefore := before[k]
+		av, inAfter := after[k]
+		if !inAfter {
+			discrepancies = append(discrepancies, Discrepancy{kind, k, "missing from the datastore"})
+			continue
+		} else if !inBefore {
+			discrepancies = append(discrepancies, Discrepancy{kind, k, "not in the export"})
+			continue
+		}
+		bj, err := json.Marshal(bv)
+		if err != nil {
+			return nil, err
+		}
+		aj, err := json.Marshal(av)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(bj, aj) {
+			discrepancies = append(discrepancies, Discrepancy{kind, k, "differs from the export"})
+		}
+	}
+	return discrepancies, nil
+}
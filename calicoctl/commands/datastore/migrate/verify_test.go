@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate_test
+
+import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migration verify handling", func() {
+	newPolicy := func() *apiv3.NetworkPolicy {
+		p := apiv3.NewNetworkPolicy()
+		p.Name = "allow-dns"
+		p.Namespace = "default"
+		p.Labels = map[string]string{"team": "dns"}
+		p.Spec.Selector = "all()"
+		return p
+	}
+
+	It("should ignore metadata set by the datastore", func() {
+		before := newPolicy()
+		after := newPolicy()
+		after.ResourceVersion = "1234"
+		after.UID = "abcd"
+		after.CreationTimestamp = v1.Now()
+		Expect(migrate.DiffResources(before, after)).To(BeEmpty())
+	})
+
+	It("should report a spec that differs", func() {
+		before := newPolicy()
+		after := newPolicy()
+		after.Spec.Selector = "role == 'dns'"
+		Expect(migrate.DiffResources(before, after)).To(Equal([]string{"spec differs from the export"}))
+	})
+
+	It("should report labels that are missing", func() {
+		before := newPolicy()
+		after := newPolicy()
+		after.Labels = nil
+		Expect(migrate.DiffResources(before, after)).To(Equal([]string{"metadata.labels is missing from the datastore"}))
+	})
+
+	It("should report annotations that were added", func() {
+		before := newPolicy()
+		after := newPolicy()
+		after.Annotations = map[string]string{"note": "added"}
+		Expect(migrate.DiffResources(before, after)).To(Equal([]string{"metadata.annotations is not in the export"}))
+	})
+
+	It("should ignore the last-applied annotation added by import --save-config", func() {
+		before := apiv3.NewIPPool()
+		before.Name = "ipam-test-v4"
+		before.Spec.CIDR = "10.65.0.0/16"
+		after := before.DeepCopy()
+		Expect(common.SetLastAppliedConfig(after)).To(Succeed())
+		Expect(migrate.DiffResources(before, after)).To(BeEmpty())
+
+		after.Annotations["note"] = "added"
+		Expect(migrate.DiffResources(before, after)).To(Equal([]string{"metadata.annotations is not in the export"}))
+	})
+})
@@ -15,6 +15,8 @@
 package commands
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -22,14 +24,18 @@ import (
 	"github.com/docopt/docopt-go"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/argutils"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
 )
 
 func Delete(args []string) error {
 	doc := constants.DatastoreIntro + `Usage:
   <BINARY_NAME> delete ( (<KIND> [<NAME>...]) |
+                   (<KIND> --selector=<SELECTOR> [--dry-run] [--yes]) |
                    --filename=<FILE> [--recursive] [--skip-empty] )
                    [--skip-not-exists] [--config=<CONFIG>] [--namespace=<NS>] [--context=<context>]
 
@@ -43,6 +49,16 @@ Examples:
   # Delete policies with names "foo" and "bar"
   <BINARY_NAME> delete policy foo bar
 
+  # Delete the policies named in names.txt, one per line
+  cat names.txt | <BINARY_NAME> delete policy -
+
+  # Delete the IP pools listed by get
+  <BINARY_NAME> get ippools -o name | xargs <BINARY_NAME> delete
+
+  # Preview, and then delete, the policies labelled app=legacy
+  <BINARY_NAME> delete policy -l app=legacy --dry-run
+  <BINARY_NAME> delete policy -l app=legacy
+
 Options:
   -h --help                 Show this screen.
   -s --skip-not-exists      Skip over and treat as successful, resources that
@@ -62,6 +78,12 @@ Options:
                             Only applicable to NetworkPolicy, NetworkSet, and WorkloadEndpoint.
                             Uses the default namespace if not specified.
   --context=<context>       The name of the kubeconfig context to use.
+  -l --selector=<SELECTOR>  Delete the resources of the type whose labels match
+                            the label selector, for example app=legacy.
+     --dry-run              Print the resources that match the selector,
+                            without deleting them.
+     --yes                  Delete the resources that match the selector
+                            without asking for confirmation.
 
 Description:
   The delete command is used to delete a set of resources by filename or stdin,
@@ -84,7 +106,14 @@ Description:
     * profile
     * workloadEndpoint
 
-  The resource type is case insensitive and may be pluralized.
+  The resource type is case insensitive and may be pluralized.  A resource may
+  also be named as <KIND>/<NAME>, as printed by "get -o name", in place of
+  <KIND> <NAME>, for example "ippool/pool1".
+
+  If <NAME> is "-" the names are read from stdin, one per line.  Blank lines
+  and lines starting with "#" are ignored.  A failure to delete one of the named
+  resources does not stop the remaining resources being processed, and the
+  status of each named resource is written to stderr.
 
   Attempting to delete a resource that does not exists is treated as a
   terminating error unless the --skip-not-exists flag is set.  If this flag is
@@ -101,6 +130,17 @@ Description:
   The resources are deleted in the order they are specified.  In the event of a
   failure deleting a specific resource it is possible to work out which
   resource failed based on the number of resources successfully deleted.
+
+  Use --selector to delete every resource of the type whose labels match a
+  label selector, instead of naming the resources.  The selector uses the same
+  syntax as kubectl, for example "app=legacy", "app!=web" or "app in (a,b)".
+  Namespaced resources are only selected from the namespace given by
+  --namespace, or the default namespace.  The matching resources are listed,
+  and the command asks for confirmation before deleting them, unless --yes is
+  set.  Use --dry-run to list the matching resources without deleting them.
+  The outcome of deleting each resource is printed, followed by the number of
+  resources deleted.  A failure to delete one resource does not stop the
+  remaining resources being deleted.
 `
 	// Replace all instances of BINARY_NAME with the name of the binary.
 	name, _ := util.NameAndDescription()
@@ -117,6 +157,10 @@ Description:
 		os.Setenv("K8S_CURRENT_CONTEXT", context.(string))
 	}
 
+	if selector := parsedArgs["--selector"]; selector != nil {
+		return deleteBySelector(parsedArgs, selector.(string))
+	}
+
 	results := common.ExecuteConfigCommand(parsedArgs, common.ActionDelete)
 	log.Infof("results: %+v", results)
 
@@ -152,3 +196,76 @@ Description:
 
 	return nil
 }
+
+// deleteBySelector deletes the resources of the kind whose labels match the selector,
+// after asking for confirmation unless --yes is set.
+func deleteBySelector(parsedArgs map[string]interface{}, selector string) error {
+	ctx := context.Background()
+	kind := parsedArgs["<KIND>"].(string)
+	rh, err := resourcemgr.GetResourceHelper(kind)
+	if err != nil {
+		return err
+	}
+	client, err := clientmgr.NewClient(parsedArgs["--config"].(string))
+	if err != nil {
+		return err
+	}
+
+	namespace := ""
+	if rh.IsNamespaced() {
+		namespace = argutils.ArgStringOrBlank(parsedArgs, "--namespace")
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+	list, err := rh.List(ctx, client, namespace)
+	if err != nil {
+		return fmt.Errorf("Failed to list '%s' resources: %v", kind, err)
+	}
+	resources, err := common.SelectResources(list, selector)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		fmt.Printf("No '%s' resources match the selector '%s'\n", kind, selector)
+		return nil
+	}
+
+	for _, r := range resources {
+		fmt.Printf("  %s\n", resourceName(r))
+	}
+	if argutils.ArgBoolOrFalse(parsedArgs, "--dry-run") {
+		fmt.Printf("Dry run: would delete %d '%s' resource(s); no changes were made\n", len(resources), kind)
+		return nil
+	}
+	if !argutils.ArgBoolOrFalse(parsedArgs, "--yes") {
+		fmt.Printf("Delete %d '%s' resource(s)? [y/N] ", len(resources), kind)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fmt.Errorf("Aborted; no resources were deleted")
+		}
+	}
+
+	numDeleted := 0
+	for _, r := range resources {
+		if _, err := rh.Delete(ctx, client, r); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete %s: %v\n", resourceName(r), err)
+			continue
+		}
+		fmt.Printf("Deleted %s\n", resourceName(r))
+		numDeleted++
+	}
+	if numDeleted < len(resources) {
+		return fmt.Errorf("Deleted %d of %d '%s' resource(s); %d failed", numDeleted, len(resources), kind, len(resources)-numDeleted)
+	}
+	fmt.Printf("Successfully deleted %d '%s' resource(s)\n", numDeleted, kind)
+	return nil
+}
+
+// resourceName returns the name of the resource, prefixed with its namespace if it has one.
+func resourceName(r resourcemgr.ResourceObject) string {
+	if ns := r.GetObjectMeta().GetNamespace(); ns != "" {
+		return ns + "/" + r.GetObjectMeta().GetName()
+	}
+	return r.GetObjectMeta().GetName()
+}
@@ -17,8 +17,10 @@ package commands
 import (
 	"github.com/docopt/docopt-go"
 
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -33,7 +35,9 @@ func Get(args []string) error {
 	doc := constants.DatastoreIntro + `Usage:
   <BINARY_NAME> get ( (<KIND> [<NAME>...]) |
                 --filename=<FILENAME> [--recursive] [--skip-empty] )
-                [--output=<OUTPUT>] [--config=<CONFIG>] [--namespace=<NS>] [--all-namespaces] [--export] [--context=<context>]
+                [--output=<OUTPUT>] [--config=<CONFIG>] [--namespace=<NS>] [--all-namespaces] [--export | --raw | --canonical] [--context=<context>]
+                [--no-headers] [--no-truncate] [--no-color | --force-color] [--limit=<N> [--continue=<TOKEN>]]
+                [--label-columns=<LABELS>] [--chunk-output] [--by-order] [--count]
 
 Examples:
   # List all policy in default output format.
@@ -42,6 +46,31 @@ Examples:
   # List specific policies in YAML format
   <BINARY_NAME> get -o yaml policy my-policy-1 my-policy-2
 
+  # Get the policies named in names.txt, one per line
+  cat names.txt | <BINARY_NAME> get policy -
+
+  # List the first 100 workload endpoints, then the next 100
+  <BINARY_NAME> get workloadendpoints -A --limit=100
+  <BINARY_NAME> get workloadendpoints -A --limit=100 --continue=<TOKEN>
+
+  # List the IP pools, with a column showing the value of the zone label
+  <BINARY_NAME> get ippools --label-columns=zone
+
+  # Back up all of the workload endpoints, writing each one as it is rendered
+  <BINARY_NAME> get workloadendpoints -A -o yaml --chunk-output > weps.yaml
+
+  # List the global network policies in the order they are evaluated
+  <BINARY_NAME> get globalnetworkpolicies --by-order -o wide
+
+  # Count the network policies in each namespace
+  <BINARY_NAME> get networkpolicies -A --count
+
+  # Export the IP pools in a stable form for version control
+  <BINARY_NAME> get ippools -o yaml --canonical > ippools.yaml
+
+  # Show a node exactly as it is stored in the datastore
+  <BINARY_NAME> get node my-node --raw -o yaml
+
 Options:
   -h --help                    Show this screen.
   -f --filename=<FILENAME>     Filename to use to get the resource.  If set to
@@ -52,7 +81,7 @@ Options:
      --skip-empty              Do not error if any files or directory specified using -f or --filename contain no
                                data.
   -o --output=<OUTPUT FORMAT>  Output format.  One of: yaml, json, ps, wide,
-                               custom-columns=..., go-template=...,
+                               name, custom-columns=..., go-template=...,
                                go-template-file=...   [Default: ps]
   -c --config=<CONFIG>         Path to the file containing connection
                                configuration in YAML or JSON format.
@@ -62,9 +91,40 @@ Options:
                                Uses the default namespace if not specified.
   -A --all-namespaces          If present, list the requested object(s) across all namespaces.
   --export                     If present, returns the requested object(s) stripped of
-                               cluster-specific information. This flag will be ignored
-                               if <NAME> is not specified.
+                               cluster-specific information, including the
+                               last-applied annotation recorded by --save-config.
+                               This flag will be ignored if <NAME> is not specified.
+  --canonical                  Print the requested object(s) in a canonical form
+                               that is identical for unchanged resources.  Only
+                               applicable to the yaml and json output formats.
+  --raw                        If present, returns the requested object(s) as
+                               stored in the datastore.  Only applicable to
+                               the yaml and json output formats.
   --context=<context>          The name of the kubeconfig context to use.
+  --no-headers                 Do not print the headings row in ps, wide and
+                               custom-columns output.
+  --no-truncate                Do not truncate the columns of ps, wide and
+                               custom-columns output to fit the terminal width.
+  --no-color                   Do not use color in ps, wide and custom-columns
+                               output.
+  --force-color                Use color in ps, wide and custom-columns output,
+                               even when not writing to a terminal.
+  --limit=<N>                  List at most N resources.  Ignored unless listing
+                               all resources of a type.
+  --continue=<TOKEN>           Continue a list from the token printed by a
+                               previous list with --limit.
+  -L --label-columns=<LABELS>  Comma separated list of labels to show as
+                               additional columns in ps, wide and
+                               custom-columns output.
+  --chunk-output               Write each resource as a separate YAML document
+                               as soon as it is rendered, rather than building
+                               a single document.  Only applicable to the yaml
+                               output format.
+  --by-order                   List policies in the order they are evaluated.
+                               Only applicable to networkPolicy and
+                               globalNetworkPolicy.
+  --count                      Print the number of resources rather than the
+                               resources themselves.
 
 Description:
   The get command is used to display a set of resources by filename or stdin,
@@ -89,6 +149,11 @@ Description:
 
   The resource type is case insensitive and may be pluralized.
 
+  If <NAME> is "-" the names are read from stdin, one per line.  Blank lines
+  and lines starting with "#" are ignored.  A failure to get one of the named
+  resources does not stop the remaining resources being processed, and the
+  status of each named resource is written to stderr.
+
   Attempting to get resources that do not exist will simply return no results.
 
   When getting resources by type, only a single type may be specified at a
@@ -101,7 +166,8 @@ Description:
   alternative ways to display the data using the --output option:
 
     ps                    Display the results in ps-style output.
-    wide                  As per the ps option, but includes more headings.
+    wide                  As per the ps option, but includes more headings,
+                          including the AGE of each resource.
     custom-columns        As per the ps option, but only display the columns
                           that are requested in the comma-separated list.
     go-template           Display the results using the specified golang
@@ -109,9 +175,90 @@ Description:
                           example to return a specific value.
     go-template-file      Display the results using the golang template that is
                           contained in the specified file.
+    name                  Display one <kind>/<name> line per resource.
     yaml                  Display the results in YAML output format.
     json                  Display the results in JSON output format.
 
+  When the ps, wide or custom-columns output is written to a terminal, the
+  headings are emboldened and disabled IP pools and policies with no order are
+  highlighted. Set the NO_COLOR environment variable or use --no-color to
+  disable color output, or use --force-color to color output that is not
+  written to a terminal.
+
+  When the ps, wide or custom-columns output is written to a terminal, the
+  widest columns (such as selectors) are truncated with an ellipsis so that
+  each line fits the terminal width. The width is taken from the COLUMNS
+  environment variable if set. Use --no-truncate to show the full values.
+  The yaml, json and go-template output formats are never truncated.
+
+  The --label-columns option adds a column to the ps, wide or custom-columns
+  output for each of the labels, showing the value of that label of each
+  resource, or nothing if the resource does not have the label.  The heading
+  of each column is the full key of the label, including any prefix, in upper
+  case.  This works for every resource type.
+
+  The go-template and go-template-file templates are executed against the list
+  of results.  Each result is either a single resource, with ObjectMeta, Spec
+  and (for some kinds) Status fields, or a resource list with Items.  For
+  example, to print the CIDR of each IP pool:
+
+    <BINARY_NAME> get ippools -o go-template='{{range .}}{{range .Items}}{{.Spec.CIDR}}{{"\n"}}{{end}}{{end}}'
+
+  The templates can use the same functions as the table output: join and
+  joinAndTruncate to join the values of a list or map, config to look up a
+  global configuration value (currently only "asnumber"), and age to format
+  a creation timestamp, for example {{age .ObjectMeta.CreationTimestamp}}.
+
+  The name output is intended for scripts, for example to pipe into xargs.  It
+  is never colored or truncated, has no headings, and skips any objects that
+  are not Calico resources.  The namespace is not included, so pass the same
+  --namespace to the next command.  The get and delete commands accept a
+  resource named as <KIND>/<NAME> in place of <KIND> <NAME>, for example:
+
+    <BINARY_NAME> get networkpolicies -n dev -o name | xargs <BINARY_NAME> delete -n dev
+
+  When listing all resources of a type, use --limit to list at most N
+  resources.  Resources are listed in order of namespace and name.  If more
+  resources remain, a continue token is written to stderr, and is also set in
+  the list metadata of yaml and json output.  Pass the token with --continue,
+  along with the same type and --limit, to list the next page.  The datastore
+  does not support paginated lists, so each page is selected from the full list.
+
+  Use --raw to debug how a resource is stored.  Each resource is fetched again
+  from the datastore, bypassing the defaulting and conversion applied by the
+  Calico API client, and printed with all of its fields, including the status
+  and the metadata managed by the datastore.  Lists are printed as their
+  individual resources.  Raw output is not always valid input to the resource
+  management commands.
+
+  Use --canonical to store the output in version control.  The metadata and
+  status managed by the datastore and the Calico components, and the
+  last-applied annotation, are removed, and the resources of each list are
+  sorted by namespace and name.  Fields are always written in a fixed order,
+  with map keys sorted, so two exports of unchanged resources are identical.
+  Unlike --export, the namespace is kept, and lists are included.  The list
+  metadata, including any continue token, is removed; the continue token is
+  still written to stderr.
+
+  Use --chunk-output with the yaml output format when dumping many resources,
+  for example in backup scripts.  Each resource is written as a separate YAML
+  document, preceded by "---", as soon as it is rendered, so the output starts
+  sooner and a single large document is never built in memory.  Lists are
+  written as their individual resources, so the list metadata (including any
+  continue token) is not included; the continue token is still written to
+  stderr.  This works with --limit, --continue and --raw.
+
+  Use --by-order to list NetworkPolicies or GlobalNetworkPolicies in the order
+  they are evaluated, rather than the order they are returned by the datastore.
+  Policies are sorted by their order, with the policies that have no order last,
+  and then by namespace and name.  This cannot be combined with --limit, since
+  pages are selected in order of namespace and name.
+
+  Use --count to print only the number of resources, rather than piping the
+  output through "wc -l".  This works for every resource type.  With
+  --all-namespaces, the number in each namespace is printed, followed by the
+  total.  The --output option is ignored.
+
   Note that the data output using YAML or JSON format is always valid to use as
   input to all of the resource management commands (create, apply, replace,
   delete, get).
@@ -142,23 +289,44 @@ Description:
 	if context := parsedArgs["--context"]; context != nil {
 		os.Setenv("K8S_CURRENT_CONTEXT", context.(string))
 	}
+	if err := common.SplitKindNames(parsedArgs); err != nil {
+		return err
+	}
 
 	printNamespace := false
 	if argutils.ArgBoolOrFalse(parsedArgs, "--all-namespaces") || argutils.ArgStringOrBlank(parsedArgs, "--namespace") != "" {
 		printNamespace = true
 	}
 
+	noHeaders := argutils.ArgBoolOrFalse(parsedArgs, "--no-headers")
+	color := common.ColorEnabled(argutils.ArgBoolOrFalse(parsedArgs, "--force-color"), argutils.ArgBoolOrFalse(parsedArgs, "--no-color"))
+	maxWidth := 0
+	if !argutils.ArgBoolOrFalse(parsedArgs, "--no-truncate") {
+		maxWidth = common.TerminalWidth()
+	}
+
+	var labelColumns []string
+	if arg := argutils.ArgStringOrBlank(parsedArgs, "--label-columns"); arg != "" {
+		for _, l := range strings.Split(arg, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				labelColumns = append(labelColumns, l)
+			}
+		}
+	}
+
 	var rp common.ResourcePrinter
 	output := parsedArgs["--output"].(string)
 	switch output {
 	case "yaml", "yml":
-		rp = common.ResourcePrinterYAML{}
+		rp = common.ResourcePrinterYAML{Chunk: argutils.ArgBoolOrFalse(parsedArgs, "--chunk-output")}
 	case "json":
 		rp = common.ResourcePrinterJSON{}
 	case "ps":
-		rp = common.ResourcePrinterTable{Wide: false, PrintNamespace: printNamespace}
+		rp = common.ResourcePrinterTable{Wide: false, PrintNamespace: printNamespace, NoHeaders: noHeaders, Color: color, MaxWidth: maxWidth, LabelColumns: labelColumns}
 	case "wide":
-		rp = common.ResourcePrinterTable{Wide: true, PrintNamespace: printNamespace}
+		rp = common.ResourcePrinterTable{Wide: true, PrintNamespace: printNamespace, NoHeaders: noHeaders, Color: color, MaxWidth: maxWidth, LabelColumns: labelColumns}
+	case "name":
+		rp = common.ResourcePrinterName{}
 	default:
 		// Output format may be a key=value pair, so split on "=" to find out.  Pull
 		// out the key and value, and split the value by "," as some options allow
@@ -187,13 +355,56 @@ Description:
 			if outputValue == "" {
 				return fmt.Errorf("need to specify at least one column")
 			}
-			rp = common.ResourcePrinterTable{Headings: outputValues}
+			rp = common.ResourcePrinterTable{Headings: outputValues, NoHeaders: noHeaders, Color: color, MaxWidth: maxWidth, LabelColumns: labelColumns}
 		}
 	}
 
 	if rp == nil {
 		return fmt.Errorf("unrecognized output format '%s'", output)
 	}
+	if _, ok := rp.(common.ResourcePrinterTable); !ok && len(labelColumns) > 0 {
+		return fmt.Errorf("--label-columns is only supported with the ps, wide and custom-columns output formats")
+	}
+	if _, ok := rp.(common.ResourcePrinterYAML); !ok && argutils.ArgBoolOrFalse(parsedArgs, "--chunk-output") {
+		return fmt.Errorf("--chunk-output is only supported with the yaml output format")
+	}
+	raw := argutils.ArgBoolOrFalse(parsedArgs, "--raw")
+	if raw {
+		switch rp.(type) {
+		case common.ResourcePrinterYAML, common.ResourcePrinterJSON:
+		default:
+			return fmt.Errorf("--raw is only supported with the yaml and json output formats")
+		}
+	}
+	canonical := argutils.ArgBoolOrFalse(parsedArgs, "--canonical")
+	if canonical {
+		switch rp.(type) {
+		case common.ResourcePrinterYAML, common.ResourcePrinterJSON:
+		default:
+			return fmt.Errorf("--canonical is only supported with the yaml and json output formats")
+		}
+	}
+
+	// Pagination only applies when listing all resources of a type.
+	limit := 0
+	if arg := parsedArgs["--limit"]; arg != nil {
+		limit, err = strconv.Atoi(arg.(string))
+		if err != nil || limit <= 0 {
+			return fmt.Errorf("Invalid limit '%s', expected a positive integer", arg)
+		}
+		if parsedArgs["<KIND>"] == nil || len(parsedArgs["<NAME>"].([]string)) > 0 {
+			log.Info("Ignoring --limit when not listing all resources of a type")
+			limit = 0
+		}
+	}
+
+	byOrder := argutils.ArgBoolOrFalse(parsedArgs, "--by-order")
+	if byOrder && limit > 0 {
+		return fmt.Errorf("--by-order cannot be used with --limit")
+	}
+	if byOrder && canonical {
+		return fmt.Errorf("--by-order cannot be used with --canonical, which sorts by namespace and name")
+	}
 
 	results := common.ExecuteConfigCommand(parsedArgs, common.ActionGetOrList)
 
@@ -205,16 +416,66 @@ Description:
 		return fmt.Errorf("Failed to get resources: %v", results.Err)
 	}
 
+	var next string
+	if limit > 0 {
+		results.Resources, next, err = common.PageResources(results.Resources, limit, argutils.ArgStringOrBlank(parsedArgs, "--continue"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if argutils.ArgBoolOrFalse(parsedArgs, "--count") {
+		counts, err := common.CountResources(results.Resources)
+		if err != nil {
+			return err
+		}
+		perNamespace := argutils.ArgBoolOrFalse(parsedArgs, "--all-namespaces")
+		if err := common.PrintCounts(os.Stdout, counts, perNamespace, noHeaders); err != nil {
+			return err
+		}
+		if next != "" {
+			fmt.Fprintf(os.Stderr, "More resources are available. Use --continue=%s to list the next page.\n", next)
+		}
+		return getErrors(results.ResErrs)
+	}
+
+	if byOrder {
+		if err := common.SortPoliciesByOrder(results.Resources); err != nil {
+			return err
+		}
+	}
+
+	if raw {
+		results.Resources, err = common.RawResources(context.Background(), results.Client, results.Resources)
+		if err != nil {
+			return err
+		}
+	}
+
+	if canonical {
+		if err := common.CanonicalResources(results.Resources); err != nil {
+			return err
+		}
+	}
+
 	err = rp.Print(results.Client, results.Resources)
 	if err != nil {
 		return err
 	}
+	if next != "" {
+		fmt.Fprintf(os.Stderr, "More resources are available. Use --continue=%s to list the next page.\n", next)
+	}
+
+	return getErrors(results.ResErrs)
+}
 
-	if len(results.ResErrs) > 0 {
+// getErrors combines the errors from getting each of the resources.
+func getErrors(resErrs []error) error {
+	if len(resErrs) > 0 {
 		var errStr string
-		for i, err := range results.ResErrs {
+		for i, err := range resErrs {
 			errStr += err.Error()
-			if (i + 1) != len(results.ResErrs) {
+			if (i + 1) != len(resErrs) {
 				errStr += "\n"
 			}
 		}
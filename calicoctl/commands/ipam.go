@@ -32,9 +32,11 @@ func IPAM(args []string) error {
 
     check            Check the integrity of the IPAM datastructures.
     release          Release a Calico assigned IP address.
+    release-affinity Release the block affinities of a removed node.
     show             Show details of a Calico configuration,
                      assigned IP address, or of overall IP usage.
     configure        Configure IPAM
+    handle           List IPAM handles, or show the allocations of a handle.
 
 Options:
   -h --help      Show this screen.
@@ -69,10 +71,14 @@ Description:
 		return ipam.Check(args, VERSION)
 	case "release":
 		return ipam.Release(args, VERSION)
+	case "release-affinity":
+		return ipam.ReleaseAffinity(args)
 	case "show":
 		return ipam.Show(args)
 	case "configure":
 		return ipam.Configure(args)
+	case "handle":
+		return ipam.Handle(args)
 	default:
 		fmt.Println(doc)
 	}
@@ -0,0 +1,164 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/projectcalico/libcalico-go/lib/net"
+)
+
+// ReleaseAccounting is the outcome of a release from reports, written by "ipam release
+// --accounting-file". Like a Report, it has a summary of the counts followed by the IPs in
+// each category, so that "ipam check --compare-snapshot" can confirm that the number of
+// leaked IPs dropped by the number released.
+type ReleaseAccounting struct {
+	Version      string `json:"version"`
+	ClusterGUID  string `json:"clusterGUID"`
+	ClusterLabel string `json:"clusterLabel,omitempty"`
+
+	// Summary of the counts of the release.
+	Summary ReleaseAccountingSummary `json:"summary"`
+
+	// ReleasedIPs lists the IPs that were released.
+	ReleasedIPs []string `json:"releasedIPs,omitempty"`
+
+	// SkippedInUseIPs lists the IPs that were skipped by --recheck since they are now in use.
+	SkippedInUseIPs []string `json:"skippedInUseIPs,omitempty"`
+
+	// NotAllocatedIPs lists the IPs that were no longer allocated when they were released.
+	NotAllocatedIPs []string `json:"notAllocatedIPs,omitempty"`
+
+	// UnreleasedIPs lists the IPs that were to be released but may not have been, due to
+	// an error, an interrupt, the deadline or --max-release.
+	UnreleasedIPs []string `json:"unreleasedIPs,omitempty"`
+
+	// Errors lists the errors that stopped the release.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ReleaseAccountingSummary contains the counts of a release.
+type ReleaseAccountingSummary struct {
+	// The number of leaked IPs in the reports, before the release.
+	NumLeakedIPs int `json:"numLeakedIPs"`
+
+	NumReleasedIPs     int `json:"numReleasedIPs"`
+	NumSkippedInUseIPs int `json:"numSkippedInUseIPs"`
+	NumNotAllocatedIPs int `json:"numNotAllocatedIPs"`
+	NumUnreleasedIPs   int `json:"numUnreleasedIPs"`
+	NumErrors          int `json:"numErrors"`
+}
+
+// The methods that record the outcome of the release do nothing if the accounting is nil,
+// so that releases that do not write an accounting file need not check.
+
+func (a *ReleaseAccounting) addReleased(ips []net.IP) {
+	if a != nil {
+		a.ReleasedIPs = appendIPs(a.ReleasedIPs, ips)
+	}
+}
+
+func (a *ReleaseAccounting) addSkippedInUse(ips []net.IP) {
+	if a != nil {
+		a.SkippedInUseIPs = appendIPs(a.SkippedInUseIPs, ips)
+	}
+}
+
+func (a *ReleaseAccounting) addNotAllocated(ips []net.IP) {
+	if a != nil {
+		a.NotAllocatedIPs = appendIPs(a.NotAllocatedIPs, ips)
+	}
+}
+
+func (a *ReleaseAccounting) addUnreleased(ips []net.IP) {
+	if a != nil {
+		a.UnreleasedIPs = appendIPs(a.UnreleasedIPs, ips)
+	}
+}
+
+func (a *ReleaseAccounting) addError(err error) {
+	if a != nil && err != nil {
+		a.Errors = append(a.Errors, err.Error())
+	}
+}
+
+func appendIPs(s []string, ips []net.IP) []string {
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return s
+}
+
+// write fills in the counts of the summary and writes the accounting to the file as JSON.
+func (a *ReleaseAccounting) write(file string) error {
+	a.Summary.NumReleasedIPs = len(a.ReleasedIPs)
+	a.Summary.NumSkippedInUseIPs = len(a.SkippedInUseIPs)
+	a.Summary.NumNotAllocatedIPs = len(a.NotAllocatedIPs)
+	a.Summary.NumUnreleasedIPs = len(a.UnreleasedIPs)
+	a.Summary.NumErrors = len(a.Errors)
+	b, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		return fmt.Errorf("failed to write release accounting to %s: %w", file, err)
+	}
+	return nil
+}
+
+// loadReleaseAccounting reads the accounting written by a release.
+func loadReleaseAccounting(file string) (*ReleaseAccounting, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	a := &ReleaseAccounting{}
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SnapshotComparison compares the leaked IPs found by a check with the number expected
+// from the accounting of an earlier release.
+type SnapshotComparison struct {
+	// The number of leaked IPs before the release, and the number released.
+	NumLeakedIPsBefore int `json:"numLeakedIPsBefore"`
+	NumReleasedIPs     int `json:"numReleasedIPs"`
+
+	// The number of leaked IPs expected to remain, and the number found by the check.
+	NumLeakedIPsExpected int `json:"numLeakedIPsExpected"`
+	NumLeakedIPsFound    int `json:"numLeakedIPsFound"`
+}
+
+// compareSnapshot compares the number of leaked IPs found with the number expected to
+// remain after the release recorded by the snapshot, printing the outcome.
+func compareSnapshot(snapshot *ReleaseAccounting, numLeaked int) *SnapshotComparison {
+	cmp := &SnapshotComparison{
+		NumLeakedIPsBefore:   snapshot.Summary.NumLeakedIPs,
+		NumReleasedIPs:       snapshot.Summary.NumReleasedIPs,
+		NumLeakedIPsExpected: snapshot.Summary.NumLeakedIPs - snapshot.Summary.NumReleasedIPs,
+		NumLeakedIPsFound:    numLeaked,
+	}
+	fmt.Printf("The release recorded %d leaked IPs and released %d of them, so %d leaked IPs are expected; found %d.\n",
+		cmp.NumLeakedIPsBefore, cmp.NumReleasedIPs, cmp.NumLeakedIPsExpected, cmp.NumLeakedIPsFound)
+	if cmp.NumLeakedIPsFound > cmp.NumLeakedIPsExpected {
+		fmt.Printf("WARNING: Found %d more leaked IPs than expected. The release may not have taken effect, or IPs may have leaked since.\n",
+			cmp.NumLeakedIPsFound-cmp.NumLeakedIPsExpected)
+	}
+	return cmp
+}
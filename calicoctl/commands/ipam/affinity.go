@@ -0,0 +1,177 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	docopt "github.com/docopt/docopt-go"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/argutils"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	cerrors "github.com/projectcalico/libcalico-go/lib/errors"
+	"github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/options"
+)
+
+// ReleaseAffinity releases the block affinities of a node that has been removed from
+// the cluster.
+func ReleaseAffinity(args []string) error {
+	doc := constants.DatastoreIntro + `Usage:
+  <BINARY_NAME> ipam release-affinity --node=<NODE> [--release-allocations] [--force] [--config=<CONFIG>]
+
+Options:
+  -h --help                Show this screen.
+     --node=<NODE>         Name of the node whose block affinities are released.
+     --release-allocations Release the addresses allocated in the blocks as well
+                           as the affinities of the blocks.
+     --force               Release the block affinities even if the node still
+                           exists.
+  -c --config=<CONFIG>     Path to the file containing connection configuration in
+                           YAML or JSON format.
+                           [default: ` + constants.DefaultConfigPath + `]
+
+Description:
+  The ipam release-affinity command releases every block affinity held by a
+  node, so that its blocks return to the pool.  Use it to clean up after a node
+  is decommissioned without its IPAM resources being released.
+
+  By default only the affinities are released.  Any addresses still allocated
+  in the blocks remain allocated, and the blocks are released once they are
+  empty.  With --release-allocations, the addresses allocated in each block are
+  released first, so that the blocks are released immediately.  Only use this
+  option once no workloads on the node are using the addresses.
+
+  The command refuses to release the affinities of a node that still exists,
+  since the node would then allocate addresses from new blocks.  Use --force to
+  release them anyway.
+`
+	// Replace all instances of BINARY_NAME with the name of the binary.
+	name, _ := util.NameAndDescription()
+	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+
+	parsedArgs, err := docopt.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if len(parsedArgs) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+
+	// Create a new backend client from env vars.
+	cf := parsedArgs["--config"].(string)
+	client, err := clientmgr.NewClient(cf)
+	if err != nil {
+		return err
+	}
+
+	node := parsedArgs["--node"].(string)
+	if !argutils.ArgBoolOrFalse(parsedArgs, "--force") {
+		_, err := client.Nodes().Get(ctx, node, options.GetOptions{})
+		if err == nil {
+			return fmt.Errorf("Node %s still exists. Use --force to release its block affinities anyway", node)
+		} else if _, ok := err.(cerrors.ErrorResourceDoesNotExist); !ok {
+			return fmt.Errorf("Failed to get node %s: %v", node, err)
+		}
+	}
+
+	numBlocks, numIPs, err := releaseNodeAffinities(ctx, client, node, argutils.ArgBoolOrFalse(parsedArgs, "--release-allocations"))
+	if err != nil {
+		return err
+	}
+	if argutils.ArgBoolOrFalse(parsedArgs, "--release-allocations") {
+		fmt.Printf("Released %d block affinities and %d addresses of node %s\n", numBlocks, numIPs, node)
+	} else {
+		fmt.Printf("Released %d block affinities of node %s\n", numBlocks, node)
+	}
+	return nil
+}
+
+// releaseNodeAffinities releases every block affinity held by the node, returning the
+// number of affinities and the number of addresses released. If releaseAllocations is
+// set, the addresses allocated in each block are released before its affinity.
+func releaseNodeAffinities(ctx context.Context, c client.Interface, node string, releaseAllocations bool) (int, int, error) {
+	type accessor interface {
+		Backend() bapi.Client
+	}
+	bc := c.(accessor).Backend()
+
+	affinities, err := bc.List(ctx, model.BlockAffinityListOptions{Host: node}, "")
+	if err != nil {
+		return 0, 0, fmt.Errorf("Failed to list IPAM block affinities: %w", err)
+	}
+	var cidrs []net.IPNet
+	for _, kvp := range affinities.KVPairs {
+		// Not every backend filters the list by host.
+		if k := kvp.Key.(model.BlockAffinityKey); k.Host == node {
+			cidrs = append(cidrs, k.CIDR)
+		}
+	}
+	sort.Slice(cidrs, func(i, j int) bool { return cidrs[i].String() < cidrs[j].String() })
+
+	numBlocks, numIPs := 0, 0
+	for _, cidr := range cidrs {
+		if releaseAllocations {
+			n, err := releaseBlockAllocations(ctx, c, bc, cidr)
+			if err != nil {
+				return numBlocks, numIPs, err
+			}
+			numIPs += n
+		}
+		if err := c.IPAM().ReleaseAffinity(ctx, cidr, node, false); err != nil {
+			return numBlocks, numIPs, fmt.Errorf("Failed to release affinity of block %s: %w", cidr, err)
+		}
+		fmt.Printf("  Released affinity of block %s\n", cidr)
+		numBlocks++
+	}
+	return numBlocks, numIPs, nil
+}
+
+// releaseBlockAllocations releases the addresses allocated in the block, returning the
+// number released.
+func releaseBlockAllocations(ctx context.Context, c client.Interface, bc bapi.Client, cidr net.IPNet) (int, error) {
+	kvp, err := bc.Get(ctx, model.BlockKey{CIDR: cidr}, "")
+	if err != nil {
+		if _, ok := err.(cerrors.ErrorResourceDoesNotExist); ok {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Failed to get IPAM block %s: %w", cidr, err)
+	}
+	b := kvp.Value.(*model.AllocationBlock)
+
+	var ips []net.IP
+	for ord, attrIdx := range b.Allocations {
+		if attrIdx != nil {
+			ips = append(ips, b.OrdinalToIP(ord))
+		}
+	}
+	if len(ips) == 0 {
+		return 0, nil
+	}
+	unallocated, err := c.IPAM().ReleaseIPs(ctx, ips)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to release the addresses in block %s: %w", cidr, err)
+	}
+	return len(ips) - len(unallocated), nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	cerrors "github.com/projectcalico/libcalico-go/lib/errors"
+	"github.com/projectcalico/libcalico-go/lib/ipam"
+	"github.com/projectcalico/libcalico-go/lib/net"
+)
+
+// affinityBackend is a backend client that holds block affinities and blocks.
+type affinityBackend struct {
+	bapi.Client
+	affinities []*model.KVPair
+	blocks     map[string]*model.KVPair
+}
+
+func (b *affinityBackend) List(ctx context.Context, list model.ListInterface, revision string) (*model.KVPairList, error) {
+	return &model.KVPairList{KVPairs: b.affinities}, nil
+}
+
+func (b *affinityBackend) Get(ctx context.Context, key model.Key, revision string) (*model.KVPair, error) {
+	if kvp, ok := b.blocks[key.(model.BlockKey).CIDR.String()]; ok {
+		return kvp, nil
+	}
+	return nil, cerrors.ErrorResourceDoesNotExist{Identifier: key}
+}
+
+// affinityIPAM records the affinities and addresses it is asked to release.
+type affinityIPAM struct {
+	ipam.Interface
+	releasedAffinities []string
+	releasedIPs        []net.IP
+}
+
+func (i *affinityIPAM) ReleaseAffinity(ctx context.Context, cidr net.IPNet, host string, requireEmpty bool) error {
+	i.releasedAffinities = append(i.releasedAffinities, host+"/"+cidr.String())
+	return nil
+}
+
+func (i *affinityIPAM) ReleaseIPs(ctx context.Context, ips []net.IP) ([]net.IP, error) {
+	i.releasedIPs = append(i.releasedIPs, ips...)
+	return nil, nil
+}
+
+type affinityClient struct {
+	client.Interface
+	backend *affinityBackend
+	ipam    *affinityIPAM
+}
+
+func (c affinityClient) Backend() bapi.Client {
+	return c.backend
+}
+
+func (c affinityClient) IPAM() ipam.Interface {
+	return c.ipam
+}
+
+var _ = Describe("Testing releasing node affinities", func() {
+	var c affinityClient
+
+	BeforeEach(func() {
+		affinity := func(host, cidr string) *model.KVPair {
+			return &model.KVPair{Key: model.BlockAffinityKey{Host: host, CIDR: net.MustParseCIDR(cidr)}}
+		}
+		block := &model.AllocationBlock{
+			CIDR:        net.MustParseCIDR("10.0.1.0/30"),
+			Allocations: make([]*int, 4),
+		}
+		zero := 0
+		block.Allocations[1] = &zero
+		block.Allocations[3] = &zero
+
+		c = affinityClient{
+			backend: &affinityBackend{
+				affinities: []*model.KVPair{affinity("node1", "10.0.1.0/30"), affinity("node2", "10.0.2.0/30"), affinity("node1", "10.0.0.0/30")},
+				blocks:     map[string]*model.KVPair{"10.0.1.0/30": {Value: block}},
+			},
+			ipam: &affinityIPAM{},
+		}
+	})
+
+	It("should release only the affinities of the node", func() {
+		numBlocks, numIPs, err := releaseNodeAffinities(context.Background(), c, "node1", false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(numBlocks).To(Equal(2))
+		Expect(numIPs).To(Equal(0))
+		Expect(c.ipam.releasedAffinities).To(Equal([]string{"node1/10.0.0.0/30", "node1/10.0.1.0/30"}))
+		Expect(c.ipam.releasedIPs).To(BeEmpty())
+	})
+
+	It("should release the allocations in the blocks", func() {
+		numBlocks, numIPs, err := releaseNodeAffinities(context.Background(), c, "node1", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(numBlocks).To(Equal(2))
+		Expect(numIPs).To(Equal(2))
+		Expect(c.ipam.releasedIPs).To(Equal([]net.IP{net.MustParseIP("10.0.1.1"), net.MustParseIP("10.0.1.3")}))
+	})
+})
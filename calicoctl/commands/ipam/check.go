@@ -19,11 +19,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	docopt "github.com/docopt/docopt-go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/projectcalico/libcalico-go/lib/ipam"
@@ -36,7 +42,9 @@ import (
 
 	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
 	"github.com/projectcalico/libcalico-go/lib/options"
+	"github.com/projectcalico/libcalico-go/lib/selector"
 
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
 
@@ -46,19 +54,243 @@ import (
 // IPAM takes keyword with an IP address then calls the subcommands.
 func Check(args []string, version string) error {
 	doc := constants.DatastoreIntro + `Usage:
-  <BINARY_NAME> ipam check [--config=<CONFIG>] [--show-all-ips] [--show-problem-ips] [-o <FILE>]
+  <BINARY_NAME> ipam check [--config=<CONFIG>] [--show-all-ips] [--show-problem-ips] [--include-reserved] [--include-disabled] [-o <FILE>] [--summary-only]
+                          [--emit-remediation=<FILE>] [--report-dir=<DIR> [--report-retention=<N>]]
+                          [--ignore-namespace=<NS>...] [--ignore-handle-prefix=<PREFIX>...] [--reserved-handle-prefix=<PREFIX>...]
+                          [--no-truncate] [--quiet]
+                          [--node=<NODE>] [--cluster-label=<NAME>] [--expect-pools=<CIDRS>] [--attr-format=<FORMAT>]
+                          [--metrics-file=<PATH>] [--since-revision=<REPORT>] [--max-problem-lines=<N>]
+                          [--compare-snapshot=<FILE>] [--host-local-ranges=<CIDRS>]
 
 Options:
   -h --help                 Show this screen.
   -o --output=<FILE>        Path to output report file.
+     --metrics-file=<PATH>  Path to write the results to in the Prometheus text
+                            format, for example for the node_exporter textfile
+                            collector.
+     --summary-only         Only write the summary counts to the report file,
+                            omitting the per-IP allocation details.
+     --emit-remediation=<FILE>
+                            Write a report containing only the leaked addresses
+                            that can safely be released, for use with
+                            "ipam release --from-report".
+     --report-dir=<DIR>     Write the report to a timestamped file in the
+                            directory, for example when running periodically.
+     --report-retention=<N>
+                            Number of reports to keep in the report directory;
+                            the oldest reports are removed.  Zero keeps all
+                            reports.  [default: 0]
+     --since-revision=<REPORT>
+                            Path to a baseline report from an earlier check.
+                            Only the IPs that have leaked since the baseline
+                            are written to the reports.
+     --compare-snapshot=<FILE>
+                            Path to the accounting file written by "ipam
+                            release --accounting-file".  Confirms that the
+                            number of leaked IPs dropped by the number
+                            released.
      --show-all-ips         Print all IPs that are checked.
      --show-problem-ips     Print all IPs that are leaked or not allocated properly.
+     --max-problem-lines=<N>
+                            Print at most N lines about problem IPs, followed
+                            by the number of lines that were not printed.  Zero
+                            prints every line.  [default: 0]
+     --include-reserved     Report IPs reserved for Windows as a separate category
+                            instead of treating them as in use.
+     --include-disabled     Treat disabled IP pools as active, reporting in-use
+                            IPs in them as being in a disabled pool.
+     --ignore-namespace=<NS>
+                            Do not report problems with IPs that belong to
+                            workloads in the namespace.  May be repeated.
+     --ignore-handle-prefix=<PREFIX>
+                            Do not report leaked IPs whose allocation handle
+                            starts with the prefix.  May be repeated.
+     --reserved-handle-prefix=<PREFIX>
+                            Report IPs whose allocation handle starts with the
+                            prefix as reserved rather than leaked.  May be
+                            repeated.
+     --node=<NODE>          Only check the IPs allocated to or in use on the
+                            node.
+     --expect-pools=<CIDRS> Comma separated list of the CIDRs of the active IP
+                            pools that are expected, reporting any difference
+                            as a problem.
+     --host-local-ranges=<CIDRS>
+                            Comma separated list of the CIDRs of the ranges
+                            managed by the host-local IPAM plugin, reporting
+                            any Calico allocation or in-use IP in them as a
+                            conflict.
+     --no-truncate          Do not truncate the attributes of the printed IPs
+                            to fit the terminal width.
+     --quiet                Do not show progress bars when writing to a
+                            terminal.
+     --attr-format=<FORMAT> Format of the attributes of the printed IPs.  One of:
+                            default, json, keys=<KEYS>.
+                            [default: default]
+     --cluster-label=<NAME>
+                            Label identifying the cluster, used to prefix the
+                            summary and recorded in the report.
   -c --config=<CONFIG>      Path to the file containing connection configuration in
                             YAML or JSON format.
                             [default: ` + constants.DefaultConfigPath + `]
 
 Description:
   The ipam check command checks the integrity of the IPAM datastructures against Kubernetes.
+
+  IPs excluded from the problem categories by --ignore-namespace or
+  --ignore-handle-prefix are counted separately as ignored, and are listed in
+  the report.  Ignored leaked IPs are not released by "ipam release
+  --from-report".
+
+  When --node is specified, only the node's tunnel IPs and workload endpoints
+  are loaded, and only the allocations for the node and the block affinities
+  of the node are checked.  This is much faster on large clusters.  An IP
+  allocated to the node that is in use by a workload on another node is
+  reported as leaked, so check the whole cluster before releasing IPs.
+
+  The --show-problem-ips option prints a line for each IP with a problem,
+  without printing every IP checked as --show-all-ips does.  On a badly
+  degraded cluster there can be tens of thousands of problem IPs, so use
+  --max-problem-lines to limit the number of lines printed.  The problems are
+  still all counted and written to the report.
+
+  When writing to a terminal, the attributes printed for each IP are truncated
+  with an ellipsis to fit the terminal width, unless --no-truncate is
+  specified.  The report files are never truncated.
+
+  When stdout and stderr are both terminals, a progress bar is shown on stderr
+  while the IPAM blocks and workload endpoints are scanned, unless --quiet is
+  specified.  The progress bars are never shown in piped or redirected output,
+  and do not change the output written to stdout.
+
+  The attributes printed for each IP are formatted according to --attr-format:
+    default      The handle and all of the other attributes, as
+                 "Main:<handle> Extra:<key>=<value>,...".
+    json         The handle and the other attributes as a JSON object, for
+                 example {"main":"<handle>","extra":{"<key>":"<value>"}}.
+    keys=<KEYS>  The default format, but only showing the comma separated list
+                 of other attributes, in the order given, for example
+                 keys=namespace,pod.
+
+  When checking many clusters and aggregating the output, set --cluster-label
+  so that the summary line and report can be attributed to the right cluster.
+  The report records the label, or the cluster GUID if no label is set.
+
+  When --metrics-file is specified, the results are also written as Prometheus
+  gauges, replacing the file atomically.  The gauges are calico_ipam_blocks,
+  calico_ipam_allocations, calico_ipam_in_use, calico_ipam_leaked,
+  calico_ipam_non_pool, calico_ipam_not_allocated and calico_ipam_problems, and
+  the size, allocations and in use IPs of each active IP pool, labelled with
+  the pool CIDR, as calico_ipam_pool_size, calico_ipam_pool_allocations and
+  calico_ipam_pool_in_use.  Every gauge is labelled with the cluster label, or
+  the cluster GUID if no label is set, and with the node if --node is
+  specified.  The pool gauges are not written when --node is specified.
+
+  IPAM blocks with no affinity that still hold allocations may have lost their
+  affinity during a failed node operation.  These blocks are listed in the
+  report with the number of allocations they hold.  They are counted
+  separately, and do not add to the number of problems or leaked IPs.
+
+  IPAM blocks that are not in any IP pool, whether active or disabled, are
+  reported as orphaned blocks, with the block CIDR and affinity.  These are
+  usually left behind when a pool is deleted while it still has allocations.
+  Each orphaned block counts as a single problem, separately from the problems
+  with the IPs it holds.
+
+  When --expect-pools is specified, the CIDRs of the active IP pools are
+  compared against the expected CIDRs.  Each expected pool that is missing and
+  each active pool that was not expected counts as a problem, and they are
+  listed in the report.  This catches pools that were accidentally created or
+  deleted.
+
+  On clusters that use host-local IPAM alongside Calico IPAM, pass the ranges
+  managed by host-local with --host-local-ranges.  Each IP that is allocated in
+  Calico IPAM or in use by a Calico workload or node, and that is inside one of
+  the ranges, counts as a host-local conflict, since both IPAM plugins may
+  assign it.  The conflicts are printed and listed in the report with the IP,
+  its Calico owners and the overlapping range.
+
+  Blocks affine to a node that does not match the node selector of the IP pool
+  containing the block are reported as problems, with the block CIDR, node,
+  pool and selector.  This catches blocks that were allocated to nodes before
+  the pool was restricted to other nodes.
+
+  Some IPAM clients record the name or CIDR of the IP pool that an address was
+  allocated from in the "pool" attribute of the allocation.  Allocations whose
+  pool attribute matches neither the name nor the CIDR of the IP pool that now
+  contains them are reported as problems, with the block CIDR, ordinal,
+  recorded pool and current pool.  This catches allocations stranded when a
+  pool is deleted and recreated, for example with a different name, which the
+  checks for IPs and blocks outside the pools do not find.  Allocations with no
+  pool attribute are not checked.
+
+  If the nodes, workload endpoints or other Kubernetes resources cannot be
+  loaded, for example because a list request fails, the check continues with
+  the data that was loaded and prints a warning.  The report records the data
+  that could not be loaded, the remediation report is not written, and the
+  command fails once the reports are written.  IPs reported as leaked by an
+  incomplete check may be in use, so "ipam release --from-report" refuses to
+  release IPs from an incomplete report.
+
+  Each VXLAN, Wireguard and IPIP tunnel IP recorded for more than one node is
+  reported as an error, with the nodes that use it, since nodes that share a
+  tunnel IP break the overlay network.  The scan is skipped when the check is
+  limited to a node.
+
+  The check finishes with the capacity of the active IP pools for each IP
+  version: the number of addressable IPs, and the number allocated, in use and
+  free.  Calico IPAM allocates every address in a pool, including the network
+  and broadcast addresses of the pool CIDR, so every address is counted.  IPs
+  reserved for Windows are allocated, so they are not counted as free.  The
+  capacity is not reported when --node is specified, since it is cluster-wide.
+
+  On Kubernetes, allocations to pods in namespaces that are stuck terminating
+  are listed with the namespace and pod.  The IPs of these pods stay allocated
+  and in use until the namespace finalizers complete, which can mask leaks.
+  They are counted separately, and do not add to the number of problems.
+
+  Allocations whose handle starts with one of the --reserved-handle-prefix
+  prefixes are intentionally reserved, rather than assigned to a workload or
+  node, and are reported as reserved and are never leaked.  No Calico
+  component creates such handles, so none are recognized unless the prefixes
+  are given.  Reserved IPs are counted separately, do not add to the number of
+  problems, and are not released by "ipam release --from-report".  IPs reserved
+  for Windows are handled separately, as described for --include-reserved.
+
+  On Kubernetes, in-use IPs that are not in an active IP pool, but are the IP
+  of a host-networked pod, are not reported as problems.  Host-networked pods
+  share the IP of their node, which is normally outside the IP pools.  These
+  IPs are counted separately as host-networked, and listed in the report.
+
+  On Kubernetes, the IPs of each workload endpoint are also compared against
+  the IPs in the status of its pod.  Workload endpoints whose IPs differ, or
+  whose pod no longer exists, are listed with the workload and pod IPs.  These
+  stale workload endpoints can explain connectivity problems where the
+  dataplane and the pod status disagree.  They are counted separately, and do
+  not add to the number of problems.
+
+  When --since-revision is specified, the check is run as usual, and the IPs
+  that are leaked now but were not leaked in the baseline report are counted
+  as newly leaked.  The reports written by --output, --report-dir and
+  --emit-remediation then only contain the allocations of the newly leaked IPs,
+  and record the cluster information revision of the baseline alongside that
+  of the check.  An incremental report can be passed to "ipam release
+  --from-report" like any other report, to release only the new leaks.  The
+  baseline must be a full report for the same cluster, so it cannot be a
+  --summary-only or incremental report.
+
+  When --compare-snapshot is specified, the number of leaked IPs found is
+  compared with the number expected from the accounting file of an earlier
+  release: the number of leaked IPs in the reports it released from, less the
+  number it released.  A warning is printed if more leaked IPs are found than
+  expected, for example because the release did not take effect or IPs have
+  leaked since.  The comparison is recorded in the report.  It assumes that the
+  reports released from were from full checks of the same cluster, so it
+  cannot be combined with --node.
+
+  If the command receives SIGINT or SIGTERM, it stops once the datastore
+  operation in progress has finished, prints a summary of the data loaded so
+  far, and exits with code 130.  No report is written for an interrupted check.
+  A second SIGINT or SIGTERM stops the command immediately, also with code 130.
 `
 	// Replace all instances of BINARY_NAME with the name of the binary.
 	name, _ := util.NameAndDescription()
@@ -87,51 +319,265 @@ Description:
 	bc := client.(accessor).Backend()
 
 	// Get a kube-client. If this is a kdd cluster, we can pull this from the backend.
-	// Otherwise, we need to build one ourselves.
-	var kubeClient *kubernetes.Clientset
+	// Otherwise, the kube-client is left nil and only the checks that are
+	// independent of the datastore type are run. Note that this must be declared
+	// as the interface type so that the checker sees a nil interface on etcd.
+	var kubeClient kubernetes.Interface
 	if kc, ok := bc.(*k8s.KubeClient); ok {
 		// Pull from the kdd client.
 		kubeClient = kc.ClientSet
 	}
-	// TODO: Support etcd mode. For now, this is OK since we don't actually
-	// use the kubeClient yet. But we will do so eventually.
 
 	// Pull out CLI args.
 	showAllIPs := parsedArgs["--show-all-ips"].(bool)
 	showProblemIPs := showAllIPs || parsedArgs["--show-problem-ips"].(bool)
+	maxProblemLines, err := strconv.Atoi(parsedArgs["--max-problem-lines"].(string))
+	if err != nil || maxProblemLines < 0 {
+		return fmt.Errorf("Invalid max problem lines '%s', expected a non-negative integer", parsedArgs["--max-problem-lines"])
+	}
+	includeReserved := parsedArgs["--include-reserved"].(bool)
+	includeDisabled := parsedArgs["--include-disabled"].(bool)
 	var outFile string = ""
 	if arg := parsedArgs["--output"]; arg != nil {
 		outFile = arg.(string)
 	}
+	var metricsFile string
+	if arg := parsedArgs["--metrics-file"]; arg != nil {
+		metricsFile = arg.(string)
+	}
+	summaryOnly := parsedArgs["--summary-only"].(bool)
+	ignoreNamespaces := parsedArgs["--ignore-namespace"].([]string)
+	ignoreHandlePrefixes := parsedArgs["--ignore-handle-prefix"].([]string)
+	reservedHandlePrefixes := parsedArgs["--reserved-handle-prefix"].([]string)
+	var expectPools []string
+	if arg := parsedArgs["--expect-pools"]; arg != nil {
+		for _, p := range strings.Split(arg.(string), ",") {
+			_, cidr, err := cnet.ParseCIDR(strings.TrimSpace(p))
+			if err != nil {
+				return fmt.Errorf("Invalid expected pool '%s': %s", p, err)
+			}
+			expectPools = append(expectPools, cidr.String())
+		}
+	}
+	var hostLocalRanges []*cnet.IPNet
+	if arg := parsedArgs["--host-local-ranges"]; arg != nil {
+		for _, r := range strings.Split(arg.(string), ",") {
+			_, cidr, err := cnet.ParseCIDR(strings.TrimSpace(r))
+			if err != nil {
+				return fmt.Errorf("Invalid host-local range '%s': %s", r, err)
+			}
+			hostLocalRanges = append(hostLocalRanges, cidr)
+		}
+	}
+	var remediationFile string
+	if arg := parsedArgs["--emit-remediation"]; arg != nil {
+		remediationFile = arg.(string)
+	}
+
+	var reportDir string
+	var reportRetention int
+	if arg := parsedArgs["--report-dir"]; arg != nil {
+		reportDir = arg.(string)
+		reportRetention, err = strconv.Atoi(parsedArgs["--report-retention"].(string))
+		if err != nil || reportRetention < 0 {
+			return fmt.Errorf("Invalid report retention '%s', expected a non-negative integer", parsedArgs["--report-retention"])
+		}
+	}
+
+	var baseline *Report
+	if arg := parsedArgs["--since-revision"]; arg != nil {
+		baseline, err = loadReport(arg.(string))
+		if err != nil {
+			return fmt.Errorf("Failed to read baseline report %s: %s", arg, err)
+		}
+		if baseline.Allocations == nil && baseline.Summary.NumLeakedIPs > 0 {
+			return fmt.Errorf("The baseline report only contains a summary. Use a report generated without --summary-only.")
+		}
+		if baseline.BaselineRevision != "" {
+			return fmt.Errorf("The baseline report is itself incremental. Use a report generated without --since-revision.")
+		}
+	}
+
+	var node string
+	if arg := parsedArgs["--node"]; arg != nil {
+		node = arg.(string)
+	}
+
+	var snapshot *ReleaseAccounting
+	if arg := parsedArgs["--compare-snapshot"]; arg != nil {
+		if node != "" {
+			return fmt.Errorf("--compare-snapshot cannot be used with --node, since it compares against a check of the whole cluster.")
+		}
+		snapshot, err = loadReleaseAccounting(arg.(string))
+		if err != nil {
+			return fmt.Errorf("Failed to read release accounting %s: %s", arg, err)
+		}
+	}
+
+	var clusterLabel string
+	if arg := parsedArgs["--cluster-label"]; arg != nil {
+		clusterLabel = arg.(string)
+	}
+
+	maxWidth := 0
+	if !parsedArgs["--no-truncate"].(bool) {
+		maxWidth = common.TerminalWidth()
+	}
+	showProgress := common.ProgressEnabled(parsedArgs["--quiet"].(bool))
+	attrFormat, err := ParseAttrFormat(parsedArgs["--attr-format"].(string))
+	if err != nil {
+		return err
+	}
 
 	// Build the checker.
-	checker := NewIPAMChecker(kubeClient, client, bc, showAllIPs, showProblemIPs, outFile, version)
-	return checker.checkIPAM(ctx)
+	checker := NewIPAMChecker(kubeClient, client, bc, IPAMCheckerOptions{
+		ShowAllIPs:             showAllIPs,
+		ShowProblemIPs:         showProblemIPs,
+		MaxProblemLines:        maxProblemLines,
+		IncludeReserved:        includeReserved,
+		IncludeDisabled:        includeDisabled,
+		IgnoreNamespaces:       ignoreNamespaces,
+		IgnoreHandlePrefixes:   ignoreHandlePrefixes,
+		ReservedHandlePrefixes: reservedHandlePrefixes,
+		ExpectPools:            expectPools,
+		HostLocalRanges:        hostLocalRanges,
+		Node:                   node,
+		ClusterLabel:           clusterLabel,
+		MaxWidth:               maxWidth,
+		ShowProgress:           showProgress,
+		AttrFormat:             attrFormat,
+		OutFile:                outFile,
+		MetricsFile:            metricsFile,
+		SummaryOnly:            summaryOnly,
+		RemediationFile:        remediationFile,
+		ReportDir:              reportDir,
+		ReportRetention:        reportRetention,
+		Baseline:               baseline,
+		Snapshot:               snapshot,
+		Version:                version,
+	})
+
+	// Stop cleanly between datastore operations on SIGINT or SIGTERM.
+	interrupt, stop := common.NotifyInterrupt()
+	defer stop()
+	return checker.checkIPAM(ctx, interrupt)
+}
+
+// IPAMCheckerOptions configures an IPAMChecker. The zero value checks the whole cluster
+// without printing the individual IPs or writing any files.
+type IPAMCheckerOptions struct {
+	ShowAllIPs      bool
+	ShowProblemIPs  bool
+	IncludeReserved bool
+	IncludeDisabled bool
+
+	// The maximum number of problem lines to print, or zero to print them all.
+	MaxProblemLines int
+
+	// The namespaces and handle prefixes whose problem IPs are ignored.
+	IgnoreNamespaces     []string
+	IgnoreHandlePrefixes []string
+
+	// The prefixes of the handles that reserve IPs rather than assigning them, other than
+	// the Windows reserved handle.
+	ReservedHandlePrefixes []string
+
+	// The CIDRs of the active IP pools that are expected, or nil to not check the pools.
+	ExpectPools []string
+
+	// The ranges managed by host-local IPAM, or nil to not check them.
+	HostLocalRanges []*cnet.IPNet
+
+	// The node to limit the check to, or "" to check the whole cluster.
+	Node string
+
+	// The label identifying the cluster in the output, or "" to not label the output.
+	ClusterLabel string
+
+	// The maximum width of the printed lines, or 0 for no limit.
+	MaxWidth int
+
+	// Whether to show progress bars while scanning.
+	ShowProgress bool
+
+	// Whether to load the IPAM state without printing what is loaded.
+	Quiet bool
+
+	// How to format the attributes of the printed IPs.
+	AttrFormat AttrFormat
+
+	// The files to write the report, metrics and remediation script to, or "" to not
+	// write them, and whether to write only the summary to the report.
+	OutFile         string
+	MetricsFile     string
+	RemediationFile string
+	SummaryOnly     bool
+
+	// The directory to keep timestamped reports in, or "", and the number of reports to
+	// keep there.
+	ReportDir       string
+	ReportRetention int
+
+	// The report to compare the leaked IPs against, or nil to report all of the leaked IPs.
+	Baseline *Report
+
+	// The accounting of an earlier release to compare the leaked IPs against, or nil.
+	Snapshot *ReleaseAccounting
+
+	// The version of calicoctl, recorded in the report.
+	Version string
 }
 
 func NewIPAMChecker(k8sClient kubernetes.Interface,
 	v3Client clientv3.Interface,
 	backendClient bapi.Client,
-	showAllIPs bool,
-	showProblemIPs bool,
-	outFile string,
-	version string) *IPAMChecker {
+	opts IPAMCheckerOptions) *IPAMChecker {
 	return &IPAMChecker{
 		allocations:       map[string][]*Allocation{},
 		allocationsByNode: map[string][]*Allocation{},
 		allocationsByPod:  map[string][]*Allocation{},
 
-		inUseIPs: map[string][]ownerRecord{},
+		inUseIPs:    map[string][]ownerRecord{},
+		reservedIPs: map[string]bool{},
+
+		reservedHandleIPs: map[string]bool{},
+
+		blockAffinityHosts: map[string]string{},
+		unaffinedBlocks:    map[string]int{},
+		nodeLabels:         map[string]map[string]string{},
 
 		k8sClient:     k8sClient,
 		v3Client:      v3Client,
 		backendClient: backendClient,
 
-		showAllIPs:     showAllIPs,
-		showProblemIPs: showProblemIPs,
-
-		version: version,
-		outFile: outFile,
+		showAllIPs:      opts.ShowAllIPs,
+		showProblemIPs:  opts.ShowProblemIPs,
+		maxProblemLines: opts.MaxProblemLines,
+		includeReserved: opts.IncludeReserved,
+		includeDisabled: opts.IncludeDisabled,
+
+		ignoreNamespaces:       opts.IgnoreNamespaces,
+		ignoreHandlePrefixes:   opts.IgnoreHandlePrefixes,
+		reservedHandlePrefixes: opts.ReservedHandlePrefixes,
+		expectPools:            opts.ExpectPools,
+		hostLocalRanges:        opts.HostLocalRanges,
+
+		node:         opts.Node,
+		clusterLabel: opts.ClusterLabel,
+		maxWidth:     opts.MaxWidth,
+		showProgress: opts.ShowProgress,
+		quiet:        opts.Quiet,
+		attrFormat:   opts.AttrFormat,
+
+		version:         opts.Version,
+		outFile:         opts.OutFile,
+		metricsFile:     opts.MetricsFile,
+		summaryOnly:     opts.SummaryOnly,
+		remediationFile: opts.RemediationFile,
+		reportDir:       opts.ReportDir,
+		reportRetention: opts.ReportRetention,
+		baseline:        opts.Baseline,
+		snapshot:        opts.Snapshot,
 	}
 }
 
@@ -140,25 +586,148 @@ type IPAMChecker struct {
 	allocationsByNode map[string][]*Allocation
 	allocationsByPod  map[string][]*Allocation
 	inUseIPs          map[string][]ownerRecord
+	reservedIPs       map[string]bool
+
+	// IPs allocated to one of the reserved handles, other than the Windows reserved handle.
+	reservedHandleIPs map[string]bool
+
+	// Allocations whose attribute index does not refer to valid attributes in the block.
+	missingAttrAllocations []*Allocation
+
+	// The affine host of each block with a host affinity, keyed by block CIDR.
+	blockAffinityHosts map[string]string
+
+	// The number of allocations in each block with no affinity, keyed by block CIDR.
+	unaffinedBlocks map[string]int
+
+	// The labels of each node that was loaded, keyed by node name.
+	nodeLabels map[string]map[string]string
+
+	// Blocks affine to nodes that do not match the node selector of the block's IP pool.
+	selectorMismatches []SelectorMismatch
+
+	// Blocks that are not in any active or disabled IP pool.
+	orphanedBlocks []OrphanedBlock
+
+	// Allocations whose pool attribute does not match the IP pool containing them.
+	poolAttributeMismatches []PoolAttributeMismatch
+
+	// Tunnel IPs that are used by more than one node.
+	duplicateTunnelIPs []DuplicateTunnelIP
+
+	// Allocated or in-use IPs inside the ranges managed by host-local IPAM.
+	hostLocalConflicts []HostLocalConflict
+
+	// Allocations to pods in namespaces that are terminating.
+	terminatingAllocations []TerminatingAllocation
+
+	// Workload endpoints whose IPs do not match the IPs of their pod.
+	workloadPodMismatches []WorkloadPodMismatch
+
+	// In-use IPs outside the active IP pools that are the IPs of host-networked pods.
+	hostNetworkedIPs []string
+
+	// The expected IP pools that are not active, and the active IP pools that were not
+	// expected.
+	missingPools    []string
+	unexpectedPools []string
+
+	// IPs with problems that were excluded from the problem categories.
+	ignoredIPs []string
+
+	// The leaked IPs that were not leaked in the baseline report.
+	newLeakedIPs []string
 
 	clusterType         string
 	clusterInfoRevision string
 	datastoreLocked     bool
 	clusterGUID         string
 
+	summary ReportSummary
+
 	k8sClient     kubernetes.Interface
 	backendClient bapi.Client
 	v3Client      clientv3.Interface
 
-	showAllIPs     bool
-	showProblemIPs bool
+	showAllIPs      bool
+	showProblemIPs  bool
+	includeReserved bool
+	includeDisabled bool
+
+	// The maximum number of problem lines to print, or zero to print them all, and the
+	// number of problem lines so far, including those not printed.
+	maxProblemLines int
+	numProblemLines int
+
+	ignoreNamespaces     []string
+	ignoreHandlePrefixes []string
+
+	// The prefixes of the handles that reserve IPs rather than assigning them, other than
+	// the Windows reserved handle.
+	reservedHandlePrefixes []string
+
+	// The CIDRs of the active IP pools that are expected, or nil to not check the pools.
+	expectPools []string
 
-	version string
-	outFile string
+	// The ranges managed by host-local IPAM, or nil to not check them.
+	hostLocalRanges []*cnet.IPNet
+
+	// The node to limit the check to, or "" to check the whole cluster.
+	node string
+
+	// The label identifying the cluster in the output, or "" to not label the output.
+	clusterLabel string
+
+	// The maximum width of the printed lines, or 0 for no limit.
+	maxWidth int
+
+	// Whether to show progress bars while scanning.
+	showProgress bool
+
+	// Whether to load the IPAM state without printing what is loaded.
+	quiet bool
+
+	// How to format the attributes of the printed IPs.
+	attrFormat AttrFormat
+
+	version         string
+	outFile         string
+	metricsFile     string
+	summaryOnly     bool
+	remediationFile string
+	reportDir       string
+	reportRetention int
+
+	// The report to compare the leaked IPs against, or nil to report all of the leaked IPs.
+	baseline *Report
+
+	// The accounting of an earlier release to compare the leaked IPs against, or nil, and
+	// the outcome of the comparison.
+	snapshot           *ReleaseAccounting
+	snapshotComparison *SnapshotComparison
+
+	// The pods, loaded the first time they are needed by a scan.
+	pods *podIndex
+
+	// The data that could not be loaded, such as "workload endpoints", if the check is
+	// incomplete.
+	incomplete []string
 }
 
-func (c *IPAMChecker) checkIPAM(ctx context.Context) error {
+// printf prints the progress of loading the IPAM state, unless the checker is quiet.
+func (c *IPAMChecker) printf(format string, args ...interface{}) {
+	if !c.quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// checkIPAM runs the check. If the interrupt context is cancelled, the check stops after
+// the datastore operation in progress, printing a summary of the data loaded so far.
+func (c *IPAMChecker) checkIPAM(ctx, interrupt context.Context) error {
 	fmt.Println("Checking IPAM for inconsistencies...")
+	if c.k8sClient == nil {
+		fmt.Println("Datastore is not Kubernetes; skipping checks that require the Kubernetes API.")
+	}
 	fmt.Println()
 
 	// First, query ClusterInformation and extract some important metadata to use in the report.
@@ -170,97 +739,21 @@ func (c *IPAMChecker) checkIPAM(ctx context.Context) error {
 	c.clusterInfoRevision = clusterInfo.ResourceVersion
 	c.datastoreLocked = clusterInfo.Spec.DatastoreReady != nil && !*clusterInfo.Spec.DatastoreReady
 	c.clusterGUID = clusterInfo.Spec.ClusterGUID
-
-	var numAllocs int
-	{
-		fmt.Println("Loading all IPAM blocks...")
-		blocks, err := c.backendClient.List(ctx, model.BlockListOptions{}, "")
-		if err != nil {
-			return fmt.Errorf("failed to list IPAM blocks: %w", err)
-		}
-		fmt.Printf("Found %d IPAM blocks.\n", len(blocks.KVPairs))
-
-		for _, kvp := range blocks.KVPairs {
-			b := kvp.Value.(*model.AllocationBlock)
-			affinity := "<none>"
-			if b.Affinity != nil {
-				affinity = *b.Affinity
-			}
-			fmt.Printf(" IPAM block %s affinity=%s:\n", b.CIDR, affinity)
-			for ord, attrIdx := range b.Allocations {
-				if attrIdx == nil {
-					continue // IP is not allocated
-				}
-				numAllocs++
-				c.recordAllocation(b, ord)
-			}
-		}
-		fmt.Printf("IPAM blocks record %d allocations.\n", numAllocs)
-		fmt.Println()
+	if c.baseline != nil && c.baseline.ClusterGUID != c.clusterGUID {
+		return fmt.Errorf("The baseline report is for a different cluster: mismatched cluster GUID.")
 	}
-	var activeIPPools []*cnet.IPNet
-	{
-		fmt.Println("Loading all IPAM pools...")
-		ipPools, err := c.v3Client.IPPools().List(ctx, options.ListOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to load IP pools: %w", err)
-		}
-		for _, p := range ipPools.Items {
-			if p.Spec.Disabled {
-				continue
-			}
-			fmt.Printf("  %s\n", p.Spec.CIDR)
-			_, cidr, err := cnet.ParseCIDR(p.Spec.CIDR)
-			if err != nil {
-				return fmt.Errorf("failed to parse IP pool CIDR: %w", err)
-			}
-			activeIPPools = append(activeIPPools, cidr)
-		}
-		fmt.Printf("Found %d active IP pools.\n", len(activeIPPools))
-		fmt.Println()
+	if c.snapshot != nil && c.snapshot.ClusterGUID != c.clusterGUID {
+		return fmt.Errorf("The release accounting is for a different cluster: mismatched cluster GUID.")
 	}
-
-	{
-		fmt.Println("Loading all nodes.")
-		nodes, err := c.v3Client.Nodes().List(ctx, options.ListOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to list nodes: %w", err)
-		}
-		numNodeIPs := 0
-		for _, n := range nodes.Items {
-			ips, err := getNodeIPs(n)
-			if err != nil {
-				return err
-			}
-			for _, ip := range ips {
-				c.recordInUseIP(ip, n, fmt.Sprintf("Node(%s)", n.Name))
-				numNodeIPs++
-			}
-		}
-		fmt.Printf("Found %d node tunnel IPs.\n", numNodeIPs)
-		fmt.Println()
+	if err := c.checkInterrupted(interrupt, "loading cluster information"); err != nil {
+		return err
 	}
 
-	{
-		fmt.Println("Loading all workload endpoints.")
-		weps, err := c.v3Client.WorkloadEndpoints().List(ctx, options.ListOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to list workload endpoints: %w", err)
-		}
-		numWEPIPs := 0
-		for _, w := range weps.Items {
-			ips, err := getWEPIPs(w)
-			if err != nil {
-				return err
-			}
-			for _, ip := range ips {
-				c.recordInUseIP(ip, w, fmt.Sprintf("Workload(%s/%s)", w.Namespace, w.Name))
-				numWEPIPs++
-			}
-		}
-		fmt.Printf("Found %d workload IPs.\n", numWEPIPs)
-		fmt.Printf("Workloads and nodes are using %d IPs.\n", len(c.inUseIPs))
-		fmt.Println()
+	// The scans below treat any IP missing from inUseIPs as leaked, so loadIPAMState records
+	// every workload endpoint before returning.
+	state, err := c.loadIPAMState(ctx, interrupt)
+	if err != nil {
+		return err
 	}
 
 	{
@@ -293,71 +786,580 @@ func (c *IPAMChecker) checkIPAM(ctx context.Context) error {
 	{
 		fmt.Printf("Scanning for IPs that are allocated but not actually in use...\n")
 		for ip, allocs := range c.allocations {
+			if c.reservedIPs[ip] || c.reservedHandleIPs[ip] {
+				// Reserved IPs are reported separately and are never leaked.
+				continue
+			}
+			if !c.allocationsIncluded(allocs) {
+				continue
+			}
 			if _, ok := c.inUseIPs[ip]; !ok {
+				if c.allocationsIgnored(allocs) {
+					for _, alloc := range allocs {
+						alloc.Ignored = true
+					}
+					c.recordIgnoredIP(ip, "leaked")
+					continue
+				}
 				if c.showProblemIPs {
 					for _, alloc := range allocs {
-						fmt.Printf("  %s leaked; attrs %v\n", ip, alloc.GetAttrString())
+						c.printProblem("%s\n", c.attrsLine(fmt.Sprintf("  %s leaked; attrs ", ip), alloc))
 					}
 				}
 				allocatedButNotInUseIPs = append(allocatedButNotInUseIPs, ip)
 			}
 		}
 		numProblems += len(allocatedButNotInUseIPs)
+		c.summary.NumLeakedIPs = len(allocatedButNotInUseIPs)
 		fmt.Printf("Found %d IPs that are allocated in IPAM but not actually in use.\n", len(allocatedButNotInUseIPs))
+
+		if c.baseline != nil {
+			c.newLeakedIPs = newLeakedIPs(c.baseline, allocatedButNotInUseIPs)
+			c.summary.NumNewLeakedIPs = len(c.newLeakedIPs)
+			fmt.Printf("Found %d IPs that have leaked since the baseline report (revision %s).\n",
+				len(c.newLeakedIPs), c.baseline.ClusterInfoRevision)
+		}
+		if c.snapshot != nil {
+			c.snapshotComparison = compareSnapshot(c.snapshot, len(allocatedButNotInUseIPs))
+		}
+	}
+
+	{
+		fmt.Printf("Scanning for allocations with missing attributes...\n")
+		numMissingAttrAllocations := 0
+		for _, alloc := range c.missingAttrAllocations {
+			if !c.allocationsIncluded([]*Allocation{alloc}) {
+				continue
+			}
+			if c.showProblemIPs {
+				c.printProblem("  %s in block %s at ordinal %d has missing attributes.\n", alloc.IP, alloc.Block.CIDR, alloc.Ordinal)
+			}
+			numMissingAttrAllocations++
+		}
+		numProblems += numMissingAttrAllocations
+		c.summary.NumMissingAttrAllocations = numMissingAttrAllocations
+		fmt.Printf("Found %d allocations with missing attributes.\n", numMissingAttrAllocations)
+	}
+
+	// On Kubernetes, host-networked pods use the IP of their node, which is not in an IP
+	// pool, so their IPs are excluded from the non-Calico IPs.
+	hostNetworkIPs := map[string]bool{}
+	if c.k8sClient != nil {
+		var err error
+		if hostNetworkIPs, err = c.hostNetworkedPodIPs(ctx); err != nil {
+			c.recordIncomplete("host-networked pods", err)
+			hostNetworkIPs = map[string]bool{}
+		}
+		if err := c.checkInterrupted(interrupt, "loading host-networked pods"); err != nil {
+			return err
+		}
 	}
 
 	var inUseButNotAllocatedIPs []string
 	var nonCalicoIPs []string
+	var inDisabledPoolIPs []string
 	{
 		fmt.Printf("Scanning for IPs that are in use by a workload or node but not allocated in IPAM...\n")
 		for ip, owners := range c.inUseIPs {
 			if c.showProblemIPs && len(owners) > 1 {
-				fmt.Printf("  %s has multiple owners.\n", ip)
+				c.printProblem("  %s has multiple owners.\n", ip)
 			}
 			if _, ok := c.allocations[ip]; !ok {
 				// The IP is being used, but is not allocated within Calico IPAM!
+				if c.ownersIgnored(owners) {
+					c.recordIgnoredIP(ip, "not allocated")
+					continue
+				}
 
-				// Found indicates whether the IP falls within an active IP pool.
-				found := false
+				// Found indicates whether the IP falls within an active IP pool. Disabled pools
+				// are only loaded if they are to be treated as active.
 				parsedIP := net.ParseIP(ip)
-				for _, cidr := range activeIPPools {
-					if cidr.Contains(parsedIP) {
-						found = true
-						break
+				inDisabledPool := poolsContain(state.DisabledPools, parsedIP)
+				found := inDisabledPool || poolsContain(state.ActivePools, parsedIP)
+				if !found && hostNetworkIPs[ip] {
+					if c.showAllIPs {
+						fmt.Printf("  %s is the IP of a host-networked pod.\n", ip)
 					}
+					c.hostNetworkedIPs = append(c.hostNetworkedIPs, ip)
+					continue
 				}
 				if !found {
 					if c.showProblemIPs {
 						for _, owner := range owners {
-							fmt.Printf("  %s in use by %v is not in any active IP pool.\n", ip, owner.FriendlyName)
+							c.printProblem("  %s in use by %v is not in any active IP pool.\n", ip, owner.FriendlyName)
 						}
 					}
 					nonCalicoIPs = append(nonCalicoIPs, ip)
 					continue
 				}
-				if c.showProblemIPs {
+				if inDisabledPool {
+					if c.showProblemIPs {
+						for _, owner := range owners {
+							c.printProblem("  %s in use by %v and in disabled IPAM pool but has no IPAM allocation.\n", ip, owner.FriendlyName)
+						}
+					}
+					inDisabledPoolIPs = append(inDisabledPoolIPs, ip)
+				} else if c.showProblemIPs {
 					for _, owner := range owners {
-						fmt.Printf("  %s in use by %v and in active IPAM pool but has no IPAM allocation.\n", ip, owner.FriendlyName)
+						c.printProblem("  %s in use by %v and in active IPAM pool but has no IPAM allocation.\n", ip, owner.FriendlyName)
 					}
 				}
 				inUseButNotAllocatedIPs = append(inUseButNotAllocatedIPs, ip)
 			}
 		}
-		numProblems += len(nonCalicoIPs)
-		numProblems += len(inUseButNotAllocatedIPs)
-		fmt.Printf("Found %d in-use IPs that are not in active IP pools.\n", len(nonCalicoIPs))
-		fmt.Printf("Found %d in-use IPs that are in active IP pools but have no corresponding IPAM allocation.\n",
-			len(inUseButNotAllocatedIPs))
-		fmt.Println()
+		numProblems += len(nonCalicoIPs)
+		numProblems += len(inUseButNotAllocatedIPs)
+		c.summary.NumNonCalicoIPs = len(nonCalicoIPs)
+		c.summary.NumNotAllocatedIPs = len(inUseButNotAllocatedIPs)
+		fmt.Printf("Found %d in-use IPs that are not in active IP pools.\n", len(nonCalicoIPs))
+		fmt.Printf("Found %d in-use IPs that are in active IP pools but have no corresponding IPAM allocation.\n",
+			len(inUseButNotAllocatedIPs))
+		if c.includeDisabled {
+			c.summary.NumNotAllocatedInDisabledPoolIPs = len(inDisabledPoolIPs)
+			fmt.Printf("Of these, %d are in disabled IP pools.\n", len(inDisabledPoolIPs))
+		}
+		if c.k8sClient != nil {
+			sort.Strings(c.hostNetworkedIPs)
+			c.summary.NumHostNetworkedIPs = len(c.hostNetworkedIPs)
+			fmt.Printf("Excluded %d in-use IPs of host-networked pods that are not in active IP pools.\n", len(c.hostNetworkedIPs))
+		}
+		fmt.Println()
+	}
+
+	if len(c.ignoreNamespaces) > 0 || len(c.ignoreHandlePrefixes) > 0 {
+		sort.Strings(c.ignoredIPs)
+		c.summary.NumIgnoredIPs = len(c.ignoredIPs)
+		fmt.Printf("Ignored %d IPs with problems that match the ignored namespaces or handle prefixes.\n", len(c.ignoredIPs))
+		fmt.Println()
+	}
+
+	if c.node == "" {
+		// A tunnel IP shared by nodes breaks the overlay network, so the duplicates are
+		// always printed rather than only with --show-problem-ips.
+		fmt.Printf("Scanning for tunnel IPs that are used by more than one node...\n")
+		duplicates := c.checkDuplicateTunnelIPs()
+		for _, d := range duplicates {
+			fmt.Printf("  ERROR: Tunnel IP %s is used by nodes %s.\n", d.IP, strings.Join(d.Nodes, ", "))
+		}
+		c.duplicateTunnelIPs = duplicates
+		numProblems += len(duplicates)
+		c.summary.NumDuplicateTunnelIPs = len(duplicates)
+		fmt.Printf("Found %d tunnel IPs that are used by more than one node.\n", len(duplicates))
+		fmt.Println()
+	}
+
+	if c.hostLocalRanges != nil {
+		fmt.Printf("Scanning for IPs that are inside the host-local ranges...\n")
+		conflicts := c.checkHostLocalRanges()
+		if c.showProblemIPs {
+			for _, hc := range conflicts {
+				c.printProblem("  %s owned by %s is inside host-local range %s.\n", hc.IP, strings.Join(hc.Owners, ", "), hc.Range)
+			}
+		}
+		c.hostLocalConflicts = conflicts
+		numProblems += len(conflicts)
+		c.summary.NumHostLocalConflicts = len(conflicts)
+		fmt.Printf("Found %d allocated or in-use IPs that are inside the host-local ranges.\n", len(conflicts))
+		fmt.Println()
+	}
+
+	{
+		fmt.Printf("Scanning for IPAM blocks and block affinities that do not match...\n")
+		mismatches, err := c.checkBlockAffinities(ctx)
+		if err != nil {
+			c.recordIncomplete("block affinities", err)
+		} else {
+			numProblems += mismatches
+			c.summary.NumAffinityMismatches = mismatches
+			fmt.Printf("Found %d mismatched IPAM blocks and block affinities.\n", mismatches)
+		}
+		fmt.Println()
+		if err := c.checkInterrupted(interrupt, "loading block affinities"); err != nil {
+			return err
+		}
+	}
+
+	{
+		fmt.Printf("Scanning for IPAM blocks that are not in any IP pool...\n")
+		for _, b := range state.Blocks {
+			if poolsContain(state.AllPools, b.CIDR.IP) {
+				continue
+			}
+			orphan := OrphanedBlock{Block: b.CIDR.String()}
+			affinity := "<none>"
+			if b.Affinity != nil {
+				orphan.Affinity = *b.Affinity
+				affinity = *b.Affinity
+			}
+			fmt.Printf("  Block %s affinity=%s is not in any active or disabled IP pool.\n", orphan.Block, affinity)
+			c.orphanedBlocks = append(c.orphanedBlocks, orphan)
+		}
+		numProblems += len(c.orphanedBlocks)
+		c.summary.NumOrphanedBlocks = len(c.orphanedBlocks)
+		fmt.Printf("Found %d IPAM blocks that are not in any IP pool.\n", len(c.orphanedBlocks))
+		fmt.Println()
+	}
+
+	{
+		fmt.Printf("Scanning for IPAM blocks affine to nodes that do not match the IP pool node selector...\n")
+		mismatches, err := c.checkPoolNodeSelectors(state.CheckedPools)
+		if err != nil {
+			return err
+		}
+		for _, m := range mismatches {
+			fmt.Printf("  Block %s is affine to node %s, which does not match node selector %q of IP pool %s.\n",
+				m.Block, m.Node, m.Selector, m.Pool)
+		}
+		c.selectorMismatches = mismatches
+		numProblems += len(mismatches)
+		c.summary.NumSelectorMismatches = len(mismatches)
+		fmt.Printf("Found %d IPAM blocks affine to nodes that do not match the IP pool node selector.\n", len(mismatches))
+		fmt.Println()
+	}
+
+	{
+		fmt.Printf("Scanning for allocations whose pool attribute does not match the IP pool containing them...\n")
+		mismatches, err := c.checkPoolAttributes(state.IPPools)
+		if err != nil {
+			return err
+		}
+		if c.showProblemIPs {
+			for _, m := range mismatches {
+				current := m.CurrentPool
+				if current == "" {
+					current = "<none>"
+				}
+				c.printProblem("  %s in block %s at ordinal %d records pool %s, but is in pool %s.\n",
+					m.IP, m.Block, m.Ordinal, m.RecordedPool, current)
+			}
+		}
+		c.poolAttributeMismatches = mismatches
+		numProblems += len(mismatches)
+		c.summary.NumPoolAttributeMismatches = len(mismatches)
+		fmt.Printf("Found %d allocations whose pool attribute does not match the IP pool containing them.\n", len(mismatches))
+		fmt.Println()
+	}
+
+	if c.expectPools != nil {
+		fmt.Printf("Comparing the active IP pools against the expected IP pools...\n")
+		c.missingPools, c.unexpectedPools = c.checkExpectedPools(state.ActivePools)
+		for _, cidr := range c.missingPools {
+			fmt.Printf("  Expected IP pool %s is not active.\n", cidr)
+		}
+		for _, cidr := range c.unexpectedPools {
+			fmt.Printf("  Active IP pool %s was not expected.\n", cidr)
+		}
+		numMismatches := len(c.missingPools) + len(c.unexpectedPools)
+		numProblems += numMismatches
+		c.summary.NumPoolMismatches = numMismatches
+		fmt.Printf("Found %d differences between the active and expected IP pools.\n", numMismatches)
+		fmt.Println()
+	}
+
+	{
+		fmt.Printf("Scanning for IPAM blocks with no affinity that hold allocations...\n")
+		var cidrs []string
+		for cidr := range c.unaffinedBlocks {
+			cidrs = append(cidrs, cidr)
+		}
+		sort.Strings(cidrs)
+		for _, cidr := range cidrs {
+			fmt.Printf("  Block %s has no affinity and holds %d allocations.\n", cidr, c.unaffinedBlocks[cidr])
+		}
+		c.summary.NumUnaffinedBlocks = len(c.unaffinedBlocks)
+		fmt.Printf("Found %d IPAM blocks with no affinity that hold allocations.\n", len(c.unaffinedBlocks))
+		fmt.Println()
+	}
+
+	if c.k8sClient != nil {
+		fmt.Printf("Scanning for allocations to pods in terminating namespaces...\n")
+		terminating, err := c.checkTerminatingNamespaces(ctx)
+		if err != nil {
+			c.recordIncomplete("namespaces", err)
+		} else {
+			for _, t := range terminating {
+				fmt.Printf("  %s is allocated to pod %s/%s, and namespace %s is terminating.\n", t.IP, t.Namespace, t.Pod, t.Namespace)
+			}
+			c.terminatingAllocations = terminating
+			c.summary.NumTerminatingNamespaceAllocations = len(terminating)
+			fmt.Printf("Found %d allocations to pods in terminating namespaces.\n", len(terminating))
+		}
+		fmt.Println()
+		if err := c.checkInterrupted(interrupt, "loading namespaces"); err != nil {
+			return err
+		}
+
+		fmt.Printf("Scanning for workload endpoints whose IPs do not match the pod IPs...\n")
+		mismatches, err := c.checkWorkloadPodIPs(ctx, state.WorkloadEndpoints)
+		if err != nil {
+			c.recordIncomplete("pods", err)
+		} else {
+			for _, m := range mismatches {
+				podIPs := "<pod not found>"
+				if m.PodIPs != nil {
+					podIPs = strings.Join(m.PodIPs, ",")
+				}
+				fmt.Printf("  Workload %s/%s has IPs %s, but pod %s has IPs %s.\n",
+					m.Namespace, m.Name, strings.Join(m.WorkloadIPs, ","), m.Pod, podIPs)
+			}
+			c.workloadPodMismatches = mismatches
+			c.summary.NumWorkloadPodMismatches = len(mismatches)
+			fmt.Printf("Found %d workload endpoints whose IPs do not match the pod IPs.\n", len(mismatches))
+		}
+		fmt.Println()
+		if err := c.checkInterrupted(interrupt, "loading pods"); err != nil {
+			return err
+		}
+	}
+
+	if c.node == "" {
+		fmt.Printf("Capacity of active IP pools:\n")
+		c.summary.Capacity = c.poolCapacity(state.ActivePools)
+		for _, pc := range c.summary.Capacity {
+			fmt.Printf("  IPv%d: %.0f addressable, %d allocated, %d in use, %.0f free (%.0f%%)\n",
+				pc.IPVersion, pc.TotalIPs, pc.AllocatedIPs, pc.InUseIPs, pc.FreeIPs, 100*pc.FreeIPs/pc.TotalIPs)
+		}
+		fmt.Println()
+	}
+
+	if c.maxProblemLines > 0 && c.numProblemLines > c.maxProblemLines {
+		fmt.Printf("...and %d more problem lines. Use --max-problem-lines=0 to print all of them.\n",
+			c.numProblemLines-c.maxProblemLines)
+		fmt.Println()
+	}
+
+	fmt.Println(common.WithClusterLabel(c.clusterLabel, fmt.Sprintf("Check complete; found %d problems.", numProblems)))
+	c.summary.NumProblems = numProblems
+	if len(c.incomplete) > 0 {
+		fmt.Printf("WARNING: The check is incomplete, since the %s could not be loaded. The results may be unreliable;\n"+
+			"in particular, IPs reported as leaked may be in use. Do not release IPs based on these results.\n",
+			strings.Join(c.incomplete, ", "))
+	}
+
+	if c.outFile != "" {
+		// Print out a machine readable report.
+		c.printReport()
+	}
+	if c.metricsFile != "" {
+		if err := c.writeMetrics(state.ActivePools); err != nil {
+			return err
+		}
+	}
+	if c.reportDir != "" {
+		if err := c.writeReportToDir(time.Now()); err != nil {
+			return err
+		}
+	}
+	if len(c.incomplete) > 0 {
+		if c.remediationFile != "" {
+			fmt.Printf("Not writing the remediation report to %s, since the check is incomplete.\n", c.remediationFile)
+		}
+		return fmt.Errorf("The check is incomplete; the %s could not be loaded", strings.Join(c.incomplete, ", "))
+	}
+	if c.remediationFile != "" {
+		leaked := allocatedButNotInUseIPs
+		if c.baseline != nil {
+			leaked = c.newLeakedIPs
+		}
+		if err := c.emitRemediation(leaked); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkInterrupted returns an error if the check has been interrupted, after printing a
+// summary of what was loaded before the given stage finished. No report is written,
+// since a partial report must not be used to release addresses.
+func (c *IPAMChecker) checkInterrupted(interrupt context.Context, stage string) error {
+	err := common.CheckInterrupt(interrupt, "IPAM check")
+	if err == nil {
+		return nil
+	}
+	fmt.Println(common.WithClusterLabel(c.clusterLabel, fmt.Sprintf("Check interrupted after %s; no report was written.", stage)))
+	fmt.Printf("Partial summary: loaded %d IPAM blocks with %d allocations; workloads and nodes are using %d IPs.\n",
+		c.summary.NumBlocks, c.summary.NumAllocations, len(c.inUseIPs))
+	return err
+}
+
+// checkPoolNodeSelectors returns the blocks with a host affinity to a node that does not
+// match the node selector of the IP pool containing the block. Blocks affine to nodes that
+// were not loaded, and blocks outside the pools, are not checked.
+func (c *IPAMChecker) checkPoolNodeSelectors(pools []apiv3.IPPool) ([]SelectorMismatch, error) {
+	var cidrs []string
+	for cidr := range c.blockAffinityHosts {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	mismatches := []SelectorMismatch{}
+	for _, cidr := range cidrs {
+		host := c.blockAffinityHosts[cidr]
+		labels, ok := c.nodeLabels[host]
+		if !ok {
+			continue
+		}
+		_, block, err := cnet.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse IPAM block CIDR: %w", err)
+		}
+		for _, p := range pools {
+			_, poolCIDR, err := cnet.ParseCIDR(p.Spec.CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse IP pool CIDR: %w", err)
+			}
+			if !poolCIDR.Contains(block.IP) {
+				continue
+			}
+			if p.Spec.NodeSelector == "" {
+				break
+			}
+			sel, err := selector.Parse(p.Spec.NodeSelector)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse node selector of IP pool %s: %w", p.Name, err)
+			}
+			if !sel.Evaluate(labels) {
+				mismatches = append(mismatches, SelectorMismatch{
+					Block:    cidr,
+					Node:     host,
+					Pool:     p.Name,
+					Selector: p.Spec.NodeSelector,
+				})
+			}
+			break
+		}
+	}
+	return mismatches, nil
+}
+
+// checkPoolAttributes returns the allocations with a pool attribute that names neither the
+// name nor the CIDR of the IP pool that now contains them. This catches allocations made
+// from a pool that was deleted and recreated, possibly with a different name or CIDR,
+// which the CIDR containment checks do not find. Allocations with no pool attribute are
+// not checked.
+func (c *IPAMChecker) checkPoolAttributes(pools []apiv3.IPPool) ([]PoolAttributeMismatch, error) {
+	type pool struct {
+		name string
+		cidr *cnet.IPNet
+	}
+	var parsed []pool
+	for _, p := range pools {
+		_, cidr, err := cnet.ParseCIDR(p.Spec.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse IP pool CIDR: %w", err)
+		}
+		parsed = append(parsed, pool{p.Name, cidr})
+	}
+
+	mismatches := []PoolAttributeMismatch{}
+	for ip, allocs := range c.allocations {
+		if !c.allocationsIncluded(allocs) {
+			continue
+		}
+		var current pool
+		for _, p := range parsed {
+			if poolsContain([]*cnet.IPNet{p.cidr}, net.ParseIP(ip)) {
+				current = p
+				break
+			}
+		}
+		for _, a := range allocs {
+			if a.Pool == "" || a.Pool == current.name || (current.cidr != nil && a.Pool == current.cidr.String()) {
+				continue
+			}
+			mismatches = append(mismatches, PoolAttributeMismatch{
+				IP:           ip,
+				Block:        a.Block.CIDR.String(),
+				Ordinal:      a.Ordinal,
+				RecordedPool: a.Pool,
+				CurrentPool:  current.name,
+			})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Block != mismatches[j].Block {
+			return mismatches[i].Block < mismatches[j].Block
+		}
+		return mismatches[i].Ordinal < mismatches[j].Ordinal
+	})
+	return mismatches, nil
+}
+
+// checkDuplicateTunnelIPs returns the tunnel IPs that are used by more than one node. An
+// IP used by a node and by workloads is reported by the scan for IPs with multiple owners;
+// this only reports IPs shared by nodes, which breaks the overlay network.
+func (c *IPAMChecker) checkDuplicateTunnelIPs() []DuplicateTunnelIP {
+	duplicates := []DuplicateTunnelIP{}
+	for ip, owners := range c.inUseIPs {
+		// A node may use the same IP for more than one kind of tunnel, so each node is
+		// only counted once.
+		var nodes []string
+		seen := map[string]bool{}
+		for _, o := range owners {
+			if n, ok := o.Resource.(apiv3.Node); ok && !seen[n.Name] {
+				seen[n.Name] = true
+				nodes = append(nodes, n.Name)
+			}
+		}
+		if len(nodes) > 1 {
+			sort.Strings(nodes)
+			duplicates = append(duplicates, DuplicateTunnelIP{IP: ip, Nodes: nodes})
+		}
 	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].IP < duplicates[j].IP })
+	return duplicates
+}
 
-	fmt.Printf("Check complete; found %d problems.\n", numProblems)
+// checkHostLocalRanges returns the IPs that are allocated in Calico IPAM or in use by a
+// workload or node, and that are inside one of the ranges managed by host-local IPAM. The
+// owners of an in-use IP are the resources using it; the owners of an allocated IP that
+// is not in use are taken from its allocation attributes.
+func (c *IPAMChecker) checkHostLocalRanges() []HostLocalConflict {
+	ips := map[string]bool{}
+	for ip, allocs := range c.allocations {
+		if c.allocationsIncluded(allocs) {
+			ips[ip] = true
+		}
+	}
+	for ip := range c.inUseIPs {
+		ips[ip] = true
+	}
 
-	if c.outFile != "" {
-		// Print out a machine readable report.
-		c.printReport()
+	conflicts := []HostLocalConflict{}
+	for ip := range ips {
+		parsedIP := net.ParseIP(ip)
+		for _, r := range c.hostLocalRanges {
+			if !poolsContain([]*cnet.IPNet{r}, parsedIP) {
+				continue
+			}
+			var owners []string
+			for _, o := range c.inUseIPs[ip] {
+				owners = append(owners, o.FriendlyName)
+			}
+			if len(owners) == 0 {
+				for _, a := range c.allocations[ip] {
+					owners = append(owners, allocationOwner(a))
+				}
+			}
+			conflicts = append(conflicts, HostLocalConflict{IP: ip, Owners: owners, Range: r.String()})
+			break
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].IP < conflicts[j].IP })
+	return conflicts
+}
+
+// allocationOwner returns the owner recorded by the attributes of the allocation, in the
+// same form as the owners of in-use IPs.
+func allocationOwner(a *Allocation) string {
+	switch {
+	case a.Pod != "":
+		return fmt.Sprintf("Workload(%s/%s)", a.Namespace, a.Pod)
+	case isTunnelAddress(a) && a.Node != "":
+		return fmt.Sprintf("Node(%s)", a.Node)
+	default:
+		return fmt.Sprintf("Handle(%s)", a.Handle)
 	}
-	return nil
 }
 
 func getWEPIPs(w apiv3.WorkloadEndpoint) ([]string, error) {
@@ -383,23 +1385,470 @@ type Report struct {
 	ClusterInfoRevision string `json:"clusterInformationRevision"`
 	ClusterType         string `json:"clusterType"`
 
-	// Allocations is a map of IP address to list of allocation data.
-	Allocations map[string][]*Allocation `json:"allocations"`
+	// The label identifying the cluster, or the cluster GUID if no label was given.
+	ClusterLabel string `json:"clusterLabel"`
+
+	// The node the check was limited to, if any.
+	Node string `json:"node,omitempty"`
+
+	// The cluster information revision of the baseline report, if the report only contains
+	// the IPs that leaked since the baseline.
+	BaselineRevision string `json:"baselineRevision,omitempty"`
+
+	// The comparison of the leaked IPs with the accounting of an earlier release, if the
+	// check was run with --compare-snapshot.
+	SnapshotComparison *SnapshotComparison `json:"snapshotComparison,omitempty"`
+
+	// Incomplete lists the data that could not be loaded, if the check is incomplete. The
+	// IPs in an incomplete report must not be released, since IPs reported as leaked may
+	// be in use.
+	Incomplete []string `json:"incomplete,omitempty"`
+
+	// Summary of the counts found by the check.
+	Summary ReportSummary `json:"summary"`
+
+	// IgnoredIPs lists the IPs with problems that were excluded from the problem counts.
+	IgnoredIPs []string `json:"ignoredIPs,omitempty"`
+
+	// HostNetworkedIPs lists the in-use IPs outside the active IP pools that were excluded
+	// from the non-Calico IPs because they are the IPs of host-networked pods.
+	HostNetworkedIPs []string `json:"hostNetworkedIPs,omitempty"`
+
+	// UnaffinedBlocks is a map of the CIDR of each block with no affinity that holds
+	// allocations to the number of allocations it holds.
+	UnaffinedBlocks map[string]int `json:"unaffinedBlocks,omitempty"`
+
+	// SelectorMismatches lists the blocks affine to nodes that do not match the node
+	// selector of the block's IP pool.
+	SelectorMismatches []SelectorMismatch `json:"selectorMismatches,omitempty"`
+
+	// OrphanedBlocks lists the blocks that are not in any active or disabled IP pool.
+	OrphanedBlocks []OrphanedBlock `json:"orphanedBlocks,omitempty"`
+
+	// PoolAttributeMismatches lists the allocations whose pool attribute does not match
+	// the IP pool containing them.
+	PoolAttributeMismatches []PoolAttributeMismatch `json:"poolAttributeMismatches,omitempty"`
+
+	// DuplicateTunnelIPs lists the tunnel IPs that are used by more than one node.
+	DuplicateTunnelIPs []DuplicateTunnelIP `json:"duplicateTunnelIPs,omitempty"`
+
+	// HostLocalConflicts lists the allocated or in-use IPs that are inside the ranges
+	// managed by host-local IPAM.
+	HostLocalConflicts []HostLocalConflict `json:"hostLocalConflicts,omitempty"`
+
+	// WorkloadPodMismatches lists the workload endpoints whose IPs do not match the IPs of
+	// their pod.
+	WorkloadPodMismatches []WorkloadPodMismatch `json:"workloadPodMismatches,omitempty"`
+
+	// MissingPools and UnexpectedPools list the CIDRs of the expected IP pools that are not
+	// active, and of the active IP pools that were not expected.
+	MissingPools    []string `json:"missingPools,omitempty"`
+	UnexpectedPools []string `json:"unexpectedPools,omitempty"`
+
+	// TerminatingAllocations lists the allocations to pods in namespaces that are
+	// terminating.
+	TerminatingAllocations []TerminatingAllocation `json:"terminatingAllocations,omitempty"`
+
+	// Allocations is a map of IP address to list of allocation data. This is omitted
+	// if only a summary was requested.
+	Allocations map[string][]*Allocation `json:"allocations,omitempty"`
+}
+
+// ReportSummary contains the counts found by an IPAM check, without any per-IP detail.
+type ReportSummary struct {
+	NumBlocks             int `json:"numBlocks"`
+	NumAllocations        int `json:"numAllocations"`
+	NumInUseIPs           int `json:"numInUseIPs"`
+	NumWindowsReservedIPs int `json:"numWindowsReservedIPs,omitempty"`
+
+	// The number of IPs allocated to reserved handles, other than the Windows reserved
+	// handle. These are not included in the problem count.
+	NumReservedHandleIPs int `json:"numReservedHandleIPs,omitempty"`
+
+	// Counts for each category of problem.
+	NumLeakedIPs              int `json:"numLeakedIPs"`
+	NumNonCalicoIPs           int `json:"numNonCalicoIPs"`
+	NumNotAllocatedIPs        int `json:"numNotAllocatedIPs"`
+	NumMissingAttrAllocations int `json:"numMissingAttrAllocations"`
+	NumAffinityMismatches     int `json:"numAffinityMismatches"`
+	NumSelectorMismatches     int `json:"numSelectorMismatches"`
+	NumOrphanedBlocks         int `json:"numOrphanedBlocks"`
+	NumPoolMismatches         int `json:"numPoolMismatches,omitempty"`
+	NumProblems               int `json:"numProblems"`
+
+	// The number of the NumLeakedIPs that were not leaked in the baseline report. Only set
+	// when the check is compared against a baseline.
+	NumNewLeakedIPs int `json:"numNewLeakedIPs,omitempty"`
+
+	// The number of allocations whose pool attribute does not match the IP pool
+	// containing them.
+	NumPoolAttributeMismatches int `json:"numPoolAttributeMismatches,omitempty"`
+
+	// The number of tunnel IPs that are used by more than one node.
+	NumDuplicateTunnelIPs int `json:"numDuplicateTunnelIPs,omitempty"`
+
+	// The number of allocated or in-use IPs that are inside the ranges managed by
+	// host-local IPAM.
+	NumHostLocalConflicts int `json:"numHostLocalConflicts,omitempty"`
+
+	// The number of blocks with no affinity that hold allocations. These are not
+	// included in the problem count.
+	NumUnaffinedBlocks int `json:"numUnaffinedBlocks"`
+
+	// The number of allocations to pods in terminating namespaces. These are not
+	// included in the problem count.
+	NumTerminatingNamespaceAllocations int `json:"numTerminatingNamespaceAllocations,omitempty"`
+
+	// The number of workload endpoints whose IPs do not match the IPs of their pod. These
+	// are not included in the problem count.
+	NumWorkloadPodMismatches int `json:"numWorkloadPodMismatches,omitempty"`
+
+	// The number of IPs with problems that were excluded from the problem counts.
+	NumIgnoredIPs int `json:"numIgnoredIPs,omitempty"`
+
+	// The number of in-use IPs that were excluded from the non-Calico IPs because they are
+	// the IPs of host-networked pods. These are not included in the problem count.
+	NumHostNetworkedIPs int `json:"numHostNetworkedIPs,omitempty"`
+
+	// The number of the NumNotAllocatedIPs that are in disabled IP pools. Only set
+	// when disabled pools are included in the check.
+	NumNotAllocatedInDisabledPoolIPs int `json:"numNotAllocatedInDisabledPoolIPs,omitempty"`
+
+	// The capacity of the active IP pools for each IP version. Not set when the check
+	// is limited to a node.
+	Capacity []PoolCapacity `json:"capacity,omitempty"`
+}
+
+// SelectorMismatch is an IPAM block affine to a node that does not match the node
+// selector of the IP pool containing the block.
+type SelectorMismatch struct {
+	Block    string `json:"block"`
+	Node     string `json:"node"`
+	Pool     string `json:"pool"`
+	Selector string `json:"selector"`
+}
+
+// OrphanedBlock is an IPAM block that is not in any active or disabled IP pool, usually
+// because the pool was deleted while the block still held allocations.
+type OrphanedBlock struct {
+	Block    string `json:"block"`
+	Affinity string `json:"affinity,omitempty"`
+}
+
+// PoolAttributeMismatch is an allocation whose pool attribute names neither the name nor
+// the CIDR of the IP pool containing it. The current pool is empty if no IP pool contains
+// the allocation.
+type PoolAttributeMismatch struct {
+	IP           string `json:"ip"`
+	Block        string `json:"block"`
+	Ordinal      int    `json:"ordinal"`
+	RecordedPool string `json:"recordedPool"`
+	CurrentPool  string `json:"currentPool,omitempty"`
+}
+
+// DuplicateTunnelIP is a VXLAN, Wireguard or IPIP tunnel IP that is used by more than one
+// node.
+type DuplicateTunnelIP struct {
+	IP    string   `json:"ip"`
+	Nodes []string `json:"nodes"`
+}
+
+// HostLocalConflict is an IP that is allocated in Calico IPAM or in use by a Calico
+// workload or node, and that is inside a range managed by host-local IPAM.
+type HostLocalConflict struct {
+	IP     string   `json:"ip"`
+	Owners []string `json:"owners"`
+	Range  string   `json:"range"`
+}
+
+// WorkloadPodMismatch is a workload endpoint whose IPs do not match the IPs in the status
+// of its pod. The pod IPs are nil if the pod does not exist.
+type WorkloadPodMismatch struct {
+	Namespace   string   `json:"namespace"`
+	Name        string   `json:"name"`
+	Pod         string   `json:"pod"`
+	WorkloadIPs []string `json:"workloadIPs"`
+	PodIPs      []string `json:"podIPs"`
+}
+
+// TerminatingAllocation is an allocation to a pod in a namespace that is terminating. The
+// IP stays allocated until the namespace finalizers complete.
+type TerminatingAllocation struct {
+	IP        string `json:"ip"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+}
+
+// PoolCapacity contains the capacity of the active IP pools of an IP version. The number
+// of addresses is a float, as for "ipam show", since IPv6 pools may have more addresses
+// than an integer can hold.
+type PoolCapacity struct {
+	IPVersion    int     `json:"ipVersion"`
+	TotalIPs     float64 `json:"totalIPs"`
+	AllocatedIPs int     `json:"allocatedIPs"`
+	InUseIPs     int     `json:"inUseIPs"`
+	FreeIPs      float64 `json:"freeIPs"`
 }
 
 func (c *IPAMChecker) printReport() {
-	r := Report{
-		Version:             c.version,
-		ClusterGUID:         c.clusterGUID,
-		ClusterType:         c.clusterType,
-		ClusterInfoRevision: c.clusterInfoRevision,
-		DatastoreLocked:     c.datastoreLocked,
-		Allocations:         c.allocations,
-	}
-	bytes, _ := json.MarshalIndent(r, "", "  ")
+	bytes, _ := json.MarshalIndent(c.fullReport(), "", "  ")
 	_ = ioutil.WriteFile(c.outFile, bytes, 0777)
 }
 
+// fullReport returns the Report, including the allocations unless only a summary was requested.
+// When compared against a baseline, only the allocations of the newly leaked IPs are included.
+func (c *IPAMChecker) fullReport() Report {
+	r := c.newReport()
+	if c.summaryOnly {
+		return r
+	}
+	if c.baseline != nil {
+		r.Allocations = c.leakedAllocations(c.newLeakedIPs)
+	} else {
+		r.Allocations = c.allocations
+	}
+	return r
+}
+
+// leakedAllocations returns the leaked allocations for the given IPs.
+func (c *IPAMChecker) leakedAllocations(leakedIPs []string) map[string][]*Allocation {
+	allocations := map[string][]*Allocation{}
+	for _, ip := range leakedIPs {
+		for _, a := range c.allocations[ip] {
+			if !a.InUse && !a.WindowsReserved && !a.Reserved {
+				allocations[ip] = append(allocations[ip], a)
+			}
+		}
+	}
+	return allocations
+}
+
+// newLeakedIPs returns the leaked IPs that were not leaked in the baseline report.
+func newLeakedIPs(baseline *Report, leakedIPs []string) []string {
+	var ips []string
+	for _, ip := range leakedIPs {
+		leakedBefore := false
+		for _, a := range baseline.Allocations[ip] {
+			if !a.InUse && !a.WindowsReserved && !a.Reserved && !a.Ignored {
+				leakedBefore = true
+				break
+			}
+		}
+		if !leakedBefore {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// emitRemediation writes a report containing only the allocations for the given leaked
+// IPs. The report can be reviewed and then passed to "ipam release --from-report".
+func (c *IPAMChecker) emitRemediation(leakedIPs []string) error {
+	r := c.newReport()
+	r.Allocations = c.leakedAllocations(leakedIPs)
+	bytes, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize remediation report: %w", err)
+	}
+	if err = ioutil.WriteFile(c.remediationFile, bytes, 0644); err != nil {
+		return fmt.Errorf("failed to write remediation report: %w", err)
+	}
+	fmt.Printf("Wrote %d leaked IPs to %s. Review the file, then run \"ipam release --from-report=%s\" to release them.\n",
+		len(r.Allocations), c.remediationFile, c.remediationFile)
+	if !c.datastoreLocked {
+		fmt.Println("Note: the data store is not locked, so the release will require --force.")
+	}
+	return nil
+}
+
+// newReport returns a Report containing the cluster metadata and summary, but no allocations.
+func (c *IPAMChecker) newReport() Report {
+	var baselineRevision string
+	if c.baseline != nil {
+		baselineRevision = c.baseline.ClusterInfoRevision
+	}
+	return Report{
+		Version:                 c.version,
+		ClusterGUID:             c.clusterGUID,
+		ClusterType:             c.clusterType,
+		ClusterLabel:            common.ClusterLabel(c.clusterLabel, c.clusterGUID),
+		ClusterInfoRevision:     c.clusterInfoRevision,
+		DatastoreLocked:         c.datastoreLocked,
+		Node:                    c.node,
+		BaselineRevision:        baselineRevision,
+		SnapshotComparison:      c.snapshotComparison,
+		Incomplete:              c.incomplete,
+		Summary:                 c.summary,
+		IgnoredIPs:              c.ignoredIPs,
+		HostNetworkedIPs:        c.hostNetworkedIPs,
+		UnaffinedBlocks:         c.unaffinedBlocks,
+		SelectorMismatches:      c.selectorMismatches,
+		OrphanedBlocks:          c.orphanedBlocks,
+		PoolAttributeMismatches: c.poolAttributeMismatches,
+		DuplicateTunnelIPs:      c.duplicateTunnelIPs,
+		HostLocalConflicts:      c.hostLocalConflicts,
+		WorkloadPodMismatches:   c.workloadPodMismatches,
+		MissingPools:            c.missingPools,
+		UnexpectedPools:         c.unexpectedPools,
+		TerminatingAllocations:  c.terminatingAllocations,
+	}
+}
+
+// hostNetworkedPodIPs returns the IPs of the host-networked pods, which are the IPs of
+// their nodes. Only the pods on the node are loaded if the check is limited to a node.
+func (c *IPAMChecker) hostNetworkedPodIPs(ctx context.Context) (map[string]bool, error) {
+	pods, err := c.podIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ips := map[string]bool{}
+	for ip, ps := range pods.byIP {
+		for _, p := range ps {
+			if p.Spec.HostNetwork {
+				ips[ip] = true
+				break
+			}
+		}
+	}
+	return ips, nil
+}
+
+// checkWorkloadPodIPs returns the workload endpoints whose IPs do not match the IPs in the
+// status of their pod, or whose pod does not exist. Pods that have not been assigned IPs
+// yet are skipped.
+func (c *IPAMChecker) checkWorkloadPodIPs(ctx context.Context, weps []apiv3.WorkloadEndpoint) ([]WorkloadPodMismatch, error) {
+	pods, err := c.podIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []WorkloadPodMismatch
+	for _, w := range weps {
+		if w.Spec.Pod == "" {
+			continue
+		}
+		wepIPs, err := getWEPIPs(w)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(wepIPs)
+		ips, ok := pods.ipsByName[w.Namespace+"/"+w.Spec.Pod]
+		if ok && (len(ips) == 0 || reflect.DeepEqual(ips, wepIPs)) {
+			continue
+		}
+		mismatches = append(mismatches, WorkloadPodMismatch{
+			Namespace:   w.Namespace,
+			Name:        w.Name,
+			Pod:         w.Spec.Pod,
+			WorkloadIPs: wepIPs,
+			PodIPs:      ips,
+		})
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Namespace != mismatches[j].Namespace {
+			return mismatches[i].Namespace < mismatches[j].Namespace
+		}
+		return mismatches[i].Name < mismatches[j].Name
+	})
+	return mismatches, nil
+}
+
+// checkExpectedPools compares the CIDRs of the active IP pools against the expected
+// CIDRs, returning the expected CIDRs that are not active and the active CIDRs that were
+// not expected, in order.
+func (c *IPAMChecker) checkExpectedPools(active []*cnet.IPNet) (missing, unexpected []string) {
+	expected := map[string]bool{}
+	for _, cidr := range c.expectPools {
+		expected[cidr] = true
+	}
+	found := map[string]bool{}
+	for _, cidr := range active {
+		found[cidr.String()] = true
+		if !expected[cidr.String()] {
+			unexpected = append(unexpected, cidr.String())
+		}
+	}
+	for cidr := range expected {
+		if !found[cidr] {
+			missing = append(missing, cidr)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+	return missing, unexpected
+}
+
+// checkTerminatingNamespaces returns the allocations to pods in namespaces that are
+// terminating, in order of IP.
+func (c *IPAMChecker) checkTerminatingNamespaces(ctx context.Context) ([]TerminatingAllocation, error) {
+	namespaces, err := c.k8sClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	terminating := map[string]bool{}
+	for _, ns := range namespaces.Items {
+		if ns.Status.Phase == corev1.NamespaceTerminating {
+			terminating[ns.Name] = true
+		}
+	}
+	if len(terminating) == 0 {
+		return nil, nil
+	}
+
+	var allocs []TerminatingAllocation
+	for ip, ipAllocs := range c.allocations {
+		for _, a := range ipAllocs {
+			if a.Pod == "" || !terminating[a.Namespace] || !c.allocationsIncluded([]*Allocation{a}) {
+				continue
+			}
+			allocs = append(allocs, TerminatingAllocation{IP: ip, Namespace: a.Namespace, Pod: a.Pod})
+		}
+	}
+	sort.Slice(allocs, func(i, j int) bool {
+		return allocs[i].IP < allocs[j].IP
+	})
+	return allocs, nil
+}
+
+// checkBlockAffinities cross-checks the block affinity resources against the affinities of
+// the blocks, returning the number of mismatches in either direction. A mismatch indicates
+// that an operation to claim or release a block did not complete.
+func (c *IPAMChecker) checkBlockAffinities(ctx context.Context) (int, error) {
+	affinities, err := c.backendClient.List(ctx, model.BlockAffinityListOptions{}, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list IPAM block affinities: %w", err)
+	}
+
+	mismatches := 0
+	affinityHosts := map[string]string{}
+	for _, kvp := range affinities.KVPairs {
+		k := kvp.Key.(model.BlockAffinityKey)
+		if c.node != "" && k.Host != c.node {
+			continue
+		}
+		cidr := k.CIDR.String()
+		affinityHosts[cidr] = k.Host
+		if host, ok := c.blockAffinityHosts[cidr]; !ok || host != k.Host {
+			if c.showProblemIPs {
+				c.printProblem("  Block affinity for host %s and block %s has no matching block.\n", k.Host, cidr)
+			}
+			mismatches++
+		}
+	}
+	for cidr, host := range c.blockAffinityHosts {
+		if c.node != "" && host != c.node {
+			continue
+		}
+		if affinityHosts[cidr] != host {
+			if c.showProblemIPs {
+				c.printProblem("  Block %s with affinity for host %s has no matching block affinity.\n", cidr, host)
+			}
+			mismatches++
+		}
+	}
+	return mismatches, nil
+}
+
 // recordAllocation takes a block and ordinal within that block and updates
 // the IPAMChecker's internal state to track the allocation.
 func (c *IPAMChecker) recordAllocation(b *model.AllocationBlock, ord int) {
@@ -417,12 +1866,24 @@ func (c *IPAMChecker) recordAllocation(b *model.AllocationBlock, ord int) {
 	}
 
 	attrIdx := *b.Allocations[ord]
-	if len(b.Attributes) > attrIdx {
+	if attrIdx < 0 || len(b.Attributes) <= attrIdx {
+		// The allocation refers to attributes which do not exist in the block.
+		c.missingAttrAllocations = append(c.missingAttrAllocations, &alloc)
+	} else {
 		attrs := b.Attributes[attrIdx]
 		if attrs.AttrPrimary != nil && *attrs.AttrPrimary == ipam.WindowsReservedHandle {
-			c.recordInUseIP(ip, b, "Reserved for Windows")
+			if c.includeReserved {
+				c.recordReservedIP(ip)
+				alloc.WindowsReserved = true
+			} else {
+				c.recordInUseIP(ip, b, "Reserved for Windows")
+			}
 		} else if attrs.AttrPrimary != nil {
 			alloc.Handle = *attrs.AttrPrimary
+			if c.isReservedHandle(alloc.Handle) {
+				c.recordReservedHandleIP(ip, alloc.Handle)
+				alloc.Reserved = true
+			}
 		}
 		if n := attrs.AttrSecondary["node"]; n != "" {
 			node = n
@@ -439,6 +1900,9 @@ func (c *IPAMChecker) recordAllocation(b *model.AllocationBlock, ord int) {
 		if t := attrs.AttrSecondary["timestamp"]; t != "" {
 			alloc.CreationTimestamp = t
 		}
+		if p := attrs.AttrSecondary[attributePool]; p != "" {
+			alloc.Pool = p
+		}
 	}
 
 	// Fill in the node for the allocation.
@@ -458,7 +1922,7 @@ func (c *IPAMChecker) recordAllocation(b *model.AllocationBlock, ord int) {
 	}
 
 	if c.showAllIPs {
-		fmt.Printf("  %s allocated; attrs %s\n", ip, alloc.GetAttrString())
+		fmt.Println(c.attrsLine(fmt.Sprintf("  %s allocated; attrs ", ip), &alloc))
 	}
 }
 
@@ -480,6 +1944,190 @@ func (c *IPAMChecker) recordInUseIP(ip string, referrer interface{}, friendlyNam
 	}
 }
 
+// listNodes returns the nodes, or just the node that the check is limited to.
+func (c *IPAMChecker) listNodes(ctx context.Context) ([]apiv3.Node, error) {
+	if c.node != "" {
+		c.printf("Loading node %s.\n", c.node)
+		n, err := c.v3Client.Nodes().Get(ctx, c.node, options.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node %s: %w", c.node, err)
+		}
+		return []apiv3.Node{*n}, nil
+	}
+
+	c.printf("Loading all nodes.\n")
+	nodes, err := c.v3Client.Nodes().List(ctx, options.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return nodes.Items, nil
+}
+
+// listWorkloadEndpoints returns the workload endpoints, or just those on the node that the
+// check is limited to. The workload endpoint names start with the node name, so the node's
+// endpoints are listed by name prefix to avoid loading every endpoint in the cluster. If the
+// datastore does not support listing by prefix, all endpoints are listed instead. The
+// endpoints are always filtered by node, since the prefix may also match other nodes whose
+// names start with the node name.
+func (c *IPAMChecker) listWorkloadEndpoints(ctx context.Context) ([]apiv3.WorkloadEndpoint, error) {
+	if c.node == "" {
+		c.printf("Loading all workload endpoints.\n")
+		weps, err := c.v3Client.WorkloadEndpoints().List(ctx, options.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workload endpoints: %w", err)
+		}
+		return weps.Items, nil
+	}
+
+	c.printf("Loading workload endpoints on node %s.\n", c.node)
+	weps, err := c.v3Client.WorkloadEndpoints().List(ctx, options.ListOptions{
+		Name:   workloadEndpointNamePrefix(c.node),
+		Prefix: true,
+	})
+	if err != nil {
+		c.printf("Unable to list workload endpoints by node (%v); listing all workload endpoints.\n", err)
+		weps, err = c.v3Client.WorkloadEndpoints().List(ctx, options.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workload endpoints: %w", err)
+		}
+	}
+
+	var nodeWEPs []apiv3.WorkloadEndpoint
+	for _, w := range weps.Items {
+		if w.Spec.Node == c.node {
+			nodeWEPs = append(nodeWEPs, w)
+		}
+	}
+	return nodeWEPs, nil
+}
+
+// workloadEndpointNamePrefix returns the prefix of the names of the workload endpoints on
+// the node. Workload endpoint names are formed by joining the node, orchestrator, workload
+// and endpoint names with "-", after replacing each "-" within them with "--".
+func workloadEndpointNamePrefix(node string) string {
+	return strings.ReplaceAll(node, "-", "--") + "-"
+}
+
+// allocationsIncluded returns true if the check is not limited to a node, or if any of the
+// allocations are for the node that the check is limited to.
+func (c *IPAMChecker) allocationsIncluded(allocs []*Allocation) bool {
+	if c.node == "" {
+		return true
+	}
+	for _, a := range allocs {
+		if a.Node == c.node {
+			return true
+		}
+	}
+	return false
+}
+
+// allocationsIgnored returns true if all of the allocations are in ignored namespaces or
+// have ignored handles.
+func (c *IPAMChecker) allocationsIgnored(allocs []*Allocation) bool {
+	for _, a := range allocs {
+		if !c.namespaceIgnored(a.Namespace) && !c.handleIgnored(a.Handle) {
+			return false
+		}
+	}
+	return len(allocs) > 0
+}
+
+// ownersIgnored returns true if all of the owners are workloads in ignored namespaces.
+func (c *IPAMChecker) ownersIgnored(owners []ownerRecord) bool {
+	for _, o := range owners {
+		w, ok := o.Resource.(apiv3.WorkloadEndpoint)
+		if !ok || !c.namespaceIgnored(w.Namespace) {
+			return false
+		}
+	}
+	return len(owners) > 0
+}
+
+func (c *IPAMChecker) namespaceIgnored(namespace string) bool {
+	if namespace == "" {
+		return false
+	}
+	for _, ns := range c.ignoreNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *IPAMChecker) handleIgnored(handle string) bool {
+	if handle == "" {
+		return false
+	}
+	for _, prefix := range c.ignoreHandlePrefixes {
+		if strings.HasPrefix(handle, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordIncomplete records that the data could not be loaded, so the check is incomplete.
+// The check continues with the data that was loaded.
+func (c *IPAMChecker) recordIncomplete(what string, err error) {
+	c.printf("WARNING: Failed to load the %s: %v. Continuing, but the results will be incomplete.\n", what, err)
+	c.incomplete = append(c.incomplete, what)
+}
+
+// printProblem prints a line about a problem IP, unless the maximum number of problem
+// lines have already been printed. The lines that are not printed are counted.
+func (c *IPAMChecker) printProblem(format string, args ...interface{}) {
+	c.numProblemLines++
+	if c.maxProblemLines > 0 && c.numProblemLines > c.maxProblemLines {
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// recordIgnoredIP records that the given IP has a problem which is ignored.
+func (c *IPAMChecker) recordIgnoredIP(ip string, problem string) {
+	if c.showProblemIPs {
+		c.printProblem("  %s %s; ignored\n", ip, problem)
+	}
+	c.ignoredIPs = append(c.ignoredIPs, ip)
+}
+
+// recordReservedIP records that the given IP is reserved for Windows. Reserved IPs are
+// only tracked separately from in use IPs when --include-reserved is set.
+func (c *IPAMChecker) recordReservedIP(ip string) {
+	if c.showAllIPs {
+		fmt.Printf("  %s reserved for Windows\n", ip)
+	}
+	c.reservedIPs[ip] = true
+}
+
+// attributePool is the allocation attribute that records the name or CIDR of the IP pool
+// that the address was allocated from. Calico IPAM does not set it, but some IPAM
+// clients do.
+const attributePool = "pool"
+
+// isReservedHandle returns true if the handle starts with one of the reserved handle
+// prefixes.
+func (c *IPAMChecker) isReservedHandle(handle string) bool {
+	for _, p := range c.reservedHandlePrefixes {
+		if strings.HasPrefix(handle, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordReservedHandleIP records that the given IP is allocated to a reserved handle.
+func (c *IPAMChecker) recordReservedHandleIP(ip, handle string) {
+	if c.showAllIPs {
+		fmt.Printf("  %s reserved by handle %s\n", ip, handle)
+	}
+	c.reservedHandleIPs[ip] = true
+}
+
+// getNodeIPs returns the tunnel addresses of the node that are allocated from Calico IPAM.
+// Nodes only have IPv4 tunnel addresses; the node's IPv6 address is not allocated from IPAM.
 func getNodeIPs(n apiv3.Node) ([]string, error) {
 	var ips []string
 	if n.Spec.IPv4VXLANTunnelAddr != "" {
@@ -509,6 +2157,78 @@ func getNodeIPs(n apiv3.Node) ([]string, error) {
 	return ips, nil
 }
 
+// poolsContain returns true if the IP is within any of the pool CIDRs. Only pools of the
+// same IP family as the IP are considered, so that an IPv4 address is never matched by an
+// IPv6 pool that covers the IPv4-mapped address range.
+func poolsContain(pools []*cnet.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	version := cnet.IP{IP: ip}.Version()
+	for _, cidr := range pools {
+		if cidr.Version() == version && cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// poolCapacity returns the capacity of the pools for each IP version that has a pool.
+// Only allocations and in use IPs within the pools are counted. Overlapping pools are
+// merged first, so that the addresses they share are only counted once.
+func (c *IPAMChecker) poolCapacity(pools []*cnet.IPNet) []PoolCapacity {
+	var capacity []PoolCapacity
+	for _, version := range []int{4, 6} {
+		var versionPools []*cnet.IPNet
+		pc := PoolCapacity{IPVersion: version}
+		for _, cidr := range mergePools(pools) {
+			if cidr.Version() == version {
+				versionPools = append(versionPools, cidr)
+				ones, bits := cidr.Mask.Size()
+				pc.TotalIPs += math.Pow(2, float64(bits-ones))
+			}
+		}
+		if len(versionPools) == 0 {
+			continue
+		}
+		for ip := range c.allocations {
+			if poolsContain(versionPools, net.ParseIP(ip)) {
+				pc.AllocatedIPs++
+			}
+		}
+		for ip := range c.inUseIPs {
+			if poolsContain(versionPools, net.ParseIP(ip)) {
+				pc.InUseIPs++
+			}
+		}
+		pc.FreeIPs = pc.TotalIPs - float64(pc.AllocatedIPs)
+		capacity = append(capacity, pc)
+	}
+	return capacity
+}
+
+// mergePools returns the pools with any pool that is within another pool removed. Two
+// CIDRs either do not overlap or one contains the other, so the remaining pools do not
+// overlap.
+func mergePools(pools []*cnet.IPNet) []*cnet.IPNet {
+	sorted := append([]*cnet.IPNet(nil), pools...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		onesI, _ := sorted[i].Mask.Size()
+		onesJ, _ := sorted[j].Mask.Size()
+		return onesI < onesJ
+	})
+	var merged []*cnet.IPNet
+	for _, cidr := range sorted {
+		if !poolsContain(merged, cidr.IP) {
+			merged = append(merged, cidr)
+		}
+	}
+	return merged
+}
+
+// normaliseIP parses the IP address or CIDR and returns the address in canonical form. The
+// in use IPs are matched against the allocations by string, so this ensures that IPv6
+// addresses written in different forms (e.g. with or without leading zeros) still match.
 func normaliseIP(addr string) (string, error) {
 	ip, _, err := cnet.ParseCIDROrIP(addr)
 	if err != nil {
@@ -536,6 +2256,9 @@ type Allocation struct {
 	Type              string `json:"type,omitempty"`
 	CreationTimestamp string `json:"creationTimestamp,omitempty"`
 
+	// The IP pool recorded by the pool attribute of the allocation, if any.
+	Pool string `json:"pool,omitempty"`
+
 	// InUse is true when this Allocation is currently being used by a running
 	// workload / node / etc. It is false if this address is not active and should be cleaned up.
 	InUse bool `json:"inUse"`
@@ -543,31 +2266,99 @@ type Allocation struct {
 	// Borrowed is true if this IP is from a block that is not affine to the node.
 	Borrowed bool `json:"borrowed,omitempty"`
 
+	// WindowsReserved is true if this IP is reserved for Windows and was reported separately
+	// from the in use IPs.
+	WindowsReserved bool `json:"windowsReserved,omitempty"`
+
+	// Reserved is true if this IP is allocated to a reserved handle other than the Windows
+	// reserved handle. Reserved IPs are never leaked.
+	Reserved bool `json:"reserved,omitempty"`
+
+	// InDisabledPool is true if this IP is in a disabled IP pool. This is only set when
+	// disabled pools are included in the check.
+	InDisabledPool bool `json:"inDisabledPool,omitempty"`
+
+	// Ignored is true if this IP is leaked but matched the namespaces or handle prefixes
+	// to ignore. Ignored IPs are not released from a report.
+	Ignored bool `json:"ignored,omitempty"`
+
 	// List of objects which are using this IP.
 	Owners []string `json:"owners"`
 }
 
-func (a *Allocation) GetAttrString() string {
+func (a *Allocation) GetAttrString(format AttrFormat) string {
 	attrIdx := *a.Block.Allocations[a.Ordinal]
-	if len(a.Block.Attributes) > attrIdx {
-		return formatAttrs(a.Block.Attributes[attrIdx])
+	if attrIdx >= 0 && len(a.Block.Attributes) > attrIdx {
+		return formatAttrs(a.Block.Attributes[attrIdx], format)
 	}
 	return "<missing>"
 }
 
-func formatAttrs(attribute model.AllocationAttribute) string {
+// attrsLine returns the prefix followed by the attributes of the allocation, truncating
+// the attributes so that the line fits within the maximum width.
+func (c *IPAMChecker) attrsLine(prefix string, alloc *Allocation) string {
+	return prefix + common.Truncate(alloc.GetAttrString(c.attrFormat), c.maxWidth-len(prefix))
+}
+
+// AttrFormat is the format of the attributes of a printed IP. The zero value is the
+// default format.
+type AttrFormat struct {
+	// JSON formats the attributes as a JSON object.
+	JSON bool
+
+	// Keys limits the secondary attributes in the default format to these keys, in order.
+	Keys []string
+}
+
+// ParseAttrFormat parses the value of the --attr-format option.
+func ParseAttrFormat(s string) (AttrFormat, error) {
+	switch {
+	case s == "default":
+		return AttrFormat{}, nil
+	case s == "json":
+		return AttrFormat{JSON: true}, nil
+	case strings.HasPrefix(s, "keys="):
+		var keys []string
+		for _, k := range strings.Split(strings.TrimPrefix(s, "keys="), ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) > 0 {
+			return AttrFormat{Keys: keys}, nil
+		}
+	}
+	return AttrFormat{}, fmt.Errorf("Unrecognized attribute format '%s', expected one of: default, json, keys=<KEYS>", s)
+}
+
+func formatAttrs(attribute model.AllocationAttribute, format AttrFormat) string {
+	if format.JSON {
+		b, err := json.Marshal(struct {
+			Main  *string           `json:"main,omitempty"`
+			Extra map[string]string `json:"extra,omitempty"`
+		}{attribute.AttrPrimary, attribute.AttrSecondary})
+		if err != nil {
+			return fmt.Sprintf("<invalid: %s>", err)
+		}
+		return string(b)
+	}
+
 	primary := "<none>"
 	if attribute.AttrPrimary != nil {
 		primary = *attribute.AttrPrimary
 	}
-	var keys []string
-	for k := range attribute.AttrSecondary {
-		keys = append(keys, k)
+	keys := format.Keys
+	if keys == nil {
+		for k := range attribute.AttrSecondary {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
 	}
-	sort.Strings(keys)
 	var kvs []string
 	for _, k := range keys {
-		kvs = append(kvs, fmt.Sprintf("%s=%s", k, attribute.AttrSecondary[k]))
+		if v, ok := attribute.AttrSecondary[k]; ok {
+			kvs = append(kvs, fmt.Sprintf("%s=%s", k, v))
+		}
 	}
 	return fmt.Sprintf("Main:%s Extra:%s", primary, strings.Join(kvs, ","))
 }
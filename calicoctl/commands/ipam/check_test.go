@@ -0,0 +1,350 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+var _ = Describe("Testing the IPAM check for terminating namespaces", func() {
+	newNamespace := func(name string, phase corev1.NamespacePhase) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NamespaceStatus{Phase: phase},
+		}
+	}
+
+	It("should report the allocations to pods in terminating namespaces", func() {
+		k8sClient := fake.NewSimpleClientset(
+			newNamespace("active", corev1.NamespaceActive),
+			newNamespace("stuck", corev1.NamespaceTerminating),
+		)
+		c := NewIPAMChecker(k8sClient, nil, nil, IPAMCheckerOptions{})
+
+		affinity := "host:node1"
+		b := &model.AllocationBlock{
+			CIDR:        cnet.MustParseCIDR("10.0.0.0/30"),
+			Affinity:    &affinity,
+			Allocations: make([]*int, 4),
+		}
+		for ord, pod := range map[int]struct{ namespace, name string }{
+			0: {"active", "pod1"},
+			1: {"stuck", "pod2"},
+			3: {"stuck", "pod3"},
+		} {
+			idx := len(b.Attributes)
+			b.Attributes = append(b.Attributes, model.AllocationAttribute{
+				AttrSecondary: map[string]string{"node": "node1", "namespace": pod.namespace, "pod": pod.name},
+			})
+			b.Allocations[ord] = &idx
+		}
+		c.recordBlock(&IPAMState{}, b)
+
+		allocs, err := c.checkTerminatingNamespaces(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allocs).To(Equal([]TerminatingAllocation{
+			{IP: "10.0.0.1", Namespace: "stuck", Pod: "pod2"},
+			{IP: "10.0.0.3", Namespace: "stuck", Pod: "pod3"},
+		}))
+	})
+})
+
+var _ = Describe("Testing the IPAM check for expected pools", func() {
+	pool := func(cidr string) *cnet.IPNet {
+		n := cnet.MustParseCIDR(cidr)
+		return &n
+	}
+
+	It("should report the missing and unexpected pools", func() {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{ExpectPools: []string{"10.0.0.0/16", "10.1.0.0/16", "fd00::/64"}})
+		active := []*cnet.IPNet{
+			pool("10.2.0.0/16"),
+			pool("fd00::/64"),
+			pool("10.0.0.0/16"),
+		}
+
+		missing, unexpected := c.checkExpectedPools(active)
+		Expect(missing).To(Equal([]string{"10.1.0.0/16"}))
+		Expect(unexpected).To(Equal([]string{"10.2.0.0/16"}))
+	})
+
+	It("should report nothing when the pools match", func() {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{ExpectPools: []string{"10.0.0.0/16"}})
+		missing, unexpected := c.checkExpectedPools([]*cnet.IPNet{pool("10.0.0.0/16")})
+		Expect(missing).To(BeEmpty())
+		Expect(unexpected).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Testing the IPAM check problem lines", func() {
+	It("should count the problem lines beyond the maximum without printing them", func() {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{
+			ShowProblemIPs:  true,
+			MaxProblemLines: 2,
+		})
+		for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+			c.recordIgnoredIP(ip, "leaked")
+		}
+		Expect(c.ignoredIPs).To(HaveLen(3))
+		Expect(c.numProblemLines).To(Equal(3))
+	})
+})
+
+// newPod returns a pod with the IPs in its status.
+func newPod(namespace, name string, ips ...string) *corev1.Pod {
+	p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	for _, ip := range ips {
+		p.Status.PodIPs = append(p.Status.PodIPs, corev1.PodIP{IP: ip})
+	}
+	return p
+}
+
+// newWEP returns a workload endpoint on node1 for the pod, with the IP networks.
+func newWEP(namespace, pod string, ipNets ...string) apiv3.WorkloadEndpoint {
+	w := apiv3.NewWorkloadEndpoint()
+	w.Namespace = namespace
+	w.Name = "node1-k8s-" + pod + "-eth0"
+	w.Spec.Pod = pod
+	w.Spec.IPNetworks = ipNets
+	return *w
+}
+
+var _ = Describe("Testing the IPAM check for workload endpoints that do not match their pod", func() {
+	It("should report the workload endpoints whose IPs do not match the pod IPs", func() {
+		k8sClient := fake.NewSimpleClientset(
+			newPod("default", "match", "10.0.0.1", "fd00::1"),
+			newPod("default", "stale", "10.0.0.3"),
+			newPod("default", "pending"),
+		)
+		c := NewIPAMChecker(k8sClient, nil, nil, IPAMCheckerOptions{})
+		weps := []apiv3.WorkloadEndpoint{
+			newWEP("default", "match", "fd00::1/128", "10.0.0.1/32"),
+			newWEP("default", "stale", "10.0.0.2/32"),
+			newWEP("default", "pending", "10.0.0.4/32"),
+			newWEP("default", "gone", "10.0.0.5/32"),
+		}
+
+		mismatches, err := c.checkWorkloadPodIPs(context.Background(), weps)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mismatches).To(Equal([]WorkloadPodMismatch{
+			{Namespace: "default", Name: "node1-k8s-gone-eth0", Pod: "gone", WorkloadIPs: []string{"10.0.0.5"}},
+			{Namespace: "default", Name: "node1-k8s-stale-eth0", Pod: "stale", WorkloadIPs: []string{"10.0.0.2"}, PodIPs: []string{"10.0.0.3"}},
+		}))
+	})
+})
+
+var _ = Describe("Testing the formatting of allocation attributes", func() {
+	handle := "k8s-pod-network.abcd"
+	attrs := model.AllocationAttribute{
+		AttrPrimary:   &handle,
+		AttrSecondary: map[string]string{"node": "node1", "namespace": "default", "pod": "pod1"},
+	}
+
+	It("should format all of the attributes by default", func() {
+		Expect(formatAttrs(attrs, AttrFormat{})).To(Equal(
+			"Main:k8s-pod-network.abcd Extra:namespace=default,node=node1,pod=pod1"))
+	})
+
+	It("should only format the given keys, in order", func() {
+		f, err := ParseAttrFormat("keys=pod,namespace,missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(formatAttrs(attrs, f)).To(Equal("Main:k8s-pod-network.abcd Extra:pod=pod1,namespace=default"))
+	})
+
+	It("should format the attributes as JSON", func() {
+		f, err := ParseAttrFormat("json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(formatAttrs(attrs, f)).To(Equal(
+			`{"main":"k8s-pod-network.abcd","extra":{"namespace":"default","node":"node1","pod":"pod1"}}`))
+	})
+
+	It("should reject an unrecognized format", func() {
+		for _, s := range []string{"yaml", "keys=", "keys= , "} {
+			_, err := ParseAttrFormat(s)
+			Expect(err).To(HaveOccurred(), s)
+		}
+	})
+})
+
+var _ = Describe("Testing the IPAM check for host-networked pods", func() {
+	It("should return the IPs of the host-networked pods", func() {
+		hostPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "kube-proxy"},
+			Spec:       corev1.PodSpec{HostNetwork: true},
+			Status:     corev1.PodStatus{PodIPs: []corev1.PodIP{{IP: "192.168.1.10"}, {IP: "fd00:0::10"}}},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod1"},
+			Status:     corev1.PodStatus{PodIPs: []corev1.PodIP{{IP: "10.0.0.1"}}},
+		}
+		c := NewIPAMChecker(fake.NewSimpleClientset(hostPod, pod), nil, nil, IPAMCheckerOptions{})
+
+		ips, err := c.hostNetworkedPodIPs(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ips).To(Equal(map[string]bool{"192.168.1.10": true, "fd00::10": true}))
+	})
+})
+
+var _ = Describe("Testing incremental IPAM reports", func() {
+	baseline := &Report{
+		ClusterInfoRevision: "100",
+		Allocations: map[string][]*Allocation{
+			"10.0.0.1": {{IP: "10.0.0.1"}},
+			"10.0.0.2": {{IP: "10.0.0.2", InUse: true}},
+			"10.0.0.3": {{IP: "10.0.0.3", Ignored: true}},
+		},
+	}
+
+	It("should return the IPs that were not leaked in the baseline", func() {
+		Expect(newLeakedIPs(baseline, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"})).To(
+			Equal([]string{"10.0.0.2", "10.0.0.3", "10.0.0.4"}))
+	})
+
+	It("should only include the newly leaked allocations in the report", func() {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{Baseline: baseline})
+		c.clusterInfoRevision = "200"
+		c.allocations = map[string][]*Allocation{
+			"10.0.0.1": {{IP: "10.0.0.1"}},
+			"10.0.0.4": {{IP: "10.0.0.4"}},
+			"10.0.0.5": {{IP: "10.0.0.5", InUse: true}},
+		}
+		c.newLeakedIPs = newLeakedIPs(baseline, []string{"10.0.0.1", "10.0.0.4"})
+
+		r := c.fullReport()
+		Expect(r.ClusterInfoRevision).To(Equal("200"))
+		Expect(r.BaselineRevision).To(Equal("100"))
+		Expect(r.Allocations).To(Equal(map[string][]*Allocation{"10.0.0.4": {{IP: "10.0.0.4"}}}))
+	})
+})
+
+var _ = Describe("Testing the pod index", func() {
+	It("should list the pods once and reuse them for each scan", func() {
+		k8sClient := fake.NewSimpleClientset(newPod("default", "pod1", "10.0.0.1"))
+		c := NewIPAMChecker(k8sClient, nil, nil, IPAMCheckerOptions{})
+
+		_, err := c.hostNetworkedPodIPs(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		_, err = c.checkWorkloadPodIPs(context.Background(), []apiv3.WorkloadEndpoint{newWEP("default", "pod1", "10.0.0.1/32")})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.Actions()).To(HaveLen(1))
+		Expect(c.pods.byIP).To(HaveKey("10.0.0.1"))
+		Expect(c.pods.ipsByName).To(HaveKeyWithValue("default/pod1", []string{"10.0.0.1"}))
+	})
+})
+
+var _ = Describe("Testing the IPAM check for allocations with a stale pool attribute", func() {
+	It("should report the allocations whose pool attribute does not match the containing pool", func() {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{})
+		block := &model.AllocationBlock{
+			CIDR:        cnet.MustParseCIDR("10.0.0.0/30"),
+			Allocations: make([]*int, 4),
+			Attributes: []model.AllocationAttribute{
+				{AttrSecondary: map[string]string{"pool": "pool-new"}},
+				{AttrSecondary: map[string]string{"pool": "10.0.0.0/24"}},
+				{AttrSecondary: map[string]string{"pool": "pool-old"}},
+				{AttrSecondary: map[string]string{}},
+			},
+		}
+		for i := range block.Allocations {
+			attrIdx := i
+			block.Allocations[i] = &attrIdx
+		}
+		c.recordBlock(&IPAMState{}, block)
+
+		pool := apiv3.NewIPPool()
+		pool.Name = "pool-new"
+		pool.Spec.CIDR = "10.0.0.0/24"
+		mismatches, err := c.checkPoolAttributes([]apiv3.IPPool{*pool})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mismatches).To(Equal([]PoolAttributeMismatch{
+			{IP: "10.0.0.2", Block: "10.0.0.0/30", Ordinal: 2, RecordedPool: "pool-old", CurrentPool: "pool-new"},
+		}))
+
+		mismatches, err = c.checkPoolAttributes(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mismatches).To(HaveLen(3))
+		Expect(mismatches[0].CurrentPool).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Testing the IPAM check for duplicate tunnel IPs", func() {
+	It("should report the tunnel IPs used by more than one node", func() {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{})
+		newNode := func(name, vxlan, ipip string) apiv3.Node {
+			n := apiv3.NewNode()
+			n.Name = name
+			n.Spec.IPv4VXLANTunnelAddr = vxlan
+			n.Spec.BGP = &apiv3.NodeBGPSpec{IPv4IPIPTunnelAddr: ipip}
+			return *n
+		}
+		s := &IPAMState{}
+		for _, n := range []apiv3.Node{
+			newNode("node2", "10.0.0.1", ""),
+			newNode("node1", "10.0.0.1", "10.0.0.1"),
+			newNode("node3", "10.0.0.3", "10.0.0.3"),
+		} {
+			Expect(c.recordNode(s, n)).To(Succeed())
+		}
+		c.recordInUseIP("10.0.0.3", apiv3.WorkloadEndpoint{}, "Workload(default/pod1)")
+
+		Expect(c.checkDuplicateTunnelIPs()).To(Equal([]DuplicateTunnelIP{
+			{IP: "10.0.0.1", Nodes: []string{"node1", "node2"}},
+		}))
+	})
+})
+
+var _ = Describe("Testing the IPAM check for host-local ranges", func() {
+	It("should report the allocated and in-use IPs inside the host-local ranges", func() {
+		r4, r6 := cnet.MustParseCIDR("10.0.1.0/24"), cnet.MustParseCIDR("fd00:1::/64")
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{HostLocalRanges: []*cnet.IPNet{&r4, &r6}})
+		c.allocations["10.0.1.5"] = []*Allocation{{IP: "10.0.1.5", Handle: "k8s-pod-network.abc", Namespace: "default", Pod: "pod1"}}
+		c.allocations["10.0.1.6"] = []*Allocation{{IP: "10.0.1.6", Handle: "ipip-tunnel-addr-node1", Node: "node1", Type: model.IPAMBlockAttributeTypeIPIP}}
+		c.allocations["10.0.2.5"] = []*Allocation{{IP: "10.0.2.5", Handle: "k8s-pod-network.def", Namespace: "default", Pod: "pod2"}}
+		c.recordInUseIP("10.0.1.5", apiv3.WorkloadEndpoint{}, "Workload(default/node1-k8s-pod1-eth0)")
+		c.recordInUseIP("fd00:1::7", apiv3.WorkloadEndpoint{}, "Workload(default/node1-k8s-pod3-eth0)")
+
+		Expect(c.checkHostLocalRanges()).To(Equal([]HostLocalConflict{
+			{IP: "10.0.1.5", Owners: []string{"Workload(default/node1-k8s-pod1-eth0)"}, Range: "10.0.1.0/24"},
+			{IP: "10.0.1.6", Owners: []string{"Node(node1)"}, Range: "10.0.1.0/24"},
+			{IP: "fd00:1::7", Owners: []string{"Workload(default/node1-k8s-pod3-eth0)"}, Range: "fd00:1::/64"},
+		}))
+	})
+})
+
+var _ = Describe("Testing the capacity of the IP pools", func() {
+	It("should only count the addresses shared by overlapping pools once", func() {
+		pool := func(cidr string) *cnet.IPNet {
+			n := cnet.MustParseCIDR(cidr)
+			return &n
+		}
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{})
+		c.allocations["10.0.1.5"] = []*Allocation{{IP: "10.0.1.5"}}
+
+		capacity := c.poolCapacity([]*cnet.IPNet{pool("10.0.1.0/24"), pool("10.0.0.0/16"), pool("10.0.0.0/16"), pool("10.1.0.0/24")})
+		Expect(capacity).To(Equal([]PoolCapacity{{IPVersion: 4, TotalIPs: 65536 + 256, AllocatedIPs: 1, FreeIPs: 65536 + 256 - 1}}))
+	})
+})
@@ -0,0 +1,288 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	docopt "github.com/docopt/docopt-go"
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/clientv3"
+	cerrors "github.com/projectcalico/libcalico-go/lib/errors"
+	"github.com/projectcalico/libcalico-go/lib/ipam"
+)
+
+// HandleDetail is an IPAM handle and the allocations that refer to it, as output by
+// "ipam handle".
+type HandleDetail struct {
+	HandleID string `json:"handleID"`
+
+	// Exists is false if allocations refer to the handle, but there is no handle resource.
+	Exists bool `json:"exists"`
+
+	// Deleted is true if the handle resource is marked as being deleted.
+	Deleted bool `json:"deleted,omitempty"`
+
+	// The number of addresses the handle resource records in each block, keyed by block
+	// CIDR, and the total over all blocks. This is the reference count of the handle.
+	Blocks map[string]int `json:"blocks,omitempty"`
+	NumIPs int            `json:"numIPs"`
+
+	// The allocations in the IPAM blocks that refer to the handle.
+	Allocations []*Allocation `json:"allocations"`
+}
+
+// Handle lists or shows the IPAM handles.
+func Handle(args []string) error {
+	doc := constants.DatastoreIntro + `Usage:
+  <BINARY_NAME> ipam handle list [--output=<OUTPUT>] [--config=<CONFIG>]
+  <BINARY_NAME> ipam handle show <HANDLE> [--output=<OUTPUT>] [--config=<CONFIG>]
+
+Options:
+  -h --help                Show this screen.
+  -o --output=<OUTPUT>     Output format.  One of: text, json.
+                           [default: text]
+  -c --config=<CONFIG>     Path to the file containing connection configuration in
+                           YAML or JSON format.
+                           [default: ` + constants.DefaultConfigPath + `]
+
+Description:
+  The ipam handle commands show IPAM from the point of view of the handles.  A
+  handle identifies the owner of a set of allocations, for example the CNI
+  plugin uses a handle for each pod network interface.
+
+  The list command prints every handle with its reference count, which is the
+  number of addresses the handle resource records, and the number of
+  allocations in the IPAM blocks that refer to it.  The show command prints the
+  blocks recorded by a single handle and each allocation that refers to it.
+
+  A reference count that does not match the number of allocations indicates
+  that an operation to assign or release addresses did not complete.  Handles
+  that are referred to by allocations but have no handle resource are listed
+  as missing.
+`
+	// Replace all instances of BINARY_NAME with the name of the binary.
+	name, _ := util.NameAndDescription()
+	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+
+	parsedArgs, err := docopt.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if len(parsedArgs) == 0 {
+		return nil
+	}
+	output := parsedArgs["--output"].(string)
+	if output != "text" && output != "json" {
+		return fmt.Errorf("Unrecognized output format '%s', expected one of: text, json", output)
+	}
+	ctx := context.Background()
+
+	// Create a new backend client from env vars.
+	cf := parsedArgs["--config"].(string)
+	client, err := clientmgr.NewClient(cf)
+	if err != nil {
+		return err
+	}
+
+	// Get the backend client.
+	type accessor interface {
+		Backend() bapi.Client
+	}
+	bc := client.(accessor).Backend()
+
+	if parsedArgs["show"].(bool) {
+		return showHandle(ctx, client, bc, parsedArgs["<HANDLE>"].(string), output)
+	}
+	return listHandles(ctx, client, bc, output)
+}
+
+// listHandles prints every handle, including the handles that allocations refer to but
+// that have no handle resource.
+func listHandles(ctx context.Context, client clientv3.Interface, bc bapi.Client, output string) error {
+	allocations, err := handleAllocations(ctx, client)
+	if err != nil {
+		return err
+	}
+	handles, err := bc.List(ctx, model.IPAMHandleListOptions{}, "")
+	if err != nil {
+		return fmt.Errorf("Failed to list IPAM handles: %v", err)
+	}
+
+	details := map[string]*HandleDetail{}
+	for _, kvp := range handles.KVPairs {
+		id := kvp.Key.(model.IPAMHandleKey).HandleID
+		details[id] = newHandleDetail(id, kvp.Value.(*model.IPAMHandle), allocations[id])
+	}
+	for id, allocs := range allocations {
+		if _, ok := details[id]; !ok {
+			details[id] = newHandleDetail(id, nil, allocs)
+		}
+	}
+
+	var ids []string
+	for id := range details {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	list := []*HandleDetail{}
+	for _, id := range ids {
+		list = append(list, details[id])
+	}
+
+	if output == "json" {
+		return printJSON(list)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"HANDLE", "IPS", "ALLOCATIONS", "BLOCKS"})
+	for _, d := range list {
+		ips := strconv.Itoa(d.NumIPs)
+		if !d.Exists {
+			ips = "<missing>"
+		}
+		table.Append([]string{d.HandleID, ips, strconv.Itoa(len(d.Allocations)), strings.Join(sortedBlocks(d), ",")})
+	}
+	table.Render()
+	return nil
+}
+
+// showHandle prints the blocks recorded by the handle and the allocations that refer to it.
+func showHandle(ctx context.Context, client clientv3.Interface, bc bapi.Client, id, output string) error {
+	allocations, err := handleAllocations(ctx, client)
+	if err != nil {
+		return err
+	}
+	var handle *model.IPAMHandle
+	kvp, err := bc.Get(ctx, model.IPAMHandleKey{HandleID: id}, "")
+	if err == nil {
+		handle = kvp.Value.(*model.IPAMHandle)
+	} else if _, ok := err.(cerrors.ErrorResourceDoesNotExist); !ok {
+		return err
+	} else if len(allocations[id]) == 0 {
+		return fmt.Errorf("Handle %s does not exist", id)
+	}
+	d := newHandleDetail(id, handle, allocations[id])
+
+	if output == "json" {
+		return printJSON(d)
+	}
+	if d.Exists {
+		fmt.Printf("Handle %s records %d IPs\n", d.HandleID, d.NumIPs)
+	} else {
+		fmt.Printf("Handle %s does not exist, but is referred to by allocations\n", d.HandleID)
+	}
+	for _, cidr := range sortedBlocks(d) {
+		fmt.Printf("  %s: %d IPs\n", cidr, d.Blocks[cidr])
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"IP", "BLOCK", "NODE", "TYPE", "POD"})
+	for _, a := range d.Allocations {
+		pod := ""
+		if a.Pod != "" {
+			pod = a.Namespace + "/" + a.Pod
+		}
+		table.Append([]string{a.IP, a.Block.CIDR.String(), a.Node, a.Type, pod})
+	}
+	table.Render()
+	return nil
+}
+
+// handleAllocations loads the IPAM state and returns the allocations that refer to each
+// handle, keyed by handle ID. The allocations are loaded in the same way as for "ipam
+// check". Allocations whose attributes are missing have no handle, and are skipped.
+func handleAllocations(ctx context.Context, client clientv3.Interface) (map[string][]*Allocation, error) {
+	// Include the reserved IPs, so that they are recorded as allocations rather than as
+	// in use by Windows.
+	checker, _, err := loadIPAMStateQuietly(ctx, client, IPAMCheckerOptions{IncludeReserved: true})
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := map[string][]*Allocation{}
+	for _, allocs := range checker.allocations {
+		for _, a := range allocs {
+			id := a.Handle
+			if a.WindowsReserved {
+				id = ipam.WindowsReservedHandle
+			}
+			if id != "" {
+				allocations[id] = append(allocations[id], a)
+			}
+		}
+	}
+	for _, allocs := range allocations {
+		sortAllocationsByIP(allocs)
+	}
+	return allocations, nil
+}
+
+// sortAllocationsByIP sorts the allocations in numerical order of their IPs, so that
+// 10.0.0.2 comes before 10.0.0.10.
+func sortAllocationsByIP(allocs []*Allocation) {
+	sort.Slice(allocs, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(allocs[i].IP).To16(), net.ParseIP(allocs[j].IP).To16()) < 0
+	})
+}
+
+// newHandleDetail returns the detail of the handle. The handle is nil if there is no
+// handle resource.
+func newHandleDetail(id string, handle *model.IPAMHandle, allocs []*Allocation) *HandleDetail {
+	d := &HandleDetail{HandleID: id, Allocations: allocs}
+	if d.Allocations == nil {
+		d.Allocations = []*Allocation{}
+	}
+	if handle != nil {
+		d.Exists = true
+		d.Deleted = handle.Deleted
+		d.Blocks = handle.Block
+		for _, n := range handle.Block {
+			d.NumIPs += n
+		}
+	}
+	return d
+}
+
+// sortedBlocks returns the CIDRs of the blocks recorded by the handle, in order.
+func sortedBlocks(d *HandleDetail) []string {
+	var cidrs []string
+	for cidr := range d.Blocks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
+
+func printJSON(v interface{}) error {
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bytes))
+	return nil
+}
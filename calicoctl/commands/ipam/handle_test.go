@@ -0,0 +1,32 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Testing the allocations of a handle", func() {
+	It("should sort the allocations in numerical order of their IPs", func() {
+		allocs := []*Allocation{{IP: "10.0.0.10"}, {IP: "fd00::2"}, {IP: "10.0.0.2"}, {IP: "9.0.0.1"}}
+		sortAllocationsByIP(allocs)
+		var ips []string
+		for _, a := range allocs {
+			ips = append(ips, a.IP)
+		}
+		Expect(ips).To(Equal([]string{"9.0.0.1", "10.0.0.2", "10.0.0.10", "fd00::2"}))
+	})
+})
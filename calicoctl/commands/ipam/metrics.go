@@ -0,0 +1,141 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
+)
+
+// The metrics written by writeMetrics. The names and help text must not change, since
+// dashboards and alerts depend on them.
+const (
+	metricBlocks       = "calico_ipam_blocks"
+	metricAllocations  = "calico_ipam_allocations"
+	metricInUse        = "calico_ipam_in_use"
+	metricLeaked       = "calico_ipam_leaked"
+	metricNonPool      = "calico_ipam_non_pool"
+	metricNotAllocated = "calico_ipam_not_allocated"
+	metricProblems     = "calico_ipam_problems"
+
+	metricPoolSize        = "calico_ipam_pool_size"
+	metricPoolAllocations = "calico_ipam_pool_allocations"
+	metricPoolInUse       = "calico_ipam_pool_in_use"
+)
+
+var metricHelp = map[string]string{
+	metricBlocks:       "Number of IPAM blocks.",
+	metricAllocations:  "Number of IPs allocated in the IPAM blocks.",
+	metricInUse:        "Number of IPs in use by workloads and nodes.",
+	metricLeaked:       "Number of IPs that are allocated but not in use.",
+	metricNonPool:      "Number of IPs in use that are not in an active IP pool.",
+	metricNotAllocated: "Number of IPs in use in an IP pool that are not allocated.",
+	metricProblems:     "Number of problems found by the IPAM check.",
+
+	metricPoolSize:        "Number of addressable IPs in the active IP pool.",
+	metricPoolAllocations: "Number of IPs allocated in the active IP pool.",
+	metricPoolInUse:       "Number of IPs in use in the active IP pool.",
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricsWriter writes gauges in the Prometheus text exposition format. Every gauge is
+// labelled with the common labels.
+type metricsWriter struct {
+	buf    bytes.Buffer
+	labels [][2]string
+}
+
+// gauges writes the help and type of the metric, and a sample for each of the sets of
+// labels and values.
+func (w *metricsWriter) gauges(name string, labels [][][2]string, values []float64) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n", name, metricHelp[name])
+	fmt.Fprintf(&w.buf, "# TYPE %s gauge\n", name)
+	for i, v := range values {
+		var kvs []string
+		for _, l := range append(append([][2]string{}, w.labels...), labels[i]...) {
+			kvs = append(kvs, fmt.Sprintf(`%s="%s"`, l[0], labelValueEscaper.Replace(l[1])))
+		}
+		w.buf.WriteString(name)
+		if len(kvs) > 0 {
+			fmt.Fprintf(&w.buf, "{%s}", strings.Join(kvs, ","))
+		}
+		fmt.Fprintf(&w.buf, " %s\n", strconv.FormatFloat(v, 'g', -1, 64))
+	}
+}
+
+// gauge writes a metric with a single sample.
+func (w *metricsWriter) gauge(name string, value float64) {
+	w.gauges(name, [][][2]string{nil}, []float64{value})
+}
+
+// metrics returns the summary of the check, and the utilization of each of the active IP
+// pools, in the Prometheus text exposition format. The samples are labelled with the
+// cluster label, and with the node if the check was limited to a node. The utilization of
+// the pools is not included when the check was limited to a node, since it is
+// cluster-wide.
+func (c *IPAMChecker) metrics(pools []*cnet.IPNet) []byte {
+	w := &metricsWriter{}
+	if label := common.ClusterLabel(c.clusterLabel, c.clusterGUID); label != "" {
+		w.labels = append(w.labels, [2]string{"cluster", label})
+	}
+	if c.node != "" {
+		w.labels = append(w.labels, [2]string{"node", c.node})
+	}
+
+	w.gauge(metricBlocks, float64(c.summary.NumBlocks))
+	w.gauge(metricAllocations, float64(c.summary.NumAllocations))
+	w.gauge(metricInUse, float64(c.summary.NumInUseIPs))
+	w.gauge(metricLeaked, float64(c.summary.NumLeakedIPs))
+	w.gauge(metricNonPool, float64(c.summary.NumNonCalicoIPs))
+	w.gauge(metricNotAllocated, float64(c.summary.NumNotAllocatedIPs))
+	w.gauge(metricProblems, float64(c.summary.NumProblems))
+	if c.node != "" || len(pools) == 0 {
+		return w.buf.Bytes()
+	}
+
+	sorted := append([]*cnet.IPNet{}, pools...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+	var labels [][][2]string
+	var size, allocated, inUse []float64
+	for _, p := range sorted {
+		pc := c.poolCapacity([]*cnet.IPNet{p})[0]
+		labels = append(labels, [][2]string{{"pool", p.String()}})
+		size = append(size, pc.TotalIPs)
+		allocated = append(allocated, float64(pc.AllocatedIPs))
+		inUse = append(inUse, float64(pc.InUseIPs))
+	}
+	w.gauges(metricPoolSize, labels, size)
+	w.gauges(metricPoolAllocations, labels, allocated)
+	w.gauges(metricPoolInUse, labels, inUse)
+	return w.buf.Bytes()
+}
+
+// writeMetrics writes the metrics to the metrics file. The file is replaced atomically,
+// so that a textfile collector never reads a partially written file.
+func (c *IPAMChecker) writeMetrics(pools []*cnet.IPNet) error {
+	if err := writeFileAtomic(c.metricsFile, c.metrics(pools), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	fmt.Printf("Wrote metrics to %s\n", c.metricsFile)
+	return nil
+}
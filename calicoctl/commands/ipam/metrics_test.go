@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+var _ = Describe("Testing the IPAM check metrics", func() {
+	pool := func(cidr string) *cnet.IPNet {
+		n := cnet.MustParseCIDR(cidr)
+		return &n
+	}
+	newChecker := func(node, metricsFile string) *IPAMChecker {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{
+			Node:         node,
+			ClusterLabel: "prod",
+			MetricsFile:  metricsFile,
+		})
+		c.summary.NumBlocks = 2
+		c.summary.NumAllocations = 3
+		c.summary.NumInUseIPs = 2
+		c.summary.NumLeakedIPs = 1
+		c.summary.NumProblems = 1
+		c.allocations["10.0.0.1"] = nil
+		c.allocations["10.0.0.2"] = nil
+		c.allocations["10.1.0.1"] = nil
+		c.inUseIPs["10.0.0.1"] = nil
+		c.inUseIPs["10.1.0.1"] = nil
+		return c
+	}
+
+	It("should write the summary and the utilization of each pool", func() {
+		m := string(newChecker("", "").metrics([]*cnet.IPNet{pool("10.1.0.0/24"), pool("10.0.0.0/30")}))
+		Expect(m).To(ContainSubstring("# HELP calico_ipam_allocations Number of IPs allocated in the IPAM blocks.\n" +
+			"# TYPE calico_ipam_allocations gauge\n" +
+			"calico_ipam_allocations{cluster=\"prod\"} 3\n"))
+		Expect(m).To(ContainSubstring("calico_ipam_leaked{cluster=\"prod\"} 1\n"))
+		Expect(m).To(ContainSubstring("calico_ipam_non_pool{cluster=\"prod\"} 0\n"))
+		Expect(m).To(ContainSubstring("calico_ipam_pool_size{cluster=\"prod\",pool=\"10.0.0.0/30\"} 4\n" +
+			"calico_ipam_pool_size{cluster=\"prod\",pool=\"10.1.0.0/24\"} 256\n"))
+		Expect(m).To(ContainSubstring("calico_ipam_pool_allocations{cluster=\"prod\",pool=\"10.0.0.0/30\"} 2\n"))
+		Expect(m).To(ContainSubstring("calico_ipam_pool_in_use{cluster=\"prod\",pool=\"10.1.0.0/24\"} 1\n"))
+	})
+
+	It("should label the metrics with the node and omit the pools when checking a node", func() {
+		m := string(newChecker("node1", "").metrics([]*cnet.IPNet{pool("10.0.0.0/30")}))
+		Expect(m).To(ContainSubstring("calico_ipam_in_use{cluster=\"prod\",node=\"node1\"} 2\n"))
+		Expect(m).NotTo(ContainSubstring("calico_ipam_pool_size"))
+	})
+
+	It("should write the metrics file", func() {
+		dir, err := ioutil.TempDir("", "ipam-metrics")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		file := filepath.Join(dir, "ipam.prom")
+		c := newChecker("", file)
+		Expect(c.writeMetrics(nil)).To(Succeed())
+		data, err := ioutil.ReadFile(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(string(c.metrics(nil))))
+	})
+})
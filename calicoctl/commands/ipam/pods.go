@@ -0,0 +1,84 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The number of pods fetched in each page when listing the pods.
+const podListPageSize = 500
+
+// podIndex is the pods in the cluster, or on the checked node, indexed for the scans that
+// cross-check the IPAM data against the pods.
+type podIndex struct {
+	// The sorted, normalised IPs in the status of each pod, keyed by <namespace>/<name>.
+	ipsByName map[string][]string
+
+	// The pods with each IP, keyed by normalised IP. More than one pod may have the same
+	// IP, for example host-networked pods on the same node.
+	byIP map[string][]*corev1.Pod
+}
+
+// podIndex returns the index of the pods, listing the pods the first time it is called.
+// The pods are listed a page at a time, and only the pods on the node are listed if the
+// check is limited to a node. The index is cached, so every scan uses the same pods.
+func (c *IPAMChecker) podIndex(ctx context.Context) (*podIndex, error) {
+	if c.pods != nil {
+		return c.pods, nil
+	}
+
+	opts := metav1.ListOptions{Limit: podListPageSize}
+	if c.node != "" {
+		opts.FieldSelector = "spec.nodeName=" + c.node
+	}
+	idx := &podIndex{
+		ipsByName: map[string][]string{},
+		byIP:      map[string][]*corev1.Pod{},
+	}
+	for {
+		pods, err := c.k8sClient.CoreV1().Pods("").List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %w", err)
+		}
+		for i := range pods.Items {
+			p := &pods.Items[i]
+			key := p.Namespace + "/" + p.Name
+			ips := []string{}
+			for _, a := range p.Status.PodIPs {
+				ip, err := normaliseIP(a.IP)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse IP (%s) of pod %s: %w", a.IP, key, err)
+				}
+				ips = append(ips, ip)
+				idx.byIP[ip] = append(idx.byIP[ip], p)
+			}
+			sort.Strings(ips)
+			idx.ipsByName[key] = ips
+		}
+		if pods.Continue == "" {
+			break
+		}
+		opts.Continue = pods.Continue
+	}
+
+	c.pods = idx
+	return idx, nil
+}
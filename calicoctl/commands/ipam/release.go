@@ -15,11 +15,22 @@
 package ipam
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
 	"github.com/projectcalico/libcalico-go/lib/net"
 	"github.com/projectcalico/libcalico-go/lib/options"
 	"k8s.io/apimachinery/pkg/util/json"
@@ -28,21 +39,66 @@ import (
 
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/argutils"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
 	client "github.com/projectcalico/libcalico-go/lib/clientv3"
 )
 
+// The prefixes of the handles used by calico/node when allocating node tunnel addresses.
+var tunnelHandlePrefixes = []string{"ipip-tunnel-addr-", "vxlan-tunnel-addr-", "wireguard-tunnel-addr-"}
+
+// The number of addresses released in each IPAM request when releasing from reports.
+const releaseBatchSize = 100
+
+// The time to wait before retrying a release that failed.
+var releaseRetryInterval = 1 * time.Second
+
 // IPAM takes keyword with an IP address then calls the subcommands.
 func Release(args []string, version string) error {
 	doc := constants.DatastoreIntro + `Usage:
-  <BINARY_NAME> ipam release [--ip=<IP>] [--from-report=<REPORT>] [--config=<CONFIG>] [--force]
+  <BINARY_NAME> ipam release [--ip=<IP>] [--from-report=<REPORT>] [--from-report-dir=<DIR>] [--config=<CONFIG>] [--force]
+                             [--recheck] [--cluster-label=<NAME>] [--max-release=<N>] [--dry-run]
+                             [--purge-empty-blocks] [--retries=<N>] [--timeout-per-ip=<DURATION>]
+                             [--deadline=<DURATION>] [--yes] [--accounting-file=<FILE>]
 
 Options:
   -h --help                   Show this screen.
      --ip=<IP>                IP address to release.
-     --from-report=<REPORT>   Release all leaked addresses from the report.
-     --force                  Force release of leaked addresses.
+     --from-report=<REPORT>   Release all leaked addresses from the report.  If
+                              set to "-" the report is read from stdin.
+     --from-report-dir=<DIR>  Release all leaked addresses from every report
+                              in the directory.  Reports that do not match the
+                              cluster are skipped.
+     --force                  Force release of leaked addresses, including node
+                              tunnel addresses.
+     --recheck                When releasing from reports, check which addresses
+                              are in use by nodes and workloads before releasing,
+                              and skip any that are now in use.
+     --cluster-label=<NAME>   Label identifying the cluster, used to prefix the
+                              summary lines.
+     --max-release=<N>        When releasing from reports, release at most N
+                              addresses, and report how many remain.
+     --dry-run                Print the addresses that would be released,
+                              without releasing them.
+     --purge-empty-blocks     When releasing from reports, release the affinity
+                              of each block left empty by the release, so that
+                              the block returns to the pool.
+     --retries=<N>            Number of times to retry a release that fails,
+                              for example due to a transient API server error.
+                              [default: 3]
+     --timeout-per-ip=<DURATION>
+                              Time allowed to release each address, for example
+                              100ms.  Each attempt to release a batch of
+                              addresses times out after this time multiplied
+                              by the number of addresses in the batch.
+     --deadline=<DURATION>    Maximum time to spend releasing addresses, for
+                              example 10m.
+     --yes                    When releasing from reports, release the
+                              addresses without asking for confirmation.
+     --accounting-file=<FILE>
+                              When releasing from reports, write the outcome of
+                              the release to the file in JSON format.
   -c --config=<CONFIG>        Path to the file containing connection configuration in
                               YAML or JSON format.
                               [default: ` + constants.DefaultConfigPath + `]
@@ -55,6 +111,81 @@ Description:
   Note that this does not remove the IP from any existing endpoints that may be
   using it, so only use this command to clean up addresses from endpoints that
   were not cleanly removed from Calico.
+
+  A report read from stdin with --from-report=- is validated in the same way as
+  a report file, so a check and release can be chained in a shell pipeline
+  without a temporary file.  This can be combined with --dry-run to preview the
+  release, for example:
+
+    cat report.json | <BINARY_NAME> ipam release --from-report=- --dry-run
+
+  When releasing from a directory of reports, each *.json file is loaded and
+  validated against the cluster in the same way as a single report.  Reports
+  that fail validation are skipped with a warning, and the leaked addresses
+  from the remaining reports are released once each.
+
+  Leaked addresses that are allocated to node tunnel devices (IPIP, VXLAN or
+  WireGuard) are not released from a report unless the --force option is set,
+  since releasing the tunnel address of a node that still exists breaks its
+  networking.
+
+  Before releasing addresses from reports, a summary of the report entries is
+  printed: the total number, the number kept because they are in use, the
+  number kept for another reason, such as being reserved or a node tunnel
+  address, and the number to release, followed by the numbers released and
+  kept in each IP pool and on each node.  The command then asks for
+  confirmation, unless --yes or --force is set.  A report read from stdin
+  leaves no input for the confirmation, so --yes must be set to release from
+  it.  With --recheck, addresses that are now in use are skipped after the
+  confirmation.
+
+  When releasing addresses in many clusters and aggregating the output, set
+  --cluster-label so that the summary lines can be attributed to the right
+  cluster.
+
+  To clean up a production cluster gradually, use --max-release to release at
+  most N addresses in each run.  The addresses are released in a fixed order,
+  and addresses that are no longer allocated do not count towards the limit,
+  so each run releases the next N addresses from the same report.  Combine it
+  with --dry-run to preview the addresses that the next run would release.
+  The preview includes any addresses that have already been released.
+
+  Releasing leaked addresses can leave blocks with no allocations that are
+  still affine to a node, fragmenting the pool.  With --purge-empty-blocks, the
+  affinity of each block that held an address released by this run, and that
+  is now empty, is released so that the block returns to the pool.  Blocks
+  that were already empty are not touched.  With --dry-run, the blocks that
+  would be left empty are printed instead.
+
+  Addresses from reports are released in batches.  If the command receives
+  SIGINT or SIGTERM, it stops once the current batch has been released, reports
+  how many addresses were released, and exits with code 130.  Re-running the
+  command releases the remaining addresses.  A second SIGINT or SIGTERM stops
+  the command immediately, also with code 130, without waiting for the batch.
+
+  With --accounting-file, the outcome of a release from reports is written to
+  the file, even if the release fails: the number of leaked addresses in the
+  reports, and the addresses that were released, skipped because they are now
+  in use, no longer allocated, or not released due to an error, an interrupt,
+  the deadline or --max-release, along with any errors.  The file is not
+  written for a dry run.  Pass it to "ipam check --compare-snapshot" to confirm
+  that the number of leaked addresses dropped by the number released.
+
+  A release that fails, for example due to a transient API server error, is
+  retried up to --retries times.  A failed release may already have released
+  some of the addresses, so each retry re-attempts the whole batch, and only
+  the addresses that are still allocated are released again.  Addresses that
+  the failed attempt released are then reported as no longer allocated.  If the
+  retries are exhausted, the addresses that may not have been released are
+  listed, and re-running the command releases them.
+
+  By default a release is not bounded in time, so a stuck API server can block
+  a large cleanup indefinitely.  With --timeout-per-ip, an attempt to release a
+  batch that takes too long fails and is retried like any other failed
+  release.  With --deadline, the whole command stops once the deadline passes,
+  without retrying.  In either case, the number of addresses released before
+  the timeout is reported, along with the addresses that may not have been
+  released, and re-running the command releases the remaining addresses.
 `
 	// Replace all instances of BINARY_NAME with the name of the binary.
 	name, _ := util.NameAndDescription()
@@ -87,7 +218,50 @@ Description:
 		return err
 	}
 
-	ipamClient := client.IPAM()
+	label := argutils.ArgStringOrBlank(parsedArgs, "--cluster-label")
+	dryRun := argutils.ArgBoolOrFalse(parsedArgs, "--dry-run")
+	purge := argutils.ArgBoolOrFalse(parsedArgs, "--purge-empty-blocks")
+	maxRelease := 0
+	if arg := parsedArgs["--max-release"]; arg != nil {
+		maxRelease, err = strconv.Atoi(arg.(string))
+		if err != nil || maxRelease <= 0 {
+			return fmt.Errorf("Invalid max release '%s', expected a positive integer", arg)
+		}
+	}
+
+	retries, err := strconv.Atoi(parsedArgs["--retries"].(string))
+	if err != nil || retries < 0 {
+		return fmt.Errorf("Invalid retries '%s', expected a non-negative integer", parsedArgs["--retries"])
+	}
+
+	var timeoutPerIP time.Duration
+	if arg := parsedArgs["--timeout-per-ip"]; arg != nil {
+		timeoutPerIP, err = time.ParseDuration(arg.(string))
+		if err != nil || timeoutPerIP <= 0 {
+			return fmt.Errorf("Invalid timeout per IP '%s', expected a positive duration such as 100ms", arg)
+		}
+	}
+
+	if arg := parsedArgs["--deadline"]; arg != nil {
+		deadline, err := time.ParseDuration(arg.(string))
+		if err != nil || deadline <= 0 {
+			return fmt.Errorf("Invalid deadline '%s', expected a positive duration such as 10m", arg)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+
+	// Record the outcome of a release from reports if requested.
+	var acct *ReleaseAccounting
+	accountingFile := argutils.ArgStringOrBlank(parsedArgs, "--accounting-file")
+	if accountingFile != "" && !dryRun {
+		acct = &ReleaseAccounting{Version: version, ClusterLabel: label}
+	}
+
+	// Stop cleanly between batches of releases on SIGINT or SIGTERM.
+	interrupt, stop := common.NotifyInterrupt()
+	defer stop()
 
 	if report := parsedArgs["--from-report"]; report != nil {
 		reportFile := parsedArgs["--from-report"].(string)
@@ -95,11 +269,29 @@ Description:
 		if parsedArgs["--force"] != nil {
 			force = parsedArgs["--force"].(bool)
 		}
-		err = releaseFromReport(ctx, client, force, reportFile, version)
-		if err != nil {
+		recheck := argutils.ArgBoolOrFalse(parsedArgs, "--recheck")
+		yes := argutils.ArgBoolOrFalse(parsedArgs, "--yes")
+		err = releaseFromReport(ctx, interrupt, client, force, recheck, yes, reportFile, version, label, maxRelease, retries, timeoutPerIP, dryRun, purge, acct)
+		if err = writeAccounting(acct, accountingFile, err); err != nil {
 			return err
 		}
-		fmt.Println("You may now unlock the data store.")
+		if !dryRun {
+			fmt.Println("You may now unlock the data store.")
+		}
+		return nil
+	}
+
+	if dir := parsedArgs["--from-report-dir"]; dir != nil {
+		force := argutils.ArgBoolOrFalse(parsedArgs, "--force")
+		recheck := argutils.ArgBoolOrFalse(parsedArgs, "--recheck")
+		yes := argutils.ArgBoolOrFalse(parsedArgs, "--yes")
+		err = releaseFromReportDir(ctx, interrupt, client, force, recheck, yes, dir.(string), version, label, maxRelease, retries, timeoutPerIP, dryRun, purge, acct)
+		if err = writeAccounting(acct, accountingFile, err); err != nil {
+			return err
+		}
+		if !dryRun {
+			fmt.Println("You may now unlock the data store.")
+		}
 		return nil
 	}
 
@@ -108,9 +300,14 @@ Description:
 		ip := argutils.ValidateIP(passedIP)
 		ips := []net.IP{ip}
 
+		if dryRun {
+			fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Dry run: would release IP address %s; no changes were made", ip)))
+			return nil
+		}
+
 		// Call ReleaseIPs releases the IP and returns an empty slice as unallocatedIPs if
 		// release was successful else it returns back the slice with the IP passed in.
-		unallocatedIPs, err := ipamClient.ReleaseIPs(ctx, ips)
+		unallocatedIPs, err := releaseWithRetries(ctx, client, ips, retries, timeoutPerIP)
 		if err != nil {
 			return fmt.Errorf("Error: %v", err)
 		}
@@ -122,29 +319,145 @@ Description:
 		}
 
 		// If unallocatedIPs slice is empty then IP was released Successfully.
-		fmt.Printf("Successfully released IP address %s\n", ip)
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Successfully released IP address %s", ip)))
 	}
 
 	return nil
 }
 
-func releaseFromReport(ctx context.Context, c client.Interface, force bool, reportFile string, version string) error {
+func releaseFromReport(ctx, interrupt context.Context, c client.Interface, force, recheck, yes bool, reportFile string, version, label string, maxRelease, retries int, timeoutPerIP time.Duration, dryRun, purge bool, acct *ReleaseAccounting) error {
 	// Load the report into memory.
-	r := Report{}
-	bytes, err := ioutil.ReadFile(reportFile)
+	r, err := loadReport(reportFile)
 	if err != nil {
 		return err
 	}
-	err = json.Unmarshal(bytes, &r)
+
+	// Make sure the metadata from the report matches the cluster.
+	clusterInfo, err := c.ClusterInformation().Get(ctx, "default", options.GetOptions{})
 	if err != nil {
 		return err
 	}
+	if err = validateReport(clusterInfo, r, force, version); err != nil {
+		return err
+	}
+	if err = checkDatastoreLocked(clusterInfo, force); err != nil {
+		return err
+	}
+	if acct != nil {
+		acct.ClusterGUID = clusterInfo.Spec.ClusterGUID
+		acct.Summary.NumLeakedIPs = r.Summary.NumLeakedIPs
+	}
+
+	ipsToRelease := leakedIPs(r, force)
+	err = confirmReleaseFromReports(ctx, c, os.Stdin, reportEntries(r), ipsToRelease, label, yes || force, dryRun, reportFile == "-")
+	if err != nil {
+		return err
+	}
+	return releaseIPs(ctx, interrupt, c, ipsToRelease, recheck, label, maxRelease, retries, timeoutPerIP, dryRun, purge, acct)
+}
+
+func releaseFromReportDir(ctx, interrupt context.Context, c client.Interface, force, recheck, yes bool, dir string, version, label string, maxRelease, retries int, timeoutPerIP time.Duration, dryRun, purge bool, acct *ReleaseAccounting) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("No reports found in directory %s", dir)
+	}
 
-	// Make sure the metadata from the report matches the cluster.
 	clusterInfo, err := c.ClusterInformation().Get(ctx, "default", options.GetOptions{})
 	if err != nil {
 		return err
 	}
+	if err = checkDatastoreLocked(clusterInfo, force); err != nil {
+		return err
+	}
+
+	// Load and validate each report, collecting the union of the leaked addresses.
+	var ipsToRelease []net.IP
+	var entries []Allocation
+	seen := map[string]bool{}
+	seenEntries := map[string]bool{}
+	leaked := map[string]bool{}
+	numValid := 0
+	for _, f := range files {
+		r, err := loadReport(f)
+		if err == nil {
+			err = validateReport(clusterInfo, r, force, version)
+		}
+		if err != nil {
+			fmt.Printf("WARNING: Skipping report %s: %v\n", f, err)
+			continue
+		}
+		numValid++
+		for _, a := range reportEntries(r) {
+			if key := a.IP + "/" + a.Handle; !seenEntries[key] {
+				seenEntries[key] = true
+				entries = append(entries, a)
+			}
+			if !a.InUse && !a.WindowsReserved && !a.Reserved && !a.Ignored {
+				leaked[ipKey(a.IP)] = true
+			}
+		}
+		for _, ip := range leakedIPs(r, force) {
+			if !seen[ip.String()] {
+				seen[ip.String()] = true
+				ipsToRelease = append(ipsToRelease, ip)
+			}
+		}
+	}
+	fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Loaded %d of %d reports; skipped %d", numValid, len(files), len(files)-numValid)))
+	if numValid == 0 {
+		return fmt.Errorf("None of the reports in directory %s match the cluster. Refusing to release.", dir)
+	}
+	if acct != nil {
+		acct.ClusterGUID = clusterInfo.Spec.ClusterGUID
+		acct.Summary.NumLeakedIPs = len(leaked)
+	}
+
+	if err := confirmReleaseFromReports(ctx, c, os.Stdin, entries, ipsToRelease, label, yes || force, dryRun, false); err != nil {
+		return err
+	}
+	return releaseIPs(ctx, interrupt, c, ipsToRelease, recheck, label, maxRelease, retries, timeoutPerIP, dryRun, purge, acct)
+}
+
+// loadReport reads the report from the file, or from stdin if the file is "-".
+func loadReport(reportFile string) (*Report, error) {
+	r := Report{}
+	var bytes []byte
+	var err error
+	if reportFile == "-" {
+		bytes, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		bytes, err = ioutil.ReadFile(reportFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(bytes, &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// validateReport checks that the report can be used to release addresses in the cluster.
+func validateReport(clusterInfo *apiv3.ClusterInformation, r *Report, force bool, version string) error {
+	// A summary-only report does not contain the allocations needed to release anything.
+	// An incremental report only contains the allocations of the newly leaked IPs.
+	numLeaked := r.Summary.NumLeakedIPs
+	if r.BaselineRevision != "" {
+		numLeaked = r.Summary.NumNewLeakedIPs
+	}
+	if r.Allocations == nil && numLeaked > 0 {
+		return fmt.Errorf("The provided report only contains a summary. Generate a report without --summary-only and try again.")
+	}
+	if len(r.Incomplete) > 0 {
+		// This check cannot be overridden using the --force option, since IPs reported as
+		// leaked by an incomplete check may be in use.
+		return fmt.Errorf("The provided report is from an incomplete check, since the %s could not be loaded. Refusing to release.",
+			strings.Join(r.Incomplete, ", "))
+	}
 	if clusterInfo.Spec.ClusterGUID != r.ClusterGUID {
 		// This check cannot be overridden using the --force option, because it is critical.
 		return fmt.Errorf("Cluster does not match the provided report: mismatched cluster GUID. Refusing to release.")
@@ -152,6 +465,18 @@ func releaseFromReport(ctx context.Context, c client.Interface, force bool, repo
 	if clusterInfo.ResourceVersion != r.ClusterInfoRevision {
 		return fmt.Errorf("The provided report is stale, please generate a new report while the data store is locked and try again.")
 	}
+	if version != r.Version {
+		if !force {
+			return fmt.Errorf("The provided report was produced using a different version (%s) of calicoctl. Refusing to release.", r.Version)
+		} else {
+			fmt.Println("WARNING: Report was produced using a different version of calicoctl. Ignoring due to --force option")
+		}
+	}
+	return nil
+}
+
+// checkDatastoreLocked checks that the data store is locked, unless forced.
+func checkDatastoreLocked(clusterInfo *apiv3.ClusterInformation, force bool) error {
 	if clusterInfo.Spec.DatastoreReady == nil || *clusterInfo.Spec.DatastoreReady {
 		if !force {
 			return fmt.Errorf("Data store is not locked. Either lock the data store, or re-run with --force.")
@@ -159,39 +484,325 @@ func releaseFromReport(ctx context.Context, c client.Interface, force bool, repo
 			fmt.Println("WARNING: Data store is not locked. Ignoring due to --force option")
 		}
 	}
-	if version != r.Version {
-		if !force {
-			return fmt.Errorf("The provided report was produced using a different version (%s) of calicoctl. Refusing to release.", r.Version)
-		} else {
-			fmt.Println("WARNING: Report was produced using a different version of calicoctl. Ignoring due to --force option")
+	return nil
+}
+
+// leakedIPs returns the addresses in the report that need to be released. Node tunnel
+// addresses are skipped with a warning, unless forced.
+func leakedIPs(r *Report, force bool) []net.IP {
+	ips := []net.IP{}
+	for _, allocations := range r.Allocations {
+		for _, a := range allocations {
+			if a.InUse || a.WindowsReserved || a.Reserved || a.Ignored {
+				continue
+			}
+			if isTunnelAddress(a) {
+				if !force {
+					fmt.Printf("WARNING: Not releasing %s, which is a tunnel address of node %s. Re-run with --force to release it.\n", a.IP, a.Node)
+					continue
+				}
+				fmt.Printf("WARNING: Releasing %s, which is a tunnel address of node %s, due to --force option\n", a.IP, a.Node)
+			}
+			ips = append(ips, argutils.ValidateIP(a.IP))
 		}
 	}
+	return ips
+}
 
-	// For each address that needs to be released, do so.
-	ipsToRelease := []net.IP{}
+// reportEntries returns the allocations in the report.
+func reportEntries(r *Report) []Allocation {
+	var entries []Allocation
 	for _, allocations := range r.Allocations {
 		for _, a := range allocations {
-			if !a.InUse {
-				ipsToRelease = append(ipsToRelease, argutils.ValidateIP(a.IP))
+			entries = append(entries, *a)
+		}
+	}
+	return entries
+}
+
+// isTunnelAddress returns true if the allocation is for a node tunnel device, using the
+// allocation type or, for allocations made before the type was recorded, the handle.
+func isTunnelAddress(a *Allocation) bool {
+	switch a.Type {
+	case model.IPAMBlockAttributeTypeIPIP, model.IPAMBlockAttributeTypeVXLAN, model.IPAMBlockAttributeTypeWireguard:
+		return true
+	}
+	for _, prefix := range tunnelHandlePrefixes {
+		if strings.HasPrefix(a.Handle, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseIPs releases the addresses. If recheck is set, any addresses that are now in use
+// by a node or workload are skipped. The summary lines are prefixed with the cluster label.
+// The addresses are released in batches, stopping between batches if the interrupt
+// context is cancelled. If maxRelease is non-zero, at most that many addresses are
+// released. Each batch is retried up to retries times if the release fails, and each
+// attempt times out after timeoutPerIP for each address in the batch, if set. If the
+// context's deadline passes, the release stops and reports how many addresses were
+// released. If dryRun is set, the addresses that would be released are printed instead.
+// If purge is set, the affinity of each block left empty by the release is released.
+// The outcome for each address is recorded in acct, if set.
+func releaseIPs(ctx, interrupt context.Context, c client.Interface, ipsToRelease []net.IP, recheck bool, label string, maxRelease, retries int, timeoutPerIP time.Duration, dryRun, purge bool, acct *ReleaseAccounting) error {
+	if recheck {
+		inUse, err := loadInUseIPs(ctx, c)
+		if err != nil {
+			return err
+		}
+		var notInUse, skipped []net.IP
+		for _, ip := range ipsToRelease {
+			if !inUse[ip.String()] {
+				notInUse = append(notInUse, ip)
+			} else {
+				skipped = append(skipped, ip)
 			}
 		}
+		acct.addSkippedInUse(skipped)
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Skipping %d IPs that are now in use", len(ipsToRelease)-len(notInUse))))
+		ipsToRelease = notInUse
 	}
 
 	if len(ipsToRelease) == 0 {
-		fmt.Println("No addresses need to be released.")
+		fmt.Println(common.WithClusterLabel(label, "No addresses need to be released."))
 		return nil
 	}
-	fmt.Printf("Releasing %d old IPs\n", len(ipsToRelease))
 
-	unallocated, err := c.IPAM().ReleaseIPs(ctx, ipsToRelease)
-	if err != nil {
-		return err
+	// Release the addresses in a fixed order, so that runs limited by maxRelease work
+	// through the same list.
+	sort.Slice(ipsToRelease, func(i, j int) bool {
+		return bytes.Compare(ipsToRelease[i].To16(), ipsToRelease[j].To16()) < 0
+	})
+
+	if dryRun {
+		preview := ipsToRelease
+		if maxRelease > 0 && len(preview) > maxRelease {
+			preview = preview[:maxRelease]
+		}
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Dry run: would release %d of %d old IPs; no changes were made", len(preview), len(ipsToRelease))))
+		for _, ip := range preview {
+			fmt.Printf("  %s\n", ip)
+		}
+		if purge {
+			return purgeEmptyBlocks(ctx, c, preview, label, true)
+		}
+		return nil
+	}
+
+	if maxRelease > 0 && len(ipsToRelease) > maxRelease {
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Releasing up to %d of %d old IPs", maxRelease, len(ipsToRelease))))
+	} else {
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Releasing %d old IPs", len(ipsToRelease))))
+	}
+
+	// Addresses that are no longer allocated do not count towards maxRelease, so keep
+	// releasing batches until enough addresses have been released.
+	var released, numUnallocated, processed int
+	var releasedIPs []net.IP
+	for processed < len(ipsToRelease) && (maxRelease == 0 || released < maxRelease) {
+		if err := common.CheckInterrupt(interrupt, "Release"); err != nil {
+			fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Release interrupted; released %d IPs, %d were no longer allocated, %d were not processed",
+				released, numUnallocated, len(ipsToRelease)-processed)))
+			acct.addUnreleased(ipsToRelease[processed:])
+			return err
+		}
+		if ctx.Err() != nil {
+			unreleased := ipsToRelease[processed:]
+			fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Release deadline exceeded; released %d IPs, %d were no longer allocated, %d were not released",
+				released, numUnallocated, len(unreleased))))
+			acct.addUnreleased(unreleased)
+			return fmt.Errorf("Release deadline exceeded: %v", ctx.Err())
+		}
+		batch := releaseBatchSize
+		if maxRelease > 0 && maxRelease-released < batch {
+			batch = maxRelease - released
+		}
+		end := processed + batch
+		if end > len(ipsToRelease) {
+			end = len(ipsToRelease)
+		}
+		unallocated, err := releaseWithRetries(ctx, c, ipsToRelease[processed:end], retries, timeoutPerIP)
+		if err != nil {
+			unreleased := ipsToRelease[processed:]
+			reason := "Release failed"
+			if ctx.Err() != nil {
+				reason = "Release deadline exceeded"
+			}
+			fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("%s; released %d IPs, %d were no longer allocated, %d may not have been released:",
+				reason, released, numUnallocated, len(unreleased))))
+			for _, ip := range unreleased {
+				fmt.Printf("  %s\n", ip)
+			}
+			acct.addUnreleased(unreleased)
+			return err
+		}
+		numUnallocated += len(unallocated)
+		released += end - processed - len(unallocated)
+		batchReleased := releasedFrom(ipsToRelease[processed:end], unallocated)
+		releasedIPs = append(releasedIPs, batchReleased...)
+		acct.addReleased(batchReleased)
+		acct.addNotAllocated(unallocated)
+		processed = end
 	}
-	if len(unallocated) != 0 {
-		fmt.Println("Warning: report contained addresses which are no longer allocated")
+	if numUnallocated != 0 {
+		fmt.Println(common.WithClusterLabel(label, "Warning: report contained addresses which are no longer allocated"))
 	} else {
-		fmt.Printf("Released %d IPs successfully\n", len(ipsToRelease))
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Released %d IPs successfully", released)))
+	}
+	if remaining := len(ipsToRelease) - processed; remaining > 0 {
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Reached --max-release; %d IPs remain to be released", remaining)))
+		acct.addUnreleased(ipsToRelease[processed:])
+	}
+	if purge {
+		return purgeEmptyBlocks(ctx, c, releasedIPs, label, false)
+	}
+	return nil
+}
+
+// writeAccounting records the error that stopped the release, if any, and writes the
+// accounting to the file, returning the error of the release in preference to any error
+// writing the file. It does nothing if the accounting is not set.
+func writeAccounting(acct *ReleaseAccounting, file string, releaseErr error) error {
+	if acct == nil {
+		return releaseErr
 	}
+	acct.addError(releaseErr)
+	if err := acct.write(file); err != nil {
+		if releaseErr != nil {
+			fmt.Printf("WARNING: %v\n", err)
+			return releaseErr
+		}
+		return err
+	}
+	fmt.Printf("Wrote release accounting to %s\n", file)
+	return releaseErr
+}
+
+// releaseWithRetries releases the addresses, returning the addresses that were not
+// allocated. The release is retried up to retries times if it fails. A failed release may
+// have released some of the addresses, which are returned as not allocated by the retry.
+// If timeoutPerIP is set, each attempt times out after that time for each address. The
+// release is not retried once the context is done.
+func releaseWithRetries(ctx context.Context, c client.Interface, ips []net.IP, retries int, timeoutPerIP time.Duration) ([]net.IP, error) {
+	var err error
+	attempts := 0
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Infof("Error releasing %d IPs: %s. Retrying.", len(ips), err)
+			time.Sleep(releaseRetryInterval)
+		}
+		attempts++
+		var unallocated []net.IP
+		if unallocated, err = releaseAttempt(ctx, c, ips, timeoutPerIP); err == nil {
+			return unallocated, nil
+		}
+	}
+	return nil, fmt.Errorf("Failed to release IPs after %d attempts: %v", attempts, err)
+}
+
+// releaseAttempt makes a single attempt to release the addresses, timing out after
+// timeoutPerIP for each address if it is set.
+func releaseAttempt(ctx context.Context, c client.Interface, ips []net.IP, timeoutPerIP time.Duration) ([]net.IP, error) {
+	if timeoutPerIP > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeoutPerIP*time.Duration(len(ips)))
+		defer cancel()
+	}
+	return c.IPAM().ReleaseIPs(ctx, ips)
+}
+
+// releasedFrom returns the addresses in the batch that were released, given the addresses
+// in the batch that were not allocated.
+func releasedFrom(batch, unallocated []net.IP) []net.IP {
+	notReleased := map[string]bool{}
+	for _, ip := range unallocated {
+		notReleased[ip.String()] = true
+	}
+	var released []net.IP
+	for _, ip := range batch {
+		if !notReleased[ip.String()] {
+			released = append(released, ip)
+		}
+	}
+	return released
+}
 
+// purgeEmptyBlocks releases the affinity of each block that held one of the released
+// addresses and has no other allocations, so that the block returns to the pool. Blocks
+// that do not contain a released address are never touched, so blocks that were already
+// empty are left alone. If dryRun is set, the addresses have not actually been released,
+// and the blocks that releasing them would leave empty are printed instead.
+func purgeEmptyBlocks(ctx context.Context, c client.Interface, released []net.IP, label string, dryRun bool) error {
+	if len(released) == 0 {
+		return nil
+	}
+	releasedSet := map[string]bool{}
+	for _, ip := range released {
+		releasedSet[ip.String()] = true
+	}
+
+	type accessor interface {
+		Backend() bapi.Client
+	}
+	blocks, err := c.(accessor).Backend().List(ctx, model.BlockListOptions{}, "")
+	if err != nil {
+		return fmt.Errorf("failed to list IPAM blocks: %w", err)
+	}
+
+	numPurged := 0
+	for _, kvp := range blocks.KVPairs {
+		b := kvp.Value.(*model.AllocationBlock)
+		if b.Affinity == nil || !strings.HasPrefix(*b.Affinity, "host:") {
+			continue
+		}
+		if !blockContainsAny(b, released) {
+			continue
+		}
+		empty := true
+		for ord, attrIdx := range b.Allocations {
+			if attrIdx != nil && !releasedSet[b.OrdinalToIP(ord).String()] {
+				empty = false
+				break
+			}
+		}
+		if !empty {
+			continue
+		}
+
+		host := strings.TrimPrefix(*b.Affinity, "host:")
+		if dryRun {
+			fmt.Printf("  Would release affinity of empty block %s to node %s\n", b.CIDR, host)
+			numPurged++
+			continue
+		}
+		// Require the block to be empty, in case an address was assigned from it since
+		// it was listed.
+		if err := c.IPAM().ReleaseAffinity(ctx, b.CIDR, host, true); err != nil {
+			fmt.Printf("WARNING: Unable to release affinity of block %s to node %s: %v\n", b.CIDR, host, err)
+			continue
+		}
+		fmt.Printf("  Released affinity of empty block %s to node %s\n", b.CIDR, host)
+		numPurged++
+	}
+
+	if dryRun {
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Dry run: would purge %d empty blocks", numPurged)))
+	} else {
+		fmt.Println(common.WithClusterLabel(label, fmt.Sprintf("Purged %d empty blocks", numPurged)))
+	}
 	return nil
 }
+
+// blockContainsAny returns true if any of the addresses are in the block.
+func blockContainsAny(b *model.AllocationBlock, ips []net.IP) bool {
+	for _, ip := range ips {
+		if b.CIDR.Contains(ip.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	"github.com/projectcalico/libcalico-go/lib/ipam"
+	"github.com/projectcalico/libcalico-go/lib/net"
+)
+
+// flakyIPAM is an IPAM client whose releases fail a number of times before succeeding.
+// Each release records the addresses it was asked to release. If hang is set, each
+// release blocks until its context is done.
+type flakyIPAM struct {
+	ipam.Interface
+	failures    int
+	hang        bool
+	unallocated []net.IP
+	calls       [][]net.IP
+}
+
+func (f *flakyIPAM) ReleaseIPs(ctx context.Context, ips []net.IP) ([]net.IP, error) {
+	f.calls = append(f.calls, ips)
+	if f.hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if len(f.calls) <= f.failures {
+		return nil, errors.New("connection refused")
+	}
+	return f.unallocated, nil
+}
+
+type flakyClient struct {
+	client.Interface
+	ipam *flakyIPAM
+}
+
+func (c flakyClient) IPAM() ipam.Interface {
+	return c.ipam
+}
+
+var _ = Describe("Testing releasing IPs with retries", func() {
+	ips := []net.IP{net.MustParseIP("10.0.0.1"), net.MustParseIP("10.0.0.2")}
+
+	interval := releaseRetryInterval
+	BeforeEach(func() {
+		releaseRetryInterval = 0
+	})
+	AfterEach(func() {
+		releaseRetryInterval = interval
+	})
+
+	It("should retry a failed release", func() {
+		f := &flakyIPAM{failures: 2, unallocated: ips[:1]}
+		unallocated, err := releaseWithRetries(context.Background(), flakyClient{ipam: f}, ips, 2, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unallocated).To(Equal(ips[:1]))
+		Expect(f.calls).To(Equal([][]net.IP{ips, ips, ips}))
+	})
+
+	It("should fail once the retries are exhausted", func() {
+		f := &flakyIPAM{failures: 3}
+		_, err := releaseWithRetries(context.Background(), flakyClient{ipam: f}, ips, 2, 0)
+		Expect(err).To(MatchError(ContainSubstring("after 3 attempts")))
+		Expect(f.calls).To(HaveLen(3))
+	})
+
+	It("should not retry if retries are disabled", func() {
+		f := &flakyIPAM{failures: 1}
+		_, err := releaseWithRetries(context.Background(), flakyClient{ipam: f}, ips, 0, 0)
+		Expect(err).To(HaveOccurred())
+		Expect(f.calls).To(HaveLen(1))
+	})
+
+	It("should time out and retry a release that hangs", func() {
+		f := &flakyIPAM{hang: true}
+		_, err := releaseWithRetries(context.Background(), flakyClient{ipam: f}, ips, 1, time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("after 2 attempts")))
+		Expect(f.calls).To(HaveLen(2))
+	})
+
+	It("should not retry once the deadline has passed", func() {
+		f := &flakyIPAM{hang: true}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_, err := releaseWithRetries(ctx, flakyClient{ipam: f}, ips, 3, 0)
+		Expect(err).To(MatchError(ContainSubstring("after 1 attempts")))
+		Expect(f.calls).To(HaveLen(1))
+	})
+
+	It("should stop releasing batches once the deadline has passed", func() {
+		f := &flakyIPAM{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := releaseIPs(ctx, context.Background(), flakyClient{ipam: f}, ips, false, "", 0, 0, 0, false, false, nil)
+		Expect(err).To(MatchError(ContainSubstring("deadline exceeded")))
+		Expect(f.calls).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Testing release accounting", func() {
+	ips := []net.IP{net.MustParseIP("10.0.0.1"), net.MustParseIP("10.0.0.2"), net.MustParseIP("10.0.0.3")}
+
+	It("should record the outcome of each address", func() {
+		f := &flakyIPAM{unallocated: ips[1:2]}
+		acct := &ReleaseAccounting{ClusterGUID: "abcd", Summary: ReleaseAccountingSummary{NumLeakedIPs: 5}}
+		err := releaseIPs(context.Background(), context.Background(), flakyClient{ipam: f}, ips, false, "", 0, 0, 0, false, false, acct)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acct.ReleasedIPs).To(Equal([]string{"10.0.0.1", "10.0.0.3"}))
+		Expect(acct.NotAllocatedIPs).To(Equal([]string{"10.0.0.2"}))
+		Expect(acct.UnreleasedIPs).To(BeEmpty())
+	})
+
+	It("should record the addresses left by --max-release as unreleased", func() {
+		f := &flakyIPAM{}
+		acct := &ReleaseAccounting{}
+		err := releaseIPs(context.Background(), context.Background(), flakyClient{ipam: f}, ips, false, "", 1, 0, 0, false, false, acct)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acct.ReleasedIPs).To(Equal([]string{"10.0.0.1"}))
+		Expect(acct.UnreleasedIPs).To(Equal([]string{"10.0.0.2", "10.0.0.3"}))
+	})
+
+	It("should write the accounting and compare it with a later check", func() {
+		dir, err := ioutil.TempDir("", "accounting")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		file := dir + "/accounting.json"
+
+		acct := &ReleaseAccounting{ClusterGUID: "abcd", Summary: ReleaseAccountingSummary{NumLeakedIPs: 5}}
+		acct.addReleased(ips)
+		Expect(writeAccounting(acct, file, errors.New("connection refused"))).To(MatchError("connection refused"))
+
+		loaded, err := loadReleaseAccounting(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Summary.NumReleasedIPs).To(Equal(3))
+		Expect(loaded.Summary.NumErrors).To(Equal(1))
+		Expect(loaded.Errors).To(Equal([]string{"connection refused"}))
+
+		cmp := compareSnapshot(loaded, 4)
+		Expect(cmp.NumLeakedIPsExpected).To(Equal(2))
+		Expect(cmp.NumLeakedIPsFound).To(Equal(4))
+	})
+
+	It("should do nothing without an accounting", func() {
+		var acct *ReleaseAccounting
+		acct.addReleased(ips)
+		Expect(writeAccounting(acct, "", nil)).To(Succeed())
+	})
+})
+
+var _ = Describe("Testing loading reports", func() {
+	It("should read the report from stdin", func() {
+		f, err := ioutil.TempFile("", "report")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Remove(f.Name())
+		_, err = f.WriteString(`{"clusterGUID": "abcd", "clusterInformationRevision": "100"}`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.Seek(0, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		stdin := os.Stdin
+		os.Stdin = f
+		defer func() { os.Stdin = stdin }()
+
+		r, err := loadReport("-")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.ClusterGUID).To(Equal("abcd"))
+		Expect(r.ClusterInfoRevision).To(Equal("100"))
+	})
+})
+
+var _ = Describe("Testing validating reports", func() {
+	clusterInfo := apiv3.NewClusterInformation()
+	clusterInfo.ResourceVersion = "100"
+	clusterInfo.Spec.ClusterGUID = "abcd"
+
+	It("should refuse to release IPs from an incomplete check, even with --force", func() {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{Version: "v1"})
+		c.clusterGUID = "abcd"
+		c.clusterInfoRevision = "100"
+		c.recordIncomplete("workload endpoints", errors.New("connection refused"))
+
+		r := c.newReport()
+		Expect(r.Incomplete).To(Equal([]string{"workload endpoints"}))
+		err := validateReport(clusterInfo, &r, true, "v1")
+		Expect(err).To(MatchError(ContainSubstring("incomplete check")))
+	})
+
+	It("should accept a complete report", func() {
+		r := Report{ClusterGUID: "abcd", ClusterInfoRevision: "100", Version: "v1"}
+		Expect(validateReport(clusterInfo, &r, false, "v1")).To(Succeed())
+	})
+})
+
+var _ = Describe("Testing the summary of a release from reports", func() {
+	It("should count the entries released and kept in each pool and on each node", func() {
+		entries := []Allocation{
+			{IP: "10.0.0.1", Node: "node1", InUse: true},
+			{IP: "10.0.0.2", Node: "node1"},
+			{IP: "10.0.0.3", Node: "node2", Reserved: true},
+			{IP: "10.1.0.1"},
+		}
+		pool := apiv3.NewIPPool()
+		pool.Name = "pool1"
+		pool.Spec.CIDR = "10.0.0.0/16"
+		release := []net.IP{net.MustParseIP("10.0.0.2"), net.MustParseIP("10.1.0.1")}
+
+		s := summarizeRelease(entries, release, []apiv3.IPPool{*pool})
+		Expect(s.NumEntries).To(Equal(4))
+		Expect(s.NumInUse).To(Equal(1))
+		Expect(s.NumKept).To(Equal(1))
+		Expect(s.NumRelease).To(Equal(2))
+		Expect(s.ByPool).To(Equal(map[string]*releaseCounts{
+			"pool1":  {Release: 1, Keep: 2},
+			"<none>": {Release: 1},
+		}))
+		Expect(s.ByNode).To(Equal(map[string]*releaseCounts{
+			"node1":  {Release: 1, Keep: 1},
+			"node2":  {Keep: 1},
+			"<none>": {Release: 1},
+		}))
+
+		buf := &bytes.Buffer{}
+		Expect(s.print(buf, "")).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("Report entries: 4; kept because in use: 1; kept for another reason: 1; to release: 2"))
+		Expect(buf.String()).To(ContainSubstring("  pool1    1         2\n"))
+	})
+})
@@ -0,0 +1,173 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/options"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
+)
+
+// releaseCounts is the number of report entries that are released and kept.
+type releaseCounts struct {
+	Release int
+	Keep    int
+}
+
+// releaseSummary summarizes the entries of the reports that a release acts on: how many
+// are kept because they are in use, how many are kept for another reason, such as being
+// reserved or the tunnel address of a node, and how many are released, in total and for
+// each IP pool and node.
+type releaseSummary struct {
+	NumEntries int
+	NumInUse   int
+	NumKept    int
+	NumRelease int
+	ByPool     map[string]*releaseCounts
+	ByNode     map[string]*releaseCounts
+}
+
+// summarizeRelease summarizes the report entries, given the IPs that will be released.
+// Each entry is attributed to the IP pool containing it, or "<none>" if there is none,
+// and to its node, or "<none>" if it has no node.
+func summarizeRelease(entries []Allocation, release []cnet.IP, pools []apiv3.IPPool) releaseSummary {
+	type pool struct {
+		name string
+		cidr *cnet.IPNet
+	}
+	var parsed []pool
+	for _, p := range pools {
+		if _, cidr, err := cnet.ParseCIDR(p.Spec.CIDR); err == nil {
+			parsed = append(parsed, pool{p.Name, cidr})
+		}
+	}
+	released := map[string]bool{}
+	for _, ip := range release {
+		released[ip.String()] = true
+	}
+
+	s := releaseSummary{ByPool: map[string]*releaseCounts{}, ByNode: map[string]*releaseCounts{}}
+	for _, a := range entries {
+		s.NumEntries++
+		poolName := "<none>"
+		for _, p := range parsed {
+			if poolsContain([]*cnet.IPNet{p.cidr}, net.ParseIP(a.IP)) {
+				poolName = p.name
+				break
+			}
+		}
+		node := a.Node
+		if node == "" {
+			node = "<none>"
+		}
+		pc, nc := countsFor(s.ByPool, poolName), countsFor(s.ByNode, node)
+		switch {
+		case a.InUse:
+			s.NumInUse++
+			pc.Keep++
+			nc.Keep++
+		case released[ipKey(a.IP)]:
+			s.NumRelease++
+			pc.Release++
+			nc.Release++
+		default:
+			s.NumKept++
+			pc.Keep++
+			nc.Keep++
+		}
+	}
+	return s
+}
+
+// countsFor returns the counts for the key, adding them if they are not yet in the map.
+func countsFor(m map[string]*releaseCounts, key string) *releaseCounts {
+	if m[key] == nil {
+		m[key] = &releaseCounts{}
+	}
+	return m[key]
+}
+
+// ipKey returns the IP in the form returned by cnet.IP.String, so that the IPs in a report
+// can be compared with the IPs to release.
+func ipKey(ip string) string {
+	if parsed := cnet.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	return ip
+}
+
+// print writes the summary to w, followed by the counts for each IP pool and node.
+func (s releaseSummary) print(w io.Writer, label string) error {
+	fmt.Fprintln(w, common.WithClusterLabel(label, fmt.Sprintf("Report entries: %d; kept because in use: %d; kept for another reason: %d; to release: %d",
+		s.NumEntries, s.NumInUse, s.NumKept, s.NumRelease)))
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, group := range []struct {
+		heading string
+		counts  map[string]*releaseCounts
+	}{{"POOL", s.ByPool}, {"NODE", s.ByNode}} {
+		keys := make([]string, 0, len(group.counts))
+		for k := range group.counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(tw, "  %s\tRELEASE\tKEEP\n", group.heading)
+		for _, k := range keys {
+			fmt.Fprintf(tw, "  %s\t%d\t%d\n", k, group.counts[k].Release, group.counts[k].Keep)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// confirmReleaseFromReports prints a summary of the report entries that will be released
+// and kept, and asks for confirmation before the release unless confirmed is set. No
+// confirmation is needed for a dry run. The confirmation cannot be read if the report was
+// read from stdin, so the release is refused unless confirmed is set.
+func confirmReleaseFromReports(ctx context.Context, c client.Interface, in io.Reader, entries []Allocation, release []cnet.IP,
+	label string, confirmed, dryRun, fromStdin bool) error {
+	pools, err := c.IPPools().List(ctx, options.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list IP pools: %w", err)
+	}
+	s := summarizeRelease(entries, release, pools.Items)
+	if err := s.print(os.Stdout, label); err != nil {
+		return err
+	}
+	if confirmed || dryRun || s.NumRelease == 0 {
+		return nil
+	}
+	if fromStdin {
+		return fmt.Errorf("The report was read from stdin, so the release cannot be confirmed. Use --yes to release without confirmation.")
+	}
+	fmt.Printf("Release %d IPs? [y/N] ", s.NumRelease)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return fmt.Errorf("Aborted; no IPs were released")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	reportFilePrefix = "ipam-check-"
+	reportFileSuffix = ".json"
+
+	// The timestamp format used in report file names. This sorts lexically in time order.
+	reportTimestampFormat = "20060102T150405Z"
+)
+
+// writeReportToDir writes the report to a file in the report directory named for the
+// time of the check, then removes the oldest reports beyond the retention limit.
+func (c *IPAMChecker) writeReportToDir(now time.Time) error {
+	if err := os.MkdirAll(c.reportDir, 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	bytes, err := json.MarshalIndent(c.fullReport(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize report: %w", err)
+	}
+	name := filepath.Join(c.reportDir, reportFilePrefix+now.UTC().Format(reportTimestampFormat)+reportFileSuffix)
+	if err := writeFileAtomic(name, bytes, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	fmt.Printf("Wrote report to %s\n", name)
+
+	if c.reportRetention > 0 {
+		return pruneReports(c.reportDir, c.reportRetention)
+	}
+	return nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory and then
+// renames it, so that the file is either fully written or not present at all.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, name)
+}
+
+// pruneReports removes the oldest reports in the directory so that at most retention
+// reports remain. Files that are not reports are left alone.
+func pruneReports(dir string, retention int) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read report directory: %w", err)
+	}
+
+	var reports []string
+	for _, f := range files {
+		if f.Mode().IsRegular() && strings.HasPrefix(f.Name(), reportFilePrefix) && strings.HasSuffix(f.Name(), reportFileSuffix) {
+			reports = append(reports, f.Name())
+		}
+	}
+	if len(reports) <= retention {
+		return nil
+	}
+
+	sort.Strings(reports)
+	for _, r := range reports[:len(reports)-retention] {
+		if err := os.Remove(filepath.Join(dir, r)); err != nil {
+			return fmt.Errorf("failed to remove old report: %w", err)
+		}
+		fmt.Printf("Removed old report %s\n", r)
+	}
+	return nil
+}
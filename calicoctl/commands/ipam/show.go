@@ -16,6 +16,7 @@ package ipam
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"os"
@@ -30,6 +31,7 @@ import (
 	"github.com/projectcalico/libcalico-go/lib/clientv3"
 	cerrors "github.com/projectcalico/libcalico-go/lib/errors"
 	"github.com/projectcalico/libcalico-go/lib/ipam"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
 
 	docopt "github.com/docopt/docopt-go"
 
@@ -172,6 +174,93 @@ func showIP(ctx context.Context, ipamClient ipam.Interface, passedIP interface{}
 	return nil
 }
 
+// BlockDump is the contents of a single IPAM block, as output by "ipam show --block".
+type BlockDump struct {
+	CIDR     string         `json:"cidr"`
+	Affinity string         `json:"affinity,omitempty"`
+	Ordinals []OrdinalState `json:"ordinals"`
+}
+
+// OrdinalState is the state of a single ordinal within an IPAM block.
+type OrdinalState struct {
+	Ordinal    int    `json:"ordinal"`
+	IP         string `json:"ip"`
+	Allocated  bool   `json:"allocated"`
+	Attributes string `json:"attributes,omitempty"`
+	InUse      bool   `json:"inUse"`
+}
+
+// showBlock prints every ordinal in the block with the given CIDR, along with its allocation
+// attributes and whether the IP is in use by a node or workload.
+func showBlock(ctx context.Context, c clientv3.Interface, bc bapi.Client, passedCIDR string, output string) error {
+	if output != "text" && output != "json" {
+		return fmt.Errorf("Unrecognized output format '%s', expected one of: text, json", output)
+	}
+	_, cidr, err := cnet.ParseCIDR(passedCIDR)
+	if err != nil {
+		return fmt.Errorf("Invalid block CIDR '%s': %v", passedCIDR, err)
+	}
+
+	kvp, err := bc.Get(ctx, model.BlockKey{CIDR: *cidr}, "")
+	if err != nil {
+		if _, ok := err.(cerrors.ErrorResourceDoesNotExist); ok {
+			return fmt.Errorf("Block %s does not exist", cidr)
+		}
+		return err
+	}
+	b := kvp.Value.(*model.AllocationBlock)
+
+	inUse, err := loadInUseIPs(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	dump := BlockDump{CIDR: b.CIDR.String()}
+	if b.Affinity != nil {
+		dump.Affinity = *b.Affinity
+	}
+	for ord, attrIdx := range b.Allocations {
+		state := OrdinalState{Ordinal: ord, IP: b.OrdinalToIP(ord).String()}
+		state.InUse = inUse[state.IP]
+		if attrIdx != nil {
+			state.Allocated = true
+			state.Attributes = "<missing>"
+			if *attrIdx >= 0 && len(b.Attributes) > *attrIdx {
+				state.Attributes = formatAttrs(b.Attributes[*attrIdx], AttrFormat{})
+			}
+		}
+		dump.Ordinals = append(dump.Ordinals, state)
+	}
+
+	if output == "json" {
+		bytes, err := json.MarshalIndent(dump, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+
+	affinity := "<none>"
+	if dump.Affinity != "" {
+		affinity = dump.Affinity
+	}
+	fmt.Printf("Block %s affinity=%s\n", dump.CIDR, affinity)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ORDINAL", "IP", "ALLOCATED", "IN USE", "ATTRIBUTES"})
+	for _, state := range dump.Ordinals {
+		table.Append([]string{
+			fmt.Sprintf("%d", state.Ordinal),
+			state.IP,
+			fmt.Sprintf("%v", state.Allocated),
+			fmt.Sprintf("%v", state.InUse),
+			state.Attributes,
+		})
+	}
+	table.Render()
+	return nil
+}
+
 func showBlockUtilization(ctx context.Context, ipamClient ipam.Interface, showBlocks bool) error {
 	usage, err := ipamClient.GetUtilization(ctx, ipam.GetUtilizationArgs{})
 	if err != nil {
@@ -245,7 +334,8 @@ func showConfiguration(ctx context.Context, ipamClient ipam.Interface) error {
 // IPAM takes keyword with an IP address then calls the subcommands.
 func Show(args []string) error {
 	doc := constants.DatastoreIntro + `Usage:
-  <BINARY_NAME> ipam show [--ip=<IP> | --show-blocks | --show-borrowed | --show-configuration] [--config=<CONFIG>]
+  <BINARY_NAME> ipam show [--ip=<IP> | --show-blocks | --show-borrowed | --show-configuration |
+                          --block=<CIDR> [--output=<OUTPUT>]] [--config=<CONFIG>]
 
 Options:
   -h --help                Show this screen.
@@ -253,6 +343,10 @@ Options:
      --show-blocks         Show detailed information for IP blocks as well as pools.
      --show-borrowed       Show detailed information for "borrowed" IP addresses.
      --show-configuration  Show current Calico IPAM configuration.
+     --block=<CIDR>        Show every IP in the IPAM block with this CIDR, with
+                           its allocation attributes and whether it is in use.
+  -o --output=<OUTPUT>     Output format for --block.  One of: text, json.
+                           [default: text]
   -c --config=<CONFIG>     Path to the file containing connection configuration in
                            YAML or JSON format.
                            [default: ` + constants.DefaultConfigPath + `]
@@ -260,6 +354,11 @@ Options:
 Description:
   The ipam show command prints information about a given IP address, or about
   overall IP usage.
+
+  The --block option shows the block's affinity, and for every ordinal in the
+  block, the IP, whether it is allocated, its allocation attributes and
+  whether it is in use by a node or workload endpoint.  This is useful for
+  debugging a single block without running a full "ipam check".
 `
 	// Replace all instances of BINARY_NAME with the name of the binary.
 	name, _ := util.NameAndDescription()
@@ -295,7 +394,9 @@ Description:
 	showBorrowed := parsedArgs["--show-borrowed"].(bool)
 	configuration := parsedArgs["--show-configuration"].(bool)
 
-	if passedIP != nil {
+	if block := parsedArgs["--block"]; block != nil {
+		return showBlock(ctx, client, bc, block.(string), parsedArgs["--output"].(string))
+	} else if passedIP != nil {
 		return showIP(ctx, ipamClient, passedIP)
 	} else if showBlocks {
 		return showBlockUtilization(ctx, ipamClient, true)
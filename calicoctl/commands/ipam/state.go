@@ -0,0 +1,280 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/clientv3"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/options"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/common"
+)
+
+// IPAMState is the IPAM data loaded by loadIPAMState. The allocations, and the IPs in use
+// by nodes and workloads, are recorded in the IPAMChecker that loaded it.
+type IPAMState struct {
+	// All the IPAM blocks.
+	Blocks []*model.AllocationBlock
+
+	// The IP pools that are checked, and the CIDRs of those that are active and disabled.
+	// Disabled pools are only checked if the checker includes them.
+	CheckedPools  []apiv3.IPPool
+	ActivePools   []*cnet.IPNet
+	DisabledPools []*cnet.IPNet
+
+	// All the IP pools and their CIDRs, including disabled pools that are not checked.
+	IPPools  []apiv3.IPPool
+	AllPools []*cnet.IPNet
+
+	// The workload endpoints that were loaded.
+	WorkloadEndpoints []apiv3.WorkloadEndpoint
+
+	NumAllocations int
+	NumNodeIPs     int
+	NumWorkloadIPs int
+}
+
+// loadIPAMState loads the IPAM blocks, IP pools, nodes and workload endpoints, and records
+// them in the checker. Every workload endpoint is recorded before it returns, so that an
+// IP that is not recorded as in use can be treated as leaked, unless the workload
+// endpoints could not be loaded, in which case the check is marked as incomplete. If the
+// interrupt context is cancelled, loading stops after the datastore operation in progress.
+func (c *IPAMChecker) loadIPAMState(ctx, interrupt context.Context) (*IPAMState, error) {
+	s := &IPAMState{}
+
+	c.printf("Loading all IPAM blocks...\n")
+	blocks, err := c.backendClient.List(ctx, model.BlockListOptions{}, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list IPAM blocks: %w", err)
+	}
+	c.printf("Found %d IPAM blocks.\n", len(blocks.KVPairs))
+	progress := common.NewProgress("Scanning IPAM blocks", len(blocks.KVPairs), c.showProgress)
+	for _, kvp := range blocks.KVPairs {
+		b := kvp.Value.(*model.AllocationBlock)
+		affinity := "<none>"
+		if b.Affinity != nil {
+			affinity = *b.Affinity
+		}
+		c.printf(" IPAM block %s affinity=%s:\n", b.CIDR, affinity)
+		c.recordBlock(s, b)
+		progress.Add(1)
+	}
+	progress.Finish()
+	c.printf("IPAM blocks record %d allocations.\n", s.NumAllocations)
+	c.summary.NumBlocks = len(s.Blocks)
+	c.summary.NumAllocations = s.NumAllocations
+	c.summary.NumWindowsReservedIPs = len(c.reservedIPs)
+	if c.includeReserved {
+		c.printf("IPAM blocks record %d IPs reserved for Windows.\n", len(c.reservedIPs))
+	}
+	c.summary.NumReservedHandleIPs = len(c.reservedHandleIPs)
+	if len(c.reservedHandleIPs) > 0 {
+		c.printf("IPAM blocks record %d IPs allocated to reserved handles.\n", len(c.reservedHandleIPs))
+	}
+	c.printf("\n")
+	if err := c.checkInterrupted(interrupt, "loading IPAM blocks"); err != nil {
+		return nil, err
+	}
+
+	c.printf("Loading all IPAM pools...\n")
+	ipPools, err := c.v3Client.IPPools().List(ctx, options.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load IP pools: %w", err)
+	}
+	if err := c.recordPools(s, ipPools.Items); err != nil {
+		return nil, err
+	}
+	for _, p := range s.CheckedPools {
+		if p.Spec.Disabled {
+			c.printf("  %s (disabled)\n", p.Spec.CIDR)
+		} else {
+			c.printf("  %s\n", p.Spec.CIDR)
+		}
+	}
+	c.printf("Found %d active IP pools.\n", len(s.ActivePools))
+	if c.includeDisabled {
+		c.printf("Found %d disabled IP pools.\n", len(s.DisabledPools))
+	}
+	c.printf("\n")
+	if err := c.checkInterrupted(interrupt, "loading IP pools"); err != nil {
+		return nil, err
+	}
+
+	// A failure to load the nodes or workload endpoints is recorded rather than returned,
+	// so that the data already loaded is still checked. Their IPs are then missing from
+	// the in-use IPs, so the check is marked as incomplete.
+	nodes, err := c.listNodes(ctx)
+	if err != nil {
+		c.recordIncomplete("nodes", err)
+	}
+	for _, n := range nodes {
+		if err := c.recordNode(s, n); err != nil {
+			return nil, err
+		}
+	}
+	c.printf("Found %d node tunnel IPs.\n", s.NumNodeIPs)
+	c.printf("\n")
+	if err := c.checkInterrupted(interrupt, "loading nodes"); err != nil {
+		return nil, err
+	}
+
+	// The datastore does not paginate lists, so listWorkloadEndpoints returns all of the
+	// endpoints in one go. If it is changed to load pages, it must still return only once
+	// every page has been loaded.
+	weps, err := c.listWorkloadEndpoints(ctx)
+	if err != nil {
+		c.recordIncomplete("workload endpoints", err)
+	}
+	progress = common.NewProgress("Scanning workload endpoints", len(weps), c.showProgress)
+	for _, w := range weps {
+		if err := c.recordWorkloadEndpoint(s, w); err != nil {
+			progress.Finish()
+			return nil, err
+		}
+		progress.Add(1)
+	}
+	progress.Finish()
+	c.printf("Found %d workload IPs.\n", s.NumWorkloadIPs)
+	c.printf("Workloads and nodes are using %d IPs.\n", len(c.inUseIPs))
+	c.summary.NumInUseIPs = len(c.inUseIPs)
+	c.printf("\n")
+	if err := c.checkInterrupted(interrupt, "loading workload endpoints"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadIPAMStateQuietly loads the IPAM state in the same way as "ipam check", without
+// printing it, for the other ipam commands that need the allocations or the IPs in use.
+func loadIPAMStateQuietly(ctx context.Context, client clientv3.Interface, opts IPAMCheckerOptions) (*IPAMChecker, *IPAMState, error) {
+	type accessor interface {
+		Backend() bapi.Client
+	}
+	opts.Quiet = true
+	checker := NewIPAMChecker(nil, client, client.(accessor).Backend(), opts)
+	s, err := checker.loadIPAMState(ctx, context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	return checker, s, nil
+}
+
+// loadInUseIPs returns the set of addresses in use by nodes and workloads, as decided by
+// the IPAM check. Unlike the check, it fails if the nodes or workload endpoints could not
+// be loaded, since their IPs would otherwise be treated as not in use.
+func loadInUseIPs(ctx context.Context, client clientv3.Interface) (map[string]bool, error) {
+	checker, _, err := loadIPAMStateQuietly(ctx, client, IPAMCheckerOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if len(checker.incomplete) > 0 {
+		return nil, fmt.Errorf("Failed to load the %s, so the IPs in use are not known", strings.Join(checker.incomplete, " and "))
+	}
+	inUse := map[string]bool{}
+	for ip := range checker.inUseIPs {
+		inUse[ip] = true
+	}
+	return inUse, nil
+}
+
+// recordBlock records the block, its host affinity and its allocations.
+func (c *IPAMChecker) recordBlock(s *IPAMState, b *model.AllocationBlock) {
+	s.Blocks = append(s.Blocks, b)
+	if b.Affinity != nil && strings.HasPrefix(*b.Affinity, "host:") {
+		c.blockAffinityHosts[b.CIDR.String()] = (*b.Affinity)[5:]
+	}
+	for ord, attrIdx := range b.Allocations {
+		if attrIdx == nil {
+			continue // IP is not allocated
+		}
+		s.NumAllocations++
+		c.recordAllocation(b, ord)
+		if b.Affinity == nil {
+			allocs := c.allocations[b.OrdinalToIP(ord).String()]
+			if c.allocationsIncluded(allocs[len(allocs)-1:]) {
+				c.unaffinedBlocks[b.CIDR.String()]++
+			}
+		}
+	}
+}
+
+// recordPools records the IP pools. Disabled pools are only checked if the checker
+// includes them, in which case the allocations in them are tagged so that they can be
+// distinguished in the report. The blocks must be recorded first.
+func (c *IPAMChecker) recordPools(s *IPAMState, pools []apiv3.IPPool) error {
+	for _, p := range pools {
+		_, cidr, err := cnet.ParseCIDR(p.Spec.CIDR)
+		if err != nil {
+			return fmt.Errorf("failed to parse IP pool CIDR: %w", err)
+		}
+		s.IPPools = append(s.IPPools, p)
+		s.AllPools = append(s.AllPools, cidr)
+		if p.Spec.Disabled && !c.includeDisabled {
+			continue
+		}
+		s.CheckedPools = append(s.CheckedPools, p)
+		if p.Spec.Disabled {
+			s.DisabledPools = append(s.DisabledPools, cidr)
+			continue
+		}
+		s.ActivePools = append(s.ActivePools, cidr)
+	}
+	if c.includeDisabled {
+		for ip, allocs := range c.allocations {
+			if poolsContain(s.DisabledPools, net.ParseIP(ip)) {
+				for _, a := range allocs {
+					a.InDisabledPool = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// recordNode records the labels of the node and the tunnel IPs that it uses.
+func (c *IPAMChecker) recordNode(s *IPAMState, n apiv3.Node) error {
+	c.nodeLabels[n.Name] = n.Labels
+	ips, err := getNodeIPs(n)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		c.recordInUseIP(ip, n, fmt.Sprintf("Node(%s)", n.Name))
+		s.NumNodeIPs++
+	}
+	return nil
+}
+
+// recordWorkloadEndpoint records the workload endpoint and the IPs that it uses.
+func (c *IPAMChecker) recordWorkloadEndpoint(s *IPAMState, w apiv3.WorkloadEndpoint) error {
+	s.WorkloadEndpoints = append(s.WorkloadEndpoints, w)
+	ips, err := getWEPIPs(w)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		c.recordInUseIP(ip, w, fmt.Sprintf("Workload(%s/%s)", w.Namespace, w.Name))
+		s.NumWorkloadIPs++
+	}
+	return nil
+}
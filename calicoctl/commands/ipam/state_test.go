@@ -0,0 +1,172 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipam
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+var _ = Describe("Testing recording the IPAM state", func() {
+	// newBlock returns a block with an allocation for the pod at each of the given ordinals.
+	newBlock := func(cidr, affinity string, pods map[int]string) *model.AllocationBlock {
+		b := &model.AllocationBlock{
+			CIDR:        cnet.MustParseCIDR(cidr),
+			Allocations: make([]*int, 4),
+		}
+		if affinity != "" {
+			b.Affinity = &affinity
+		}
+		for ord, pod := range pods {
+			handle := "k8s-pod-network." + pod
+			idx := len(b.Attributes)
+			b.Attributes = append(b.Attributes, model.AllocationAttribute{
+				AttrPrimary:   &handle,
+				AttrSecondary: map[string]string{"node": "node1", "namespace": "default", "pod": pod},
+			})
+			b.Allocations[ord] = &idx
+		}
+		return b
+	}
+	newPool := func(cidr string, disabled bool) apiv3.IPPool {
+		p := apiv3.NewIPPool()
+		p.Name = cidr
+		p.Spec.CIDR = cidr
+		p.Spec.Disabled = disabled
+		return *p
+	}
+	newChecker := func(includeDisabled bool) *IPAMChecker {
+		return NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{IncludeDisabled: includeDisabled})
+	}
+
+	It("should record the blocks, their affinities and their allocations", func() {
+		c := newChecker(false)
+		s := &IPAMState{}
+		c.recordBlock(s, newBlock("10.0.0.0/30", "host:node1", map[int]string{0: "pod1", 2: "pod2"}))
+		c.recordBlock(s, newBlock("10.0.0.4/30", "", map[int]string{1: "pod3"}))
+
+		Expect(s.Blocks).To(HaveLen(2))
+		Expect(s.NumAllocations).To(Equal(3))
+		Expect(c.blockAffinityHosts).To(Equal(map[string]string{"10.0.0.0/30": "node1"}))
+		Expect(c.unaffinedBlocks).To(Equal(map[string]int{"10.0.0.4/30": 1}))
+		Expect(c.allocations).To(HaveKey("10.0.0.0"))
+		Expect(c.allocations).To(HaveKey("10.0.0.2"))
+		Expect(c.allocations).To(HaveKey("10.0.0.5"))
+		Expect(c.allocationsByNode["node1"]).To(HaveLen(3))
+		Expect(c.allocationsByPod).To(HaveKey("default/pod3"))
+		Expect(c.allocations["10.0.0.5"][0].Borrowed).To(BeTrue())
+	})
+
+	It("should record the allocations to reserved handles as reserved", func() {
+		c := NewIPAMChecker(nil, nil, nil, IPAMCheckerOptions{ReservedHandlePrefixes: []string{"reserved-", "gateway-"}})
+		s := &IPAMState{}
+		b := newBlock("10.0.0.0/30", "host:node1", map[int]string{0: "pod1"})
+		for ord, handle := range map[int]string{1: "gateway-10.0.0.1", 2: "reserved-range1"} {
+			h := handle
+			idx := len(b.Attributes)
+			b.Attributes = append(b.Attributes, model.AllocationAttribute{AttrPrimary: &h})
+			b.Allocations[ord] = &idx
+		}
+		c.recordBlock(s, b)
+
+		Expect(c.reservedHandleIPs).To(Equal(map[string]bool{"10.0.0.1": true, "10.0.0.2": true}))
+		Expect(c.allocations["10.0.0.0"][0].Reserved).To(BeFalse())
+		Expect(c.allocations["10.0.0.1"][0].Reserved).To(BeTrue())
+		Expect(c.allocations["10.0.0.2"][0].Handle).To(Equal("reserved-range1"))
+	})
+
+	It("should not recognize any reserved handles by default", func() {
+		c := newChecker(false)
+		s := &IPAMState{}
+		b := newBlock("10.0.0.0/30", "host:node1", nil)
+		h := "reserved-range1"
+		idx := len(b.Attributes)
+		b.Attributes = append(b.Attributes, model.AllocationAttribute{AttrPrimary: &h})
+		b.Allocations[1] = &idx
+		c.recordBlock(s, b)
+
+		Expect(c.reservedHandleIPs).To(BeEmpty())
+		Expect(c.allocations["10.0.0.1"][0].Reserved).To(BeFalse())
+	})
+
+	It("should only check disabled pools if they are included", func() {
+		c := newChecker(false)
+		s := &IPAMState{}
+		Expect(c.recordPools(s, []apiv3.IPPool{newPool("10.0.0.0/24", false), newPool("10.1.0.0/24", true)})).To(Succeed())
+
+		Expect(s.AllPools).To(HaveLen(2))
+		Expect(s.CheckedPools).To(HaveLen(1))
+		Expect(s.CheckedPools[0].Spec.CIDR).To(Equal("10.0.0.0/24"))
+		Expect(s.ActivePools).To(HaveLen(1))
+		Expect(s.DisabledPools).To(BeEmpty())
+	})
+
+	It("should tag the allocations in included disabled pools", func() {
+		c := newChecker(true)
+		s := &IPAMState{}
+		c.recordBlock(s, newBlock("10.0.0.0/30", "host:node1", map[int]string{0: "pod1"}))
+		c.recordBlock(s, newBlock("10.1.0.0/30", "host:node1", map[int]string{0: "pod2"}))
+		Expect(c.recordPools(s, []apiv3.IPPool{newPool("10.0.0.0/24", false), newPool("10.1.0.0/24", true)})).To(Succeed())
+
+		Expect(s.CheckedPools).To(HaveLen(2))
+		Expect(s.ActivePools).To(HaveLen(1))
+		Expect(s.DisabledPools).To(HaveLen(1))
+		Expect(c.allocations["10.0.0.0"][0].InDisabledPool).To(BeFalse())
+		Expect(c.allocations["10.1.0.0"][0].InDisabledPool).To(BeTrue())
+	})
+
+	It("should fail to record a pool with an invalid CIDR", func() {
+		c := newChecker(false)
+		Expect(c.recordPools(&IPAMState{}, []apiv3.IPPool{newPool("10.0.0.0/33", false)})).NotTo(Succeed())
+	})
+
+	It("should record the IPs in use by nodes and workload endpoints", func() {
+		c := newChecker(false)
+		s := &IPAMState{}
+		c.recordBlock(s, newBlock("10.0.0.0/30", "host:node1", map[int]string{0: "node1-tunnel", 1: "pod1"}))
+
+		n := apiv3.NewNode()
+		n.Name = "node1"
+		n.Labels = map[string]string{"zone": "a"}
+		n.Spec.IPv4VXLANTunnelAddr = "10.0.0.0"
+		Expect(c.recordNode(s, *n)).To(Succeed())
+
+		w := apiv3.NewWorkloadEndpoint()
+		w.Namespace = "default"
+		w.Name = "node1-k8s-pod1-eth0"
+		w.Spec.IPNetworks = []string{"10.0.0.1/32", "10.0.0.3/32"}
+		Expect(c.recordWorkloadEndpoint(s, *w)).To(Succeed())
+
+		Expect(s.NumNodeIPs).To(Equal(1))
+		Expect(s.NumWorkloadIPs).To(Equal(2))
+		Expect(s.WorkloadEndpoints).To(HaveLen(1))
+		Expect(c.nodeLabels).To(Equal(map[string]map[string]string{"node1": {"zone": "a"}}))
+		Expect(c.inUseIPs).To(HaveLen(3))
+		Expect(c.allocations["10.0.0.0"][0].InUse).To(BeTrue())
+		Expect(c.allocations["10.0.0.0"][0].Owners).To(Equal([]string{"Node(node1)"}))
+		Expect(c.allocations["10.0.0.1"][0].Owners).To(Equal([]string{"Workload(default/node1-k8s-pod1-eth0)"}))
+	})
+
+	It("should fail to record a workload endpoint with an invalid IP", func() {
+		c := newChecker(false)
+		w := apiv3.NewWorkloadEndpoint()
+		w.Spec.IPNetworks = []string{"not-an-ip"}
+		Expect(c.recordWorkloadEndpoint(&IPAMState{}, *w)).NotTo(Succeed())
+	})
+})
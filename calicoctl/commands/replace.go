@@ -31,7 +31,7 @@ import (
 
 func Replace(args []string) error {
 	doc := constants.DatastoreIntro + `Usage:
-  <BINARY_NAME> replace --filename=<FILENAME> [--recursive] [--skip-empty]
+  <BINARY_NAME> replace --filename=<FILENAME> [--recursive] [--skip-empty] [--conflict=<MODE>] [--strict]
                     [--config=<CONFIG>] [--namespace=<NS>] [--context=<context>]
 
 Examples:
@@ -50,6 +50,11 @@ Options:
   -R --recursive             Process the filename specified in -f or --filename recursively.
      --skip-empty            Do not error if any files or directory specified using -f or --filename contain no
                              data.
+     --conflict=<MODE>       How to resolve a conflict with a newer version of a
+                             resource.  One of: fail, overwrite, merge.
+                             [default: fail]
+     --strict                Treat validation warnings, such as an IPPool whose
+                             CIDR overlaps another IPPool, as errors.
   -c --config=<CONFIG>       Path to the file containing connection
                              configuration in YAML or JSON format.
                              [default: ` + constants.DefaultConfigPath + `]
@@ -90,6 +95,17 @@ Description:
 
   When replacing a resource, the complete resource spec must be provided, it is
   not sufficient to supply only the fields that are being updated.
+
+  A conflict occurs when a resource includes a resource version that is older
+  than the latest version of the resource in the datastore, for example when
+  replacing a resource from an earlier export.  The --conflict option
+  controls how a conflict is resolved:
+
+    fail       Fail to replace the resource.  This is the default.
+    overwrite  Replace the latest version of the resource with the supplied
+               resource.
+    merge      Merge the spec of the supplied resource into the latest version
+               of the resource.  Maps are merged and lists are replaced.
 `
 	// Replace all instances of BINARY_NAME with the name of the binary.
 	name, _ := util.NameAndDescription()
@@ -1,4 +1,4 @@
-// Copyright (c) 2020 Tigera, Inc. All rights reserved.
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
 
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package datastore
+package commands
 
 import (
 	"fmt"
@@ -21,28 +21,24 @@ import (
 	"github.com/docopt/docopt-go"
 
 	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
-	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/datastore/migrate"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/validate"
 	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
 )
 
-// Migrate function is a switch to migrate related sub-commands
-func Migrate(args []string) error {
-	var err error
+// Validate is a switch to the validation sub-commands.
+func Validate(args []string) error {
 	doc := constants.DatastoreIntro + `Usage:
-  <BINARY_NAME> datastore migrate <command> [<args>...]
+  <BINARY_NAME> validate <command> [<args>...]
 
-    export  Export the contents of the etcdv3 datastore to yaml.
-    import  Store and convert yaml of resources into the Kubernetes datastore.
-    lock    Lock the datastore to prevent changes from occurring during datastore migration.
-    unlock  Unlock the datastore to allow changes once the migration is completed.
+    references       Report references between resources that do not resolve.
 
 Options:
   -h --help      Show this screen.
 
 Description:
-  Migration specific commands.
+  Validation commands for Calico.  These commands do not modify the datastore.
 
-  See '<BINARY_NAME> datastore migrate <command> --help' to read about a specific subcommand.
+  See '<BINARY_NAME> validate <command> --help' to read about a specific subcommand.
 `
 	// Replace all instances of BINARY_NAME with the name of the binary.
 	name, _ := util.NameAndDescription()
@@ -62,17 +58,11 @@ Description:
 	}
 
 	command := arguments["<command>"].(string)
-	args = append([]string{"datastore", "migrate", command}, arguments["<args>"].([]string)...)
+	args = append([]string{"validate", command}, arguments["<args>"].([]string)...)
 
 	switch command {
-	case "export":
-		return migrate.Export(args)
-	case "import":
-		return migrate.Import(args)
-	case "lock":
-		return migrate.Lock(args)
-	case "unlock":
-		return migrate.Unlock(args)
+	case "references":
+		return validate.References(args)
 	default:
 		fmt.Println(doc)
 	}
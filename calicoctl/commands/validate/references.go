@@ -0,0 +1,230 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/constants"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/util"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+// The kinds of resource that refer to, or are referred to by, other resources.
+var referenceKinds = []string{
+	"node", "profile", "workloadendpoint", "hostendpoint", "bgppeer",
+	"felixconfiguration", "bgpconfiguration", "networkpolicy", "globalnetworkpolicy",
+}
+
+// The prefix of the names of the per-node configuration resources.
+const nodeConfigPrefix = "node."
+
+func References(args []string) error {
+	doc := constants.DatastoreIntro + `Usage:
+  <BINARY_NAME> validate references [--config=<CONFIG>]
+
+Options:
+  -h --help                 Show this screen.
+  -c --config=<CONFIG>      Path to the file containing connection configuration in
+                            YAML or JSON format.
+                            [default: ` + constants.DefaultConfigPath + `]
+
+Description:
+  Report the references between resources in the datastore that do not
+  resolve, listing the referring resource and the missing target of each.
+  The references checked are:
+
+    * The node of each BGPPeer, HostEndpoint and WorkloadEndpoint.
+    * The node of each per-node FelixConfiguration and BGPConfiguration,
+      named node.<NODE>.
+    * The profiles of each HostEndpoint and WorkloadEndpoint.
+    * The named ports in the rules of each NetworkPolicy and
+      GlobalNetworkPolicy, which must be declared by at least one
+      HostEndpoint or WorkloadEndpoint.
+
+  The command fails if any references do not resolve.
+`
+	// Replace all instances of BINARY_NAME with the name of the binary.
+	name, _ := util.NameAndDescription()
+	doc = strings.ReplaceAll(doc, "<BINARY_NAME>", name)
+
+	parsedArgs, err := docopt.ParseArgs(doc, args, "")
+	if err != nil {
+		return fmt.Errorf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.", strings.Join(args, " "))
+	}
+	if len(parsedArgs) == 0 {
+		return nil
+	}
+
+	client, err := clientmgr.NewClient(parsedArgs["--config"].(string))
+	if err != nil {
+		return err
+	}
+
+	dangling, err := CheckReferences(context.Background(), client)
+	if err != nil {
+		return err
+	}
+	for _, d := range dangling {
+		fmt.Printf("  %s\n", d)
+	}
+	if len(dangling) > 0 {
+		return fmt.Errorf("Found %d references that do not resolve.", len(dangling))
+	}
+	fmt.Println("All references resolve.")
+	return nil
+}
+
+// DanglingReference is a reference from one resource to another that does not exist.
+type DanglingReference struct {
+	// The kind and name of the referring resource. The name includes the namespace of
+	// namespaced resources.
+	Kind string
+	Name string
+
+	// The kind and name of the missing target. Named ports do not have a resource of
+	// their own, so their kind is "named port".
+	TargetKind string
+	Target     string
+}
+
+func (d DanglingReference) String() string {
+	return fmt.Sprintf("%s %s refers to missing %s %s", d.Kind, d.Name, d.TargetKind, d.Target)
+}
+
+// CheckReferences lists the resources in the datastore that refer to, or are referred to
+// by, other resources, and returns the references that do not resolve.
+func CheckReferences(ctx context.Context, c client.Interface) ([]DanglingReference, error) {
+	var resources []resourcemgr.ResourceObject
+	for _, kind := range referenceKinds {
+		rh, err := resourcemgr.GetResourceHelper(kind)
+		if err != nil {
+			return nil, err
+		}
+		list, err := rh.List(ctx, c, "")
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list %s resources: %s", kind, err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			resources = append(resources, item.(resourcemgr.ResourceObject))
+		}
+	}
+	return FindDanglingReferences(resources), nil
+}
+
+// FindDanglingReferences returns the references between the resources that do not
+// resolve, sorted by the referring resource and then the target. Each dangling reference
+// is only returned once, even if the resource refers to the target more than once.
+func FindDanglingReferences(resources []resourcemgr.ResourceObject) []DanglingReference {
+	nodes := map[string]bool{}
+	profiles := map[string]bool{}
+	namedPorts := map[string]bool{}
+	for _, r := range resources {
+		switch r := r.(type) {
+		case *apiv3.Node:
+			nodes[r.Name] = true
+		case *apiv3.Profile:
+			profiles[r.Name] = true
+		case *apiv3.WorkloadEndpoint:
+			for _, p := range r.Spec.Ports {
+				namedPorts[p.Name] = true
+			}
+		case *apiv3.HostEndpoint:
+			for _, p := range r.Spec.Ports {
+				namedPorts[p.Name] = true
+			}
+		}
+	}
+
+	var dangling []DanglingReference
+	seen := map[DanglingReference]bool{}
+	for _, r := range resources {
+		kind := r.GetObjectKind().GroupVersionKind().Kind
+		name := r.GetObjectMeta().GetName()
+		if ns := r.GetObjectMeta().GetNamespace(); ns != "" {
+			name = ns + "/" + name
+		}
+		check := func(exists map[string]bool, targetKind, target string) {
+			d := DanglingReference{kind, name, targetKind, target}
+			if target != "" && !exists[target] && !seen[d] {
+				seen[d] = true
+				dangling = append(dangling, d)
+			}
+		}
+		checkRules := func(rules ...[]apiv3.Rule) {
+			for _, rs := range rules {
+				for _, rule := range rs {
+					for _, ports := range [][]numorstring.Port{rule.Source.Ports, rule.Source.NotPorts, rule.Destination.Ports, rule.Destination.NotPorts} {
+						for _, p := range ports {
+							check(namedPorts, "named port", p.PortName)
+						}
+					}
+				}
+			}
+		}
+
+		switch r := r.(type) {
+		case *apiv3.BGPPeer:
+			check(nodes, "Node", r.Spec.Node)
+		case *apiv3.HostEndpoint:
+			check(nodes, "Node", r.Spec.Node)
+			for _, p := range r.Spec.Profiles {
+				check(profiles, "Profile", p)
+			}
+		case *apiv3.WorkloadEndpoint:
+			check(nodes, "Node", r.Spec.Node)
+			for _, p := range r.Spec.Profiles {
+				check(profiles, "Profile", p)
+			}
+		case *apiv3.FelixConfiguration, *apiv3.BGPConfiguration:
+			if strings.HasPrefix(r.GetObjectMeta().GetName(), nodeConfigPrefix) {
+				check(nodes, "Node", strings.TrimPrefix(r.GetObjectMeta().GetName(), nodeConfigPrefix))
+			}
+		case *apiv3.NetworkPolicy:
+			checkRules(r.Spec.Ingress, r.Spec.Egress)
+		case *apiv3.GlobalNetworkPolicy:
+			checkRules(r.Spec.Ingress, r.Spec.Egress)
+		}
+	}
+
+	sort.SliceStable(dangling, func(i, j int) bool {
+		a, b := dangling[i], dangling[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.TargetKind != b.TargetKind {
+			return a.TargetKind < b.TargetKind
+		}
+		return a.Target < b.Target
+	})
+	return dangling
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate_test
+
+import (
+	"github.com/projectcalico/calicoctl/v3/calicoctl/commands/validate"
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	apiv3 "github.com/projectcalico/libcalico-go/lib/apis/v3"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Finding dangling references", func() {
+	node := apiv3.NewNode()
+	node.Name = "node1"
+
+	profile := apiv3.NewProfile()
+	profile.Name = "kns.default"
+
+	wep := apiv3.NewWorkloadEndpoint()
+	wep.Namespace = "default"
+	wep.Name = "node1-k8s-pod1-eth0"
+	wep.Spec.Node = "node1"
+	wep.Spec.Profiles = []string{"kns.default", "ksa.default.deleted"}
+	wep.Spec.Ports = []apiv3.EndpointPort{{Name: "http", Port: 80}}
+
+	peer := apiv3.NewBGPPeer()
+	peer.Name = "peer1"
+	peer.Spec.Node = "node2"
+
+	felixConfig := apiv3.NewFelixConfiguration()
+	felixConfig.Name = "node.node3"
+
+	policy := apiv3.NewGlobalNetworkPolicy()
+	policy.Name = "allow-web"
+	policy.Spec.Ingress = []apiv3.Rule{
+		{Destination: apiv3.EntityRule{Ports: []numorstring.Port{numorstring.NamedPort("http"), numorstring.NamedPort("https")}}},
+		{Destination: apiv3.EntityRule{NotPorts: []numorstring.Port{numorstring.NamedPort("https")}}},
+	}
+
+	It("should report each reference that does not resolve", func() {
+		dangling := validate.FindDanglingReferences([]resourcemgr.ResourceObject{node, profile, wep, peer, felixConfig, policy})
+		Expect(dangling).To(Equal([]validate.DanglingReference{
+			{Kind: "BGPPeer", Name: "peer1", TargetKind: "Node", Target: "node2"},
+			{Kind: "FelixConfiguration", Name: "node.node3", TargetKind: "Node", Target: "node3"},
+			{Kind: "GlobalNetworkPolicy", Name: "allow-web", TargetKind: "named port", Target: "https"},
+			{Kind: "WorkloadEndpoint", Name: "default/node1-k8s-pod1-eth0", TargetKind: "Profile", Target: "ksa.default.deleted"},
+		}))
+		Expect(dangling[0].String()).To(Equal("BGPPeer peer1 refers to missing Node node2"))
+	})
+
+	It("should not report anything when the references resolve", func() {
+		Expect(validate.FindDanglingReferences([]resourcemgr.ResourceObject{node, profile})).To(BeEmpty())
+	})
+})
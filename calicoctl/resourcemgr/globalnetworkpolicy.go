@@ -56,4 +56,11 @@ func init() {
 			return client.GlobalNetworkPolicies().List(ctx, options.ListOptions{ResourceVersion: r.ResourceVersion, Name: r.Name})
 		},
 	)
+
+	registerPolicyOrder(
+		api.NewGlobalNetworkPolicy(),
+		func(resource ResourceObject) *float64 {
+			return resource.(*api.GlobalNetworkPolicy).Spec.Order
+		},
+	)
 }
@@ -29,10 +29,12 @@ func init() {
 		false,
 		[]string{"globalnetworkset", "globalnetworksets", "gnetsets"},
 		[]string{"NAME"},
-		[]string{"NAME", "NETS"},
+		[]string{"NAME", "NUMNETS", "NETS", "LABELS"},
 		map[string]string{
-			"NAME": "{{.ObjectMeta.Name}}",
-			"NETS": "{{joinAndTruncate .Spec.Nets \",\" 80}}",
+			"NAME":    "{{.ObjectMeta.Name}}",
+			"NUMNETS": "{{len .Spec.Nets}}",
+			"NETS":    "{{joinAndTruncate .Spec.Nets \",\" 80}}",
+			"LABELS":  "{{joinAndTruncate .ObjectMeta.Labels \",\" 80}}",
 		},
 		func(ctx context.Context, client client.Interface, resource ResourceObject) (ResourceObject, error) {
 			r := resource.(*api.GlobalNetworkSet)
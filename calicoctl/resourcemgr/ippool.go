@@ -16,9 +16,11 @@ package resourcemgr
 
 import (
 	"context"
+	"fmt"
 
 	api "github.com/projectcalico/libcalico-go/lib/apis/v3"
 	client "github.com/projectcalico/libcalico-go/lib/clientv3"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
 	"github.com/projectcalico/libcalico-go/lib/options"
 )
 
@@ -60,4 +62,43 @@ func init() {
 			return client.IPPools().List(ctx, options.ListOptions{ResourceVersion: r.ResourceVersion, Name: r.Name})
 		},
 	)
+
+	// Warn about pools that overlap other pools, since addresses in the overlap could be
+	// allocated from either pool.
+	registerValidator(
+		api.NewIPPool(),
+		func(ctx context.Context, client client.Interface, resource ResourceObject) ([]string, error) {
+			r := resource.(*api.IPPool)
+			pools, err := client.IPPools().List(ctx, options.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			return OverlappingIPPools(r, pools.Items), nil
+		},
+	)
+}
+
+// OverlappingIPPools returns a warning for each of the pools, other than the pool itself,
+// whose CIDR overlaps the CIDR of the pool.
+func OverlappingIPPools(pool *api.IPPool, pools []api.IPPool) []string {
+	_, cidr, err := cnet.ParseCIDR(pool.Spec.CIDR)
+	if err != nil {
+		// The CIDR is validated when the pool is created or updated.
+		return nil
+	}
+
+	var warnings []string
+	for _, p := range pools {
+		if p.Name == pool.Name {
+			continue
+		}
+		_, other, err := cnet.ParseCIDR(p.Spec.CIDR)
+		if err != nil {
+			continue
+		}
+		if cidr.Contains(other.IP) || other.Contains(cidr.IP) {
+			warnings = append(warnings, fmt.Sprintf("IPPool %s CIDR %s overlaps IPPool %s CIDR %s", pool.Name, pool.Spec.CIDR, p.Name, p.Spec.CIDR))
+		}
+	}
+	return warnings
 }
@@ -0,0 +1,60 @@
+// Copyright (c) 2021 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourcemgr_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
+	api "github.com/projectcalico/libcalico-go/lib/apis/v3"
+)
+
+var _ = Describe("IPPool validation", func() {
+	newPool := func(name, cidr string) *api.IPPool {
+		p := api.NewIPPool()
+		p.Name = name
+		p.Spec.CIDR = cidr
+		return p
+	}
+
+	It("Should have a validator", func() {
+		Expect(resourcemgr.GetValidator(api.NewIPPool())).NotTo(BeNil())
+	})
+
+	It("Should not have a validator for kinds without additional validation", func() {
+		Expect(resourcemgr.GetValidator(api.NewBGPPeer())).To(BeNil())
+	})
+
+	It("Should warn about pools that overlap", func() {
+		pool := newPool("pool1", "10.0.0.0/16")
+		pools := []api.IPPool{
+			*newPool("pool1", "10.0.0.0/16"),
+			*newPool("pool2", "10.0.128.0/24"),
+			*newPool("pool3", "10.0.0.0/8"),
+			*newPool("pool4", "10.1.0.0/16"),
+			*newPool("pool5", "fd00::/64"),
+		}
+		Expect(resourcemgr.OverlappingIPPools(pool, pools)).To(Equal([]string{
+			"IPPool pool1 CIDR 10.0.0.0/16 overlaps IPPool pool2 CIDR 10.0.128.0/24",
+			"IPPool pool1 CIDR 10.0.0.0/16 overlaps IPPool pool3 CIDR 10.0.0.0/8",
+		}))
+	})
+
+	It("Should not warn about pools that do not overlap", func() {
+		pool := newPool("pool1", "10.0.0.0/16")
+		Expect(resourcemgr.OverlappingIPPools(pool, []api.IPPool{*newPool("pool2", "10.1.0.0/16")})).To(BeEmpty())
+	})
+})
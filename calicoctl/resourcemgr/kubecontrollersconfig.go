@@ -16,6 +16,7 @@ package resourcemgr
 
 import (
 	"context"
+	"reflect"
 
 	api "github.com/projectcalico/libcalico-go/lib/apis/v3"
 	client "github.com/projectcalico/libcalico-go/lib/clientv3"
@@ -54,4 +55,14 @@ func init() {
 			return client.KubeControllersConfiguration().List(ctx, options.ListOptions{ResourceVersion: r.ResourceVersion, Name: r.Name})
 		},
 	)
+
+	// The kube-controllers write the configuration they are running with to the status,
+	// so the spec has been programmed once the running config matches it.
+	registerStatusCheck(
+		api.NewKubeControllersConfiguration(),
+		func(resource ResourceObject) bool {
+			r := resource.(*api.KubeControllersConfiguration)
+			return reflect.DeepEqual(r.Status.RunningConfig, r.Spec)
+		},
+	)
 }
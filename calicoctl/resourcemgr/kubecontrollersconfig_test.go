@@ -21,6 +21,7 @@ import (
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/projectcalico/calicoctl/v3/calicoctl/resourcemgr"
 	api "github.com/projectcalico/libcalico-go/lib/apis/v3"
 )
 
@@ -85,3 +86,20 @@ spec:
 	})
 
 })
+
+var _ = Describe("KubeControllersConfig status check", func() {
+	It("Should not pass until the running config matches the spec", func() {
+		kcc := api.NewKubeControllersConfiguration()
+		kcc.Spec.LogSeverityScreen = "Info"
+		check := resourcemgr.GetStatusCheck(kcc)
+		Expect(check).NotTo(BeNil())
+		Expect(check(kcc)).To(BeFalse())
+
+		kcc.Status.RunningConfig = kcc.Spec
+		Expect(check(kcc)).To(BeTrue())
+	})
+
+	It("Should not have a status check for kinds without status", func() {
+		Expect(resourcemgr.GetStatusCheck(api.NewIPPool())).To(BeNil())
+	})
+})
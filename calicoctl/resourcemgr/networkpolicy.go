@@ -82,4 +82,11 @@ func init() {
 			return client.NetworkPolicies().List(ctx, options.ListOptions{ResourceVersion: r.ResourceVersion, Namespace: r.Namespace, Name: r.Name})
 		},
 	)
+
+	registerPolicyOrder(
+		api.NewNetworkPolicy(),
+		func(resource ResourceObject) *float64 {
+			return resource.(*api.NetworkPolicy).Spec.Order
+		},
+	)
 }
@@ -29,11 +29,13 @@ func init() {
 		true,
 		[]string{"networkset", "networksets", "netsets"},
 		[]string{"NAME"},
-		[]string{"NAME", "NETS"},
+		[]string{"NAME", "NUMNETS", "NETS", "LABELS"},
 		map[string]string{
 			"NAME":      "{{.ObjectMeta.Name}}",
 			"NAMESPACE": "{{.ObjectMeta.Namespace}}",
+			"NUMNETS":   "{{len .Spec.Nets}}",
 			"NETS":      "{{joinAndTruncate .Spec.Nets \",\" 80}}",
+			"LABELS":    "{{joinAndTruncate .ObjectMeta.Labels \",\" 80}}",
 		},
 		func(ctx context.Context, client client.Interface, resource ResourceObject) (ResourceObject, error) {
 			r := resource.(*api.NetworkSet)
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"reflect"
 	"strings"
@@ -45,7 +46,7 @@ import (
 //	-  Commands to manage resource instances through an un-typed interface.
 type ResourceManager interface {
 	GetTableDefaultHeadings(wide bool) []string
-	GetTableTemplate(columns []string, printNamespace bool) (string, error)
+	GetTableTemplate(columns []string, printNamespace bool, labelColumns []string) (string, error)
 	GetObjectType() reflect.Type
 	IsNamespaced() bool
 	Apply(ctx context.Context, client client.Interface, resource ResourceObject) (ResourceObject, error)
@@ -56,6 +57,15 @@ type ResourceManager interface {
 	Patch(ctx context.Context, client client.Interface, resource ResourceObject, patch string) (ResourceObject, error)
 }
 
+// ResourceHelper provides typed access to the resource management actions for a
+// single kind of resource, without needing to construct command line arguments.
+type ResourceHelper interface {
+	ResourceManager
+	NewResource(namespace, name string) ResourceObject
+	Get(ctx context.Context, client client.Interface, namespace, name string) (ResourceObject, error)
+	List(ctx context.Context, client client.Interface, namespace string) (ResourceListObject, error)
+}
+
 // ResourceObject is implemented by all Calico resources
 type ResourceObject interface {
 	runtime.Object
@@ -108,6 +118,64 @@ func (rh resourceHelper) String() string {
 var helpers map[schema.GroupVersionKind]resourceHelper
 var kindToRes = make(map[string]ResourceObject)
 
+// ResourceStatusCheck returns true if the status of the resource shows that its current
+// spec has been accepted and programmed.
+type ResourceStatusCheck func(ResourceObject) bool
+
+// Store a ResourceStatusCheck for each resource with an observable status.
+var statusChecks = make(map[schema.GroupVersionKind]ResourceStatusCheck)
+
+// registerStatusCheck registers the status check for a resource kind. Only kinds whose
+// status is written once the resource has been programmed should register a check.
+func registerStatusCheck(res ResourceObject, check ResourceStatusCheck) {
+	statusChecks[res.GetObjectKind().GroupVersionKind()] = check
+}
+
+// GetStatusCheck returns the status check for the kind of the resource, or nil if the
+// kind does not have an observable status.
+func GetStatusCheck(resource runtime.Object) ResourceStatusCheck {
+	return statusChecks[resource.GetObjectKind().GroupVersionKind()]
+}
+
+// ResourceValidator validates a resource before it is created or updated. It returns
+// warnings about the resource, which do not prevent the operation, or an error if the
+// operation must not go ahead.
+type ResourceValidator func(context.Context, client.Interface, ResourceObject) ([]string, error)
+
+// Store a ResourceValidator for each resource with additional validation.
+var validators = make(map[schema.GroupVersionKind]ResourceValidator)
+
+// registerValidator registers the validator for a resource kind. Validation that only
+// depends on the resource itself belongs in libcalico-go; a validator checks the
+// resource against the other resources in the datastore.
+func registerValidator(res ResourceObject, validator ResourceValidator) {
+	validators[res.GetObjectKind().GroupVersionKind()] = validator
+}
+
+// GetValidator returns the validator for the kind of the resource, or nil if the kind
+// does not have additional validation.
+func GetValidator(resource runtime.Object) ResourceValidator {
+	return validators[resource.GetObjectKind().GroupVersionKind()]
+}
+
+// PolicyOrder returns the order of a policy, or nil if the order is not set. Policies with
+// no order are evaluated after all of the policies with an order.
+type PolicyOrder func(ResourceObject) *float64
+
+// Store a PolicyOrder for each policy kind.
+var policyOrders = make(map[schema.GroupVersionKind]PolicyOrder)
+
+// registerPolicyOrder registers the policy order for a policy kind.
+func registerPolicyOrder(res ResourceObject, order PolicyOrder) {
+	policyOrders[res.GetObjectKind().GroupVersionKind()] = order
+}
+
+// GetPolicyOrder returns the policy order for the kind of the resource, or nil if the kind
+// is not a policy.
+func GetPolicyOrder(resource runtime.Object) PolicyOrder {
+	return policyOrders[resource.GetObjectKind().GroupVersionKind()]
+}
+
 func registerResource(res ResourceObject, resList ResourceListObject, isNamespaced bool, names []string,
 	tableHeadings []string, tableHeadingsWide []string, headingsMap map[string]string,
 	create, update, delete, get ResourceActionCommand, list ResourceListActionCommand) {
@@ -116,6 +184,11 @@ func registerResource(res ResourceObject, resList ResourceListObject, isNamespac
 		helpers = make(map[schema.GroupVersionKind]resourceHelper)
 	}
 
+	// Every resource has an AGE column, which is included in the wide output by default.
+	// The template uses the "age" function provided by the table printer.
+	headingsMap["AGE"] = "{{age .ObjectMeta.CreationTimestamp}}"
+	tableHeadingsWide = append(tableHeadingsWide, "AGE")
+
 	rh := resourceHelper{
 		resource:          res,
 		resourceType:      reflect.ValueOf(res).Elem().Type(),
@@ -334,6 +407,38 @@ func GetResourceManager(resource runtime.Object) ResourceManager {
 	return helpers[resource.GetObjectKind().GroupVersionKind()]
 }
 
+// GetResourceHelper returns the ResourceHelper for the named resource kind. The kind
+// may be any of the names accepted on the command line, e.g. "networkpolicy" or "ippools".
+func GetResourceHelper(kind string) (ResourceHelper, error) {
+	res, ok := kindToRes[strings.ToLower(kind)]
+	if !ok {
+		return nil, fmt.Errorf("resource type '%s' is not supported", kind)
+	}
+	return helpers[res.GetObjectKind().GroupVersionKind()], nil
+}
+
+// NewResource returns a new, empty resource of the helper's kind with the name and namespace
+// filled in. The namespace is ignored for resources that are not namespaced.
+func (rh resourceHelper) NewResource(namespace, name string) ResourceObject {
+	res := rh.resource.DeepCopyObject().(ResourceObject)
+	res.GetObjectMeta().SetName(name)
+	if rh.isNamespaced {
+		res.GetObjectMeta().SetNamespace(namespace)
+	}
+	return res
+}
+
+// Get is a typed method to get a single existing resource by namespace and name.
+func (rh resourceHelper) Get(ctx context.Context, client client.Interface, namespace, name string) (ResourceObject, error) {
+	return rh.get(ctx, client, rh.NewResource(namespace, name))
+}
+
+// List is a typed method to list the existing resources. An empty namespace lists the
+// resources across all namespaces.
+func (rh resourceHelper) List(ctx context.Context, client client.Interface, namespace string) (ResourceListObject, error) {
+	return rh.list(ctx, client, rh.NewResource(namespace, ""))
+}
+
 // GetResourcesFromArgs gets resources from arguments.
 // This function also inserts resource name, namespace if specified.
 // Example "calicoctl get bgppeer peer123" will return
@@ -499,9 +604,32 @@ func CreateResourcesFromFile(f string) ([]runtime.Object, error) {
 		}
 	}
 
+	return createResourcesFromReader(reader, logCxt)
+}
+
+// CreateResourcesFromReader creates the Resources from the data read from r. The data
+// may contain multiple YAML documents, or a stream of JSON values, each of which is handled
+// as described for CreateResourcesFromFile.
+func CreateResourcesFromReader(r io.Reader) ([]runtime.Object, error) {
+	return createResourcesFromReader(r, log.WithField("source", "reader"))
+}
+
+func createResourcesFromReader(reader io.Reader, logCxt *log.Entry) ([]runtime.Object, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		logCxt.WithError(err).Error("Failed to read resources")
+		return nil, err
+	}
+
+	// JSON has no document separator, so a stream of JSON values, each of which may be
+	// a resource or a list of resources, is split using a JSON decoder instead.
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return createResourcesFromJSON(trimmed, logCxt)
+	}
+
 	logCxt.Debug("Creating document separator")
 	var resources []runtime.Object
-	separator := yamlsep.NewYAMLDocumentSeparator(reader)
+	separator := yamlsep.NewYAMLDocumentSeparator(bytes.NewReader(data))
 	for {
 		b, err := separator.Next()
 		if err != nil {
@@ -526,6 +654,34 @@ func CreateResourcesFromFile(f string) ([]runtime.Object, error) {
 	return resources, nil
 }
 
+// createResourcesFromJSON creates the Resources from a stream of JSON values.
+func createResourcesFromJSON(data []byte, logCxt *log.Entry) ([]runtime.Object, error) {
+	var resources []runtime.Object
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var b json.RawMessage
+		if err := decoder.Decode(&b); err != nil {
+			if err == io.EOF {
+				break
+			}
+			logCxt.WithError(err).Error("Failed to split JSON values")
+			return nil, err
+		}
+
+		logCxt.WithField("byteLength", len(b)).Debug("Found a resource")
+		r, err := createResourcesFromBytes(b)
+		if err != nil {
+			logCxt.WithError(err).Error("Failed to parse resource from bytes")
+			return nil, err
+		}
+
+		resources = append(resources, r...)
+	}
+
+	logCxt.WithField("numResources", len(resources)).Info("Finished parsing")
+	return resources, nil
+}
+
 // Implement the ResourceManager interface on the resourceHelper struct.
 
 // GetTableDefaultHeadings returns the default headings to use in the ps-style get output
@@ -541,8 +697,9 @@ func (rh resourceHelper) GetTableDefaultHeadings(wide bool) []string {
 
 // GetTableTemplate constructs the go-lang template string from the supplied set of headings.
 // The template separates columns using tabs so that a tabwriter can be used to pretty-print
-// the table.
-func (rh resourceHelper) GetTableTemplate(headings []string, printNamespace bool) (string, error) {
+// the table.  A column is appended for each of the label columns, showing the value of that
+// label of the resource.
+func (rh resourceHelper) GetTableTemplate(headings []string, printNamespace bool, labelColumns []string) (string, error) {
 	if _, ok := rh.headingsMap["NAMESPACE"]; printNamespace && ok {
 		headings = append([]string{"NAMESPACE"}, headings...)
 	}
@@ -552,6 +709,10 @@ func (rh resourceHelper) GetTableTemplate(headings []string, printNamespace bool
 		buf.WriteString(heading)
 		buf.WriteByte('\t')
 	}
+	for _, label := range labelColumns {
+		buf.WriteString(labelColumnHeading(label))
+		buf.WriteByte('\t')
+	}
 	buf.WriteByte('\n')
 
 	// If this is a list type, we need to iterate over the list items.
@@ -574,6 +735,10 @@ func (rh resourceHelper) GetTableTemplate(headings []string, printNamespace bool
 		buf.WriteString(value)
 		buf.WriteByte('\t')
 	}
+	for _, label := range labelColumns {
+		fmt.Fprintf(buf, "{{index .ObjectMeta.Labels %q}}", label)
+		buf.WriteByte('\t')
+	}
 	buf.WriteByte('\n')
 
 	// If this is a list, close off the range.
@@ -584,6 +749,13 @@ func (rh resourceHelper) GetTableTemplate(headings []string, printNamespace bool
 	return buf.String(), nil
 }
 
+// labelColumnHeading returns the heading of the column showing the value of the label. This
+// is the full key of the label, including its prefix, in upper case, so that a label such as
+// app.kubernetes.io/name cannot be mistaken for the NAME column.
+func labelColumnHeading(label string) string {
+	return strings.ToUpper(label)
+}
+
 // mergeMetadataForUpdate merges the Metadata for a stored ResourceObject and a potential
 // update. All metadata in the potential update will be overwritten by the stored object
 // except for Labels and Annotations. This prevents accidental modifications to the metadata
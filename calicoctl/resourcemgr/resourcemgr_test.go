@@ -94,6 +94,25 @@ var _ = Describe("Create resource from file", func() {
 		expectResourcesToMatch(resources, expectedIpPools)
 	})
 
+	It("Should create IPPOOLs from a stream of JSON values, including a JSON array", func() {
+		pool := func(name, cidr, vxlanMode string) string {
+			return fmt.Sprintf(`{"kind": "IPPool", "apiVersion": "projectcalico.org/v3", "metadata": {"name": %q}, `+
+				`"spec": {"cidr": %q, "ipipMode": "Never", "vxlanMode": %q, "natOutgoing": true}}`, name, cidr, vxlanMode)
+		}
+		content := pool(PoolName, CidrV6, VxlanModeNever) + "\n[" +
+			pool(AnotherPoolName, CidrV6, VxlanModeNever) + ", " + pool(AnotherPoolName, CidrV4, VxlanModeAlways) + "]\n"
+		resources, err := resourcemgr.CreateResourcesFromReader(strings.NewReader(content))
+		Expect(err).NotTo(HaveOccurred())
+
+		expectedIpPools := ipPools(ipPoolV6, anotherIpPoolV6, anotherIpPoolV4)
+		expectResourcesToMatch(resources, expectedIpPools)
+	})
+
+	It("Should fail to create resources from invalid JSON", func() {
+		_, err := resourcemgr.CreateResourcesFromReader(strings.NewReader(`{"kind": "IPPool"`))
+		Expect(err).To(HaveOccurred())
+	})
+
 	It("Should create no resources from an empty Spec", func() {
 		resources, err := createResources()
 		Expect(err).NotTo(HaveOccurred())
@@ -102,6 +121,62 @@ var _ = Describe("Create resource from file", func() {
 
 })
 
+var _ = Describe("Resource helper lookup", func() {
+	It("Should return the helper for a namespaced kind", func() {
+		rh, err := resourcemgr.GetResourceHelper("NetworkPolicy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rh.IsNamespaced()).To(BeTrue())
+
+		res := rh.NewResource("ns1", "policy1")
+		Expect(res).To(BeAssignableToTypeOf(&api.NetworkPolicy{}))
+		Expect(res.GetObjectMeta().GetNamespace()).To(Equal("ns1"))
+		Expect(res.GetObjectMeta().GetName()).To(Equal("policy1"))
+	})
+
+	It("Should ignore the namespace for a non-namespaced kind", func() {
+		rh, err := resourcemgr.GetResourceHelper("ippools")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rh.IsNamespaced()).To(BeFalse())
+
+		res := rh.NewResource("ns1", "pool1")
+		Expect(res).To(BeAssignableToTypeOf(&api.IPPool{}))
+		Expect(res.GetObjectMeta().GetNamespace()).To(Equal(""))
+		Expect(res.GetObjectMeta().GetName()).To(Equal("pool1"))
+	})
+
+	It("Should return an error for an unknown kind", func() {
+		_, err := resourcemgr.GetResourceHelper("notakind")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Network set table columns", func() {
+	It("Should show the number of nets and the labels in the wide output", func() {
+		for _, kind := range []string{"networkset", "globalnetworkset"} {
+			rh, err := resourcemgr.GetResourceHelper(kind)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rh.GetTableDefaultHeadings(true)).To(ContainElement("NUMNETS"))
+			Expect(rh.GetTableDefaultHeadings(true)).To(ContainElement("LABELS"))
+
+			tpl, err := rh.GetTableTemplate([]string{"NAME", "NUMNETS"}, false, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tpl).To(ContainSubstring("{{len .Spec.Nets}}"))
+		}
+	})
+})
+
+var _ = Describe("Label table columns", func() {
+	It("Should add a column for each label", func() {
+		rh, err := resourcemgr.GetResourceHelper("ippool")
+		Expect(err).NotTo(HaveOccurred())
+
+		tpl, err := rh.GetTableTemplate([]string{"NAME"}, false, []string{"zone", "app.kubernetes.io/name"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tpl).To(HavePrefix("NAME\tZONE\tAPP.KUBERNETES.IO/NAME\t\n"))
+		Expect(tpl).To(ContainSubstring("{{index .ObjectMeta.Labels \"zone\"}}\t{{index .ObjectMeta.Labels \"app.kubernetes.io/name\"}}\t"))
+	})
+})
+
 func expectResourcesToMatch(resources []runtime.Object, expectedIpPools []*api.IPPool) {
 	Expect(len(expectedIpPools)).To(Equal(len(resources)))
 	for index := range expectedIpPools {
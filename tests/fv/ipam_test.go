@@ -16,7 +16,10 @@ package fv_test
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -105,7 +108,7 @@ func TestIPAM(t *testing.T) {
 	Expect(out).To(ContainSubstring("59 (92%)"))
 
 	// Find out the allocation block.
-	var allocatedIP string
+	var allocatedIP, allocatedBlock string
 	r, err := regexp.Compile(`(10\.65\.[0-9]+\.)([0-9]+)/26`)
 	Expect(err).NotTo(HaveOccurred())
 	for _, line := range strings.Split(out, "\n") {
@@ -114,6 +117,7 @@ func TestIPAM(t *testing.T) {
 			ordinalBase, err := strconv.Atoi(sm[2])
 			Expect(err).NotTo(HaveOccurred())
 			allocatedIP = sm[1] + strconv.Itoa(ordinalBase+2)
+			allocatedBlock = sm[0]
 			break
 		}
 	}
@@ -125,6 +129,15 @@ func TestIPAM(t *testing.T) {
 	Expect(out).To(ContainSubstring("Attributes:"))
 	Expect(out).To(ContainSubstring("note: reserved by ipam_test.go"))
 
+	// ipam show for the block that the IP is allocated from.
+	out = Calicoctl(false, "ipam", "show", "--block="+allocatedBlock)
+	Expect(out).To(ContainSubstring("Block " + allocatedBlock))
+	Expect(out).To(ContainSubstring(allocatedIP))
+	Expect(out).To(ContainSubstring("Extra:note=reserved by ipam_test.go"))
+
+	out = Calicoctl(false, "ipam", "show", "--block="+allocatedBlock, "-o", "json")
+	Expect(out).To(ContainSubstring(`"cidr": "` + allocatedBlock + `"`))
+
 	// ipam show with an invalid IP.
 	out, err = CalicoctlMayFail(false, "ipam", "show", "--ip=10.240.0.300")
 	Expect(err).To(HaveOccurred())
@@ -192,3 +205,315 @@ func TestIPAM(t *testing.T) {
 	_, err = client.IPPools().Delete(ctx, "ipam-test-v4-b29", options.DeleteOptions{})
 	Expect(err).NotTo(HaveOccurred())
 }
+
+func TestIPAMCheckDualStack(t *testing.T) {
+	RegisterTestingT(t)
+
+	ctx := context.Background()
+
+	// Create a Calico client.
+	config := apiconfig.NewCalicoAPIConfig()
+	config.Spec.DatastoreType = "etcdv3"
+	config.Spec.EtcdEndpoints = "http://127.0.0.1:2379"
+	client, err := clientv3.New(*config)
+	Expect(err).NotTo(HaveOccurred())
+
+	// Create an IPv4 and an IPv6 pool.
+	pool := v3.NewIPPool()
+	pool.Name = "ipam-check-v4"
+	pool.Spec.CIDR = "10.67.0.0/16"
+	_, err = client.IPPools().Create(ctx, pool, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	pool = v3.NewIPPool()
+	pool.Name = "ipam-check-v6"
+	pool.Spec.CIDR = "fd5f:abcd:65::/48"
+	_, err = client.IPPools().Create(ctx, pool, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Create a Node resource for this host.
+	nodename, err := os.Hostname()
+	Expect(err).NotTo(HaveOccurred())
+	node := v3.NewNode()
+	node.Name = nodename
+	_, err = client.Nodes().Create(ctx, node, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Assign two IPs from each family. The first of each is used by the workload below,
+	// and the second is leaked.
+	handle := "ipam-check-dual-stack"
+	v4, v6, err := client.IPAM().AutoAssign(ctx, ipam.AutoAssignArgs{
+		Num4:     2,
+		Num6:     2,
+		HandleID: &handle,
+		Attrs:    map[string]string{"note": "reserved by ipam_test.go"},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(v4).To(HaveLen(2))
+	Expect(v6).To(HaveLen(2))
+
+	// Create a dual-stack workload using the first IP of each family, an IPv6 address in
+	// the pool that is not allocated, and an IPv6 address that is not in any pool.
+	wep := v3.NewWorkloadEndpoint()
+	wep.Namespace = "default"
+	wep.Spec.Node = nodename
+	wep.Spec.Orchestrator = "k8s"
+	wep.Spec.Pod = "dual-stack"
+	wep.Spec.Endpoint = "eth0"
+	wep.Spec.InterfaceName = "cali0123456789a"
+	wep.Spec.IPNetworks = []string{
+		v4[0].IP.String() + "/32",
+		v6[0].IP.String() + "/128",
+		"fd5f:abcd:65::ffff/128",
+		"fd00:1::1/128",
+	}
+	wep, err = client.WorkloadEndpoints().Create(ctx, wep, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	out := Calicoctl(false, "ipam", "check", "--show-problem-ips")
+
+	// The IPs used by the workload are matched against the allocations of both families.
+	Expect(out).NotTo(ContainSubstring(v4[0].IP.String() + " leaked"))
+	Expect(out).NotTo(ContainSubstring(v6[0].IP.String() + " leaked"))
+	Expect(out).To(ContainSubstring(v4[1].IP.String() + " leaked"))
+	Expect(out).To(ContainSubstring(v6[1].IP.String() + " leaked"))
+
+	// The IPv6 addresses that are not allocated are classified by whether they are in the
+	// IPv6 pool.
+	Expect(out).To(ContainSubstring("fd5f:abcd:65::ffff in use by Workload(default/" + wep.Name +
+		") and in active IPAM pool but has no IPAM allocation."))
+	Expect(out).To(ContainSubstring("fd00:1::1 in use by Workload(default/" + wep.Name +
+		") is not in any active IP pool."))
+
+	// The capacity is reported for each family. The unallocated address in the IPv6 pool
+	// is in use but not allocated.
+	Expect(out).To(ContainSubstring("IPv4: 65536 addressable, 2 allocated, 1 in use, 65534 free"))
+	Expect(out).To(ContainSubstring(", 2 allocated, 2 in use, "))
+
+	// Clean up resources.
+	_, err = client.WorkloadEndpoints().Delete(ctx, wep.Namespace, wep.Name, options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	err = client.IPAM().ReleaseByHandle(ctx, handle)
+	Expect(err).NotTo(HaveOccurred())
+	for _, cidr := range append(v4, v6...) {
+		err = client.IPAM().ReleaseAffinity(ctx, cidr, nodename, false)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	_, err = client.IPPools().Delete(ctx, "ipam-check-v4", options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.IPPools().Delete(ctx, "ipam-check-v6", options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.Nodes().Delete(ctx, nodename, options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func TestIPAMCheckPoolNodeSelector(t *testing.T) {
+	RegisterTestingT(t)
+
+	ctx := context.Background()
+
+	// Create a Calico client.
+	config := apiconfig.NewCalicoAPIConfig()
+	config.Spec.DatastoreType = "etcdv3"
+	config.Spec.EtcdEndpoints = "http://127.0.0.1:2379"
+	client, err := clientv3.New(*config)
+	Expect(err).NotTo(HaveOccurred())
+
+	// Create an IPv4 pool that any node may use.
+	pool := v3.NewIPPool()
+	pool.Name = "ipam-check-selector"
+	pool.Spec.CIDR = "10.68.0.0/16"
+	pool, err = client.IPPools().Create(ctx, pool, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Create a Node resource for this host, with no labels.
+	nodename, err := os.Hostname()
+	Expect(err).NotTo(HaveOccurred())
+	node := v3.NewNode()
+	node.Name = nodename
+	_, err = client.Nodes().Create(ctx, node, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Assign an IP, so that a block in the pool is affine to the node.
+	handle := "ipam-check-selector"
+	v4, _, err := client.IPAM().AutoAssign(ctx, ipam.AutoAssignArgs{
+		Num4:     1,
+		HandleID: &handle,
+		Attrs:    map[string]string{"note": "reserved by ipam_test.go"},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(v4).To(HaveLen(1))
+
+	out := Calicoctl(false, "ipam", "check")
+	Expect(out).To(ContainSubstring("Found 0 IPAM blocks affine to nodes that do not match the IP pool node selector."))
+
+	// Restrict the pool to nodes the host does not match.
+	pool.Spec.NodeSelector = "zone == 'east'"
+	_, err = client.IPPools().Update(ctx, pool, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	out = Calicoctl(false, "ipam", "check")
+	Expect(out).To(ContainSubstring("is affine to node " + nodename +
+		", which does not match node selector \"zone == 'east'\" of IP pool ipam-check-selector."))
+	Expect(out).To(ContainSubstring("Found 1 IPAM blocks affine to nodes that do not match the IP pool node selector."))
+
+	// Clean up resources.
+	err = client.IPAM().ReleaseByHandle(ctx, handle)
+	Expect(err).NotTo(HaveOccurred())
+	err = client.IPAM().ReleaseAffinity(ctx, v4[0], nodename, false)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.IPPools().Delete(ctx, "ipam-check-selector", options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.Nodes().Delete(ctx, nodename, options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func TestIPAMHandle(t *testing.T) {
+	RegisterTestingT(t)
+
+	ctx := context.Background()
+
+	// Create a Calico client.
+	config := apiconfig.NewCalicoAPIConfig()
+	config.Spec.DatastoreType = "etcdv3"
+	config.Spec.EtcdEndpoints = "http://127.0.0.1:2379"
+	client, err := clientv3.New(*config)
+	Expect(err).NotTo(HaveOccurred())
+
+	// Create an IPv4 pool.
+	pool := v3.NewIPPool()
+	pool.Name = "ipam-handle-v4"
+	pool.Spec.CIDR = "10.69.0.0/16"
+	_, err = client.IPPools().Create(ctx, pool, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Create a Node resource for this host.
+	nodename, err := os.Hostname()
+	Expect(err).NotTo(HaveOccurred())
+	node := v3.NewNode()
+	node.Name = nodename
+	_, err = client.Nodes().Create(ctx, node, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Assign two IPs with the same handle.
+	handle := "ipam-handle-test"
+	v4, _, err := client.IPAM().AutoAssign(ctx, ipam.AutoAssignArgs{
+		Num4:     2,
+		HandleID: &handle,
+		Attrs:    map[string]string{"note": "reserved by ipam_test.go"},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(v4).To(HaveLen(2))
+
+	out := Calicoctl(false, "ipam", "handle", "show", handle)
+	Expect(out).To(ContainSubstring("Handle " + handle + " records 2 IPs"))
+	Expect(out).To(ContainSubstring(v4[0].IP.String()))
+	Expect(out).To(ContainSubstring(v4[1].IP.String()))
+
+	out = Calicoctl(false, "ipam", "handle", "list", "-o", "json")
+	Expect(out).To(ContainSubstring(`"handleID": "` + handle + `"`))
+	Expect(out).To(ContainSubstring(`"numIPs": 2`))
+
+	// Clean up resources.
+	err = client.IPAM().ReleaseByHandle(ctx, handle)
+	Expect(err).NotTo(HaveOccurred())
+	err = client.IPAM().ReleaseAffinity(ctx, v4[0], nodename, false)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.IPPools().Delete(ctx, "ipam-handle-v4", options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.Nodes().Delete(ctx, nodename, options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func TestIPAMReleaseFromMixedClusterReports(t *testing.T) {
+	RegisterTestingT(t)
+
+	ctx := context.Background()
+
+	// Create a Calico client.
+	config := apiconfig.NewCalicoAPIConfig()
+	config.Spec.DatastoreType = "etcdv3"
+	config.Spec.EtcdEndpoints = "http://127.0.0.1:2379"
+	client, err := clientv3.New(*config)
+	Expect(err).NotTo(HaveOccurred())
+
+	// Create an IPv4 pool.
+	pool := v3.NewIPPool()
+	pool.Name = "ipam-release-mixed"
+	pool.Spec.CIDR = "10.70.0.0/16"
+	_, err = client.IPPools().Create(ctx, pool, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Create a Node resource for this host.
+	nodename, err := os.Hostname()
+	Expect(err).NotTo(HaveOccurred())
+	node := v3.NewNode()
+	node.Name = nodename
+	_, err = client.Nodes().Create(ctx, node, options.SetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Assign two IPs that are not used by any workload, so both are leaked.
+	handle := "ipam-release-mixed"
+	v4, _, err := client.IPAM().AutoAssign(ctx, ipam.AutoAssignArgs{
+		Num4:     2,
+		HandleID: &handle,
+		Attrs:    map[string]string{"note": "reserved by ipam_test.go"},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(v4).To(HaveLen(2))
+	matchingIP := v4[0].IP.String()
+	otherIP := v4[1].IP.String()
+
+	dir, err := ioutil.TempDir("", "ipam-release-mixed")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	reportFile := filepath.Join(dir, "check.json")
+	Calicoctl(false, "ipam", "check", "-o", reportFile)
+	data, err := ioutil.ReadFile(reportFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.Remove(reportFile)).NotTo(HaveOccurred())
+
+	// Write a report for this cluster containing only the first IP, and a report that
+	// claims to be from another cluster containing only the second IP.
+	writeReport := func(name, guid, keepIP string) {
+		var report map[string]interface{}
+		Expect(json.Unmarshal(data, &report)).NotTo(HaveOccurred())
+		allocations := report["allocations"].(map[string]interface{})
+		for ip := range allocations {
+			if ip != keepIP {
+				delete(allocations, ip)
+			}
+		}
+		Expect(allocations).To(HaveKey(keepIP))
+		if guid != "" {
+			report["clusterGUID"] = guid
+		}
+		b, err := json.Marshal(report)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), b, 0644)).NotTo(HaveOccurred())
+	}
+	writeReport("this-cluster.json", "", matchingIP)
+	writeReport("other-cluster.json", "other-cluster-guid", otherIP)
+
+	out := Calicoctl(false, "ipam", "release", "--from-report-dir="+dir, "--force")
+	Expect(out).To(ContainSubstring("Skipping report " + filepath.Join(dir, "other-cluster.json") +
+		": Cluster does not match the provided report: mismatched cluster GUID."))
+	Expect(out).To(ContainSubstring("Loaded 1 of 2 reports; skipped 1"))
+	Expect(out).To(ContainSubstring("Released 1 IPs successfully"))
+
+	// Only the IP from the matching report was released.
+	_, _, err = client.IPAM().GetAssignmentAttributes(ctx, cnet.IP{IP: v4[0].IP})
+	Expect(err).To(HaveOccurred())
+	_, _, err = client.IPAM().GetAssignmentAttributes(ctx, cnet.IP{IP: v4[1].IP})
+	Expect(err).NotTo(HaveOccurred())
+
+	// Clean up resources.
+	err = client.IPAM().ReleaseByHandle(ctx, handle)
+	Expect(err).NotTo(HaveOccurred())
+	err = client.IPAM().ReleaseAffinity(ctx, v4[0], nodename, false)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.IPPools().Delete(ctx, "ipam-release-mixed", options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.Nodes().Delete(ctx, nodename, options.DeleteOptions{})
+	Expect(err).NotTo(HaveOccurred())
+}
@@ -125,6 +125,17 @@ func TestDatastoreMigrationIPAM(t *testing.T) {
 	// Import the data
 	_ = Calicoctl(true, "datastore", "migrate", "import", "-f", tempfile.Name())
 
+	// Verify the round trip. The Node may not match, since the Kubernetes datastore
+	// backs Nodes with Kubernetes nodes, but the cluster information, IP pools and IPAM
+	// must.
+	out, _ = CalicoctlMayFail(true, "datastore", "migrate", "verify", "--before", tempfile.Name())
+	Expect(out).NotTo(ContainSubstring("ClusterInformation default:"))
+	Expect(out).NotTo(ContainSubstring("IPAMBlock "))
+	Expect(out).NotTo(ContainSubstring("BlockAffinity "))
+	Expect(out).NotTo(ContainSubstring("IPAMHandle "))
+	Expect(out).NotTo(ContainSubstring("IPAMConfig "))
+	Expect(out).NotTo(ContainSubstring("IPPool "))
+
 	// Unlock the datastore
 	_ = Calicoctl(true, "datastore", "migrate", "unlock")
 
@@ -62,7 +62,7 @@ class TestCalicoctlCommands(TestBase):
         rc = calicoctl("get ippool %s" % name(ippool_name1_rev1_v4))
         rc.assert_output_equals(ippool_name1_rev1_table)
         rc = calicoctl("get ippool %s -o wide" % name(ippool_name1_rev1_v4))
-        rc.assert_output_equals(ippool_name1_rev1_wide_table)
+        rc.assert_output_contains(ippool_name1_rev1_wide_table)
 
         # Remove both the ipv4 pool and ipv6 pool by CLI options and by file.
         rc = calicoctl("delete ippool %s" % name(ippool_name1_rev1_v4))
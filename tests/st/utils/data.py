@@ -51,9 +51,11 @@ ippool_name1_rev1_table = (
     "ippool-name1   10.0.1.0/24   foo == 'bar'"
 )
 
+# The wide table ends with the AGE column, which depends on when the pool was created, so
+# only the output up to the AGE value is checked.
 ippool_name1_rev1_wide_table = (
-    "NAME           CIDR          NAT     IPIPMODE   VXLANMODE   DISABLED   SELECTOR       \n"
-    "ippool-name1   10.0.1.0/24   false   Always     Never       false      foo == 'bar'"
+    "NAME           CIDR          NAT     IPIPMODE   VXLANMODE   DISABLED   SELECTOR       AGE   \n"
+    "ippool-name1   10.0.1.0/24   false   Always     Never       false      foo == 'bar'   "
 )
 
 ippool_name1_rev2_v4 = {